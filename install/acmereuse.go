@@ -0,0 +1,226 @@
+package main
+
+import (
+	"bytes"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Let's Encrypt issues at most 5 certificates for the same set of names per
+// week and allows 5 failed validations per hostname per hour. Repeated
+// reinstalls that request a new certificate each time run into the first,
+// which locks the domain out for a week. The installer warns once an
+// install would come within acmeLimitMargin of either limit.
+const (
+	duplicateCertLimit     = 5
+	duplicateCertWindow    = 7 * 24 * time.Hour
+	failedValidationLimit  = 5
+	failedValidationWindow = time.Hour
+	acmeLimitMargin        = 2
+)
+
+// acmeHistoryFile records the certificates the installer saw Traefik obtain
+// and the ACME errors it reported. It lives next to the install directory
+// record, so it survives removing the installation directory.
+const acmeHistoryFile = "acme-history.yaml"
+
+// acmeAttempt is an entry of the ACME history: the certificate Traefik
+// served for Domain, identified by its serial, or the error it logged.
+type acmeAttempt struct {
+	Domain    string    `yaml:"domain"`
+	Time      time.Time `yaml:"time"`
+	Serial    string    `yaml:"serial,omitempty"`
+	NotBefore time.Time `yaml:"not_before,omitempty"`
+	Error     string    `yaml:"error,omitempty"`
+}
+
+func init() {
+	registerStep(installStep{
+		Name:  "reuse certificates",
+		Order: 55,
+		When: func(state *installState) bool {
+			return containersStarting(state) && !state.Config.SelfSignedTLS
+		},
+		Run: func(state *installState) error {
+			reuseCertificate(state.Config.DashboardDomain)
+			return nil
+		},
+	})
+}
+
+// reuseCertificate looks for a certificate for domain in the acme.json of
+// this installation and of the others on the host before Traefik starts.
+// One found elsewhere is copied in, along with the ACME account it was
+// issued to, when this installation has no certificates yet. Without one,
+// it warns if a new certificate is likely to run into the rate limits.
+func reuseCertificate(domain string) {
+	storage := acmeStorageFiles()[0]
+	current, _ := readACMECertificates(storage)
+	if cert := reusableCertificate(current, domain); cert != nil {
+		fmt.Printf("Traefik will reuse the certificate for %s in %s, valid until %s.\n", domain, storage, cert.NotAfter.Format("2006-01-02"))
+		return
+	}
+
+	var seen []storedCertificate
+	for _, dir := range knownInstallDirs() {
+		source := filepath.Join(dir, defaultACMEStorage)
+		certs, err := readACMECertificates(source)
+		if err != nil {
+			fmt.Printf("Warning: %v\n", err)
+			continue
+		}
+		seen = append(seen, certs...)
+		cert := reusableCertificate(certs, domain)
+		if cert == nil || len(current) > 0 {
+			continue
+		}
+		if err := copyACMEStorage(source, storage); err != nil {
+			fmt.Printf("Warning: could not reuse the certificate for %s from %s: %v\n", domain, source, err)
+			continue
+		}
+		fmt.Printf("Reusing the certificate for %s from %s, valid until %s, instead of requesting a new one.\n", domain, dir, cert.NotAfter.Format("2006-01-02"))
+		return
+	}
+
+	warnACMERateLimits(domain, append(current, seen...), readACMEHistory())
+}
+
+// reusableCertificate returns the unexpired Let's Encrypt certificate for
+// domain among certs that lasts longest, or nil.
+func reusableCertificate(certs []storedCertificate, domain string) *x509.Certificate {
+	var best *x509.Certificate
+	for _, c := range certs {
+		if c.Resolver != "letsencrypt" || c.Cert.VerifyHostname(domain) != nil || time.Now().After(c.Cert.NotAfter) {
+			continue
+		}
+		if best == nil || c.Cert.NotAfter.After(best.NotAfter) {
+			best = c.Cert
+		}
+	}
+	return best
+}
+
+// copyACMEStorage copies an acme.json, which holds the private keys of the
+// certificates and of the ACME account, keeping it owner-only.
+func copyACMEStorage(source, storage string) error {
+	data, err := os.ReadFile(source)
+	if err != nil {
+		return err
+	}
+	// The simulation maps absolute paths in its scratch directory back
+	path, err := filepath.Abs(storage)
+	if err != nil {
+		return err
+	}
+	if err := hostOps.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	return hostOps.WriteFile(path, data, 0600)
+}
+
+// warnACMERateLimits warns when the certificates issued for domain in the
+// last week, counted from the acme.json files found and the ACME history,
+// or the failed attempts of the last hour come close to the Let's Encrypt
+// limits.
+func warnACMERateLimits(domain string, certs []storedCertificate, history []acmeAttempt) {
+	now := time.Now()
+	issued := map[string]time.Time{}
+	for _, c := range certs {
+		if c.Cert.VerifyHostname(domain) == nil {
+			issued[c.Cert.SerialNumber.String()] = c.Cert.NotBefore
+		}
+	}
+	var failed []time.Time
+	for _, attempt := range history {
+		switch {
+		case attempt.Domain != domain:
+		case attempt.Serial != "":
+			issued[attempt.Serial] = attempt.NotBefore
+		case attempt.Error != "" && now.Sub(attempt.Time) < failedValidationWindow:
+			failed = append(failed, attempt.Time)
+		}
+	}
+
+	var recent []time.Time
+	for _, notBefore := range issued {
+		if now.Sub(notBefore) < duplicateCertWindow {
+			recent = append(recent, notBefore)
+		}
+	}
+	if len(recent) >= duplicateCertLimit-acmeLimitMargin {
+		slices.SortFunc(recent, time.Time.Compare)
+		fmt.Printf("Warning: %d certificates for %s were issued in the last 7 days; Let's Encrypt issues at most %d per week for the same domains.\n", len(recent), domain, duplicateCertLimit)
+		if len(recent) >= duplicateCertLimit {
+			fmt.Printf("A new certificate will be refused until about %s.\n", recent[0].Add(duplicateCertWindow).Format(time.RFC1123))
+		}
+		fmt.Println("Keep config/letsencrypt/acme.json when reinstalling so the certificate is reused, or install with self-signed certificates (--dev) while testing.")
+	}
+	if len(failed) >= failedValidationLimit-acmeLimitMargin {
+		slices.SortFunc(failed, time.Time.Compare)
+		fmt.Printf("Warning: %d certificate requests for %s failed in the last hour; Let's Encrypt stops validating the domain for an hour after %d failures.\n", len(failed), domain, failedValidationLimit)
+		fmt.Printf("Fix the cause reported before, or wait until %s before starting again.\n", failed[0].Add(failedValidationWindow).Format(time.Kitchen))
+	}
+}
+
+// acmeHistoryPaths returns the files the ACME history may be kept in, next
+// to the install directory records.
+func acmeHistoryPaths() []string {
+	var paths []string
+	for _, record := range installDirRecordPaths() {
+		paths = append(paths, filepath.Join(filepath.Dir(record), acmeHistoryFile))
+	}
+	return paths
+}
+
+// readACMEHistory returns the entries of the first ACME history found.
+func readACMEHistory() []acmeAttempt {
+	for _, path := range acmeHistoryPaths() {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		var history []acmeAttempt
+		if yaml.Unmarshal(data, &history) == nil {
+			return history
+		}
+	}
+	return nil
+}
+
+// recordACMEAttempt adds the certificate Traefik served for domain, or the
+// ACME error it logged, to the ACME history. Entries older than the longest
+// rate limit window are dropped, as is a repeat of a known certificate.
+func recordACMEAttempt(domain string, cert *x509.Certificate, acmeError string) {
+	now := time.Now().UTC().Truncate(time.Second)
+	attempt := acmeAttempt{Domain: domain, Time: now, Error: acmeError}
+	// Self-signed certificates do not count towards the limits
+	if cert != nil && !bytes.Equal(cert.RawIssuer, cert.RawSubject) {
+		attempt.Serial = cert.SerialNumber.String()
+		attempt.NotBefore = cert.NotBefore.UTC()
+	}
+	if attempt.Serial == "" && attempt.Error == "" {
+		return
+	}
+
+	history := slices.DeleteFunc(readACMEHistory(), func(a acmeAttempt) bool {
+		return now.Sub(a.Time) > duplicateCertWindow || (attempt.Serial != "" && a.Serial == attempt.Serial)
+	})
+	data, err := yaml.Marshal(append(history, attempt))
+	if err != nil {
+		return
+	}
+	for _, path := range acmeHistoryPaths() {
+		if err := hostOps.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			continue
+		}
+		if err := hostOps.WriteFile(path, data, 0644); err == nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/fosrl/pangolin/install/pkg/installer"
+)
+
+func init() {
+	registerStep(installStep{
+		Name:  "enable monitoring",
+		Order: 22,
+		When: func(state *installState) bool {
+			return freshInstall(state) && state.Config.EnableMonitoring
+		},
+		Run: func(state *installState) error {
+			return enableComposeProfile(composeFile, "monitoring")
+		},
+	})
+}
+
+// collectMonitoring asks whether to run the monitoring profile and where
+// Alertmanager sends its alerts. Email reuses Pangolin's SMTP settings, so it
+// is only offered when email is enabled.
+func collectMonitoring(config *Config) {
+	fmt.Println("\n=== " + msg("sectionMonitoring") + " ===")
+	config.EnableMonitoring = readBool(msg("promptMonitoring"), false)
+	if !config.EnableMonitoring {
+		return
+	}
+
+	// Alerts go to the Let's Encrypt address unless another one is given
+	// or it is cleared
+	if config.EnableEmail {
+		config.AlertEmail = readOptionalString(msg("promptAlertEmail"), config.LetsEncryptEmail, localizedCheck(installer.CheckEmail))
+	}
+	config.AlertWebhookURL = readOptionalString(msg("promptAlertWebhook"), "", func(url string) error {
+		if !installer.ValidNotifyURL(url) {
+			return errors.New(msg("autoUpdateNotifyURLInvalid"))
+		}
+		return nil
+	})
+	if config.AlertEmail == "" && config.AlertWebhookURL == "" {
+		fmt.Println(msg("alertNoReceiver"))
+	}
+}
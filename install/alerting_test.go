@@ -0,0 +1,27 @@
+package main
+
+import "testing"
+
+func TestCollectMonitoringReceivers(t *testing.T) {
+	for _, tt := range []struct {
+		name              string
+		answers           []string
+		email, webhookURL string
+	}{
+		{"defaults", []string{"y", "", ""}, "admin@example.com", ""},
+		{"other address", []string{"y", "alerts@example.com", ""}, "alerts@example.com", ""},
+		{"invalid address asked again", []string{"y", "alerts", "alerts@example.com", ""}, "alerts@example.com", ""},
+		{"address cleared", []string{"y", clearAnswer, ""}, "", ""},
+		{"webhook only", []string{"y", clearAnswer, "https://hooks.example.com/alerts"}, "", "https://hooks.example.com/alerts"},
+		{"invalid webhook asked again", []string{"y", "", "not a url", "https://hooks.example.com/alerts"}, "admin@example.com", "https://hooks.example.com/alerts"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			answerPrompts(t, tt.answers...)
+			config := Config{EnableEmail: true, LetsEncryptEmail: "admin@example.com"}
+			collectMonitoring(&config)
+			if config.AlertEmail != tt.email || config.AlertWebhookURL != tt.webhookURL {
+				t.Errorf("receivers = %q, %q, want %q, %q", config.AlertEmail, config.AlertWebhookURL, tt.email, tt.webhookURL)
+			}
+		})
+	}
+}
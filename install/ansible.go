@@ -0,0 +1,168 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"text/template"
+
+	"github.com/fosrl/pangolin/install/pkg/installer"
+)
+
+// ansiblePlaybook reproduces what the installer does on the server. Its
+// delimiters differ from Go's so the Jinja expressions pass through.
+var ansiblePlaybook = template.Must(template.New("playbook.yml").Delims("[[", "]]").Parse(`# Generated by the Pangolin installer for [[.Config.DashboardDomain]].
+# files/ holds the rendered configuration including secrets: encrypt it with
+# ansible-vault or keep it out of version control.
+- name: Install Pangolin
+  hosts: pangolin
+  become: true
+  vars:
+    install_dir: [[.InstallDir]]
+  tasks:
+    - name: Install packages
+      ansible.builtin.apt:
+        name:
+[[- range .Packages]]
+          - [[.]]
+[[- end]]
+        update_cache: true
+[[- if eq .Config.InstallationContainerType "podman"]]
+
+    - name: Allow containers to bind ports 80 and 443
+      ansible.builtin.copy:
+        dest: /etc/sysctl.d/99-podman.conf
+        content: "net.ipv4.ip_unprivileged_port_start=80\n"
+        mode: "0644"
+      register: pangolin_sysctl
+
+    - name: Apply the sysctl settings
+      ansible.builtin.command: sysctl --system
+      when: pangolin_sysctl.changed
+[[- else]]
+
+    - name: Install Docker
+      ansible.builtin.shell: curl -fsSL https://get.docker.com | sh
+      args:
+        creates: /usr/bin/docker
+
+    - name: Start Docker
+      ansible.builtin.systemd_service:
+        name: docker
+        enabled: true
+        state: started
+[[- end]]
+
+    - name: Create the directories
+      ansible.builtin.file:
+        path: "{{ install_dir }}/{{ item.path }}"
+        state: directory
+        mode: "{{ item.mode }}"
+      loop:
+        - { path: ".", mode: "0755" }
+[[- range .Dirs]]
+        - { path: "[[.Path]]", mode: "[[.Mode]]" }
+[[- end]]
+
+    - name: Copy the configuration
+      ansible.builtin.copy:
+        src: files/
+        dest: "{{ install_dir }}/"
+        mode: preserve
+      register: pangolin_config
+[[- if .Config.EnableMaxMind]]
+
+    - name: Download the MaxMind databases
+      ansible.builtin.shell: curl -fsSL {{ item.url }} | tar -xz --strip-components=1 -C config --wildcards '*.mmdb'
+      args:
+        chdir: "{{ install_dir }}"
+        creates: "{{ install_dir }}/config/{{ item.file }}"
+      loop:
+        - { url: "[[.MaxMindCountryURL]]", file: GeoLite2-Country.mmdb }
+        - { url: "[[.MaxMindASNURL]]", file: GeoLite2-ASN.mmdb }
+[[- end]]
+
+    - name: Start the stack
+      ansible.builtin.command: [[.Compose]] up -d
+      args:
+        chdir: "{{ install_dir }}"
+      changed_when: pangolin_config.changed
+`))
+
+// ansibleDir is a directory of the rendered configuration the playbook
+// creates with its mode, since copy skips empty directories.
+type ansibleDir struct {
+	Path string
+	Mode string
+}
+
+func runGenerateAnsible(args []string) error {
+	flags := flag.NewFlagSet("generate ansible", flag.ExitOnError)
+	answersPath := flags.String("answers", "", "Path to the YAML answers file (required)")
+	out := flags.String("out", "ansible", "Directory to write the playbook and files to")
+	dir := flags.String("dir", defaultInstallDir, "Installation directory on the server")
+	flags.StringVar(&templatesDir, "templates-dir", "", "Directory of templates that override the embedded config files")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	config, err := loadProvisioningAnswers(*answersPath)
+	if err != nil {
+		return err
+	}
+	config.DoCrowdsecInstall = false
+
+	filesDir := filepath.Join(*out, "files")
+	if err := renderConfigFiles(config, filesDir); err != nil {
+		return fmt.Errorf("error rendering config files: %w", err)
+	}
+	if err := moveFile(filepath.Join(filesDir, "config", "docker-compose.yml"), filepath.Join(filesDir, "docker-compose.yml")); err != nil {
+		return fmt.Errorf("error moving docker-compose.yml: %w", err)
+	}
+
+	var dirs []ansibleDir
+	err = filepath.WalkDir(filesDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || !d.IsDir() || path == filesDir {
+			return err
+		}
+		rel, _ := filepath.Rel(filesDir, path)
+		dirs = append(dirs, ansibleDir{Path: filepath.ToSlash(rel), Mode: fmt.Sprintf("%04o", installer.DirModeFor(rel))})
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	compose := "docker compose"
+	if config.InstallationContainerType == Podman {
+		compose = "podman-compose"
+	}
+	var playbook bytes.Buffer
+	if err := ansiblePlaybook.Execute(&playbook, map[string]any{
+		"Config":            config,
+		"InstallDir":        *dir,
+		"Packages":          provisionPackages(config),
+		"Dirs":              dirs,
+		"Compose":           compose,
+		"MaxMindCountryURL": maxMindCountryURL,
+		"MaxMindASNURL":     maxMindASNURL,
+	}); err != nil {
+		return err
+	}
+
+	inventory := fmt.Sprintf("[pangolin]\n%s ansible_user=root\n", config.DashboardDomain)
+	for name, content := range map[string][]byte{"playbook.yml": playbook.Bytes(), "inventory.ini": []byte(inventory)} {
+		path := filepath.Join(*out, name)
+		if err := os.WriteFile(path, content, 0644); err != nil {
+			return fmt.Errorf("failed to write %s: %v", path, err)
+		}
+	}
+
+	fmt.Printf("Wrote the playbook and the rendered configuration to %s. Run it with:\n", *out)
+	fmt.Printf("  cd %s && ansible-playbook -i inventory.ini playbook.yml\n", *out)
+	fmt.Println("The files directory contains secrets; encrypt it with ansible-vault before committing it.")
+	return nil
+}
@@ -0,0 +1,20 @@
+package main
+
+import "github.com/fosrl/pangolin/install/pkg/installer"
+
+// componentVersions returns the versions this installer deploys.
+func componentVersions() installer.Versions {
+	return installer.Versions{
+		Pangolin:        pangolinVersion,
+		Gerbil:          gerbilVersion,
+		Badger:          badgerVersion,
+		Traefik:         traefikVersion,
+		CrowdsecBouncer: crowdsecBouncerVersion,
+	}
+}
+
+// loadAnswers reads a YAML answers file into a Config, falling back to the
+// versions baked into the installer.
+func loadAnswers(path string) (Config, error) {
+	return installer.LoadAnswers(path, componentVersions())
+}
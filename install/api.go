@@ -0,0 +1,205 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// integrationAPIPort is the port Pangolin serves the integration API on
+// inside its container when flags.enable_integration_api is set.
+const integrationAPIPort = 3003
+
+// dashboardAPIPort is the port of the API the dashboard itself uses, which
+// authenticates users by session cookie.
+const dashboardAPIPort = 3000
+
+// apiClient talks to Pangolin's integration API. With an empty baseURL the
+// requests are made from inside the pangolin container, so the API does not
+// have to be exposed through Traefik.
+type apiClient struct {
+	baseURL       string
+	apiKey        string
+	containerType SupportedContainer
+	httpClient    *http.Client
+	// dashboard selects the dashboard API instead, for setup that has no
+	// integration API equivalent; cookie is the session from login
+	dashboard bool
+	cookie    string
+}
+
+// apiResponse is the envelope every Pangolin API response is wrapped in.
+type apiResponse struct {
+	Data    json.RawMessage `json:"data"`
+	Success bool            `json:"success"`
+	Error   bool            `json:"error"`
+	Message string          `json:"message"`
+	Status  int             `json:"status"`
+}
+
+func newAPIClient(baseURL, apiKey string, containerType SupportedContainer) *apiClient {
+	return &apiClient{
+		baseURL:       strings.TrimSuffix(baseURL, "/"),
+		apiKey:        apiKey,
+		containerType: containerType,
+		httpClient:    &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// newDashboardClient returns a client for the dashboard API inside the
+// pangolin container. Call login before any request that needs a user.
+func newDashboardClient(containerType SupportedContainer) *apiClient {
+	return &apiClient{containerType: containerType, dashboard: true}
+}
+
+// login signs in to the dashboard API and keeps the session for the
+// following requests.
+func (c *apiClient) login(email, password string) error {
+	if err := c.do("POST", "/auth/login", map[string]any{"email": email, "password": password}, nil); err != nil {
+		return err
+	}
+	if c.cookie == "" {
+		return fmt.Errorf("POST /auth/login: no session cookie in the response")
+	}
+	return nil
+}
+
+// installAPIClient returns a client for the integration API of the install
+// in the current directory, along with its dashboard URL. With an empty
+// apiURL the API is called inside the pangolin container, which requires
+// flags.enable_integration_api.
+func installAPIClient(apiURL, apiKey string) (*apiClient, string, error) {
+	appConfig, err := readAppConfigMap()
+	if err != nil {
+		return nil, "", err
+	}
+	if apiURL == "" {
+		if enabled, _ := lookup(appConfig, "flags", "enable_integration_api"); enabled != true {
+			return nil, "", fmt.Errorf("the integration API is disabled; set flags.enable_integration_api: true in %s and restart Pangolin", appConfigFile)
+		}
+	}
+	dashboardURL, _ := lookupString(appConfig, "app", "dashboard_url")
+	if dashboardURL == "" {
+		return nil, "", fmt.Errorf("app.dashboard_url is not set in %s", appConfigFile)
+	}
+
+	containerType := detectContainerType()
+	if containerType == Undefined {
+		return nil, "", fmt.Errorf("unable to detect the container runtime of the installation")
+	}
+	return newAPIClient(apiURL, apiKey, containerType), dashboardURL, nil
+}
+
+// do sends a request and decodes the data field of the response into out,
+// which may be nil.
+func (c *apiClient) do(method, path string, body, out any) error {
+	var payload []byte
+	if body != nil {
+		var err error
+		if payload, err = json.Marshal(body); err != nil {
+			return fmt.Errorf("failed to encode request: %v", err)
+		}
+	}
+
+	var raw []byte
+	var err error
+	if c.baseURL == "" {
+		raw, err = c.doInContainer(method, path, payload)
+	} else {
+		raw, err = c.doHTTP(method, path, payload)
+	}
+	if err != nil {
+		return fmt.Errorf("%s %s: %v", method, path, err)
+	}
+
+	var response apiResponse
+	if err := json.Unmarshal(raw, &response); err != nil {
+		return fmt.Errorf("%s %s: unexpected response: %s", method, path, strings.TrimSpace(string(raw)))
+	}
+	if response.Error || !response.Success {
+		return fmt.Errorf("%s %s: %s (status %d)", method, path, response.Message, response.Status)
+	}
+	if out != nil && len(response.Data) > 0 {
+		if err := json.Unmarshal(response.Data, out); err != nil {
+			return fmt.Errorf("%s %s: failed to decode response: %v", method, path, err)
+		}
+	}
+	return nil
+}
+
+func (c *apiClient) doHTTP(method, path string, payload []byte) ([]byte, error) {
+	req, err := http.NewRequest(method, c.baseURL+path, bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.apiKey)
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	return io.ReadAll(resp.Body)
+}
+
+func (c *apiClient) doInContainer(method, path string, payload []byte) ([]byte, error) {
+	url := fmt.Sprintf("http://localhost:%d/v1%s", integrationAPIPort, path)
+	args := []string{"exec", "-i", serviceContainer("pangolin"), "curl", "-sS", "--max-time", "30", "-X", method}
+	if c.dashboard {
+		// Include the headers to pick up the session cookie
+		url = fmt.Sprintf("http://localhost:%d/api/v1%s", dashboardAPIPort, path)
+		args = append(args, "-i", "-H", "X-CSRF-Token: x-csrf-protection")
+		if c.cookie != "" {
+			args = append(args, "-H", "Cookie: "+c.cookie)
+		}
+	} else {
+		args = append(args, "-H", "Authorization: Bearer "+c.apiKey)
+	}
+	if payload != nil {
+		args = append(args, "-H", "Content-Type: application/json", "--data-binary", "@-")
+	}
+	args = append(args, url)
+
+	cmd := containerCommand(c.containerType, args...)
+	cmd.Stdin = bytes.NewReader(payload)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("%v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	if c.dashboard {
+		return c.readHeaders(out), nil
+	}
+	return out, nil
+}
+
+// readHeaders strips the header blocks curl -i puts in front of the body,
+// keeping a session cookie that was set.
+func (c *apiClient) readHeaders(out []byte) []byte {
+	for bytes.HasPrefix(out, []byte("HTTP/")) {
+		headers, body, ok := bytes.Cut(out, []byte("\r\n\r\n"))
+		if !ok {
+			return nil
+		}
+		for _, line := range strings.Split(string(headers), "\r\n") {
+			name, value, _ := strings.Cut(line, ":")
+			if !strings.EqualFold(name, "Set-Cookie") {
+				continue
+			}
+			cookie, _, _ := strings.Cut(strings.TrimSpace(value), ";")
+			if _, v, _ := strings.Cut(cookie, "="); v != "" {
+				c.cookie = cookie
+			}
+		}
+		out = body
+	}
+	return out
+}
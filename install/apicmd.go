@@ -0,0 +1,429 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"gopkg.in/yaml.v3"
+)
+
+// apiCredentialsFile keeps the integration API key `api login` stored, in
+// the installation directory.
+const apiCredentialsFile = "api-credentials.yml"
+
+// apiCredentials are the stored credentials of the api subcommands.
+type apiCredentials struct {
+	APIKey string `yaml:"api_key"`
+	Org    string `yaml:"org"`
+	APIURL string `yaml:"api_url,omitempty"`
+}
+
+// apiSession is what an api subcommand runs with: a client for the
+// installation and the organization to act on.
+type apiSession struct {
+	api  *apiClient
+	org  string
+	json bool
+	// dashboardURL is the endpoint Newt connects to
+	dashboardURL string
+}
+
+// apiCommand is an api subcommand, such as "resource list".
+type apiCommand struct {
+	Description string
+	// Args names the positional arguments, for the usage
+	Args string
+	// Setup defines the flags of the subcommand besides the common ones and
+	// returns its entry point
+	Setup func(flags *flag.FlagSet) func(session *apiSession, args []string) error
+}
+
+var apiCommands = map[string]apiCommand{
+	"resource list": {
+		Description: "List the resources of the organization",
+		Setup: func(flags *flag.FlagSet) func(*apiSession, []string) error {
+			return listResources
+		},
+	},
+	"site list": {
+		Description: "List the sites of the organization",
+		Setup: func(flags *flag.FlagSet) func(*apiSession, []string) error {
+			return listSites
+		},
+	},
+	"site create": {
+		Description: "Create a Newt site and print the credentials to start Newt with",
+		Args:        "<name>",
+		Setup: func(flags *flag.FlagSet) func(*apiSession, []string) error {
+			return func(s *apiSession, args []string) error {
+				if len(args) != 1 {
+					return usageErrorf("expected the name of the site")
+				}
+				_, err := createNewtSite(s.api, s.org, args[0], s.dashboardURL)
+				return err
+			}
+		},
+	},
+	"user list": {
+		Description: "List the users of the organization",
+		Setup: func(flags *flag.FlagSet) func(*apiSession, []string) error {
+			return listUsers
+		},
+	},
+	"user invite": {
+		Description: "Invite a user to the organization and print the invite link",
+		Args:        "<email>",
+		Setup: func(flags *flag.FlagSet) func(*apiSession, []string) error {
+			role := flags.String("role", "Member", "Name or ID of the role to give the user")
+			validHours := flags.Int("valid-hours", 72, "How long the invite link is valid, in hours")
+			sendEmail := flags.Bool("send-email", false, "Also send the invite by email, which needs email set up")
+			return func(s *apiSession, args []string) error {
+				if len(args) != 1 || !strings.Contains(args[0], "@") {
+					return usageErrorf("expected the email address to invite")
+				}
+				return inviteUser(s, args[0], *role, *validHours, *sendEmail)
+			}
+		},
+	},
+}
+
+func apiUsage() string {
+	var names []string
+	for name, command := range apiCommands {
+		names = append(names, fmt.Sprintf("  %-24s %s", strings.TrimSpace(name+" "+command.Args), command.Description))
+	}
+	slices.Sort(names)
+	return "usage: installer api <command> [flags]\n\nCommands:\n" +
+		fmt.Sprintf("  %-24s %s\n  %-24s %s\n", "login", "Store an integration API key for the other commands", "logout", "Remove the stored API key") +
+		strings.Join(names, "\n")
+}
+
+// runAPI administers the installation through Pangolin's integration API,
+// with the key stored by `api login` or given by flag or environment.
+func runAPI(args []string) error {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		return usageErrorf("%s", apiUsage())
+	}
+	switch args[0] {
+	case "login":
+		return runAPILogin(args[1:])
+	case "logout":
+		return runAPILogout(args[1:])
+	}
+
+	if len(args) < 2 {
+		return usageErrorf("%s", apiUsage())
+	}
+	name := args[0] + " " + args[1]
+	command, ok := apiCommands[name]
+	if !ok {
+		return usageErrorf("unknown api command %q\n%s", name, apiUsage())
+	}
+
+	flags := flag.NewFlagSet("api "+name, flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "usage: installer api %s [flags]\n\n%s\n\n", strings.TrimSpace(name+" "+command.Args), command.Description)
+		flags.PrintDefaults()
+	}
+	common := addAPIFlags(flags)
+	jsonOutput := flags.Bool("json", false, "Print the API response as JSON")
+	run := command.Setup(flags)
+	// Flags may follow the positional arguments
+	var positional []string
+	rest := args[2:]
+	for {
+		if err := flags.Parse(rest); err != nil {
+			return err
+		}
+		if flags.NArg() == 0 {
+			break
+		}
+		positional = append(positional, flags.Arg(0))
+		rest = flags.Args()[1:]
+	}
+
+	session, err := common.session()
+	if err != nil {
+		return err
+	}
+	session.json = *jsonOutput
+	return run(session, positional)
+}
+
+// apiFlags are the flags of the commands that use the stored credentials.
+type apiFlags struct {
+	dir, org, apiKey, apiURL *string
+}
+
+func addAPIFlags(flags *flag.FlagSet) *apiFlags {
+	return &apiFlags{
+		dir:    flags.String("dir", "", "Installation directory"),
+		org:    flags.String("org", "", "ID of the organization (default: the one stored by api login)"),
+		apiKey: flags.String("api-key", os.Getenv("PANGOLIN_API_KEY"), "Integration API key (default $PANGOLIN_API_KEY, then the one stored by api login)"),
+		apiURL: flags.String("api-url", "", "Integration API base URL, e.g. https://api.example.com/v1 (default: call it inside the pangolin container)"),
+	}
+}
+
+// session enters the installation directory and returns a session with the
+// credentials of the flags, falling back to the stored ones.
+func (f *apiFlags) session() (*apiSession, error) {
+	if err := enterInstallDir(*f.dir); err != nil {
+		return nil, err
+	}
+	return storedAPISession(*f.apiKey, *f.org, *f.apiURL)
+}
+
+// storedAPISession returns a session for the installation in the current
+// directory, with the stored credentials for the empty arguments.
+func storedAPISession(apiKey, org, apiURL string) (*apiSession, error) {
+	stored, err := readAPICredentials()
+	if err != nil {
+		return nil, err
+	}
+	if apiKey == "" {
+		apiKey = stored.APIKey
+	}
+	if org == "" {
+		org = stored.Org
+	}
+	if apiURL == "" {
+		apiURL = stored.APIURL
+	}
+	if apiKey == "" || org == "" {
+		return nil, usageErrorf("no API key and organization stored; run `installer api login` or pass --api-key and --org")
+	}
+
+	api, dashboardURL, err := installAPIClient(apiURL, apiKey)
+	if err != nil {
+		return nil, withExitCode(exitPreflight, err)
+	}
+	return &apiSession{api: api, org: org, dashboardURL: dashboardURL}, nil
+}
+
+// runAPILogin checks an integration API key against the installation and
+// stores it, readable only by its owner, for the other api commands.
+func runAPILogin(args []string) error {
+	flags := flag.NewFlagSet("api login", flag.ExitOnError)
+	dir := flags.String("dir", "", "Installation directory")
+	org := flags.String("org", "", "ID of the organization the key belongs to")
+	apiKey := flags.String("api-key", os.Getenv("PANGOLIN_API_KEY"), "Integration API key, created under API Keys in the organization settings (default $PANGOLIN_API_KEY, otherwise prompted)")
+	apiURL := flags.String("api-url", "", "Integration API base URL, e.g. https://api.example.com/v1 (default: call it inside the pangolin container)")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *org == "" {
+		return usageErrorf("--org is required")
+	}
+
+	if err := enterInstallDir(*dir); err != nil {
+		return err
+	}
+	if *apiKey == "" {
+		*apiKey = readPassword("Integration API key", "")
+	}
+	if *apiKey == "" {
+		return usageErrorf("an API key is required")
+	}
+
+	api, _, err := installAPIClient(*apiURL, *apiKey)
+	if err != nil {
+		return withExitCode(exitPreflight, err)
+	}
+	if err := api.do("GET", "/org/"+*org+"/sites", nil, nil); err != nil {
+		return fmt.Errorf("the API key was not accepted: %v", err)
+	}
+
+	data, err := yaml.Marshal(apiCredentials{APIKey: *apiKey, Org: *org, APIURL: *apiURL})
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(apiCredentialsFile, data, 0600); err != nil {
+		return fmt.Errorf("failed to write %s: %v", apiCredentialsFile, err)
+	}
+	fmt.Printf("Stored the API key for organization %s in %s.\n", *org, apiCredentialsFile)
+	return nil
+}
+
+func runAPILogout(args []string) error {
+	flags := flag.NewFlagSet("api logout", flag.ExitOnError)
+	dir := flags.String("dir", "", "Installation directory")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if err := enterInstallDir(*dir); err != nil {
+		return err
+	}
+	if err := os.Remove(apiCredentialsFile); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	fmt.Println("Removed the stored API key. Delete the key in the organization settings to revoke it.")
+	return nil
+}
+
+// readAPICredentials returns the stored credentials, which are empty if
+// there are none.
+func readAPICredentials() (apiCredentials, error) {
+	var credentials apiCredentials
+	data, err := os.ReadFile(apiCredentialsFile)
+	if os.IsNotExist(err) {
+		return credentials, nil
+	}
+	if err != nil {
+		return credentials, err
+	}
+	if err := yaml.Unmarshal(data, &credentials); err != nil {
+		return credentials, fmt.Errorf("error parsing %s: %v", apiCredentialsFile, err)
+	}
+	return credentials, nil
+}
+
+// printAPIList prints rows as a table, or the response as JSON with --json.
+func printAPIList(s *apiSession, response any, header string, rows [][]string) error {
+	if s.json {
+		out, err := json.MarshalIndent(response, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(out))
+		return nil
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, header)
+	for _, row := range rows {
+		fmt.Fprintln(w, strings.Join(row, "\t"))
+	}
+	return w.Flush()
+}
+
+func listResources(s *apiSession, args []string) error {
+	var response struct {
+		Resources []struct {
+			ResourceID int    `json:"resourceId"`
+			Name       string `json:"name"`
+			FullDomain string `json:"fullDomain"`
+			HTTP       bool   `json:"http"`
+			Protocol   string `json:"protocol"`
+			ProxyPort  int    `json:"proxyPort"`
+			Enabled    bool   `json:"enabled"`
+		} `json:"resources"`
+	}
+	if err := s.api.do("GET", "/org/"+s.org+"/resources", nil, &response); err != nil {
+		return err
+	}
+	var rows [][]string
+	for _, r := range response.Resources {
+		target := "https://" + r.FullDomain
+		if !r.HTTP {
+			target = fmt.Sprintf("%s port %d", r.Protocol, r.ProxyPort)
+		}
+		rows = append(rows, []string{strconv.Itoa(r.ResourceID), r.Name, target, enabledLabel(r.Enabled)})
+	}
+	return printAPIList(s, response, "ID\tNAME\tADDRESS\tSTATE", rows)
+}
+
+func listSites(s *apiSession, args []string) error {
+	var response struct {
+		Sites []struct {
+			SiteID int    `json:"siteId"`
+			Name   string `json:"name"`
+			Type   string `json:"type"`
+			Online bool   `json:"online"`
+			Subnet string `json:"subnet"`
+		} `json:"sites"`
+	}
+	if err := s.api.do("GET", "/org/"+s.org+"/sites", nil, &response); err != nil {
+		return err
+	}
+	var rows [][]string
+	for _, site := range response.Sites {
+		state := "offline"
+		if site.Online {
+			state = "online"
+		}
+		rows = append(rows, []string{strconv.Itoa(site.SiteID), site.Name, site.Type, state, site.Subnet})
+	}
+	return printAPIList(s, response, "ID\tNAME\tTYPE\tSTATE\tSUBNET", rows)
+}
+
+func listUsers(s *apiSession, args []string) error {
+	var response struct {
+		Users []struct {
+			ID       string `json:"id"`
+			Email    string `json:"email"`
+			Username string `json:"username"`
+			RoleName string `json:"roleName"`
+			IsOwner  bool   `json:"isOwner"`
+		} `json:"users"`
+	}
+	if err := s.api.do("GET", "/org/"+s.org+"/users", nil, &response); err != nil {
+		return err
+	}
+	var rows [][]string
+	for _, u := range response.Users {
+		role := u.RoleName
+		if u.IsOwner {
+			role += " (owner)"
+		}
+		rows = append(rows, []string{u.ID, orUnknown(u.Email, u.Username), role})
+	}
+	return printAPIList(s, response, "ID\tUSER\tROLE", rows)
+}
+
+// inviteUser creates an invite for email with the role named or numbered
+// role.
+func inviteUser(s *apiSession, email, role string, validHours int, sendEmail bool) error {
+	roleID, err := strconv.Atoi(role)
+	if err != nil {
+		var roles struct {
+			Roles []struct {
+				RoleID int    `json:"roleId"`
+				Name   string `json:"name"`
+			} `json:"roles"`
+		}
+		if err := s.api.do("GET", "/org/"+s.org+"/roles", nil, &roles); err != nil {
+			return fmt.Errorf("failed to list roles: %v", err)
+		}
+		var names []string
+		for _, r := range roles.Roles {
+			if strings.EqualFold(r.Name, role) {
+				roleID = r.RoleID
+			}
+			names = append(names, r.Name)
+		}
+		if roleID == 0 {
+			return usageErrorf("no role %q in organization %s; roles: %s", role, s.org, strings.Join(names, ", "))
+		}
+	}
+
+	var invite struct {
+		InviteLink string `json:"inviteLink"`
+		ExpiresAt  int64  `json:"expiresAt"`
+	}
+	err = s.api.do("POST", "/org/"+s.org+"/create-invite", map[string]any{
+		"email":      email,
+		"roleId":     roleID,
+		"validHours": validHours,
+		"sendEmail":  sendEmail,
+	}, &invite)
+	if err != nil {
+		return fmt.Errorf("failed to invite %s: %v", email, err)
+	}
+	if s.json {
+		return printAPIList(s, invite, "", nil)
+	}
+	fmt.Printf("Invited %s. Invite link, valid for %d hours:\n  %s\n", email, validHours, invite.InviteLink)
+	return nil
+}
+
+func enabledLabel(enabled bool) string {
+	if enabled {
+		return "enabled"
+	}
+	return "disabled"
+}
@@ -0,0 +1,348 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/fosrl/pangolin/install/pkg/installer"
+)
+
+// storedAnswersFile holds the answers an installation was generated from,
+// in the installation directory. The provisioning generators upload the
+// answers file under the same name.
+const storedAnswersFile = "answers.yml"
+
+// saveStoredAnswers writes config as the stored answers of the installation
+// in the current directory.
+func saveStoredAnswers(config Config) error {
+	data, err := yaml.Marshal(config)
+	if err != nil {
+		return fmt.Errorf("failed to encode the answers: %v", err)
+	}
+	if err := os.WriteFile(storedAnswersFile, data, 0600); err != nil {
+		return fmt.Errorf("failed to write %s: %v", storedAnswersFile, err)
+	}
+	return nil
+}
+
+// updateStoredAnswers applies update to the stored answers, so that apply
+// keeps a change made by another subcommand, and to the recorded installer
+// state. Installations without stored answers are left alone.
+func updateStoredAnswers(update func(config *Config)) error {
+	if err := updateInstallState(update); err != nil {
+		return err
+	}
+	if _, err := os.Stat(storedAnswersFile); err != nil {
+		return nil
+	}
+	config, err := loadAnswers(storedAnswersFile)
+	if err != nil {
+		return err
+	}
+	update(&config)
+	return saveStoredAnswers(config)
+}
+
+// crowdsecManagedFiles are rewritten when CrowdSec is layered onto an
+// installation, so rendering them from the answers would undo it.
+var crowdsecManagedFiles = []string{composeFile, traefikStaticFile, traefikDynamicFile}
+
+// managedImages are the images whose tags apply reconciles in a compose
+// file it does not manage, by service.
+var managedImages = map[string]string{
+	"pangolin": "fosrl/pangolin",
+	"gerbil":   "fosrl/gerbil",
+	"traefik":  "docker.io/traefik",
+}
+
+// convergePlan is what apply found to differ from the stored answers.
+type convergePlan struct {
+	// Files maps paths relative to the installation directory to their
+	// rendered contents.
+	Files map[string][]byte
+	// Images maps services to the image tag their compose entry should have.
+	Images map[string]string
+	// Profile is set when the monitoring profile has to be enabled.
+	Profile string
+	// Stopped lists services that should be running and are not.
+	Stopped []string
+	// Unmanaged lists files that differ but are left alone.
+	Unmanaged []string
+	// Managed lists every file rendered from the answers.
+	Managed []string
+}
+
+func (p *convergePlan) empty() bool {
+	return len(p.Files) == 0 && len(p.Images) == 0 && p.Profile == "" && len(p.Stopped) == 0
+}
+
+// runApply converges the installation on its stored answers: it re-renders
+// the configuration, rewrites only the files that drifted and brings the
+// services up when something changed or a service is not running. Without
+// drift it changes nothing, so it can run repeatedly, e.g. from a timer.
+// The sites and resources of pangolin.yaml are applied afterwards.
+func runApply(args []string) error {
+	flags := flag.NewFlagSet("apply", flag.ExitOnError)
+	dir := flags.String("dir", "", "Installation directory")
+	answersPath := flags.String("answers", storedAnswersFile, "Answers file to converge on, relative to the installation directory")
+	dryRun := flags.Bool("dry-run", false, "Only report what would change")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if err := enterInstallDir(*dir); err != nil {
+		return err
+	}
+	config, err := loadStoredAnswers(*answersPath)
+	if err != nil {
+		return err
+	}
+	if err := convergeInstallation(config, *answersPath, *dryRun); err != nil {
+		return err
+	}
+	return applyDesiredResources(*dryRun)
+}
+
+// convergeInstallation brings the installation in the current directory in
+// line with config, read from answersPath.
+func convergeInstallation(config Config, answersPath string, dryRun bool) error {
+	containerType := installedContainerType(config)
+
+	plan, err := planConverge(config, containerType)
+	if err != nil {
+		return err
+	}
+	printConvergePlan(plan)
+	if plan.empty() {
+		fmt.Println("Everything matches the answers; nothing to do.")
+		return nil
+	}
+	if dryRun {
+		return nil
+	}
+	if containerType != Docker && containerType != Podman {
+		return preflightErrorf("could not detect the container runtime of the installation")
+	}
+
+	if err := backupConfig(); err != nil {
+		return fmt.Errorf("backup failed: %v", err)
+	}
+	for _, path := range sortedKeys(plan.Files) {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(path, plan.Files[path], installer.FileModeFor(path)); err != nil {
+			return fmt.Errorf("failed to write %s: %v", path, err)
+		}
+	}
+	for _, service := range sortedKeys(plan.Images) {
+		if err := setComposeImageVersion(composeFile, managedImages[service], plan.Images[service]); err != nil {
+			return err
+		}
+	}
+	if plan.Profile != "" {
+		if err := enableComposeProfile(composeFile, plan.Profile); err != nil {
+			return err
+		}
+	}
+	secureInstallFiles()
+
+	if _, ok := plan.Files[composeFile]; ok || len(plan.Images) > 0 {
+		if err := composeCommand(containerType, "pull"); err != nil {
+			return withExitCode(exitNetwork, fmt.Errorf("failed to pull images: %v", err))
+		}
+	}
+	// compose only recreates the services whose definition changed
+	if err := composeCommand(containerType, "up", "-d"); err != nil {
+		return fmt.Errorf("failed to bring the services up: %v", err)
+	}
+	// A simulation started nothing to wait for
+	if !simulating() {
+		if err := waitForServices(containerType); err != nil {
+			return fmt.Errorf("the services are not healthy: %v", err)
+		}
+	}
+
+	config.InstallationContainerType = containerType
+	if err := saveInstallState(config); err != nil {
+		return err
+	}
+
+	if len(plan.Files) > 0 || len(plan.Images) > 0 {
+		recordChange(fmt.Sprintf("Apply %s: %d file(s) and %d image(s) updated", answersPath, len(plan.Files), len(plan.Images)))
+	}
+	fmt.Println("The installation matches the answers.")
+	return nil
+}
+
+// loadStoredAnswers reads and validates the answers an installation is
+// converged on or checked against.
+func loadStoredAnswers(path string) (Config, error) {
+	if _, err := os.Stat(path); err != nil {
+		return Config{}, preflightErrorf("no answers at %s: installations made before apply existed have none; write one with the keys of `installer render`", path)
+	}
+	config, err := loadAnswers(path)
+	if err != nil {
+		return Config{}, withExitCode(exitUsage, err)
+	}
+	if err := applyDesiredSettings(&config); err != nil {
+		return Config{}, withExitCode(exitUsage, err)
+	}
+	if missing := installer.MissingAnswers(config); len(missing) > 0 {
+		return Config{}, usageErrorf("%s is missing required keys: %s", path, strings.Join(missing, ", "))
+	}
+	// Answers written by the provisioning generators may leave the secret to
+	// the installation, which keeps it in its config
+	if config.Secret == "" {
+		config.Secret = installedSecret()
+	}
+	if config.Secret == "" {
+		return Config{}, usageErrorf("%s is missing required key: secret", path)
+	}
+	if err := installer.Validate(config); err != nil {
+		return Config{}, withExitCode(exitUsage, localizeError(err))
+	}
+	return config, nil
+}
+
+// installedContainerType returns the runtime the installation runs on, or
+// the one of the answers if none is running.
+func installedContainerType(config Config) SupportedContainer {
+	if containerType := detectContainerType(); containerType != Undefined {
+		return containerType
+	}
+	return config.InstallationContainerType
+}
+
+// installedSecret returns the server secret recorded for the installation
+// or, for older installations, that of the installed Pangolin config, or ""
+// if there is none.
+func installedSecret() string {
+	if config, ok, err := loadInstallState(); err == nil && ok && config.Secret != "" {
+		return config.Secret
+	}
+	data, err := os.ReadFile(appConfigFile)
+	if err != nil {
+		return ""
+	}
+	var doc map[string]any
+	if yaml.Unmarshal(data, &doc) != nil {
+		return ""
+	}
+	secret, _ := lookupString(doc, "server", "secret")
+	return secret
+}
+
+// planConverge renders the configuration from config into a temporary
+// directory and compares it with the installation.
+func planConverge(config Config, containerType SupportedContainer) (*convergePlan, error) {
+	plan := &convergePlan{Files: map[string][]byte{}, Images: map[string]string{}}
+
+	staging, err := os.MkdirTemp("", "pangolin-apply-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(staging)
+
+	config.DoCrowdsecInstall = false
+	if err := renderConfigFiles(config, staging); err != nil {
+		return nil, fmt.Errorf("error rendering the configuration: %w", err)
+	}
+	if err := moveFile(filepath.Join(staging, "config", composeFile), filepath.Join(staging, composeFile)); err != nil {
+		return nil, err
+	}
+
+	crowdsec := checkIsCrowdsecInstalledInCompose()
+	err = filepath.WalkDir(staging, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(staging, path)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		plan.Managed = append(plan.Managed, rel)
+		rendered, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		installed, err := os.ReadFile(rel)
+		if err == nil && bytes.Equal(installed, rendered) {
+			return nil
+		}
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		if crowdsec && slices.Contains(crowdsecManagedFiles, rel) {
+			plan.Unmanaged = append(plan.Unmanaged, rel)
+			return nil
+		}
+		plan.Files[rel] = rendered
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// A compose file apply does not manage still gets the image versions
+	if crowdsec {
+		for _, service := range sortedKeys(managedImages) {
+			want, _ := ReadComposeImageTag(filepath.Join(staging, composeFile), service)
+			have, err := ReadComposeImageTag(composeFile, service)
+			if err != nil || have == "" || want == "" || installer.StripVersionPrefix(have) == installer.StripVersionPrefix(want) {
+				continue
+			}
+			plan.Images[service] = installer.StripVersionPrefix(want)
+		}
+	}
+
+	if config.EnableMonitoring && !slices.Contains(readComposeProfiles(composeFile), "monitoring") {
+		plan.Profile = "monitoring"
+	}
+
+	if containerType == Docker || containerType == Podman {
+		services, err := composeServices(composeFile)
+		if err != nil {
+			return nil, err
+		}
+		for _, service := range services {
+			state, err := inspectContainer(containerType, service.Container)
+			if err != nil || !state.Running {
+				plan.Stopped = append(plan.Stopped, service.Name)
+			}
+		}
+	}
+	return plan, nil
+}
+
+func printConvergePlan(plan *convergePlan) {
+	for _, path := range sortedKeys(plan.Files) {
+		if _, err := os.Stat(path); err != nil {
+			fmt.Printf("create   %s\n", path)
+		} else {
+			fmt.Printf("update   %s\n", path)
+		}
+	}
+	for _, service := range sortedKeys(plan.Images) {
+		fmt.Printf("image    %s -> %s\n", service, plan.Images[service])
+	}
+	if plan.Profile != "" {
+		fmt.Printf("profile  enable %s\n", plan.Profile)
+	}
+	for _, service := range plan.Stopped {
+		fmt.Printf("start    %s\n", service)
+	}
+	for _, path := range plan.Unmanaged {
+		fmt.Printf("skip     %s (changed by the CrowdSec setup, not managed by apply)\n", path)
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import "testing"
+
+// TestApplyKeepsRecordedState checks that apply, which records the state
+// from the stored answers, keeps what other subcommands recorded since the
+// install.
+func TestApplyKeepsRecordedState(t *testing.T) {
+	apply := func(t *testing.T) Config {
+		t.Helper()
+		config, err := loadStoredAnswers(storedAnswersFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := convergeInstallation(config, storedAnswersFile, false); err != nil {
+			t.Fatal(err)
+		}
+		installed, ok, err := loadInstallState()
+		if err != nil || !ok {
+			t.Fatalf("no installer state after apply: %v", err)
+		}
+		return installed
+	}
+
+	t.Run("crowdsec", func(t *testing.T) {
+		installForTest(t, false)
+		before, _, err := loadInstallState()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !before.DoCrowdsecInstall || before.TraefikBouncerKey == "" {
+			t.Fatal("the install did not record CrowdSec")
+		}
+
+		after := apply(t)
+		if !after.DoCrowdsecInstall {
+			t.Error("apply dropped install_crowdsec")
+		}
+		if after.TraefikBouncerKey != before.TraefikBouncerKey {
+			t.Errorf("apply changed the bouncer key from %q to %q", before.TraefikBouncerKey, after.TraefikBouncerKey)
+		}
+		if !checkIsCrowdsecInstalledInCompose() {
+			t.Error("apply removed CrowdSec from the compose file")
+		}
+	})
+
+	t.Run("rollback", func(t *testing.T) {
+		installForTest(t, false)
+		err := updateStoredAnswers(func(config *Config) {
+			config.PangolinVersion, config.GerbilVersion, config.BadgerVersion = "1.11.0", "1.3.0", "v1.3.0"
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		restored := map[string]string{"pangolin": "1.10.0", "gerbil": "1.2.0", "badger": "v1.2.0"}
+		if err := recordRolledBackVersions(restored); err != nil {
+			t.Fatal(err)
+		}
+
+		after := apply(t)
+		got := map[string]string{"pangolin": after.PangolinVersion, "gerbil": after.GerbilVersion, "badger": after.BadgerVersion}
+		for component, version := range restored {
+			if got[component] != version {
+				t.Errorf("apply recorded %s %s, want the rolled back %s", component, got[component], version)
+			}
+		}
+		if tag, err := ReadComposeImageTag(composeFile, "pangolin"); err != nil || tag != "1.10.0" {
+			t.Errorf("apply runs Pangolin %q (%v), want the rolled back 1.10.0", tag, err)
+		}
+	})
+}
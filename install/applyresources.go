@@ -0,0 +1,379 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+
+	"gopkg.in/yaml.v3"
+)
+
+// resourcesFile is the declarative description of sites and resources that
+// apply-resources creates and updates:
+//
+//	org: home
+//	sites:
+//	  - name: homelab
+//	resources:
+//	  - name: Grafana
+//	    site: homelab
+//	    domain: grafana.example.com
+//	    targets: [http://10.0.0.5:3000]
+//	  - name: Minecraft
+//	    site: homelab
+//	    protocol: tcp
+//	    proxy_port: 25565
+//	    targets: [10.0.0.6:25565]
+type resourcesFile struct {
+	Org       string             `yaml:"org"`
+	Sites     []declaredSite     `yaml:"sites"`
+	Resources []declaredResource `yaml:"resources"`
+}
+
+// declaredSite is a Newt site of the resources file, matched with the
+// existing sites by name.
+type declaredSite struct {
+	Name string `yaml:"name"`
+}
+
+// declaredResource is a resource of the resources file. Resources are
+// matched with the existing ones by name.
+type declaredResource struct {
+	Name string `yaml:"name"`
+	Site string `yaml:"site"`
+	// Domain makes it an HTTP resource
+	Domain    string   `yaml:"domain"`
+	Protocol  string   `yaml:"protocol"`
+	ProxyPort int      `yaml:"proxy_port"`
+	Enabled   *bool    `yaml:"enabled"`
+	Targets   []string `yaml:"targets"`
+
+	resource importedResource
+}
+
+// existingResource is a resource of the organization as the API lists it.
+type existingResource struct {
+	ResourceID int    `json:"resourceId"`
+	Name       string `json:"name"`
+	FullDomain string `json:"fullDomain"`
+	HTTP       bool   `json:"http"`
+	Protocol   string `json:"protocol"`
+	ProxyPort  int    `json:"proxyPort"`
+	Enabled    bool   `json:"enabled"`
+}
+
+// existingTarget is a target of a resource as the API lists it.
+type existingTarget struct {
+	TargetID int    `json:"targetId"`
+	SiteID   int    `json:"siteId"`
+	IP       string `json:"ip"`
+	Port     int    `json:"port"`
+	Method   string `json:"method"`
+}
+
+// runApplyResources creates and updates sites, resources and their targets
+// to match a resources file. Sites and resources missing from the file are
+// left alone; targets of a declared resource that the file does not list are
+// removed. Running it again with the same file changes nothing.
+func runApplyResources(args []string) error {
+	flags := flag.NewFlagSet("apply-resources", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: installer apply-resources [flags] resources.yml")
+		flags.PrintDefaults()
+	}
+	common := addAPIFlags(flags)
+	dryRun := flags.Bool("dry-run", false, "Only show what would change")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return usageErrorf("expected the resources file")
+	}
+
+	path, err := expandPath(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	file, err := loadResourcesFile(path)
+	if err != nil {
+		return withExitCode(exitUsage, err)
+	}
+	if *common.org == "" {
+		*common.org = file.Org
+	}
+	session, err := common.session()
+	if err != nil {
+		return err
+	}
+	return applyResources(session, file, *dryRun)
+}
+
+// applyResources creates and updates the sites and resources of file in the
+// organization of the session.
+func applyResources(session *apiSession, file *resourcesFile, dryRun bool) error {
+	api, org := session.api, session.org
+
+	var sites struct {
+		Sites []struct {
+			SiteID int    `json:"siteId"`
+			Name   string `json:"name"`
+		} `json:"sites"`
+	}
+	if err := api.do("GET", "/org/"+org+"/sites", nil, &sites); err != nil {
+		return err
+	}
+	siteIDs := map[string]int{}
+	for _, site := range sites.Sites {
+		siteIDs[site.Name] = site.SiteID
+	}
+	var resources struct {
+		Resources []existingResource `json:"resources"`
+	}
+	if err := api.do("GET", "/org/"+org+"/resources", nil, &resources); err != nil {
+		return err
+	}
+	existing := map[string]existingResource{}
+	for _, r := range resources.Resources {
+		existing[r.Name] = r
+	}
+	domains, err := listOrgDomains(api, org)
+	if err != nil {
+		return err
+	}
+
+	for _, r := range file.Resources {
+		if _, ok := siteIDs[r.Site]; !ok && !slices.Contains(file.Sites, declaredSite{Name: r.Site}) {
+			return usageErrorf("resource %s: site %q neither exists nor is declared under sites", r.Name, r.Site)
+		}
+		if r.resource.HTTP {
+			if _, _, err := resourceDomain(r.Domain, domains); err != nil {
+				return usageErrorf("resource %s: %s: %v", r.Name, r.Domain, err)
+			}
+		}
+	}
+
+	fmt.Println("\n=== Applying Resources ===")
+	changes := 0
+	for _, site := range file.Sites {
+		if _, ok := siteIDs[site.Name]; ok {
+			continue
+		}
+		changes++
+		fmt.Printf("create site %s\n", site.Name)
+		if dryRun {
+			continue
+		}
+		id, err := createNewtSite(api, org, site.Name, session.dashboardURL)
+		if err != nil {
+			return err
+		}
+		siteIDs[site.Name] = id
+	}
+
+	failed := 0
+	for _, r := range file.Resources {
+		n, err := applyResource(api, org, r, existing, siteIDs[r.Site], domains, dryRun)
+		changes += n
+		if err != nil {
+			fmt.Printf("Failed to apply %s: %v\n", r.Name, err)
+			failed++
+		}
+	}
+
+	switch {
+	case failed > 0:
+		return withExitCode(exitPartial, fmt.Errorf("%d of %d resources were not applied", failed, len(file.Resources)))
+	case changes == 0:
+		fmt.Println("Everything matches the resources file; nothing to do.")
+	case dryRun:
+		fmt.Printf("%d change(s) would be made.\n", changes)
+	default:
+		fmt.Printf("Made %d change(s).\n", changes)
+	}
+	return nil
+}
+
+// applyResource creates or updates one resource and its targets and returns
+// the number of changes. A site that is only created in a dry run has ID 0.
+func applyResource(api *apiClient, org string, r declaredResource, existing map[string]existingResource, siteID int, domains []orgDomain, dryRun bool) (int, error) {
+	changes := 0
+	current, found := existing[r.Name]
+	var targets []existingTarget
+	if !found {
+		changes++
+		fmt.Printf("create resource %s (%s)\n", r.Name, r.resource.label())
+		if !dryRun {
+			body, err := resourceBody(r.resource, domains)
+			if err != nil {
+				return changes, err
+			}
+			if err := api.do("PUT", "/org/"+org+"/resource", body, &current); err != nil {
+				return changes, err
+			}
+		}
+		current.Enabled = true
+	} else {
+		if current.HTTP != r.resource.HTTP {
+			return changes, fmt.Errorf("an existing resource of that name is of another kind; rename or delete it")
+		}
+		update := map[string]any{}
+		if r.resource.HTTP && current.FullDomain != r.Domain {
+			domainID, subdomain, err := resourceDomain(r.Domain, domains)
+			if err != nil {
+				return changes, err
+			}
+			update["domainId"], update["subdomain"] = domainID, subdomain
+		}
+		if !r.resource.HTTP && current.ProxyPort != r.ProxyPort {
+			update["proxyPort"] = r.ProxyPort
+		}
+		if len(update) > 0 {
+			changes++
+			fmt.Printf("update resource %s (%s)\n", r.Name, r.resource.label())
+			if !dryRun {
+				if err := api.do("POST", fmt.Sprintf("/resource/%d", current.ResourceID), update, nil); err != nil {
+					return changes, err
+				}
+			}
+		}
+
+		var response struct {
+			Targets []existingTarget `json:"targets"`
+		}
+		if err := api.do("GET", fmt.Sprintf("/resource/%d/targets", current.ResourceID), nil, &response); err != nil {
+			return changes, err
+		}
+		targets = response.Targets
+	}
+
+	if r.Enabled != nil && *r.Enabled != current.Enabled {
+		changes++
+		if *r.Enabled {
+			fmt.Printf("enable resource %s\n", r.Name)
+		} else {
+			fmt.Printf("disable resource %s\n", r.Name)
+		}
+		if !dryRun {
+			if err := api.do("POST", fmt.Sprintf("/resource/%d", current.ResourceID), map[string]any{"enabled": *r.Enabled}, nil); err != nil {
+				return changes, err
+			}
+		}
+	}
+
+	// Targets are matched by site and address; changing one replaces it
+	matches := func(t existingTarget, want importedTarget) bool {
+		return t.SiteID == siteID && t.IP == want.Host && t.Port == want.Port && (want.Method == "" || t.Method == want.Method)
+	}
+	for _, want := range r.resource.Targets {
+		if slices.ContainsFunc(targets, func(t existingTarget) bool { return matches(t, want) }) {
+			continue
+		}
+		changes++
+		fmt.Printf("  add target %s\n", want)
+		if !dryRun {
+			if err := addResourceTarget(api, current.ResourceID, siteID, want); err != nil {
+				return changes, err
+			}
+		}
+	}
+	for _, t := range targets {
+		if slices.ContainsFunc(r.resource.Targets, func(want importedTarget) bool { return matches(t, want) }) {
+			continue
+		}
+		changes++
+		fmt.Printf("  remove target %s\n", net.JoinHostPort(t.IP, strconv.Itoa(t.Port)))
+		if !dryRun {
+			if err := api.do("DELETE", fmt.Sprintf("/target/%d", t.TargetID), nil, nil); err != nil {
+				return changes, err
+			}
+		}
+	}
+	return changes, nil
+}
+
+// loadResourcesFile reads and validates a resources file.
+func loadResourcesFile(path string) (*resourcesFile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading resources file: %w", err)
+	}
+	var file resourcesFile
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("error parsing resources file: %w", err)
+	}
+	if err := file.check(); err != nil {
+		return nil, err
+	}
+	return &file, nil
+}
+
+// check validates the file and translates its resources for the API.
+func (file *resourcesFile) check() error {
+	seen := map[string]bool{}
+	for _, site := range file.Sites {
+		if site.Name == "" {
+			return fmt.Errorf("a site has no name")
+		}
+	}
+	for i := range file.Resources {
+		r := &file.Resources[i]
+		if r.Name == "" {
+			return fmt.Errorf("resource %d has no name", i+1)
+		}
+		if seen[r.Name] {
+			return fmt.Errorf("resource %s is declared twice", r.Name)
+		}
+		seen[r.Name] = true
+		if r.Site == "" {
+			return fmt.Errorf("resource %s has no site", r.Name)
+		}
+		if (r.Domain == "") == (r.ProxyPort == 0) {
+			return fmt.Errorf("resource %s needs either a domain or a proxy_port", r.Name)
+		}
+
+		r.resource = importedResource{Name: r.Name, Hostname: r.Domain, HTTP: r.Domain != "", ProxyPort: r.ProxyPort, Protocol: "tcp"}
+		if !r.resource.HTTP {
+			switch r.Protocol {
+			case "", "tcp", "udp":
+				r.resource.Protocol = orUnknown(r.Protocol, "tcp")
+			default:
+				return fmt.Errorf("resource %s: protocol must be tcp or udp", r.Name)
+			}
+		}
+		for _, target := range r.Targets {
+			t, err := parseDeclaredTarget(target, r.resource.HTTP)
+			if err != nil {
+				return fmt.Errorf("resource %s: %v", r.Name, err)
+			}
+			r.resource.Targets = append(r.resource.Targets, t)
+		}
+	}
+	return nil
+}
+
+// parseDeclaredTarget parses a target of a resources file: a URL such as
+// http://10.0.0.5:3000 for HTTP resources and host:port otherwise.
+func parseDeclaredTarget(target string, http bool) (importedTarget, error) {
+	if http {
+		u, err := url.Parse(target)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" {
+			return importedTarget{}, fmt.Errorf("target %q is not an http or https URL", target)
+		}
+		port := map[string]int{"http": 80, "https": 443}[u.Scheme]
+		if p := u.Port(); p != "" {
+			port, _ = strconv.Atoi(p)
+		}
+		return importedTarget{Method: u.Scheme, Host: u.Hostname(), Port: port}, nil
+	}
+	host, p, err := net.SplitHostPort(target)
+	port, _ := strconv.Atoi(p)
+	if err != nil || host == "" || port == 0 {
+		return importedTarget{}, fmt.Errorf("target %q is not host:port", target)
+	}
+	return importedTarget{Host: host, Port: port}, nil
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/fosrl/pangolin/install/pkg/installer"
+)
+
+// badgerPrompts are the message keys of the prompts for the Badger options,
+// by answers file key.
+var badgerPrompts = map[string]string{
+	"badger_api_base_url":   "promptBadgerAPIBaseURL",
+	"badger_session_cookie": "promptBadgerSessionCookie",
+	"badger_session_param":  "promptBadgerSessionParam",
+	"badger_timeout":        "promptBadgerTimeout",
+}
+
+// collectBadgerOptions asks for the Badger settings, for setups where
+// Traefik reaches Pangolin at another address or other cookie names are
+// needed.
+func collectBadgerOptions(config *Config) {
+	if !readBool(msg("promptBadgerOptions"), false) {
+		return
+	}
+	fmt.Println(msg("badgerOptionsHint"))
+	for _, option := range installer.BadgerOptions {
+		value := option.Value(config)
+		*value = readOptionalString(msg(badgerPrompts[option.Key]), *value, localizedCheck(option.Check))
+	}
+}
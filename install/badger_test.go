@@ -0,0 +1,68 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// answerPrompts answers the questions asked in plain mode with lines, one
+// per question, and discards what the questions print.
+func answerPrompts(t *testing.T, lines ...string) {
+	t.Helper()
+	answers := filepath.Join(t.TempDir(), "answers")
+	if err := os.WriteFile(answers, []byte(strings.Join(lines, "\n")+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	stdin, err := os.Open(answers)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout, err := os.Create(os.DevNull)
+	if err != nil {
+		t.Fatal(err)
+	}
+	savedStdin, savedStdout := os.Stdin, os.Stdout
+	os.Stdin, os.Stdout, plainMode = stdin, stdout, true
+	t.Cleanup(func() {
+		os.Stdin, os.Stdout, plainMode = savedStdin, savedStdout, false
+		stdin.Close()
+		stdout.Close()
+	})
+}
+
+func TestCollectBadgerOptions(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		answers []string
+		want    Config
+	}{
+		{
+			name:    "empty answers keep the Badger defaults",
+			answers: []string{"y", "", "", "", ""},
+		},
+		{
+			name:    "one setting",
+			answers: []string{"y", "", "", "", "10s"},
+			want:    Config{BadgerTimeout: "10s"},
+		},
+		{
+			name:    "an invalid value is asked again",
+			answers: []string{"y", "pangolin:3001", "http://pangolin:3001", "", "", ""},
+			want:    Config{BadgerAPIBaseURL: "http://pangolin:3001"},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			answerPrompts(t, tt.answers...)
+			var config Config
+			collectBadgerOptions(&config)
+			if config.BadgerAPIBaseURL != tt.want.BadgerAPIBaseURL || config.BadgerSessionCookie != tt.want.BadgerSessionCookie ||
+				config.BadgerSessionParam != tt.want.BadgerSessionParam || config.BadgerTimeout != tt.want.BadgerTimeout {
+				t.Errorf("Badger options = %q, %q, %q, %q, want %q, %q, %q, %q",
+					config.BadgerAPIBaseURL, config.BadgerSessionCookie, config.BadgerSessionParam, config.BadgerTimeout,
+					tt.want.BadgerAPIBaseURL, tt.want.BadgerSessionCookie, tt.want.BadgerSessionParam, tt.want.BadgerTimeout)
+			}
+		})
+	}
+}
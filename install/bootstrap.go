@@ -0,0 +1,335 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/fosrl/pangolin/install/pkg/installer"
+)
+
+// cloudProvider creates servers through the API of a hosting provider.
+// Create registers the SSH public key if needed and returns the ID of the new
+// server; Address returns its public IPv4 address once it is running, or an
+// empty string before.
+type cloudProvider struct {
+	Label string
+	// TokenEnv is the environment variable the API token is read from when
+	// --token is not given
+	TokenEnv          string
+	DefaultServerType string
+	DefaultLocation   string
+	Create            func(token, name, serverType, location, publicKey string) (string, error)
+	Address           func(token, id string) (string, error)
+}
+
+var cloudProviders = map[string]cloudProvider{
+	"hetzner": {
+		Label:             "Hetzner Cloud",
+		TokenEnv:          "HCLOUD_TOKEN",
+		DefaultServerType: "cx22",
+		DefaultLocation:   "nbg1",
+		Create:            hetznerCreateServer,
+		Address:           hetznerServerAddress,
+	},
+	"digitalocean": {
+		Label:             "DigitalOcean",
+		TokenEnv:          "DIGITALOCEAN_TOKEN",
+		DefaultServerType: "s-1vcpu-2gb",
+		DefaultLocation:   "fra1",
+		Create:            digitalOceanCreateServer,
+		Address:           digitalOceanServerAddress,
+	},
+}
+
+// runBootstrap creates a server, points DNS at it and installs Pangolin on
+// it over SSH, from an answers file.
+func runBootstrap(args []string) error {
+	var names []string
+	for name := range cloudProviders {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	flags := flag.NewFlagSet("bootstrap", flag.ExitOnError)
+	answersPath := flags.String("answers", "", "Path to the YAML answers file (required)")
+	providerName := flags.String("provider", "hetzner", "Hosting provider to create the server at: "+strings.Join(names, ", "))
+	token := flags.String("token", "", "API token of the hosting provider (default: from HCLOUD_TOKEN or DIGITALOCEAN_TOKEN)")
+	name := flags.String("name", "pangolin", "Name of the server")
+	serverType := flags.String("server-type", "", "Server type or size (default: the provider's smallest with 2 GB of memory)")
+	location := flags.String("location", "", "Location or region of the server")
+	sshKey := flags.String("ssh-key", "~/.ssh/id_ed25519", "Private SSH key; its .pub file is installed on the server")
+	dnsProviderName := flags.String("dns-provider", "", "DNS provider to create the records at: "+strings.Join(dnsProviderNames(), ", ")+" (default: print the records to create by hand)")
+	dnsToken := flags.String("dns-token", "", "Credential of the DNS provider")
+	dir := flags.String("dir", defaultInstallDir, "Installation directory on the server")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	provider, ok := cloudProviders[*providerName]
+	if !ok {
+		return fmt.Errorf("unknown provider %q: use %s", *providerName, strings.Join(names, ", "))
+	}
+	if *token == "" {
+		*token = os.Getenv(provider.TokenEnv)
+	}
+	if *token == "" {
+		return usageErrorf("--token or %s is required", provider.TokenEnv)
+	}
+	var dnsProvider dnsProvider
+	if *dnsProviderName != "" {
+		if dnsProvider, ok = dnsProviders[*dnsProviderName]; !ok {
+			return fmt.Errorf("unknown DNS provider %q: use %s", *dnsProviderName, strings.Join(dnsProviderNames(), ", "))
+		}
+		if *dnsToken == "" {
+			return usageErrorf("--dns-token is required with --dns-provider")
+		}
+	}
+	if *serverType == "" {
+		*serverType = provider.DefaultServerType
+	}
+	if *location == "" {
+		*location = provider.DefaultLocation
+	}
+
+	config, err := loadProvisioningAnswers(*answersPath)
+	if err != nil {
+		return err
+	}
+	keyPath, err := expandPath(*sshKey)
+	if err != nil {
+		return err
+	}
+	publicKey, err := os.ReadFile(keyPath + ".pub")
+	if err != nil {
+		return fmt.Errorf("failed to read the SSH public key: %v", err)
+	}
+
+	fmt.Printf("Creating %s server %s (%s in %s)...\n", provider.Label, *name, *serverType, *location)
+	id, err := provider.Create(*token, *name, *serverType, *location, strings.TrimSpace(string(publicKey)))
+	if err != nil {
+		return fmt.Errorf("failed to create the server: %v", err)
+	}
+	var ip string
+	running := waitUntil(waitTimeout, func() bool {
+		ip, err = provider.Address(*token, id)
+		return err != nil || ip != ""
+	})
+	if err != nil {
+		return fmt.Errorf("failed to get the server's address: %v", err)
+	}
+	if !running {
+		return fmt.Errorf("server %s was not running within %v", id, waitTimeout)
+	}
+	fmt.Printf("Server %s is running at %s.\n", *name, ip)
+
+	// The records have to resolve before the stack starts, or Let's
+	// Encrypt fails its first attempts for the dashboard
+	fmt.Println("\n=== " + msg("sectionDNSRecords") + " ===")
+	records := installer.DNSRecordsTo(config, []string{ip})
+	if *dnsProviderName == "" {
+		checkDNSRecordsByHand(records)
+	} else {
+		for _, r := range records {
+			if err := dnsProvider.Upsert(*dnsToken, r.Name, r.Type, r.Value); err != nil {
+				return fmt.Errorf("failed to create the %s %s record: %v", r.Name, r.Type, err)
+			}
+			fmt.Println(msg("dnsRecordCreated", r.Name, r.Type, r.Value))
+		}
+		fmt.Println(msg("dnsWaitingForPropagation"))
+		if waitUntil(waitTimeout, func() bool { return installer.DNSRecordsPropagated(records) }) {
+			fmt.Println(msg("dnsPropagated"))
+		} else {
+			fmt.Println(msg("dnsNotPropagated", waitTimeout))
+		}
+	}
+
+	fmt.Println("\n=== Installing Pangolin over SSH ===")
+	ssh := func(command string, stdin []byte) *exec.Cmd {
+		cmd := exec.Command("ssh", "-i", keyPath, "-o", "BatchMode=yes", "-o", "StrictHostKeyChecking=accept-new",
+			"-o", "ConnectTimeout=5", "root@"+ip, command)
+		if stdin != nil {
+			cmd.Stdin = bytes.NewReader(stdin)
+		}
+		return cmd
+	}
+	if !waitUntil(waitTimeout, func() bool { return ssh("true", nil).Run() == nil }) {
+		return fmt.Errorf("could not connect to root@%s over SSH within %v", ip, waitTimeout)
+	}
+
+	answers, err := yaml.Marshal(config)
+	if err != nil {
+		return err
+	}
+	answersFile := shellQuote(path.Join(*dir, "answers.yml"))
+	upload := fmt.Sprintf("mkdir -p %s && umask 077 && cat > %s", shellQuote(*dir), answersFile)
+	if out, err := ssh(upload, answers).CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to copy the answers file: %v: %s", err, strings.TrimSpace(string(out)))
+	}
+
+	// cloud-init of the image may still hold the package manager lock
+	commands := []string{
+		"cloud-init status --wait >/dev/null 2>&1 || true",
+		"apt-get update && DEBIAN_FRONTEND=noninteractive apt-get install -y " + strings.Join(provisionPackages(config), " "),
+	}
+	commands = append(commands, provisionCommands(config, *dir)...)
+	install := ssh("set -e; "+strings.Join(commands, "; "), nil)
+	install.Stdout, install.Stderr = os.Stdout, os.Stderr
+	if err := install.Run(); err != nil {
+		return fmt.Errorf("the install on the server failed: %v", err)
+	}
+
+	fmt.Printf("\nPangolin is running on %s. Get the setup token with:\n", ip)
+	fmt.Printf("  ssh root@%s %s logs pangolin 2>&1 | grep -A 2 'SETUP TOKEN'\n", ip, config.InstallationContainerType)
+	fmt.Printf("then finish the setup at https://%s/auth/initial-setup\n", config.DashboardDomain)
+	return nil
+}
+
+const hetznerCloudAPI = "https://api.hetzner.cloud/v1"
+
+func hetznerCreateServer(token, name, serverType, location, publicKey string) (string, error) {
+	headers := map[string]string{"Authorization": "Bearer " + token}
+
+	var keys struct {
+		SSHKeys []struct {
+			ID        int64  `json:"id"`
+			PublicKey string `json:"public_key"`
+		} `json:"ssh_keys"`
+	}
+	if err := jsonRequest("GET", hetznerCloudAPI+"/ssh_keys?per_page=50", headers, nil, &keys); err != nil {
+		return "", err
+	}
+	var keyID int64
+	for _, key := range keys.SSHKeys {
+		if sameSSHKey(key.PublicKey, publicKey) {
+			keyID = key.ID
+		}
+	}
+	if keyID == 0 {
+		var created struct {
+			SSHKey struct {
+				ID int64 `json:"id"`
+			} `json:"ssh_key"`
+		}
+		if err := jsonRequest("POST", hetznerCloudAPI+"/ssh_keys", headers, map[string]any{"name": name, "public_key": publicKey}, &created); err != nil {
+			return "", err
+		}
+		keyID = created.SSHKey.ID
+	}
+
+	var server struct {
+		Server struct {
+			ID int64 `json:"id"`
+		} `json:"server"`
+	}
+	body := map[string]any{"name": name, "server_type": serverType, "location": location, "image": "ubuntu-24.04", "ssh_keys": []int64{keyID}}
+	if err := jsonRequest("POST", hetznerCloudAPI+"/servers", headers, body, &server); err != nil {
+		return "", err
+	}
+	return strconv.FormatInt(server.Server.ID, 10), nil
+}
+
+func hetznerServerAddress(token, id string) (string, error) {
+	var server struct {
+		Server struct {
+			Status    string `json:"status"`
+			PublicNet struct {
+				IPv4 struct {
+					IP string `json:"ip"`
+				} `json:"ipv4"`
+			} `json:"public_net"`
+		} `json:"server"`
+	}
+	if err := jsonRequest("GET", hetznerCloudAPI+"/servers/"+id, map[string]string{"Authorization": "Bearer " + token}, nil, &server); err != nil {
+		return "", err
+	}
+	if server.Server.Status != "running" {
+		return "", nil
+	}
+	return server.Server.PublicNet.IPv4.IP, nil
+}
+
+const digitalOceanAPI = "https://api.digitalocean.com/v2"
+
+func digitalOceanCreateServer(token, name, size, region, publicKey string) (string, error) {
+	headers := map[string]string{"Authorization": "Bearer " + token}
+
+	var keys struct {
+		SSHKeys []struct {
+			ID        int64  `json:"id"`
+			PublicKey string `json:"public_key"`
+		} `json:"ssh_keys"`
+	}
+	if err := jsonRequest("GET", digitalOceanAPI+"/account/keys?per_page=200", headers, nil, &keys); err != nil {
+		return "", err
+	}
+	var keyID int64
+	for _, key := range keys.SSHKeys {
+		if sameSSHKey(key.PublicKey, publicKey) {
+			keyID = key.ID
+		}
+	}
+	if keyID == 0 {
+		var created struct {
+			SSHKey struct {
+				ID int64 `json:"id"`
+			} `json:"ssh_key"`
+		}
+		if err := jsonRequest("POST", digitalOceanAPI+"/account/keys", headers, map[string]any{"name": name, "public_key": publicKey}, &created); err != nil {
+			return "", err
+		}
+		keyID = created.SSHKey.ID
+	}
+
+	var droplet struct {
+		Droplet struct {
+			ID int64 `json:"id"`
+		} `json:"droplet"`
+	}
+	body := map[string]any{"name": name, "size": size, "region": region, "image": "ubuntu-24-04-x64", "ssh_keys": []int64{keyID}}
+	if err := jsonRequest("POST", digitalOceanAPI+"/droplets", headers, body, &droplet); err != nil {
+		return "", err
+	}
+	return strconv.FormatInt(droplet.Droplet.ID, 10), nil
+}
+
+func digitalOceanServerAddress(token, id string) (string, error) {
+	var droplet struct {
+		Droplet struct {
+			Status   string `json:"status"`
+			Networks struct {
+				V4 []struct {
+					IPAddress string `json:"ip_address"`
+					Type      string `json:"type"`
+				} `json:"v4"`
+			} `json:"networks"`
+		} `json:"droplet"`
+	}
+	if err := jsonRequest("GET", digitalOceanAPI+"/droplets/"+id, map[string]string{"Authorization": "Bearer " + token}, nil, &droplet); err != nil {
+		return "", err
+	}
+	if droplet.Droplet.Status != "active" {
+		return "", nil
+	}
+	for _, network := range droplet.Droplet.Networks.V4 {
+		if network.Type == "public" {
+			return network.IPAddress, nil
+		}
+	}
+	return "", nil
+}
+
+// sameSSHKey compares two authorized_keys lines by type and key, ignoring
+// the comments.
+func sameSSHKey(a, b string) bool {
+	fa, fb := strings.Fields(a), strings.Fields(b)
+	return len(fa) >= 2 && len(fb) >= 2 && fa[0] == fb[0] && fa[1] == fb[1]
+}
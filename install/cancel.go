@@ -0,0 +1,154 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"slices"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Interrupt handling. SIGINT and SIGTERM stop the child processes the
+// installer started, undo any cleanup tasks registered for the step in
+// progress and print how to resume, so an interrupted install never leaves a
+// half-written config/ tree that looks like a finished installation.
+var (
+	interruptMu  sync.Mutex
+	cleanupTasks []cleanupTask
+	nextTaskID   int
+	runningCmds  = map[*exec.Cmd]struct{}{}
+	// subcommand is the subcommand being run, "" for the install.
+	subcommand string
+	// resumeHint is printed when the install is cancelled, "" for the
+	// default one.
+	resumeHint string
+)
+
+type cleanupTask struct {
+	id  int
+	run func()
+}
+
+// handleInterrupts installs the SIGINT/SIGTERM handler. Interactive prompts
+// put the terminal in raw mode and report Ctrl-C through handleAbort instead.
+func handleInterrupts() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+		sig := <-signals
+		signal.Stop(signals)
+		fmt.Printf("\nReceived %v, stopping...\n", sig)
+		stopRunningCommands(sig)
+		cancelRun()
+		os.Exit(exitInterrupted)
+	}()
+}
+
+// cancelRun runs the registered cleanup tasks, newest first, and reports
+// what was cancelled: the subcommand, or the install and how to resume it.
+func cancelRun() {
+	interruptMu.Lock()
+	tasks := cleanupTasks
+	cleanupTasks = nil
+	command, hint := subcommand, resumeHint
+	interruptMu.Unlock()
+
+	for i := len(tasks) - 1; i >= 0; i-- {
+		tasks[i].run()
+	}
+
+	if command != "" {
+		fmt.Println(msg("commandCancelled", command))
+		return
+	}
+	if hint == "" {
+		hint = msg("installResumeHint")
+	}
+	fmt.Println(msg("installCancelled"))
+	fmt.Println(hint)
+}
+
+// onInterrupt registers a cleanup task to run if the installer is cancelled
+// and returns a function that unregisters it once the step has completed.
+func onInterrupt(run func()) (done func()) {
+	interruptMu.Lock()
+	defer interruptMu.Unlock()
+
+	nextTaskID++
+	id := nextTaskID
+	cleanupTasks = append(cleanupTasks, cleanupTask{id: id, run: run})
+
+	return func() {
+		interruptMu.Lock()
+		defer interruptMu.Unlock()
+		cleanupTasks = slices.DeleteFunc(cleanupTasks, func(t cleanupTask) bool { return t.id == id })
+	}
+}
+
+// setResumeHint sets the message printed when the install is cancelled.
+func setResumeHint(hint string) {
+	interruptMu.Lock()
+	defer interruptMu.Unlock()
+	resumeHint = hint
+}
+
+// setSubcommand records the subcommand being run, which is reported when it
+// is cancelled.
+func setSubcommand(name string) {
+	interruptMu.Lock()
+	defer interruptMu.Unlock()
+	subcommand = name
+}
+
+// runCommand runs cmd and tracks it so an interrupt can stop it.
+func runCommand(cmd *exec.Cmd) error {
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	interruptMu.Lock()
+	runningCmds[cmd] = struct{}{}
+	interruptMu.Unlock()
+
+	err := cmd.Wait()
+
+	interruptMu.Lock()
+	delete(runningCmds, cmd)
+	interruptMu.Unlock()
+
+	return err
+}
+
+// stopRunningCommands forwards sig to the tracked child processes and gives
+// them a few seconds to exit before killing them.
+func stopRunningCommands(sig os.Signal) {
+	interruptMu.Lock()
+	cmds := make([]*exec.Cmd, 0, len(runningCmds))
+	for cmd := range runningCmds {
+		cmds = append(cmds, cmd)
+	}
+	interruptMu.Unlock()
+
+	for _, cmd := range cmds {
+		_ = cmd.Process.Signal(sig)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		interruptMu.Lock()
+		remaining := len(runningCmds)
+		interruptMu.Unlock()
+		if remaining == 0 {
+			return
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	for _, cmd := range cmds {
+		_ = cmd.Process.Kill()
+	}
+}
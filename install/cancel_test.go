@@ -0,0 +1,61 @@
+package main
+
+import (
+	"io"
+	"os"
+	"strings"
+	"testing"
+)
+
+// TestCancelMessage checks that a cancelled subcommand is reported as such
+// and only a cancelled install as an install with how to resume it.
+func TestCancelMessage(t *testing.T) {
+	if err := setLanguage(defaultLanguage); err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		subcommand string
+		want       string
+		unwanted   string
+	}{
+		{"", "Installation cancelled.\nRun the installer again to start over.\n", ""},
+		{"upgrade", "The upgrade command was cancelled.\n", "Installation"},
+	} {
+		t.Run(tt.subcommand, func(t *testing.T) {
+			setSubcommand(tt.subcommand)
+			setResumeHint("")
+			t.Cleanup(func() { setSubcommand("") })
+			cleaned := false
+			onInterrupt(func() { cleaned = true })
+
+			got := captureStdout(t, cancelRun)
+			if !cleaned {
+				t.Error("the cleanup task did not run")
+			}
+			if got != tt.want {
+				t.Errorf("printed %q, want %q", got, tt.want)
+			}
+			if tt.unwanted != "" && strings.Contains(got, tt.unwanted) {
+				t.Errorf("printed %q, which mentions %q", got, tt.unwanted)
+			}
+		})
+	}
+}
+
+func captureStdout(t *testing.T, run func()) string {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	saved := os.Stdout
+	os.Stdout = w
+	run()
+	os.Stdout = saved
+	w.Close()
+	out, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(out)
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// traefikDefaultCertCN is the subject of the self-signed certificate Traefik
+// serves until it has obtained a real one.
+const traefikDefaultCertCN = "TRAEFIK DEFAULT CERT"
+
+// acmeHints map fragments of ACME errors in Traefik's logs to remediation
+// hints.
+var acmeHints = []struct {
+	fragments []string
+	hint      string
+}{
+	{
+		[]string{"rateLimited", "too many certificates", "too many failed authorizations"},
+		"Let's Encrypt rate limits were hit. Wait for the limit to reset (see https://letsencrypt.org/docs/rate-limits/) and avoid reinstalling repeatedly in the meantime.",
+	},
+	{
+		[]string{"NXDOMAIN", "DNS problem", "no valid A records", "no valid AAAA records"},
+		"Let's Encrypt could not resolve the domain. Check that the A (and AAAA, if any) records of the domain point to this server's public IP.",
+	},
+	{
+		[]string{"Timeout during connect", "Connection refused", "Fetching http://", "connection reset"},
+		"Let's Encrypt could not reach this server on port 80. Open TCP port 80 in the firewall of the server and of your provider.",
+	},
+	{
+		[]string{"unauthorized", "Invalid response from"},
+		"Let's Encrypt reached a different server than this one. Check the DNS records and any proxy (such as Cloudflare) in front of the domain.",
+	},
+}
+
+// fetchServedCertificate returns the certificate Traefik serves for domain
+// on the local HTTPS port.
+func fetchServedCertificate(domain string, port int) (*x509.Certificate, error) {
+	dialer := &net.Dialer{Timeout: 5 * time.Second}
+	conn, err := tls.DialWithDialer(dialer, "tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(port)), &tls.Config{
+		ServerName:         domain,
+		InsecureSkipVerify: true, // inspected below; the default cert is expected until issuance
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	certs := conn.ConnectionState().PeerCertificates
+	if len(certs) == 0 {
+		return nil, fmt.Errorf("no certificate presented")
+	}
+	return certs[0], nil
+}
+
+// isIssuedCertificate reports whether cert is a real certificate for domain
+// rather than Traefik's default one.
+func isIssuedCertificate(cert *x509.Certificate, domain string) bool {
+	return cert.Subject.CommonName != traefikDefaultCertCN && cert.VerifyHostname(domain) == nil
+}
+
+// printCertificate shows the issuer and validity of a certificate.
+func printCertificate(cert *x509.Certificate) {
+	fmt.Printf("Issuer:  %s\n", cert.Issuer.String())
+	fmt.Printf("Domains: %s\n", strings.Join(cert.DNSNames, ", "))
+	fmt.Printf("Expires: %s (in %d days)\n", cert.NotAfter.Format(time.RFC1123), int(time.Until(cert.NotAfter).Hours()/24))
+}
+
+// verifyCertificate waits until Traefik serves a certificate for the
+// dashboard domain and prints it. On failure it reports the ACME error from
+// Traefik's logs along with remediation hints.
+func verifyCertificate(containerType SupportedContainer, domain string, port int) error {
+	fmt.Println("\n=== Certificate ===")
+	fmt.Printf("Waiting for Traefik to obtain a certificate for %s...\n", domain)
+
+	var cert *x509.Certificate
+	issued := waitUntil(waitTimeout, func() bool {
+		served, err := fetchServedCertificate(domain, port)
+		if err != nil {
+			return false
+		}
+		cert = served
+		return isIssuedCertificate(served, domain)
+	})
+
+	if issued {
+		fmt.Println("Certificate obtained.")
+		printCertificate(cert)
+		recordACMEAttempt(domain, cert, "")
+		return nil
+	}
+
+	acmeError := lastACMEError(containerLogTail(containerType, serviceContainer("traefik"), 200))
+	recordACMEAttempt(domain, nil, acmeError)
+	if acmeError != "" {
+		fmt.Printf("Traefik reported: %s\n", acmeError)
+	}
+	for _, hint := range acmeHintsFor(acmeError) {
+		fmt.Println("- " + hint)
+	}
+	return fmt.Errorf("no certificate for %s was obtained within %v", domain, waitTimeout)
+}
+
+// lastACMEError returns the last ACME related error line in Traefik's logs.
+func lastACMEError(logs string) string {
+	lines := strings.Split(logs, "\n")
+	for i := len(lines) - 1; i >= 0; i-- {
+		line := lines[i]
+		if (strings.Contains(line, "acme") || strings.Contains(line, "ACME")) &&
+			(strings.Contains(line, "error") || strings.Contains(line, "ERR")) {
+			return strings.TrimSpace(line)
+		}
+	}
+	return ""
+}
+
+// acmeHintsFor returns the hints matching an ACME error, or all of them if
+// the error is unknown.
+func acmeHintsFor(acmeError string) []string {
+	var hints, all []string
+	for _, h := range acmeHints {
+		all = append(all, h.hint)
+		for _, fragment := range h.fragments {
+			if strings.Contains(acmeError, fragment) {
+				hints = append(hints, h.hint)
+				break
+			}
+		}
+	}
+	if len(hints) == 0 {
+		return all
+	}
+	return hints
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+const defaultACMEStorage = "config/letsencrypt/acme.json"
+
+// Traefik renews certificates 30 days before they expire. A certificate with
+// less time left than renewalOverdue has missed its renewal.
+const (
+	renewalOverdue = 25 * 24 * time.Hour
+	expiryCritical = 7 * 24 * time.Hour
+)
+
+// acmeStore is the layout of Traefik's acme.json: one entry per certificate
+// resolver.
+type acmeStore map[string]struct {
+	Certificates []struct {
+		Domain struct {
+			Main string   `json:"main"`
+			SANs []string `json:"sans"`
+		} `json:"domain"`
+		Certificate string `json:"certificate"`
+	} `json:"Certificates"`
+}
+
+// storedCertificate is a certificate found in acme.json.
+type storedCertificate struct {
+	Resolver string
+	Domains  []string
+	Cert     *x509.Certificate
+}
+
+// runCertStatus lists the certificates Traefik has obtained with their
+// expiry, and warns about certificates that should have been renewed.
+func runCertStatus(args []string) error {
+	flags := flag.NewFlagSet("cert-status", flag.ExitOnError)
+	dir := flags.String("dir", "", "Installation directory")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if err := enterInstallDir(*dir); err != nil {
+		return err
+	}
+
+	var certs []storedCertificate
+	for _, file := range acmeStorageFiles() {
+		found, err := readACMECertificates(file)
+		if err != nil {
+			return err
+		}
+		certs = append(certs, found...)
+	}
+
+	if len(certs) == 0 {
+		fmt.Println("No certificates have been obtained yet.")
+		return nil
+	}
+
+	slices.SortFunc(certs, func(a, b storedCertificate) int {
+		return a.Cert.NotAfter.Compare(b.Cert.NotAfter)
+	})
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "DOMAIN\tRESOLVER\tISSUER\tEXPIRES\tDAYS LEFT")
+	var overdue []storedCertificate
+	for _, c := range certs {
+		left := time.Until(c.Cert.NotAfter)
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\n",
+			strings.Join(c.Domains, ", "), c.Resolver, c.Cert.Issuer.CommonName,
+			c.Cert.NotAfter.Format("2006-01-02"), int(left.Hours()/24))
+		if left < renewalOverdue {
+			overdue = append(overdue, c)
+		}
+	}
+	w.Flush()
+
+	if len(overdue) == 0 {
+		return nil
+	}
+
+	fmt.Println()
+	for _, c := range overdue {
+		left := time.Until(c.Cert.NotAfter)
+		switch {
+		case left <= 0:
+			fmt.Printf("Error: the certificate for %s expired on %s.\n", c.Domains[0], c.Cert.NotAfter.Format("2006-01-02"))
+		case left < expiryCritical:
+			fmt.Printf("Error: the certificate for %s expires in %d days and has not been renewed.\n", c.Domains[0], int(left.Hours()/24))
+		default:
+			fmt.Printf("Warning: the certificate for %s should have been renewed by now.\n", c.Domains[0])
+		}
+	}
+
+	if containerType := detectContainerType(); containerType != Undefined {
+		if acmeError := lastACMEError(containerLogTail(containerType, serviceContainer("traefik"), 500)); acmeError != "" {
+			fmt.Printf("Last ACME error from Traefik: %s\n", acmeError)
+			for _, hint := range acmeHintsFor(acmeError) {
+				fmt.Println("- " + hint)
+			}
+		}
+	}
+
+	return fmt.Errorf("%d certificate(s) are not renewing", len(overdue))
+}
+
+// acmeStorageFiles returns the host paths of the ACME storage files of all
+// certificate resolvers in the Traefik static config.
+func acmeStorageFiles() []string {
+	var files []string
+
+	mounts := []bindMount{{Source: "config/letsencrypt", Target: "/letsencrypt"}}
+	if data, err := os.ReadFile(composeFile); err == nil {
+		var compose map[string]any
+		if yaml.Unmarshal(data, &compose) == nil {
+			if found := composeBindMounts(compose, "traefik"); len(found) > 0 {
+				mounts = found
+			}
+		}
+	}
+
+	if data, err := os.ReadFile(traefikStaticFile); err == nil {
+		var static map[string]any
+		if yaml.Unmarshal(data, &static) == nil {
+			for _, name := range mapKeys(static, "certificatesResolvers") {
+				storage, ok := lookupString(static, "certificatesResolvers", name, "acme", "storage")
+				if !ok {
+					continue
+				}
+				if hostPath, mounted := hostPathFor(mounts, storage); mounted && !slices.Contains(files, hostPath) {
+					files = append(files, hostPath)
+				}
+			}
+		}
+	}
+
+	if len(files) == 0 {
+		files = append(files, defaultACMEStorage)
+	}
+	return files
+}
+
+// readACMECertificates decodes the certificates in an acme.json file.
+func readACMECertificates(file string) ([]storedCertificate, error) {
+	data, err := os.ReadFile(file)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %v", file, err)
+	}
+	if len(strings.TrimSpace(string(data))) == 0 {
+		return nil, nil
+	}
+
+	var store acmeStore
+	if err := json.Unmarshal(data, &store); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %v", file, err)
+	}
+
+	var certs []storedCertificate
+	for _, resolver := range sortedKeys(store) {
+		for _, entry := range store[resolver].Certificates {
+			pemData, err := base64.StdEncoding.DecodeString(entry.Certificate)
+			if err != nil {
+				return nil, fmt.Errorf("%s: invalid certificate for %s: %v", file, entry.Domain.Main, err)
+			}
+			block, _ := pem.Decode(pemData)
+			if block == nil {
+				return nil, fmt.Errorf("%s: invalid certificate for %s", file, entry.Domain.Main)
+			}
+			cert, err := x509.ParseCertificate(block.Bytes)
+			if err != nil {
+				return nil, fmt.Errorf("%s: invalid certificate for %s: %v", file, entry.Domain.Main, err)
+			}
+			certs = append(certs, storedCertificate{
+				Resolver: resolver,
+				Domains:  append([]string{entry.Domain.Main}, entry.Domain.SANs...),
+				Cert:     cert,
+			})
+		}
+	}
+	return certs, nil
+}
@@ -0,0 +1,283 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// containerDetails is the subset of `docker inspect` and `podman inspect`
+// output that check compares with the configuration.
+type containerDetails struct {
+	Image  string `json:"Image"`
+	Mounts []struct {
+		Type        string `json:"Type"`
+		Source      string `json:"Source"`
+		Destination string `json:"Destination"`
+	} `json:"Mounts"`
+}
+
+// checkReport collects the results of check, one line per finding.
+type checkReport struct {
+	drift int
+}
+
+func (r *checkReport) ok(format string, args ...any) {
+	fmt.Printf("ok       "+format+"\n", args...)
+}
+
+func (r *checkReport) mismatch(format string, args ...any) {
+	r.drift++
+	fmt.Printf("drift    "+format+"\n", args...)
+}
+
+func (r *checkReport) skip(format string, args ...any) {
+	fmt.Printf("skip     "+format+"\n", args...)
+}
+
+// runCheck compares the running installation with what its stored answers
+// describe: the rendered config files, the enabled profiles, the containers
+// and the images they run, config changes made after a container started
+// and the published ports. It changes nothing and exits with exitDrift on a
+// mismatch, for monitoring and for audits before a change.
+func runCheck(args []string) error {
+	flags := flag.NewFlagSet("check", flag.ExitOnError)
+	dir := flags.String("dir", "", "Installation directory")
+	answersPath := flags.String("answers", storedAnswersFile, "Answers file to check against, relative to the installation directory")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if err := enterInstallDir(*dir); err != nil {
+		return err
+	}
+	config, err := loadStoredAnswers(*answersPath)
+	if err != nil {
+		return err
+	}
+	containerType := detectContainerType()
+	if containerType == Undefined {
+		return preflightErrorf("could not detect the container runtime of the installation")
+	}
+
+	plan, err := planConverge(config, containerType)
+	if err != nil {
+		return err
+	}
+
+	report := &checkReport{}
+	checkConfigFiles(report, plan)
+	if plan.Profile != "" {
+		report.mismatch("profile %s is not enabled", plan.Profile)
+	}
+
+	services, err := composeServices(composeFile)
+	if err != nil {
+		return err
+	}
+	images, err := composeImages(composeFile)
+	if err != nil {
+		return err
+	}
+	for _, service := range services {
+		checkContainer(report, containerType, service, images[service.Name], plan.Managed)
+	}
+	checkPorts(report, containerType, config, services)
+
+	if report.drift > 0 {
+		return withExitCode(exitDrift, fmt.Errorf("%d difference(s) from %s; run `installer apply` to converge", report.drift, *answersPath))
+	}
+	fmt.Println("The installation matches the answers.")
+	return nil
+}
+
+// checkConfigFiles reports the rendered files whose contents differ from the
+// installed ones.
+func checkConfigFiles(report *checkReport, plan *convergePlan) {
+	for _, path := range plan.Managed {
+		rendered, drifted := plan.Files[path]
+		switch {
+		case slices.Contains(plan.Unmanaged, path):
+			report.skip("%s (changed by the CrowdSec setup)", path)
+		case !drifted:
+			report.ok("%s", path)
+		default:
+			installed, err := os.ReadFile(path)
+			if err != nil {
+				report.mismatch("%s is missing", path)
+				continue
+			}
+			report.mismatch("%s has sha256 %s, the answers render %s", path, shortHash(installed), shortHash(rendered))
+		}
+	}
+}
+
+func shortHash(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])[:12]
+}
+
+// checkContainer reports whether a service runs, whether it runs the image
+// its compose entry names as currently pulled, and whether a config file it
+// mounts changed after it started, which it would not have read yet.
+func checkContainer(report *checkReport, containerType SupportedContainer, service composeService, image string, managed []string) {
+	state, err := inspectContainer(containerType, service.Container)
+	if err != nil || !state.Running {
+		report.mismatch("%s is not running", service.Name)
+		return
+	}
+	details, err := inspectContainerDetails(containerType, service.Container)
+	if err != nil {
+		report.mismatch("%s: %v", service.Name, err)
+		return
+	}
+
+	if image != "" {
+		want, err := imageID(containerType, image)
+		switch {
+		case err != nil:
+			report.mismatch("%s: image %s is not pulled", service.Name, image)
+		case normalizeImageID(details.Image) != want:
+			report.mismatch("%s runs image %s, %s is %s; recreate it", service.Name, shortImageID(details.Image), image, shortImageID(want))
+		default:
+			report.ok("%s runs %s (%s)", service.Name, image, shortImageID(want))
+		}
+	}
+
+	cwd, err := os.Getwd()
+	if err != nil {
+		return
+	}
+	for _, mount := range details.Mounts {
+		if mount.Type != "bind" {
+			continue
+		}
+		for _, path := range managed {
+			abs := filepath.Join(cwd, filepath.FromSlash(path))
+			if abs != mount.Source && !strings.HasPrefix(abs, mount.Source+string(filepath.Separator)) {
+				continue
+			}
+			info, err := os.Stat(path)
+			if err == nil && info.ModTime().After(state.StartedAt) {
+				report.mismatch("%s changed after %s started; restart it to load the change", path, service.Name)
+			}
+		}
+	}
+}
+
+func inspectContainerDetails(containerType SupportedContainer, container string) (containerDetails, error) {
+	out, err := containerCommand(containerType, "inspect", "--format", "{{json .}}", container).Output()
+	if err != nil {
+		return containerDetails{}, fmt.Errorf("failed to inspect container %s: %v", container, err)
+	}
+	var details containerDetails
+	if err := json.Unmarshal(out, &details); err != nil {
+		return containerDetails{}, fmt.Errorf("failed to parse container %s: %v", container, err)
+	}
+	return details, nil
+}
+
+// imageID returns the ID of the local image a reference points to.
+func imageID(containerType SupportedContainer, image string) (string, error) {
+	out, err := containerCommand(containerType, "image", "inspect", "--format", "{{.Id}}", image).Output()
+	if err != nil {
+		return "", err
+	}
+	return normalizeImageID(strings.TrimSpace(string(out))), nil
+}
+
+// normalizeImageID strips the digest algorithm Docker prefixes image IDs
+// with and Podman leaves out.
+func normalizeImageID(id string) string {
+	return strings.TrimPrefix(id, "sha256:")
+}
+
+func shortImageID(id string) string {
+	id = normalizeImageID(id)
+	if len(id) > 12 {
+		return id[:12]
+	}
+	return id
+}
+
+// composeImages returns the image of each service in the compose file.
+func composeImages(composePath string) (map[string]string, error) {
+	data, err := os.ReadFile(composePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %v", composePath, err)
+	}
+	var compose struct {
+		Services map[string]struct {
+			Image string `yaml:"image"`
+		} `yaml:"services"`
+	}
+	if err := yaml.Unmarshal(data, &compose); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %v", composePath, err)
+	}
+	images := map[string]string{}
+	for name, service := range compose.Services {
+		images[name] = service.Image
+	}
+	return images, nil
+}
+
+// checkPorts reports whether the ports of the answers are published by the
+// container that serves them: Gerbil when it is installed, which Traefik
+// shares its network with, and Traefik otherwise.
+func checkPorts(report *checkReport, containerType SupportedContainer, config Config, services []composeService) {
+	name := "traefik"
+	expected := []string{fmt.Sprintf("%d/tcp", config.HTTPPort), fmt.Sprintf("%d/tcp", config.HTTPSPort)}
+	if config.InstallGerbil {
+		name = "gerbil"
+		expected = append(expected, fmt.Sprintf("%d/udp", config.WireGuardPort), fmt.Sprintf("%d/udp", config.ClientsWireGuardPort))
+	}
+	index := slices.IndexFunc(services, func(s composeService) bool { return s.Name == name })
+	if index < 0 {
+		report.mismatch("%s is not in %s", name, composeFile)
+		return
+	}
+
+	out, err := containerCommand(containerType, "port", services[index].Container).Output()
+	if err != nil {
+		report.mismatch("could not read the ports of %s: %v", name, err)
+		return
+	}
+	published := publishedPorts(string(out))
+	for _, port := range expected {
+		if slices.Contains(published, port) {
+			report.ok("port %s published by %s", port, name)
+		} else {
+			report.mismatch("port %s is not published by %s", port, name)
+		}
+	}
+}
+
+// publishedPorts parses `docker port` output, lines such as
+// "443/tcp -> 0.0.0.0:8443", into host ports with their protocol.
+func publishedPorts(output string) []string {
+	var ports []string
+	for _, line := range strings.Split(output, "\n") {
+		container, host, ok := strings.Cut(strings.TrimSpace(line), " -> ")
+		if !ok {
+			continue
+		}
+		_, proto, _ := strings.Cut(container, "/")
+		if proto == "" {
+			proto = "tcp"
+		}
+		hostPort := host[strings.LastIndex(host, ":")+1:]
+		port := hostPort + "/" + proto
+		if !slices.Contains(ports, port) {
+			ports = append(ports, port)
+		}
+	}
+	return ports
+}
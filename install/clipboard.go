@@ -0,0 +1,84 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+// clipboardCommand returns a command that copies its stdin to the clipboard
+// of the local desktop session, or nil if there is none.
+func clipboardCommand() *exec.Cmd {
+	var candidates [][]string
+	switch {
+	case runtime.GOOS == "darwin":
+		candidates = append(candidates, []string{"pbcopy"})
+	case os.Getenv("WAYLAND_DISPLAY") != "":
+		candidates = append(candidates, []string{"wl-copy"})
+	case os.Getenv("DISPLAY") != "":
+		candidates = append(candidates, []string{"xclip", "-selection", "clipboard"}, []string{"xsel", "--clipboard", "--input"})
+	}
+	for _, candidate := range candidates {
+		if _, err := exec.LookPath(candidate[0]); err == nil {
+			return exec.Command(candidate[0], candidate[1:]...)
+		}
+	}
+	return nil
+}
+
+// overSSH reports whether the installer runs in an SSH session, where the
+// clipboard that matters is the one of the terminal on the other end.
+func overSSH() bool {
+	return os.Getenv("SSH_CONNECTION") != "" || os.Getenv("SSH_TTY") != ""
+}
+
+// osc52Supported reports whether the clipboard can be set with an OSC 52
+// escape sequence. Whether the terminal honors it cannot be detected, so this
+// only rules out the cases where it certainly cannot work.
+func osc52Supported() bool {
+	return overSSH() && !plainMode && os.Getenv("TERM") != "dumb" &&
+		term.IsTerminal(int(os.Stdout.Fd()))
+}
+
+// clipboardAvailable reports whether copyToClipboard has a way to reach a
+// clipboard.
+func clipboardAvailable() bool {
+	return osc52Supported() || !overSSH() && clipboardCommand() != nil
+}
+
+// copyToClipboard puts text on the clipboard, preferring the terminal's
+// clipboard over SSH and the desktop's clipboard locally.
+func copyToClipboard(text string) error {
+	if osc52Supported() {
+		seq := "\x1b]52;c;" + base64.StdEncoding.EncodeToString([]byte(text)) + "\a"
+		if os.Getenv("TMUX") != "" {
+			// tmux only forwards escape sequences wrapped in a passthrough
+			seq = "\x1bPtmux;" + strings.ReplaceAll(seq, "\x1b", "\x1b\x1b") + "\x1b\\"
+		}
+		_, err := fmt.Fprint(os.Stdout, seq)
+		return err
+	}
+
+	cmd := clipboardCommand()
+	if cmd == nil {
+		return fmt.Errorf("no clipboard available")
+	}
+	cmd.Stdin = strings.NewReader(text)
+	return cmd.Run()
+}
+
+// offerCopySetupToken offers to copy the setup token to the clipboard when
+// there is one. Failures are ignored: the token is printed either way.
+func offerCopySetupToken(token string) {
+	if !clipboardAvailable() || !readBool(msg("promptCopySetupToken"), true) {
+		return
+	}
+	if err := copyToClipboard(token); err == nil {
+		fmt.Println(msg("setupTokenCopied"))
+	}
+}
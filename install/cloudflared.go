@@ -0,0 +1,169 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// cloudflaredConfig is the part of a cloudflared config.yml the importer
+// understands.
+type cloudflaredConfig struct {
+	Tunnel          string `yaml:"tunnel"`
+	CredentialsFile string `yaml:"credentials-file"`
+	Ingress         []struct {
+		Hostname      string         `yaml:"hostname"`
+		Path          string         `yaml:"path"`
+		Service       string         `yaml:"service"`
+		OriginRequest map[string]any `yaml:"originRequest"`
+	} `yaml:"ingress"`
+	WarpRouting struct {
+		Enabled bool `yaml:"enabled"`
+	} `yaml:"warp-routing"`
+}
+
+// cloudflaredDefaultPorts are the ports cloudflared assumes for services
+// given without one.
+var cloudflaredDefaultPorts = map[string]int{
+	"http": 80, "https": 443, "ssh": 22, "rdp": 3389, "smb": 445,
+}
+
+// parseCloudflaredConfig translates the ingress rules of a cloudflared
+// config.yml. The tunnel becomes a suggested site: the services are addressed
+// as cloudflared sees them, so Newt has to run where cloudflared runs.
+func parseCloudflaredConfig(path string) (*importPlan, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %v", path, err)
+	}
+	var config cloudflaredConfig
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %v", path, err)
+	}
+	if len(config.Ingress) == 0 {
+		return nil, fmt.Errorf("%s has no ingress rules; remotely managed tunnels keep them in the Cloudflare dashboard", path)
+	}
+
+	plan := &importPlan{}
+	plan.Sites = append(plan.Sites, suggestedSite{
+		Name: cloudflaredTunnelName(config, path),
+		Note: "Run Newt on the host running cloudflared, with host networking if in a container, so the services resolve the same way.",
+	})
+	if config.WarpRouting.Enabled {
+		plan.Unmapped = append(plan.Unmapped, "warp-routing: private network access maps to Pangolin clients and site resources, not public resources")
+	}
+
+	tcpPorts := map[int]bool{}
+	for i, rule := range config.Ingress {
+		source := fmt.Sprintf("ingress[%d]", i)
+		if rule.Hostname != "" {
+			source += " " + rule.Hostname
+		}
+
+		switch {
+		case rule.Hostname == "" && i == len(config.Ingress)-1:
+			// The mandatory catch-all rule, usually http_status:404
+			continue
+		case strings.Contains(rule.Hostname, "*"):
+			plan.Unmapped = append(plan.Unmapped, source+": wildcard hostnames need one resource per subdomain")
+			continue
+		case rule.Path != "":
+			plan.Unmapped = append(plan.Unmapped, fmt.Sprintf("%s: path %s; use resource rules to match paths", source, rule.Path))
+			continue
+		}
+
+		target, err := url.Parse(rule.Service)
+		if err != nil || target.Host == "" {
+			plan.Unmapped = append(plan.Unmapped, fmt.Sprintf("%s: service %s has no network equivalent", source, rule.Service))
+			continue
+		}
+		port := cloudflaredDefaultPorts[target.Scheme]
+		if p := target.Port(); p != "" {
+			port, _ = strconv.Atoi(p)
+		}
+		if port == 0 {
+			plan.Unmapped = append(plan.Unmapped, fmt.Sprintf("%s: service %s has no port", source, rule.Service))
+			continue
+		}
+
+		host := target.Hostname()
+		if host == "localhost" {
+			host = "127.0.0.1"
+		}
+		resource := importedResource{
+			Name:     rule.Hostname,
+			Hostname: rule.Hostname,
+			Protocol: "tcp",
+			Targets:  []importedTarget{{Host: host, Port: port}},
+			Source:   source,
+		}
+
+		switch target.Scheme {
+		case "http", "https":
+			resource.HTTP = true
+			resource.Targets[0].Method = target.Scheme
+			if len(rule.OriginRequest) > 0 {
+				plan.Unmapped = append(plan.Unmapped, fmt.Sprintf("%s: originRequest settings (%s) were not carried over", source, strings.Join(sortedKeys(rule.OriginRequest), ", ")))
+			}
+		case "tcp", "ssh", "rdp", "smb":
+			// Cloudflare reaches these through cloudflared access on the
+			// client; in Pangolin they become raw TCP resources on a port
+			resource.HTTP = false
+			resource.ProxyPort = port
+			for tcpPorts[resource.ProxyPort] {
+				resource.ProxyPort++
+			}
+			tcpPorts[resource.ProxyPort] = true
+			resource.Name = fmt.Sprintf("%s (%s)", rule.Hostname, target.Scheme)
+			if rule.Hostname == "" {
+				resource.Name = resource.Targets[0].String()
+			}
+		default:
+			plan.Unmapped = append(plan.Unmapped, fmt.Sprintf("%s: service %s has no Pangolin equivalent", source, rule.Service))
+			continue
+		}
+		if resource.HTTP && rule.Hostname == "" {
+			plan.Unmapped = append(plan.Unmapped, source+": HTTP rule without a hostname")
+			continue
+		}
+		plan.Resources = append(plan.Resources, resource)
+	}
+
+	if tcp := len(tcpPorts); tcp > 0 {
+		plan.Unmapped = append(plan.Unmapped, fmt.Sprintf("raw TCP resources (%d): enable flags.allow_raw_resources, add a Traefik entry point per port and check the ports are free on this server", tcp))
+	}
+	return plan, nil
+}
+
+// cloudflaredTunnelName names the tunnel after the tunnel setting, or the
+// tunnel ID in the credentials file next to the config.
+func cloudflaredTunnelName(config cloudflaredConfig, configPath string) string {
+	if config.Tunnel != "" {
+		return config.Tunnel
+	}
+
+	credentials := config.CredentialsFile
+	if credentials == "" {
+		return "cloudflared"
+	}
+	if !filepath.IsAbs(credentials) {
+		credentials = filepath.Join(filepath.Dir(configPath), credentials)
+	}
+	data, err := os.ReadFile(credentials)
+	if err != nil {
+		return strings.TrimSuffix(filepath.Base(credentials), ".json")
+	}
+	var creds struct {
+		TunnelID string `json:"TunnelID"`
+	}
+	if json.Unmarshal(data, &creds) == nil && creds.TunnelID != "" {
+		return creds.TunnelID
+	}
+	return "cloudflared"
+}
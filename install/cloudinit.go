@@ -0,0 +1,89 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// cloudConfig is the subset of cloud-config the generated user data uses.
+type cloudConfig struct {
+	PackageUpdate bool              `yaml:"package_update"`
+	Packages      []string          `yaml:"packages"`
+	WriteFiles    []cloudConfigFile `yaml:"write_files"`
+	RunCmd        []string          `yaml:"runcmd"`
+}
+
+type cloudConfigFile struct {
+	Path        string `yaml:"path"`
+	Permissions string `yaml:"permissions"`
+	Content     string `yaml:"content"`
+}
+
+func runGenerateCloudInit(args []string) error {
+	flags := flag.NewFlagSet("generate cloud-init", flag.ExitOnError)
+	answersPath := flags.String("answers", "", "Path to the YAML answers file (required)")
+	out := flags.String("out", "cloud-init.yml", "File to write the user data to, - for standard output")
+	dir := flags.String("dir", defaultInstallDir, "Installation directory on the server")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	config, err := loadProvisioningAnswers(*answersPath)
+	if err != nil {
+		return err
+	}
+	userData, err := renderCloudInit(config, *dir)
+	if err != nil {
+		return err
+	}
+
+	if *out == "-" {
+		_, err := os.Stdout.Write(userData)
+		return err
+	}
+	// The user data holds the secret and any passwords of the answers
+	if err := os.WriteFile(*out, userData, 0600); err != nil {
+		return fmt.Errorf("failed to write %s: %v", *out, err)
+	}
+	fmt.Printf("Wrote %s. Pass it as user data when creating the server; the install log is in /var/log/cloud-init-output.log.\n", *out)
+	fmt.Printf("Once it is up, get the setup token with: %s logs pangolin 2>&1 | grep -A 2 'SETUP TOKEN'\n", config.InstallationContainerType)
+	return nil
+}
+
+// renderCloudInit returns cloud-config user data that installs the container
+// runtime, fetches the installer, renders the configuration from the answers
+// and starts the stack on first boot.
+func renderCloudInit(config Config, installDir string) ([]byte, error) {
+	answers, err := yaml.Marshal(config)
+	if err != nil {
+		return nil, err
+	}
+
+	cc := cloudConfig{
+		PackageUpdate: true,
+		Packages:      provisionPackages(config),
+		WriteFiles: []cloudConfigFile{{
+			Path:        path.Join(installDir, "answers.yml"),
+			Permissions: "0600",
+			Content:     string(answers),
+		}},
+		RunCmd: provisionCommands(config, installDir),
+	}
+
+	body, err := yaml.Marshal(cc)
+	if err != nil {
+		return nil, err
+	}
+	header := strings.Join([]string{
+		"#cloud-config",
+		"# Generated by the Pangolin installer for " + config.DashboardDomain + ".",
+		"# Contains secrets: keep it out of version control.",
+		"",
+	}, "\n")
+	return append([]byte(header), body...), nil
+}
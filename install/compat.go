@@ -0,0 +1,47 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/fosrl/pangolin/install/pkg/installer"
+)
+
+// compatibilityRule constrains the version of a component relative to the
+// Pangolin version it runs with.
+type compatibilityRule struct {
+	Component string
+	// Check returns a problem description, or an empty string if the
+	// versions work together.
+	Check func(pangolin, component string) string
+}
+
+// compatibilityMatrix lists the known constraints between Pangolin and the
+// components that can be upgraded on their own. Gerbil and Badger talk to
+// Pangolin over versioned APIs that only change between major releases.
+var compatibilityMatrix = []compatibilityRule{
+	{Component: "gerbil", Check: sameMajorVersion},
+	{Component: "badger", Check: sameMajorVersion},
+}
+
+func sameMajorVersion(pangolin, component string) string {
+	if installer.ParseVersion(pangolin)[0] != installer.ParseVersion(component)[0] {
+		return fmt.Sprintf("major version %d does not match Pangolin %s", installer.ParseVersion(component)[0], pangolin)
+	}
+	return ""
+}
+
+// checkCompatibility returns the problems the given component versions have
+// with the Pangolin version.
+func checkCompatibility(pangolin string, components map[string]string) []string {
+	var problems []string
+	for _, rule := range compatibilityMatrix {
+		version, ok := components[rule.Component]
+		if !ok || version == "" {
+			continue
+		}
+		if problem := rule.Check(pangolin, version); problem != "" {
+			problems = append(problems, fmt.Sprintf("%s %s: %s", rule.Component, version, problem))
+		}
+	}
+	return problems
+}
@@ -1,7 +1,6 @@
 package main
 
 import (
-	"bytes"
 	"fmt"
 	"os"
 	"os/exec"
@@ -50,11 +49,15 @@ type AppConfig struct {
 		DashboardURL string `yaml:"dashboard_url"`
 		LogLevel     string `yaml:"log_level"`
 	} `yaml:"app"`
+	Domains map[string]struct {
+		BaseDomain string `yaml:"base_domain"`
+	} `yaml:"domains"`
 }
 
 type AppConfigValues struct {
 	DashboardURL string
 	LogLevel     string
+	BaseDomain   string
 }
 
 // ReadTraefikConfig reads and extracts values from Traefik configuration files
@@ -94,11 +97,51 @@ func ReadAppConfig(configPath string) (*AppConfigValues, error) {
 	values := &AppConfigValues{
 		DashboardURL: appConfig.App.DashboardURL,
 		LogLevel:     appConfig.App.LogLevel,
+		// The installer writes the base domain as domain1
+		BaseDomain: appConfig.Domains["domain1"].BaseDomain,
 	}
 
 	return values, nil
 }
 
+// ReadComposeImageTag returns the image tag used by a service in a Docker
+// Compose file, e.g. "1.2.0" for docker.io/fosrl/pangolin:1.2.0.
+func ReadComposeImageTag(composePath, serviceName string) (string, error) {
+	data, err := os.ReadFile(composePath)
+	if err != nil {
+		return "", fmt.Errorf("error reading compose file: %w", err)
+	}
+
+	var compose map[string]any
+	if err := yaml.Unmarshal(data, &compose); err != nil {
+		return "", fmt.Errorf("error parsing compose file: %w", err)
+	}
+
+	services, ok := compose["services"].(map[string]any)
+	if !ok {
+		return "", fmt.Errorf("services section not found or invalid")
+	}
+
+	service, ok := services[serviceName].(map[string]any)
+	if !ok {
+		return "", fmt.Errorf("service '%s' not found", serviceName)
+	}
+
+	image, ok := service["image"].(string)
+	if !ok {
+		return "", fmt.Errorf("service '%s' has no image", serviceName)
+	}
+
+	// Only look for a tag after the last slash so registry ports are ignored
+	name := image[strings.LastIndex(image, "/")+1:]
+	_, tag, found := strings.Cut(name, ":")
+	if !found {
+		return "latest", nil
+	}
+
+	return tag, nil
+}
+
 func copyDockerService(sourceFile, destFile, serviceName string) error {
 	// Read source file
 	sourceData, err := os.ReadFile(sourceFile)
@@ -106,23 +149,18 @@ func copyDockerService(sourceFile, destFile, serviceName string) error {
 		return fmt.Errorf("error reading source file: %w", err)
 	}
 
-	// Read destination file
-	destData, err := os.ReadFile(destFile)
-	if err != nil {
-		return fmt.Errorf("error reading destination file: %w", err)
-	}
-
 	// Parse source Docker Compose YAML
 	var sourceCompose map[string]any
 	if err := yaml.Unmarshal(sourceData, &sourceCompose); err != nil {
 		return fmt.Errorf("error parsing source Docker Compose file: %w", err)
 	}
 
-	// Parse destination Docker Compose YAML
-	var destCompose map[string]any
-	if err := yaml.Unmarshal(destData, &destCompose); err != nil {
-		return fmt.Errorf("error parsing destination Docker Compose file: %w", err)
+	// Read destination Docker Compose YAML
+	dest, err := readYAMLFile(destFile)
+	if err != nil {
+		return err
 	}
+	destCompose := dest.Doc
 
 	// Get services section from source
 	sourceServices, ok := sourceCompose["services"].(map[string]any)
@@ -144,23 +182,20 @@ func copyDockerService(sourceFile, destFile, serviceName string) error {
 		destCompose["services"] = destServices
 	}
 
+	// A stack renamed to avoid container name conflicts has no fixed
+	// container names, so neither does the added service
+	if pangolin, ok := destServices["pangolin"].(map[string]any); ok && pangolin["container_name"] == nil {
+		if service, ok := serviceConfig.(map[string]any); ok {
+			delete(service, "container_name")
+		}
+	}
+
 	// Update service in destination
 	destServices[serviceName] = serviceConfig
 
-	// Marshal updated destination YAML
-	// Use yaml.v3 encoder to preserve formatting and comments
-	// updatedData, err := yaml.Marshal(destCompose)
-	updatedData, err := MarshalYAMLWithIndent(destCompose, 2)
-	if err != nil {
-		return fmt.Errorf("error marshaling updated Docker Compose file: %w", err)
-	}
-
 	// Write updated YAML back to destination file
-	if err := os.WriteFile(destFile, updatedData, 0644); err != nil {
-		return fmt.Errorf("error writing to destination file: %w", err)
-	}
-
-	return nil
+	_, err = dest.save()
+	return err
 }
 
 func backupConfig() error {
@@ -177,29 +212,15 @@ func backupConfig() error {
 		if err := cmd.Run(); err != nil {
 			return fmt.Errorf("failed to backup config directory: %v", err)
 		}
+		// The archive contains every secret in the config directory
+		if err := os.Chmod("config.tar.gz", 0600); err != nil {
+			return fmt.Errorf("failed to restrict permissions of config.tar.gz: %v", err)
+		}
 	}
 
 	return nil
 }
 
-func MarshalYAMLWithIndent(data any, indent int) (resp []byte, err error) {
-	buffer := new(bytes.Buffer)
-	encoder := yaml.NewEncoder(buffer)
-	encoder.SetIndent(indent)
-
-	if err := encoder.Encode(data); err != nil {
-		return nil, err
-	}
-
-	defer func() {
-		if cerr := encoder.Close(); cerr != nil && err == nil {
-			err = cerr
-		}
-	}()
-
-	return buffer.Bytes(), nil
-}
-
 func replaceInFile(filepath, oldStr, newStr string) error {
 	// Read the file content
 	content, err := os.ReadFile(filepath)
@@ -221,19 +242,13 @@ func replaceInFile(filepath, oldStr, newStr string) error {
 
 func CheckAndAddTraefikLogVolume(composePath string) error {
 	// Read the docker-compose.yml file
-	data, err := os.ReadFile(composePath)
+	file, err := readYAMLFile(composePath)
 	if err != nil {
-		return fmt.Errorf("error reading compose file: %w", err)
-	}
-
-	// Parse YAML into a generic map
-	var compose map[string]any
-	if err := yaml.Unmarshal(data, &compose); err != nil {
-		return fmt.Errorf("error parsing compose file: %w", err)
+		return err
 	}
 
 	// Get services section
-	services, ok := compose["services"].(map[string]any)
+	services, ok := file.Doc["services"].(map[string]any)
 	if !ok {
 		return fmt.Errorf("services section not found or invalid")
 	}
@@ -264,13 +279,8 @@ func CheckAndAddTraefikLogVolume(composePath string) error {
 	traefik["volumes"] = volumes
 
 	// Write updated config back to file
-	newData, err := MarshalYAMLWithIndent(compose, 2)
-	if err != nil {
-		return fmt.Errorf("error marshaling updated compose file: %w", err)
-	}
-
-	if err := os.WriteFile(composePath, newData, 0644); err != nil {
-		return fmt.Errorf("error writing updated compose file: %w", err)
+	if _, err := file.save(); err != nil {
+		return err
 	}
 
 	fmt.Println("Added traefik log volume and created logs directory")
@@ -282,9 +292,9 @@ func CheckAndAddTraefikLogVolume(composePath string) error {
 // second file take precedence.
 func MergeYAML(baseFile, overlayFile string) error {
 	// Read the base YAML file
-	baseContent, err := os.ReadFile(baseFile)
+	base, err := readYAMLFile(baseFile)
 	if err != nil {
-		return fmt.Errorf("error reading base file: %v", err)
+		return err
 	}
 
 	// Read the overlay YAML file
@@ -293,33 +303,16 @@ func MergeYAML(baseFile, overlayFile string) error {
 		return fmt.Errorf("error reading overlay file: %v", err)
 	}
 
-	// Parse base YAML into a map
-	var baseMap map[string]any
-	if err := yaml.Unmarshal(baseContent, &baseMap); err != nil {
-		return fmt.Errorf("error parsing base YAML: %v", err)
-	}
-
 	// Parse overlay YAML into a map
 	var overlayMap map[string]any
 	if err := yaml.Unmarshal(overlayContent, &overlayMap); err != nil {
 		return fmt.Errorf("error parsing overlay YAML: %v", err)
 	}
 
-	// Merge the overlay into the base
-	merged := mergeMap(baseMap, overlayMap)
-
-	// Marshal the merged result back to YAML
-	mergedContent, err := MarshalYAMLWithIndent(merged, 2)
-	if err != nil {
-		return fmt.Errorf("error marshaling merged YAML: %v", err)
-	}
-
-	// Write the merged content back to the base file
-	if err := os.WriteFile(baseFile, mergedContent, 0644); err != nil {
-		return fmt.Errorf("error writing merged YAML: %v", err)
-	}
-
-	return nil
+	// Merge the overlay into the base and write it back to the base file
+	base.Doc = mergeMap(base.Doc, overlayMap)
+	_, err = base.save()
+	return err
 }
 
 // mergeMap recursively merges two maps
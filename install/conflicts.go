@@ -0,0 +1,174 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// defaultProjectName is the compose project name of a standard install. Its
+// services have fixed container names such as "pangolin" and "gerbil".
+const defaultProjectName = "pangolin"
+
+// projectNamePattern is what compose accepts as a project name.
+var projectNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// containerNameConflict is an existing container whose name the install
+// would take over.
+type containerNameConflict struct {
+	Container  string
+	Project    string
+	WorkingDir string
+}
+
+func init() {
+	registerStep(installStep{Name: "check container names", Order: 55, When: containersStarting, Run: resolveContainerNameConflicts})
+}
+
+// serviceContainer returns the container name of a compose service of the
+// install in the current directory. Stacks renamed to avoid conflicts have
+// no fixed container names, so the name is looked up in docker-compose.yml.
+func serviceContainer(service string) string {
+	services, err := composeServices("docker-compose.yml")
+	if err != nil {
+		return service
+	}
+	for _, s := range services {
+		if s.Name == service {
+			return s.Container
+		}
+	}
+	return service
+}
+
+// findContainerNameConflicts returns the containers that have the name of one
+// of the stack's containers but belong to another compose project, or to the
+// same project name in another directory, which compose would treat as this
+// stack and recreate.
+func findContainerNameConflicts(containerType SupportedContainer) ([]containerNameConflict, error) {
+	services, err := composeServices("docker-compose.yml")
+	if err != nil {
+		return nil, err
+	}
+	names := []string{"crowdsec"}
+	for _, service := range services {
+		names = append(names, service.Container)
+	}
+
+	installDir, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+	project := composeProjectName()
+
+	var conflicts []containerNameConflict
+	for _, name := range names {
+		out, err := containerCommand(containerType, "inspect", "--format",
+			`{{index .Config.Labels "com.docker.compose.project"}}|{{index .Config.Labels "com.docker.compose.project.working_dir"}}`,
+			name).Output()
+		if err != nil {
+			// No such container
+			continue
+		}
+		owner, workingDir, _ := strings.Cut(strings.TrimSpace(string(out)), "|")
+		if owner == project && (workingDir == "" || workingDir == installDir) {
+			continue
+		}
+		conflicts = append(conflicts, containerNameConflict{Container: name, Project: owner, WorkingDir: workingDir})
+	}
+	return conflicts, nil
+}
+
+// composeProjectName returns the project name set in docker-compose.yml.
+func composeProjectName() string {
+	data, err := os.ReadFile("docker-compose.yml")
+	if err != nil {
+		return defaultProjectName
+	}
+	var compose map[string]any
+	if err := yaml.Unmarshal(data, &compose); err != nil {
+		return defaultProjectName
+	}
+	if name, ok := compose["name"].(string); ok && name != "" {
+		return name
+	}
+	return defaultProjectName
+}
+
+// resolveContainerNameConflicts checks for containers that would clash with
+// the stack before it is started. Compose fails on such conflicts with an
+// error that does not say what to do, so the user can instead rename the
+// stack or stop here with an explanation.
+func resolveContainerNameConflicts(state *installState) error {
+	conflicts, err := findContainerNameConflicts(state.Config.InstallationContainerType)
+	if err != nil || len(conflicts) == 0 {
+		return nil
+	}
+
+	fmt.Println("\n=== " + msg("sectionContainerConflicts") + " ===")
+	for _, conflict := range conflicts {
+		switch {
+		case conflict.Project == "":
+			fmt.Println(msg("containerConflictStandalone", conflict.Container))
+		case conflict.WorkingDir != "":
+			fmt.Println(msg("containerConflictProjectDir", conflict.Container, conflict.Project, conflict.WorkingDir))
+		default:
+			fmt.Println(msg("containerConflictProject", conflict.Container, conflict.Project))
+		}
+	}
+	fmt.Println(msg("containerConflictExplanation"))
+
+	if !readBool(msg("promptRenameStack"), true) {
+		return fmt.Errorf("containers named %s already exist; remove or rename them, or run the installer again and choose a different project name", conflictNames(conflicts))
+	}
+
+	name := readString(msg("promptProjectName"), availableProjectName(state.Config.InstallationContainerType))
+	for !projectNamePattern.MatchString(name) {
+		fmt.Println(msg("invalidProjectName"))
+		name = readString(msg("promptProjectName"), availableProjectName(state.Config.InstallationContainerType))
+	}
+
+	if err := renameStack("docker-compose.yml", name); err != nil {
+		return fmt.Errorf("error renaming the stack: %v", err)
+	}
+	fmt.Println(msg("stackRenamed", name))
+	return nil
+}
+
+// availableProjectName suggests a project name whose containers do not
+// exist yet.
+func availableProjectName(containerType SupportedContainer) string {
+	for i := 2; ; i++ {
+		name := fmt.Sprintf("%s-%d", defaultProjectName, i)
+		if containerCommand(containerType, "inspect", name+"-pangolin-1").Run() != nil {
+			return name
+		}
+	}
+}
+
+// renameStack sets the compose project name and drops the fixed container
+// names, so the containers are named <project>-<service>-1 instead.
+func renameStack(composePath, project string) error {
+	_, err := editYAMLFile(composePath, func(compose map[string]any) bool {
+		compose["name"] = project
+		services, _ := compose["services"].(map[string]any)
+		for _, raw := range services {
+			if service, ok := raw.(map[string]any); ok {
+				delete(service, "container_name")
+			}
+		}
+		return true
+	})
+	return err
+}
+
+func conflictNames(conflicts []containerNameConflict) string {
+	var names []string
+	for _, conflict := range conflicts {
+		names = append(names, conflict.Container)
+	}
+	return strings.Join(names, ", ")
+}
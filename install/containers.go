@@ -1,7 +1,6 @@
 package main
 
 import (
-	"bytes"
 	"fmt"
 	"os"
 	"os/exec"
@@ -10,34 +9,54 @@ import (
 	"strconv"
 	"strings"
 	"time"
+
+	"github.com/fosrl/pangolin/install/pkg/installer"
 )
 
-func waitForContainer(containerName string, containerType SupportedContainer) error {
-	maxAttempts := 30
-	retryInterval := time.Second * 2
-
-	for attempt := 0; attempt < maxAttempts; attempt++ {
-		// Check if container is running
-		cmd := exec.Command(string(containerType), "container", "inspect", "-f", "{{.State.Running}}", containerName)
-		var out bytes.Buffer
-		cmd.Stdout = &out
-
-		if err := cmd.Run(); err != nil {
-			// If the container doesn't exist or there's another error, wait and retry
-			time.Sleep(retryInterval)
-			continue
+// waitTimeout bounds every wait for Docker and the containers
+// (--wait-timeout). The default leaves room for slow hosts such as a
+// Raspberry Pi pulling images over Wi-Fi.
+var waitTimeout = 5 * time.Minute
+
+// pollInterval is how often waitUntil re-checks its condition.
+const pollInterval = 2 * time.Second
+
+// waitUntil calls ready every pollInterval until it returns true or timeout
+// has elapsed, and reports whether it succeeded.
+func waitUntil(timeout time.Duration, ready func() bool) bool {
+	deadline := time.Now().Add(timeout)
+	for {
+		if ready() {
+			return true
 		}
-
-		isRunning := strings.TrimSpace(out.String()) == "true"
-		if isRunning {
-			return nil
+		if time.Now().Add(pollInterval).After(deadline) {
+			return false
 		}
+		time.Sleep(pollInterval)
+	}
+}
 
-		// Container exists but isn't running yet, wait and retry
-		time.Sleep(retryInterval)
+// waitForContainer waits until the container is running and, if it has a
+// healthcheck, healthy.
+func waitForContainer(containerName string, containerType SupportedContainer) error {
+	var failure string
+	ready := waitUntil(waitTimeout, func() bool {
+		// If the container doesn't exist yet or isn't ready, wait and retry
+		state, err := inspectContainer(containerType, containerName)
+		if err != nil {
+			return false
+		}
+		failure = state.failure()
+		return failure != "" || state.ready()
+	})
+	if failure != "" {
+		return fmt.Errorf("container %s %s", containerName, failure)
+	}
+	if ready {
+		return nil
 	}
 
-	return fmt.Errorf("container %s did not start within %v seconds", containerName, maxAttempts*int(retryInterval.Seconds()))
+	return fmt.Errorf("container %s did not become ready within %v (use --wait-timeout to wait longer)", containerName, waitTimeout)
 }
 
 func installDocker() error {
@@ -71,7 +90,7 @@ func installDocker() error {
 	var installCmd *exec.Cmd
 	switch {
 	case strings.Contains(osRelease, "ID=ubuntu"):
-		installCmd = exec.Command("bash", "-c", fmt.Sprintf(`
+		installCmd = rootCommand("bash", "-c", fmt.Sprintf(`
 			apt-get update &&
 			apt-get install -y apt-transport-https ca-certificates curl gpg &&
 			curl -fsSL https://download.docker.com/linux/ubuntu/gpg | gpg --dearmor -o /usr/share/keyrings/docker-archive-keyring.gpg &&
@@ -80,7 +99,7 @@ func installDocker() error {
 			apt-get install -y docker-ce docker-ce-cli containerd.io docker-compose-plugin
 		`, dockerArch))
 	case strings.Contains(osRelease, "ID=debian"):
-		installCmd = exec.Command("bash", "-c", fmt.Sprintf(`
+		installCmd = rootCommand("bash", "-c", fmt.Sprintf(`
 			apt-get update &&
 			apt-get install -y apt-transport-https ca-certificates curl gpg &&
 			curl -fsSL https://download.docker.com/linux/debian/gpg | gpg --dearmor -o /usr/share/keyrings/docker-archive-keyring.gpg &&
@@ -109,18 +128,18 @@ func installDocker() error {
 			repoCmd = "dnf config-manager --add-repo https://download.docker.com/linux/fedora/docker-ce.repo"
 		}
 
-		installCmd = exec.Command("bash", "-c", fmt.Sprintf(`
+		installCmd = rootCommand("bash", "-c", fmt.Sprintf(`
 			dnf -y install dnf-plugins-core &&
 			%s &&
 			dnf install -y docker-ce docker-ce-cli containerd.io docker-compose-plugin
 		`, repoCmd))
 	case strings.Contains(osRelease, "ID=opensuse") || strings.Contains(osRelease, "ID=\"opensuse-"):
-		installCmd = exec.Command("bash", "-c", `
+		installCmd = rootCommand("bash", "-c", `
 			zypper install -y docker docker-compose &&
 			systemctl enable docker
 		`)
 	case strings.Contains(osRelease, "ID=rhel") || strings.Contains(osRelease, "ID=\"rhel"):
-		installCmd = exec.Command("bash", "-c", `
+		installCmd = rootCommand("bash", "-c", `
 			dnf remove -y runc &&
 			dnf -y install yum-utils &&
 			dnf config-manager --add-repo https://download.docker.com/linux/rhel/docker-ce.repo &&
@@ -128,7 +147,7 @@ func installDocker() error {
 			systemctl enable docker
 		`)
 	case strings.Contains(osRelease, "ID=amzn"):
-		installCmd = exec.Command("bash", "-c", `
+		installCmd = rootCommand("bash", "-c", `
 			yum update -y &&
 			yum install -y docker &&
 			systemctl enable docker &&
@@ -138,18 +157,22 @@ func installDocker() error {
 		return fmt.Errorf("unsupported Linux distribution")
 	}
 
+	if tool := privilegeTool(); tool != "" {
+		fmt.Printf("Installing Docker as root through %s...\n", tool)
+	}
+	installCmd.Stdin = os.Stdin
 	installCmd.Stdout = os.Stdout
 	installCmd.Stderr = os.Stderr
-	return installCmd.Run()
+	return hostOps.Run(installCmd)
 }
 
 func startDockerService() error {
 	switch runtime.GOOS {
 	case "linux":
-		cmd := exec.Command("systemctl", "enable", "--now", "docker")
+		cmd := rootCommand("systemctl", "enable", "--now", "docker")
 		cmd.Stdout = os.Stdout
 		cmd.Stderr = os.Stderr
-		return cmd.Run()
+		return hostOps.Run(cmd)
 	case "darwin":
 		// On macOS, Docker is usually started via the Docker Desktop application
 		fmt.Println("Please start Docker Desktop manually on macOS.")
@@ -159,52 +182,95 @@ func startDockerService() error {
 }
 
 func isDockerInstalled() bool {
-	return isContainerInstalled("docker")
+	return installer.CommandInstalled("docker")
 }
 
 func isPodmanInstalled() bool {
-	return isContainerInstalled("podman") && isContainerInstalled("podman-compose")
+	return installer.CommandInstalled("podman") && installer.CommandInstalled("podman-compose")
 }
 
-func isContainerInstalled(container string) bool {
-	cmd := exec.Command(container, "--version")
-	if err := cmd.Run(); err != nil {
-		return false
+// dockerAsRoot is set when the user is not in the docker group yet and
+// chose to run the docker commands of this session through sudo or doas.
+var dockerAsRoot bool
+
+// dockerCommand returns the command running name, the docker CLI or
+// docker-compose, with args: as root when dockerAsRoot is set.
+func dockerCommand(name string, args ...string) *exec.Cmd {
+	if dockerAsRoot {
+		return rootCommand(name, args...)
 	}
-	return true
+	return exec.Command(name, args...)
 }
 
-func isUserInDockerGroup() bool {
-	if runtime.GOOS == "darwin" {
-		// Docker group is not applicable on macOS
-		// So we assume that the user can run Docker commands
-		return true
+// containerCommand returns the command running the CLI of containerType
+// with args.
+func containerCommand(containerType SupportedContainer, args ...string) *exec.Cmd {
+	if containerType == Docker {
+		return dockerCommand("docker", args...)
 	}
+	return exec.Command(string(containerType), args...)
+}
 
-	if os.Geteuid() == 0 {
-		return true // Root user can run Docker commands anyway
+// resolveDockerGroup is run for a user that is not in the docker group. It
+// offers to add them, which only applies from their next login, and to run
+// the docker commands of this session through sudo or doas until then. It
+// reports whether docker commands can run now.
+func resolveDockerGroup() bool {
+	currentUser, err := user.Current()
+	if err != nil {
+		return false
+	}
+	tool := privilegeTool()
+	if tool == "" {
+		return false
 	}
 
-	// Check if the current user is in the docker group
-	if dockerGroup, err := user.LookupGroup("docker"); err == nil {
-		if currentUser, err := user.Current(); err == nil {
-			if currentUserGroupIds, err := currentUser.GroupIds(); err == nil {
-				for _, groupId := range currentUserGroupIds {
-					if groupId == dockerGroup.Gid {
-						return true
-					}
-				}
-			}
+	if confirmHostChange(msg("promptAddDockerGroup", currentUser.Username), true) {
+		if err := runAsRoot("usermod", "usermod", "-aG", "docker", currentUser.Username); err != nil {
+			fmt.Printf("Error adding %s to the docker group: %v\n", currentUser.Username, err)
+		} else {
+			fmt.Println(msg("dockerGroupAdded", currentUser.Username))
 		}
 	}
+	if !readBool(msg("promptDockerAsRoot", tool), true) {
+		return false
+	}
+	// Ask for the password once, rather than in the middle of a command;
+	// doas has no such option and asks for it on the first one
+	if tool == "sudo" {
+		if err := run("sudo", "-v"); err != nil {
+			return false
+		}
+	}
+	dockerAsRoot = true
+	return true
+}
 
-	// Eventually, if any of the checks fail, we assume the user cannot run Docker commands
-	return false
+// offerDockerGroupForSudoUser offers to add the user who ran the installer
+// through sudo to the docker group, so they can manage the stack without
+// root later.
+func offerDockerGroupForSudoUser() {
+	name := os.Getenv("SUDO_USER")
+	if name == "" || name == "root" || runtime.GOOS != "linux" {
+		return
+	}
+	sudoUser, err := user.Lookup(name)
+	if err != nil || installer.UserInDockerGroup(sudoUser) {
+		return
+	}
+	if !confirmHostChange(msg("promptAddDockerGroup", name), false) {
+		return
+	}
+	if err := run("usermod", "-aG", "docker", name); err != nil {
+		fmt.Printf("Error adding %s to the docker group: %v\n", name, err)
+		return
+	}
+	fmt.Println(msg("dockerGroupAdded", name))
 }
 
 // isDockerRunning checks if the Docker daemon is running by using the `docker info` command.
 func isDockerRunning() bool {
-	cmd := exec.Command("docker", "info")
+	cmd := dockerCommand("docker", "info")
 	if err := cmd.Run(); err != nil {
 		return false
 	}
@@ -233,7 +299,7 @@ func detectContainerType() SupportedContainer {
 
 	// Check if we have running containers with docker
 	if isDockerRunning() {
-		cmd := exec.Command("docker", "ps", "-q")
+		cmd := dockerCommand("docker", "ps", "-q")
 		output, err := cmd.Output()
 		if err == nil && len(strings.TrimSpace(string(output))) > 0 {
 			return Docker
@@ -257,15 +323,16 @@ func executeDockerComposeCommandWithArgs(args ...string) error {
 	var cmd *exec.Cmd
 	var useNewStyle bool
 
-	if !isDockerInstalled() {
+	// A simulation may just have recorded installing Docker with the
+	// compose plugin
+	if simulating() {
+		useNewStyle = true
+	} else if !isDockerInstalled() {
 		return fmt.Errorf("docker is not installed")
-	}
-
-	checkCmd := exec.Command("docker", "compose", "version")
-	if err := checkCmd.Run(); err == nil {
+	} else if checkCmd := exec.Command("docker", "compose", "version"); checkCmd.Run() == nil {
 		useNewStyle = true
 	} else {
-		checkCmd = exec.Command("docker-compose", "version")
+		checkCmd := exec.Command("docker-compose", "version")
 		if err := checkCmd.Run(); err == nil {
 			useNewStyle = false
 		} else {
@@ -274,21 +341,21 @@ func executeDockerComposeCommandWithArgs(args ...string) error {
 	}
 
 	if useNewStyle {
-		cmd = exec.Command("docker", append([]string{"compose"}, args...)...)
+		cmd = dockerCommand("docker", append([]string{"compose"}, args...)...)
 	} else {
-		cmd = exec.Command("docker-compose", args...)
+		cmd = dockerCommand("docker-compose", args...)
 	}
 
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
-	return cmd.Run()
+	return hostOps.Run(cmd)
 }
 
 // pullContainers pulls the containers using the appropriate command.
 func pullContainers(containerType SupportedContainer) error {
 	fmt.Println("Pulling the container images...")
 	if containerType == Podman {
-		if err := run("podman-compose", "-f", "docker-compose.yml", "pull"); err != nil {
+		if err := run("podman-compose", podmanComposeArgs("pull")...); err != nil {
 			return fmt.Errorf("failed to pull the containers: %v", err)
 		}
 
@@ -311,7 +378,7 @@ func startContainers(containerType SupportedContainer) error {
 	fmt.Println("Starting containers...")
 
 	if containerType == Podman {
-		if err := run("podman-compose", "-f", "docker-compose.yml", "up", "-d", "--force-recreate"); err != nil {
+		if err := run("podman-compose", podmanComposeArgs("up", "-d", "--force-recreate")...); err != nil {
 			return fmt.Errorf("failed start containers: %v", err)
 		}
 
@@ -333,7 +400,7 @@ func startContainers(containerType SupportedContainer) error {
 func stopContainers(containerType SupportedContainer) error {
 	fmt.Println("Stopping containers...")
 	if containerType == Podman {
-		if err := run("podman-compose", "-f", "docker-compose.yml", "down"); err != nil {
+		if err := run("podman-compose", podmanComposeArgs("down")...); err != nil {
 			return fmt.Errorf("failed to stop containers: %v", err)
 		}
 
@@ -355,7 +422,7 @@ func stopContainers(containerType SupportedContainer) error {
 func restartContainer(container string, containerType SupportedContainer) error {
 	fmt.Println("Restarting containers...")
 	if containerType == Podman {
-		if err := run("podman-compose", "-f", "docker-compose.yml", "restart"); err != nil {
+		if err := run("podman-compose", podmanComposeArgs("restart")...); err != nil {
 			return fmt.Errorf("failed to stop the container \"%s\": %v", container, err)
 		}
 
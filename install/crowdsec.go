@@ -3,89 +3,145 @@ package main
 import (
 	"bytes"
 	"fmt"
-	"log"
+	"net/url"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"strings"
 
 	"gopkg.in/yaml.v3"
-)
-
-func installCrowdsec(config Config, installDir string) error {
 
-	if err := stopContainers(config.InstallationContainerType); err != nil {
-		return fmt.Errorf("failed to stop containers: %v", err)
-	}
+	"github.com/fosrl/pangolin/install/pkg/installer"
+)
 
-	// Run installation steps
-	if err := backupConfig(); err != nil {
-		return fmt.Errorf("backup failed: %v", err)
-	}
+func init() {
+	registerStep(installStep{
+		Name:  "install CrowdSec",
+		Order: 100,
+		When: func(state *installState) bool {
+			return state.CrowdsecRequested && !devMode && !checkIsCrowdsecInstalledInCompose()
+		},
+		Run: offerCrowdsecInstall,
+	})
+}
 
-	if err := createConfigFiles(config); err != nil {
-		fmt.Printf("Error creating config files: %v\n", err)
-		os.Exit(1)
+// offerCrowdsecInstall adds CrowdSec to the installation if the user agrees
+// to manage it, reading the answers back from an existing installation. A
+// fresh installation whose containers are not started gets the CrowdSec
+// configuration with a bouncer key CrowdSec registers when it first starts.
+func offerCrowdsecInstall(state *installState) error {
+	config := &state.Config
+
+	fmt.Println("\n=== " + msg("sectionCrowdsec") + " ===")
+	// check if crowdsec is installed
+	if answeredBool(installCrowdsecAnswer, msg("promptCrowdsec"), false) {
+		fmt.Println(msg("crowdsecDisclaimer"))
+
+		if answeredBool(installCrowdsecAnswer, msg("promptCrowdsecManage"), false) {
+			if config.DashboardDomain == "" {
+				installed, ok, err := loadInstallState()
+				if err != nil {
+					return err
+				}
+				if ok {
+					*config = installed
+				} else if err := readGeneratedAnswers(config); err != nil {
+					return err
+				}
+
+				// print the values and check if they are right; the secrets
+				// among them, such as the SMTP password, are never shown
+				fmt.Println(msg("crowdsecDetectedValues"))
+				fmt.Printf("Dashboard Domain: %s\n", config.DashboardDomain)
+				fmt.Printf("Let's Encrypt Email: %s\n", config.LetsEncryptEmail)
+				fmt.Printf("Badger Version: %s\n", config.BadgerVersion)
+
+				if !readBool(msg("promptValuesCorrect"), true) {
+					*config = collectUserInput()
+				}
+			}
+
+			if !state.AlreadyInstalled && !state.StartContainers {
+				if err := addCrowdsecForFirstStart(*config, state.InstallDir); err != nil {
+					return fmt.Errorf("error installing CrowdSec: %v", err)
+				}
+				recordChange("Install CrowdSec")
+				fmt.Println(msg("crowdsecOnFirstStart"))
+				return nil
+			}
+
+			// Try to detect container type from existing installation
+			if config.InstallationContainerType == Docker || config.InstallationContainerType == Podman {
+				fmt.Printf("Container type: %s\n", config.InstallationContainerType)
+			} else if detectedType := detectContainerType(); detectedType == Undefined {
+				// If detection fails, prompt the user
+				fmt.Println("Unable to detect container type from existing installation.")
+				config.InstallationContainerType = podmanOrDocker()
+			} else {
+				config.InstallationContainerType = detectedType
+				fmt.Printf("Detected container type: %s\n", config.InstallationContainerType)
+			}
+
+			config.DoCrowdsecInstall = true
+			err := installCrowdsec(*config, state.InstallDir)
+			if err != nil {
+				return fmt.Errorf("error installing CrowdSec: %v", err)
+			}
+
+			recordChange("Install CrowdSec")
+
+			fmt.Println(msg("crowdsecInstalled"))
+		}
 	}
+	return nil
+}
 
-	if err := os.MkdirAll("config/crowdsec/db", 0755); err != nil {
-		fmt.Printf("Error creating config files: %v\n", err)
-		os.Exit(1)
-	}
-	if err := os.MkdirAll("config/crowdsec/acquis.d", 0755); err != nil {
-		fmt.Printf("Error creating config files: %v\n", err)
-		os.Exit(1)
+// readGeneratedAnswers reads the answers CrowdSec needs back from the
+// generated configs of an installation made before the installer recorded
+// its state.
+func readGeneratedAnswers(config *Config) error {
+	traefikConfig, err := ReadTraefikConfig("config/traefik/traefik_config.yml")
+	if err != nil {
+		return fmt.Errorf("error reading config: %v", err)
 	}
-	if err := os.MkdirAll("config/traefik/logs", 0755); err != nil {
-		fmt.Printf("Error creating config files: %v\n", err)
-		os.Exit(1)
+	appConfig, err := ReadAppConfig("config/config.yml")
+	if err != nil {
+		return fmt.Errorf("error reading config: %v", err)
 	}
 
-	setupTraefikLogRotate(installDir)
-
-	if err := copyDockerService("config/crowdsec/docker-compose.yml", "docker-compose.yml", "crowdsec"); err != nil {
-		fmt.Printf("Error copying docker service: %v\n", err)
-		os.Exit(1)
+	parsedURL, err := url.Parse(appConfig.DashboardURL)
+	if err != nil {
+		return fmt.Errorf("error parsing URL: %v", err)
 	}
 
-	if err := MergeYAML("config/traefik/traefik_config.yml", "config/crowdsec/traefik_config.yml"); err != nil {
-		fmt.Printf("Error copying entry points: %v\n", err)
-		os.Exit(1)
-	}
-	// delete the 2nd file
-	if err := os.Remove("config/crowdsec/traefik_config.yml"); err != nil {
-		fmt.Printf("Error removing file: %v\n", err)
-		os.Exit(1)
-	}
+	config.DashboardDomain = parsedURL.Hostname()
+	config.BaseDomain = appConfig.BaseDomain
+	config.LetsEncryptEmail = traefikConfig.LetsEncryptEmail
+	config.BadgerVersion = traefikConfig.BadgerVersion
+	return nil
+}
 
-	if err := MergeYAML("config/traefik/dynamic_config.yml", "config/crowdsec/dynamic_config.yml"); err != nil {
-		fmt.Printf("Error copying entry points: %v\n", err)
-		os.Exit(1)
-	}
-	// delete the 2nd file
-	if err := os.Remove("config/crowdsec/dynamic_config.yml"); err != nil {
-		fmt.Printf("Error removing file: %v\n", err)
-		os.Exit(1)
+// installCrowdsec adds CrowdSec to the installation in the current
+// directory, fresh or existing, then starts it and recreates Traefik with
+// the bouncer. Pangolin and Gerbil keep running.
+func installCrowdsec(config Config, installDir string) error {
+	if config.CrowdsecBouncerVersion == "" {
+		config.CrowdsecBouncerVersion = crowdsecBouncerVersion
 	}
 
-	if err := os.Remove("config/crowdsec/docker-compose.yml"); err != nil {
-		fmt.Printf("Error removing file: %v\n", err)
-		os.Exit(1)
+	if err := backupConfig(); err != nil {
+		return fmt.Errorf("backup failed: %v", err)
 	}
-
-	if err := CheckAndAddTraefikLogVolume("docker-compose.yml"); err != nil {
-		fmt.Printf("Error checking and adding Traefik log volume: %v\n", err)
-		os.Exit(1)
+	if err := addCrowdsecConfig(config, installDir); err != nil {
+		return err
 	}
 
-	// check and add the service dependency of crowdsec to traefik
-	if err := CheckAndAddCrowdsecDependency("docker-compose.yml"); err != nil {
-		fmt.Printf("Error adding crowdsec dependency to traefik: %v\n", err)
-		os.Exit(1)
+	// Traefik only loads the bouncer plugin and the access log on start
+	if err := composeCommand(config.InstallationContainerType, "up", "-d", "--force-recreate", "crowdsec", "traefik"); err != nil {
+		return fmt.Errorf("failed to start CrowdSec: %v", err)
 	}
-
-	if err := startContainers(config.InstallationContainerType); err != nil {
-		return fmt.Errorf("failed to start containers: %v", err)
+	// A simulation started no CrowdSec to register the bouncer with
+	if simulating() {
+		return nil
 	}
 
 	// get API key
@@ -108,28 +164,115 @@ func installCrowdsec(config Config, installDir string) error {
 		fmt.Printf("	%s exec crowdsec cscli bouncers add traefik-bouncer\n", config.InstallationContainerType)
 	}
 
+	return updateStoredAnswers(func(installed *Config) {
+		installed.DoCrowdsecInstall = true
+		installed.CrowdsecBouncerVersion = config.CrowdsecBouncerVersion
+		installed.TraefikBouncerKey = config.TraefikBouncerKey
+	})
+}
+
+// addCrowdsecForFirstStart adds CrowdSec to an installation whose
+// containers have not started yet. Without CrowdSec running to register the
+// bouncer with, the key is chosen here and passed to CrowdSec, which
+// registers it when it first starts.
+func addCrowdsecForFirstStart(config Config, installDir string) error {
+	if config.CrowdsecBouncerVersion == "" {
+		config.CrowdsecBouncerVersion = crowdsecBouncerVersion
+	}
+	config.TraefikBouncerKey = generateRandomSecretKey()
+
+	if err := backupConfig(); err != nil {
+		return fmt.Errorf("backup failed: %v", err)
+	}
+	if err := addCrowdsecConfig(config, installDir); err != nil {
+		return err
+	}
+	return updateStoredAnswers(func(installed *Config) {
+		installed.DoCrowdsecInstall = true
+		installed.CrowdsecBouncerVersion = config.CrowdsecBouncerVersion
+		installed.TraefikBouncerKey = config.TraefikBouncerKey
+	})
+}
+
+// addCrowdsecConfig renders the CrowdSec templates, merges their Traefik
+// settings into the Traefik config and enables the crowdsec service. The
+// CrowdSec templates are rendered on their own, so this works the same
+// right after the configuration was generated and on an installation made
+// long before.
+func addCrowdsecConfig(config Config, installDir string) error {
+	config.DoCrowdsecInstall = true
+	if err := createConfigFiles(config); err != nil {
+		return fmt.Errorf("error creating the CrowdSec config files: %v", err)
+	}
+	for _, dir := range []string{"config/crowdsec/db", "config/crowdsec/acquis.d", "config/traefik/logs"} {
+		if err := os.MkdirAll(dir, installer.DirModeFor(dir)); err != nil {
+			return fmt.Errorf("error creating %s: %v", dir, err)
+		}
+	}
+
+	setupTraefikLogRotate(installDir)
+
+	// Compose files from before the profiles lack the crowdsec service, and
+	// a bouncer key chosen up front goes into its environment
+	if services, _ := profileServices(composeFile, "crowdsec"); len(services) == 0 || config.TraefikBouncerKey != "" {
+		rendered, err := renderScratchConfig(config)
+		if err != nil {
+			return err
+		}
+		defer os.RemoveAll(rendered)
+		if err := copyDockerService(filepath.Join(rendered, "config", composeFile), composeFile, "crowdsec"); err != nil {
+			return fmt.Errorf("error adding the crowdsec service: %v", err)
+		}
+	}
+	if err := enableComposeProfile(composeFile, "crowdsec"); err != nil {
+		return fmt.Errorf("error enabling the crowdsec profile: %v", err)
+	}
+
+	// The rendered Traefik settings are merged in and removed again
+	for _, file := range []string{traefikStaticFile, traefikDynamicFile} {
+		overlay := filepath.Join("config/crowdsec", filepath.Base(file))
+		if err := MergeYAML(file, overlay); err != nil {
+			return fmt.Errorf("error merging %s into %s: %v", overlay, file, err)
+		}
+		if err := os.Remove(overlay); err != nil {
+			return fmt.Errorf("error removing %s: %v", overlay, err)
+		}
+	}
+
+	if err := CheckAndAddTraefikLogVolume(composeFile); err != nil {
+		return fmt.Errorf("error adding the Traefik log volume: %v", err)
+	}
+	if err := CheckAndAddCrowdsecDependency(composeFile); err != nil {
+		return fmt.Errorf("error adding crowdsec dependency to traefik: %v", err)
+	}
 	return nil
 }
 
+// checkIsCrowdsecInstalledInCompose reports whether the crowdsec service
+// runs: its profile is enabled, or it predates the profiles.
 func checkIsCrowdsecInstalledInCompose() bool {
-	// Read docker-compose.yml
-	content, err := os.ReadFile("docker-compose.yml")
+	data, err := os.ReadFile("docker-compose.yml")
 	if err != nil {
 		return false
 	}
-
-	// Check for crowdsec service
-	return bytes.Contains(content, []byte("crowdsec:"))
+	var compose map[string]any
+	if err := yaml.Unmarshal(data, &compose); err != nil {
+		return false
+	}
+	services, _ := compose["services"].(map[string]any)
+	service, ok := services["crowdsec"].(map[string]any)
+	return ok && serviceProfileActive(service, readComposeProfiles("docker-compose.yml"))
 }
 
 func GetCrowdSecAPIKey(containerType SupportedContainer) (string, error) {
 	// First, ensure the container is running
-	if err := waitForContainer("crowdsec", containerType); err != nil {
+	container := serviceContainer("crowdsec")
+	if err := waitForContainer(container, containerType); err != nil {
 		return "", fmt.Errorf("waiting for container: %w", err)
 	}
 
 	// Execute the command to get the API key
-	cmd := exec.Command(string(containerType), "exec", "crowdsec", "cscli", "bouncers", "add", "traefik-bouncer", "-o", "raw")
+	cmd := containerCommand(containerType, "exec", container, "cscli", "bouncers", "add", "traefik-bouncer", "-o", "raw")
 	var out bytes.Buffer
 	cmd.Stdout = &out
 
@@ -159,19 +302,13 @@ func checkIfTextInFile(file, text string) bool {
 
 func CheckAndAddCrowdsecDependency(composePath string) error {
 	// Read the docker-compose.yml file
-	data, err := os.ReadFile(composePath)
+	file, err := readYAMLFile(composePath)
 	if err != nil {
-		return fmt.Errorf("error reading compose file: %w", err)
-	}
-
-	// Parse YAML into a generic map
-	var compose map[string]any
-	if err := yaml.Unmarshal(data, &compose); err != nil {
-		return fmt.Errorf("error parsing compose file: %w", err)
+		return err
 	}
 
 	// Get services section
-	services, ok := compose["services"].(map[string]any)
+	services, ok := file.Doc["services"].(map[string]any)
 	if !ok {
 		return fmt.Errorf("services section not found or invalid")
 	}
@@ -188,24 +325,22 @@ func CheckAndAddCrowdsecDependency(composePath string) error {
 		// Append the new block for crowdsec
 		dependsOn["crowdsec"] = map[string]any{
 			"condition": "service_healthy",
+			// Lets Traefik start once the crowdsec profile is disabled
+			"required": false,
 		}
 	} else {
 		// No dependencies exist, create it
 		traefik["depends_on"] = map[string]any{
 			"crowdsec": map[string]any{
 				"condition": "service_healthy",
+				"required":  false,
 			},
 		}
 	}
 
-	// Marshal the modified data back to YAML with indentation
-	modifiedData, err := MarshalYAMLWithIndent(compose, 2) // Set indentation to 2 spaces
-	if err != nil {
-		log.Fatalf("error marshaling YAML: %v", err)
-	}
-
-	if err := os.WriteFile(composePath, modifiedData, 0644); err != nil {
-		return fmt.Errorf("error writing updated compose file: %w", err)
+	// Write the modified data back, keeping the rest of the file
+	if _, err := file.save(); err != nil {
+		return err
 	}
 
 	fmt.Println("Added dependency of crowdsec to traefik")
@@ -225,10 +360,15 @@ func setupTraefikLogRotate(installDir string) {
 
 	logPath := filepath.Join(installDir, "config/traefik/logs/access.log")
 
+	// Installs since the log rotation step already rotate all Traefik logs,
+	// and logrotate rejects a file listed in two configs
+	if _, err := os.Stat(logrotateConfigPath); err == nil {
+		fmt.Println(msg("crowdsecLogrotateCovered", logrotateConfigPath))
+		return
+	}
+
 	if os.Geteuid() != 0 {
-		fmt.Println("\n[logrotate] Skipping automatic logrotate setup: not running as root.")
-		fmt.Println("[logrotate] To prevent unbounded growth of the Traefik access log used by CrowdSec,")
-		fmt.Println("[logrotate] create the file /etc/logrotate.d/pangolin-traefik manually with:")
+		fmt.Println("\n" + msg("crowdsecLogrotateNeedsRoot", logrotateFile))
 		printLogrotateConfig(logPath)
 		return
 	}
@@ -246,20 +386,18 @@ func setupTraefikLogRotate(installDir string) {
 }
 `, logPath)
 
-	if err := os.MkdirAll(logrotateDir, 0755); err != nil {
-		fmt.Printf("[logrotate] Warning: could not create %s: %v\n", logrotateDir, err)
+	if err := hostOps.MkdirAll(logrotateDir, 0755); err != nil {
+		fmt.Println(msg("crowdsecLogrotateDirFailed", logrotateDir, err))
 		return
 	}
 
-	if err := os.WriteFile(logrotateFile, []byte(config), 0644); err != nil {
-		fmt.Printf("[logrotate] Warning: could not write %s: %v\n", logrotateFile, err)
-		fmt.Println("[logrotate] Set it up manually:")
+	if err := hostOps.WriteFile(logrotateFile, []byte(config), 0644); err != nil {
+		fmt.Println(msg("crowdsecLogrotateWriteFailed", logrotateFile, err))
 		printLogrotateConfig(logPath)
 		return
 	}
 
-	fmt.Printf("[logrotate] Wrote logrotate config to %s\n", logrotateFile)
-	fmt.Println("[logrotate] Traefik access logs will be rotated daily, keeping 7 compressed copies.")
+	fmt.Println(msg("crowdsecLogrotateWritten", logrotateFile))
 }
 
 // printLogrotateConfig prints a logrotate config block to stdout so users can
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/fosrl/pangolin/install/pkg/installer"
+)
+
+// TestFreshInstallWithCrowdsec runs the install steps of a fresh
+// non-interactive install with CrowdSec and checks that CrowdSec ends up in
+// the configuration, whether or not the containers are started. The host
+// changes go to a recorder, so no containers are started.
+func TestFreshInstallWithCrowdsec(t *testing.T) {
+	for _, start := range []bool{true, false} {
+		t.Run(fmt.Sprintf("start containers %v", start), func(t *testing.T) {
+			state := installForTest(t, start)
+			if state.StartContainers != start {
+				t.Fatalf("StartContainers = %v, want %v", state.StartContainers, start)
+			}
+			assertCrowdsecInstalled(t)
+
+			// Without running containers, CrowdSec registers the key the
+			// bouncer uses when it first starts
+			if !start {
+				installed, _, err := loadInstallState()
+				if err != nil {
+					t.Fatal(err)
+				}
+				key := installed.TraefikBouncerKey
+				if key == "" {
+					t.Fatal("no bouncer key was recorded")
+				}
+				compose := readYAMLMap(t, composeFile)
+				if got, _ := lookupString(compose, "services", "crowdsec", "environment", "BOUNCER_KEY_traefik"); got != key {
+					t.Errorf("crowdsec registers bouncer key %q, want %q", got, key)
+				}
+				dynamic := readYAMLMap(t, traefikDynamicFile)
+				if got, _ := lookupString(dynamic, "http", "middlewares", "crowdsec", "plugin", "crowdsec", "crowdsecLapiKey"); got != key {
+					t.Errorf("the bouncer uses key %q, want %q", got, key)
+				}
+			}
+		})
+	}
+}
+
+// installForTest runs the install steps of a fresh non-interactive install
+// with CrowdSec in a temporary directory, which becomes the working
+// directory, recording the host changes instead of making them.
+func installForTest(t *testing.T, startContainers bool) *installState {
+	t.Helper()
+	dir := t.TempDir()
+	t.Chdir(dir)
+	hostOps = &hostRecorder{}
+	// A non-interactive install does not install Docker, so the host has
+	// a docker command, one that finds no engine and no containers
+	bin := t.TempDir()
+	if err := os.WriteFile(filepath.Join(bin, "docker"), []byte("#!/bin/sh\n[ \"$1\" = --version ]\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+	nonInteractive, installCrowdsecAnswer, startContainersAnswer = true, true, startContainers
+	t.Cleanup(func() {
+		hostOps = systemHost{}
+		nonInteractive, installCrowdsecAnswer, startContainersAnswer = false, false, false
+		answeredConfig = Config{}
+	})
+
+	answeredConfig = installer.DefaultConfig()
+	answeredConfig.BaseDomain = "example.com"
+	answeredConfig.DashboardDomain = "pangolin.example.com"
+	answeredConfig.LetsEncryptEmail = "admin@example.com"
+	answeredConfig.Secret = "0123456789abcdef0123456789abcdef"
+	answeredConfig.PangolinVersion = "1.10.0"
+	answeredConfig.GerbilVersion = "1.2.0"
+	answeredConfig.BadgerVersion = "v1.2.0"
+	answeredConfig.TraefikVersion = "v3.6"
+	answeredConfig.CrowdsecBouncerVersion = "v1.4.2"
+
+	state := &installState{InstallDir: dir, CrowdsecRequested: true}
+	if err := runInstallSteps(state); err != nil {
+		t.Fatal(err)
+	}
+	return state
+}
+
+// assertCrowdsecInstalled checks that the installation in the current
+// directory runs CrowdSec with the bouncer in front of Traefik.
+func assertCrowdsecInstalled(t *testing.T) {
+	t.Helper()
+	compose := readYAMLMap(t, composeFile)
+	services, _ := compose["services"].(map[string]any)
+	if _, ok := services["crowdsec"]; !ok {
+		t.Fatalf("%s has no crowdsec service", composeFile)
+	}
+	if !checkIsCrowdsecInstalledInCompose() {
+		t.Errorf("the crowdsec profile is not enabled: COMPOSE_PROFILES=%s", strings.Join(readComposeProfiles(composeFile), ","))
+	}
+	traefik, _ := services["traefik"].(map[string]any)
+	if dependsOn, _ := traefik["depends_on"].(map[string]any); dependsOn["crowdsec"] == nil {
+		t.Error("traefik does not depend on crowdsec")
+	}
+
+	static := readYAMLMap(t, traefikStaticFile)
+	if _, ok := lookupString(static, "experimental", "plugins", "crowdsec", "moduleName"); !ok {
+		t.Errorf("%s does not load the bouncer plugin", traefikStaticFile)
+	}
+	value, _ := lookup(static, "entryPoints", "websecure", "http", "middlewares")
+	middlewares, _ := value.([]any)
+	if !slices.Contains(middlewares, any("crowdsec@file")) {
+		t.Errorf("the websecure entry point does not use the bouncer, middlewares: %v", middlewares)
+	}
+
+	dynamic := readYAMLMap(t, traefikDynamicFile)
+	if _, ok := lookup(dynamic, "http", "middlewares", "crowdsec", "plugin", "crowdsec"); !ok {
+		t.Errorf("%s does not define the bouncer middleware", traefikDynamicFile)
+	}
+	if _, err := os.Stat("config/crowdsec/traefik_config.yml"); !os.IsNotExist(err) {
+		t.Error("the merged CrowdSec Traefik config was left behind")
+	}
+}
+
+func readYAMLMap(t *testing.T, path string) map[string]any {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc map[string]any
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		t.Fatalf("%s: %v", path, err)
+	}
+	return doc
+}
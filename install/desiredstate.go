@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"gopkg.in/yaml.v3"
+)
+
+// desiredStateFile describes the installation beyond its answers, in the
+// installation directory. apply and every upgrade re-apply it, so the
+// settings and the API-managed sites and resources live next to the
+// infrastructure they run on:
+//
+//	settings:
+//	  log_driver: journald
+//	  monitoring: true
+//	org: home
+//	sites:
+//	  - name: homelab
+//	resources:
+//	  - name: Grafana
+//	    site: homelab
+//	    domain: grafana.example.com
+//	    targets: [http://10.0.0.5:3000]
+const desiredStateFile = "pangolin.yaml"
+
+// desiredState is the content of pangolin.yaml: answers file keys that
+// override the stored answers, and a resources file.
+type desiredState struct {
+	Settings      yaml.Node `yaml:"settings"`
+	resourcesFile `yaml:",inline"`
+}
+
+// loadDesiredState reads pangolin.yaml, which is nil if there is none.
+func loadDesiredState() (*desiredState, error) {
+	data, err := os.ReadFile(desiredStateFile)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var state desiredState
+	if err := yaml.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("error parsing %s: %w", desiredStateFile, err)
+	}
+	if err := state.check(); err != nil {
+		return nil, fmt.Errorf("%s: %v", desiredStateFile, err)
+	}
+	return &state, nil
+}
+
+// applyDesiredSettings overrides the answers in config with the settings of
+// pangolin.yaml.
+func applyDesiredSettings(config *Config) error {
+	state, err := loadDesiredState()
+	if err != nil || state == nil || state.Settings.Kind == 0 {
+		return err
+	}
+	if err := state.Settings.Decode(config); err != nil {
+		return fmt.Errorf("%s: invalid settings: %v", desiredStateFile, err)
+	}
+	return nil
+}
+
+// applyDesiredResources applies the sites and resources of pangolin.yaml
+// with the credentials stored by `api login`.
+func applyDesiredResources(dryRun bool) error {
+	state, err := loadDesiredState()
+	if err != nil {
+		return withExitCode(exitUsage, err)
+	}
+	if state == nil || (len(state.Sites) == 0 && len(state.Resources) == 0) {
+		return nil
+	}
+	session, err := storedAPISession(os.Getenv("PANGOLIN_API_KEY"), state.Org, "")
+	if err != nil {
+		return err
+	}
+	return applyResources(session, &state.resourcesFile, dryRun)
+}
+
+// reapplyDesiredState converges the installation on its answers and
+// pangolin.yaml after an upgrade, so the upgraded templates and the state
+// kept in the API match the declared one again.
+func reapplyDesiredState() error {
+	if _, err := os.Stat(desiredStateFile); err != nil {
+		return nil
+	}
+	fmt.Println("\n=== Applying " + desiredStateFile + " ===")
+	config, err := loadStoredAnswers(storedAnswersFile)
+	if err != nil {
+		return err
+	}
+	if err := convergeInstallation(config, storedAnswersFile, false); err != nil {
+		return err
+	}
+	return applyDesiredResources(false)
+}
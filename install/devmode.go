@@ -0,0 +1,159 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"flag"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"time"
+)
+
+// devMode selects the local development and evaluation install (--dev, the
+// default on macOS), for Docker Desktop, OrbStack or a Podman machine:
+//
+//   - Linux host setup is skipped: no sysctl changes, no docker group or
+//     root checks, no Docker installation, logrotate or systemd units, and
+//     no CrowdSec, which protects public servers;
+//   - the defaults suit a laptop: the stack is reachable on localhost
+//     domains, without Gerbil, MaxMind or automatic updates, and installs
+//     into ~/pangolin, which Docker Desktop shares with its VM by default;
+//   - Traefik serves a self-signed certificate generated by the installer
+//     instead of requesting one from Let's Encrypt.
+var devMode bool
+
+const (
+	devInstallDir = "~/pangolin"
+	devBaseDomain = "localhost"
+
+	devCertFile = "config/traefik/certs/dev.crt"
+	devKeyFile  = "config/traefik/certs/dev.key"
+)
+
+func init() {
+	registerStep(installStep{
+		Name:  "self-signed certificate",
+		Order: 25,
+		When: func(state *installState) bool {
+			return freshInstall(state) && state.Config.SelfSignedTLS
+		},
+		Run: func(state *installState) error {
+			if err := writeSelfSignedCertificate(state.Config); err != nil {
+				return fmt.Errorf("error creating the self-signed certificate: %v", err)
+			}
+			fmt.Println(msg("devCertificateCreated", devCertFile))
+			cert := filepath.Join(state.InstallDir, devCertFile)
+			if runtime.GOOS == "darwin" {
+				fmt.Printf("  security add-trusted-cert -r trustRoot -k ~/Library/Keychains/login.keychain-db %s\n", cert)
+			} else {
+				fmt.Printf("  sudo cp %s /usr/local/share/ca-certificates/pangolin-dev.crt && sudo update-ca-certificates\n", cert)
+			}
+			return nil
+		},
+	})
+}
+
+// devModeFlag registers --dev, which is on by default on macOS.
+func devModeFlag(flags *flag.FlagSet) {
+	flags.BoolVar(&devMode, "dev", runtime.GOOS == "darwin", "Install for local development on localhost with a self-signed certificate, skipping Linux host setup (default on macOS)")
+}
+
+// suggestedInstallDir is the installation directory offered when no install
+// is found.
+func suggestedInstallDir() string {
+	if devMode {
+		return devInstallDir
+	}
+	return defaultInstallDir
+}
+
+// ensureDesktopDocker checks that Docker Desktop, OrbStack or another local
+// Docker engine is installed and running, waiting for it to be started.
+func ensureDesktopDocker() {
+	if !isDockerInstalled() {
+		fmt.Println(msg("devDockerNotInstalled"))
+		os.Exit(exitPreflight)
+	}
+	if isDockerRunning() {
+		return
+	}
+
+	fmt.Println(msg("devDockerNotRunning"))
+	if runtime.GOOS == "darwin" {
+		// Starts Docker Desktop if present; OrbStack starts with its CLI
+		if exec.Command("open", "-ga", "Docker").Run() != nil {
+			exec.Command("orbctl", "start").Run()
+		}
+	}
+	if !waitUntil(waitTimeout, isDockerRunning) {
+		fmt.Printf("Docker is still not running after %v.\n", waitTimeout)
+		os.Exit(1)
+	}
+	fmt.Println("Docker is running!")
+}
+
+// writeSelfSignedCertificate creates the certificate Traefik serves by
+// default in dev mode, valid for the dashboard, the base domain and its
+// subdomains, and localhost.
+func writeSelfSignedCertificate(config Config) error {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return err
+	}
+
+	names := []string{config.DashboardDomain, config.BaseDomain, "*." + config.BaseDomain, "localhost"}
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: config.DashboardDomain, Organization: []string{"Pangolin development"}},
+		DNSNames:     uniqueNonEmpty(names),
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback},
+		NotBefore:    time.Now().Add(-time.Hour),
+		// Apple platforms reject server certificates valid for longer
+		NotAfter:              time.Now().AddDate(0, 0, 397),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return err
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(devCertFile), 0755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(devCertFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644); err != nil {
+		return err
+	}
+	return os.WriteFile(devKeyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}), 0600)
+}
+
+// uniqueNonEmpty drops empty and repeated entries, keeping the order.
+func uniqueNonEmpty(values []string) []string {
+	var result []string
+	for _, v := range values {
+		if v != "" && !slices.Contains(result, v) {
+			result = append(result, v)
+		}
+	}
+	return result
+}
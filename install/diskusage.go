@@ -0,0 +1,149 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/fosrl/pangolin/install/pkg/installer"
+)
+
+// diskUsageCategories group the paths of an installation, relative to the
+// installation directory, by what they hold.
+var diskUsageCategories = []struct {
+	Name  string
+	Paths []string
+	Hint  string
+}{
+	{"Database", []string{"config/db", "postgres18", "redis8", "config/postgres18", "config/redis8"}, ""},
+	{"Logs", []string{"config/logs", "config/traefik/logs"}, "Traefik access logs grow without bound unless rotated; old files in config/traefik/logs can be deleted."},
+	{"ACME storage", []string{"config/letsencrypt"}, ""},
+	{"CrowdSec data", []string{"config/crowdsec/db", "config/crowdsec/hub"}, ""},
+	{"GeoIP databases", []string{"config/GeoLite2-Country.mmdb", "config/GeoLite2-ASN.mmdb"}, ""},
+	{"Backups", []string{"config.tar.gz", "docker-compose.yml.backup", "backups"}, "Every upgrade and rollback adds a backup under backups/; remove old ones once the upgrade is known to work."},
+}
+
+// runDiskUsage reports the space used by the installation's data and by the
+// container images of the stack.
+func runDiskUsage(args []string) error {
+	flags := flag.NewFlagSet("disk-usage", flag.ExitOnError)
+	dir := flags.String("dir", "", "Installation directory")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if err := enterInstallDir(*dir); err != nil {
+		return err
+	}
+
+	fmt.Println("\n=== Disk Usage ===")
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	var total int64
+	var hints []string
+	for _, category := range diskUsageCategories {
+		var size int64
+		for _, path := range category.Paths {
+			size += pathSize(path)
+		}
+		total += size
+		fmt.Fprintf(w, "%s\t%s\n", category.Name, installer.FormatBytes(size))
+		if size > 100<<20 && category.Hint != "" {
+			hints = append(hints, category.Hint)
+		}
+	}
+
+	var imagesSize, oldImagesSize int64
+	containerType := detectContainerType()
+	if containerType != Undefined {
+		imagesSize = stackImagesSize(containerType)
+		oldImagesSize = oldImagesSizeOf(containerType)
+		fmt.Fprintf(w, "Container images\t%s\n", installer.FormatBytes(imagesSize))
+		if oldImagesSize > 0 {
+			fmt.Fprintf(w, "Old image versions\t%s\n", installer.FormatBytes(oldImagesSize))
+			hints = append(hints, "Old Pangolin and Gerbil images can be removed with `upgrade`, or manually with `"+string(containerType)+" image prune -a`.")
+		}
+	}
+	fmt.Fprintf(w, "Total\t%s\n", installer.FormatBytes(total+imagesSize+oldImagesSize))
+	w.Flush()
+
+	for _, hint := range hints {
+		fmt.Println("- " + hint)
+	}
+	return nil
+}
+
+// pathSize returns the total size of the files under path. Unreadable
+// entries, such as container-owned files, are skipped.
+func pathSize(path string) int64 {
+	var size int64
+	_ = filepath.WalkDir(path, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if d.Type().IsRegular() {
+			if info, err := d.Info(); err == nil {
+				size += info.Size()
+			}
+		}
+		return nil
+	})
+	return size
+}
+
+// stackImagesSize returns the size of the images the compose services run.
+func stackImagesSize(containerType SupportedContainer) int64 {
+	services, err := composeServices(composeFile)
+	if err != nil {
+		return 0
+	}
+
+	var size int64
+	seen := map[string]bool{}
+	for _, service := range services {
+		out, err := containerCommand(containerType, "inspect", "--format", "{{.Image}}", service.Container).Output()
+		if err != nil {
+			continue
+		}
+		image := strings.TrimSpace(string(out))
+		if seen[image] {
+			continue
+		}
+		seen[image] = true
+		size += imageSize(containerType, image)
+	}
+	return size
+}
+
+// oldImagesSizeOf returns the size of installer-managed image versions that
+// the compose file no longer references.
+func oldImagesSizeOf(containerType SupportedContainer) int64 {
+	var size int64
+	for _, repository := range prunableImages {
+		inUse, _ := ReadComposeImageTag(composeFile, strings.TrimPrefix(repository, "fosrl/"))
+		images, err := listLocalImages(containerType, repository)
+		if err != nil {
+			continue
+		}
+		for _, image := range images {
+			if image.Tag != inUse {
+				size += imageSize(containerType, image.ID)
+			}
+		}
+	}
+	return size
+}
+
+// imageSize returns the size of an image in bytes.
+func imageSize(containerType SupportedContainer, image string) int64 {
+	out, err := containerCommand(containerType, "image", "inspect", "--format", "{{.Size}}", image).Output()
+	if err != nil {
+		return 0
+	}
+	size, _ := strconv.ParseInt(strings.TrimSpace(string(out)), 10, 64)
+	return size
+}
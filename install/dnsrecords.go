@@ -0,0 +1,528 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/fosrl/pangolin/install/pkg/installer"
+)
+
+// dnsProvider creates records through the API of a DNS host. Upsert creates
+// the record or replaces the value of an existing one of the same type.
+type dnsProvider struct {
+	Label string
+	// Credential describes what the user has to enter
+	Credential string
+	Upsert     func(credential, name, recordType, value string) error
+}
+
+var dnsProviders = map[string]dnsProvider{
+	"cloudflare": {
+		Label:      "Cloudflare",
+		Credential: "API token with the Zone.DNS edit permission",
+		Upsert:     cloudflareUpsert,
+	},
+	"route53": {
+		Label:      "Amazon Route 53",
+		Credential: "access key as ACCESS_KEY_ID:SECRET_ACCESS_KEY",
+		Upsert:     route53Upsert,
+	},
+	"hetzner": {
+		Label:      "Hetzner DNS",
+		Credential: "API token",
+		Upsert:     hetznerUpsert,
+	},
+	"desec": {
+		Label:      "deSEC",
+		Credential: "API token",
+		Upsert:     desecUpsert,
+	},
+}
+
+// dnsRecordTTL is short so a wrong address is corrected quickly.
+const dnsRecordTTL = 300
+
+var apiHTTPClient = &http.Client{Timeout: 30 * time.Second}
+
+func init() {
+	registerStep(installStep{
+		Name:  "create DNS records",
+		Order: 35,
+		When: func(state *installState) bool {
+			return freshInstall(state) && !devMode && !state.Config.SelfSignedTLS
+		},
+		Run: func(state *installState) error {
+			createDNSRecords(state.Config)
+			return nil
+		},
+		Live: true,
+	})
+}
+
+// createDNSRecords points the dashboard domain and the wildcard of the base
+// domain at this server, through the DNS provider's API or by hand from a
+// report of the records, and waits until public resolvers return them so
+// Let's Encrypt can validate them when the stack starts. The install goes on
+// either way: the certificates are retried once the records exist.
+func createDNSRecords(config Config) {
+	fmt.Println("\n=== " + msg("sectionDNSRecords") + " ===")
+	records := dnsRecordsFor(config)
+	if len(records) == 0 {
+		fmt.Println(msg("dnsNoPublicIP"))
+		return
+	}
+
+	if readBool(msg("promptCreateDNSRecords"), false) && upsertDNSRecords(records) {
+		fmt.Println(msg("dnsWaitingForPropagation"))
+		if waitUntil(waitTimeout, func() bool { return installer.DNSRecordsPropagated(records) }) {
+			fmt.Println(msg("dnsPropagated"))
+		} else {
+			fmt.Println(msg("dnsNotPropagated", waitTimeout))
+		}
+		return
+	}
+
+	checkDNSRecordsByHand(records)
+}
+
+// checkDNSRecordsByHand prints the records for the user to create and checks
+// them again for as long as the user asks to.
+func checkDNSRecordsByHand(records []installer.DNSRecord) {
+	fmt.Println("\n" + msg("dnsRecordReport"))
+	printDNSRecordTable(records)
+	for {
+		missing := 0
+		for _, r := range records {
+			if problem := installer.DNSRecordProblem(r); problem != "" {
+				fmt.Printf("  ✗ %s %s: %s\n", r.Name, r.Type, problem)
+				missing++
+			} else {
+				fmt.Printf("  ✓ %s %s\n", r.Name, r.Type)
+			}
+		}
+		if missing == 0 {
+			fmt.Println(msg("dnsPropagated"))
+			return
+		}
+		if !readBool(msg("promptRecheckDNS"), true) {
+			fmt.Println(msg("dnsContinueWithoutRecords"))
+			return
+		}
+	}
+}
+
+// upsertDNSRecords asks for the DNS provider and its credential and creates
+// the records, reporting whether all of them were created.
+func upsertDNSRecords(records []installer.DNSRecord) bool {
+	names := dnsProviderNames()
+	var provider dnsProvider
+	for {
+		name := strings.ToLower(readString(msg("dnsProviderPrompt", strings.Join(names, ", ")), "cloudflare"))
+		if p, ok := dnsProviders[name]; ok {
+			provider = p
+			break
+		}
+		fmt.Println(msg("dnsProviderUnknown", name))
+	}
+	credential := readPassword(msg("dnsCredentialPrompt", provider.Label, provider.Credential), "")
+
+	for _, r := range records {
+		if err := provider.Upsert(credential, r.Name, r.Type, r.Value); err != nil {
+			fmt.Println(msg("dnsRecordFailed", r.Name, r.Type, err))
+			return false
+		}
+		fmt.Println(msg("dnsRecordCreated", r.Name, r.Type, r.Value))
+	}
+	return true
+}
+
+func dnsProviderNames() []string {
+	var names []string
+	for name := range dnsProviders {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// printDNSRecordTable prints the records to create, aligned for copying into
+// a DNS provider's form.
+func printDNSRecordTable(records []installer.DNSRecord) {
+	width := len("Name")
+	for _, r := range records {
+		width = max(width, len(r.Name))
+	}
+	fmt.Printf("\n  %-*s  %-4s  %s\n", width, "Name", "Type", "Value")
+	for _, r := range records {
+		fmt.Printf("  %-*s  %-4s  %s\n", width, r.Name, r.Type, r.Value)
+	}
+	fmt.Println()
+}
+
+// dnsRecordsFor returns the A and, with IPv6 enabled, AAAA records of the
+// dashboard domain and of the wildcard the resources are served on. They
+// point at the addresses collected for Gerbil, or else the detected ones.
+func dnsRecordsFor(config Config) []installer.DNSRecord {
+	var ips []string
+	if config.GerbilIPv4 != "" {
+		ips = append(ips, config.GerbilIPv4)
+	} else if !config.IPv6Only {
+		if ip, err := publicIPv4(); err == nil {
+			ips = append(ips, ip)
+		} else {
+			fmt.Println(err)
+		}
+	}
+	if config.GerbilIPv6 != "" {
+		ips = append(ips, config.GerbilIPv6)
+	} else if config.EnableIPv6 {
+		ip, err := publicIPv6()
+		if err != nil {
+			// The address of an interface is the public one without NAT66
+			for _, local := range installer.LocalAddresses() {
+				if strings.Contains(local, ":") {
+					ip, err = local, nil
+					break
+				}
+			}
+		}
+		if err == nil {
+			ips = append(ips, ip)
+		} else {
+			fmt.Println(err)
+		}
+	}
+	return installer.DNSRecordsTo(config, ips)
+}
+
+// dnsZoneCandidates returns the names the zone of name may be, from the most
+// to the least specific, down to the registered domain.
+func dnsZoneCandidates(name string) []string {
+	labels := strings.Split(strings.TrimPrefix(name, "*."), ".")
+	var candidates []string
+	for i := 0; i < len(labels)-1; i++ {
+		candidates = append(candidates, strings.Join(labels[i:], "."))
+	}
+	return candidates
+}
+
+// httpStatusError is a response of a provider API with an error status.
+type httpStatusError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *httpStatusError) Error() string { return e.Message }
+
+// jsonRequest sends a JSON request to a provider API and decodes the
+// response into out, returning the body in the error for any status other
+// than 2xx.
+func jsonRequest(method, rawURL string, headers map[string]string, body, out any) error {
+	var payload io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		payload = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, rawURL, payload)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := apiHTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return &httpStatusError{StatusCode: resp.StatusCode, Message: fmt.Sprintf("%s %s: %s: %s", method, req.URL.Path, resp.Status, strings.TrimSpace(string(data)))}
+	}
+	if out != nil && len(data) > 0 {
+		return json.Unmarshal(data, out)
+	}
+	return nil
+}
+
+const cloudflareAPI = "https://api.cloudflare.com/client/v4"
+
+func cloudflareUpsert(token, name, recordType, value string) error {
+	headers := map[string]string{"Authorization": "Bearer " + token}
+
+	var zoneID string
+	for _, candidate := range dnsZoneCandidates(name) {
+		var zones struct {
+			Result []struct {
+				ID string `json:"id"`
+			} `json:"result"`
+		}
+		if err := jsonRequest("GET", cloudflareAPI+"/zones?name="+url.QueryEscape(candidate), headers, nil, &zones); err != nil {
+			return err
+		}
+		if len(zones.Result) > 0 {
+			zoneID = zones.Result[0].ID
+			break
+		}
+	}
+	if zoneID == "" {
+		return fmt.Errorf("no zone for %s in this Cloudflare account", name)
+	}
+
+	var existing struct {
+		Result []struct {
+			ID string `json:"id"`
+		} `json:"result"`
+	}
+	query := url.Values{"type": {recordType}, "name": {name}}
+	if err := jsonRequest("GET", cloudflareAPI+"/zones/"+zoneID+"/dns_records?"+query.Encode(), headers, nil, &existing); err != nil {
+		return err
+	}
+	// Proxying through Cloudflare would break the WireGuard tunnels and the
+	// HTTP challenge, so the records are DNS only
+	record := map[string]any{"type": recordType, "name": name, "content": value, "ttl": dnsRecordTTL, "proxied": false}
+	if len(existing.Result) > 0 {
+		return jsonRequest("PUT", cloudflareAPI+"/zones/"+zoneID+"/dns_records/"+existing.Result[0].ID, headers, record, nil)
+	}
+	return jsonRequest("POST", cloudflareAPI+"/zones/"+zoneID+"/dns_records", headers, record, nil)
+}
+
+const hetznerDNSAPI = "https://dns.hetzner.com/api/v1"
+
+func hetznerUpsert(token, name, recordType, value string) error {
+	headers := map[string]string{"Auth-API-Token": token}
+
+	var zoneID, zoneName string
+	for _, candidate := range dnsZoneCandidates(name) {
+		var zones struct {
+			Zones []struct {
+				ID   string `json:"id"`
+				Name string `json:"name"`
+			} `json:"zones"`
+		}
+		// Hetzner answers 404 for a name that is not one of the zones
+		err := jsonRequest("GET", hetznerDNSAPI+"/zones?name="+url.QueryEscape(candidate), headers, nil, &zones)
+		var apiErr *httpStatusError
+		if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound {
+			continue
+		} else if err != nil {
+			return err
+		}
+		if len(zones.Zones) > 0 {
+			zoneID, zoneName = zones.Zones[0].ID, zones.Zones[0].Name
+			break
+		}
+	}
+	if zoneID == "" {
+		return fmt.Errorf("no zone for %s in this Hetzner DNS account", name)
+	}
+
+	relative := "@"
+	if name != zoneName {
+		relative = strings.TrimSuffix(name, "."+zoneName)
+	}
+	var existing struct {
+		Records []struct {
+			ID   string `json:"id"`
+			Type string `json:"type"`
+			Name string `json:"name"`
+		} `json:"records"`
+	}
+	if err := jsonRequest("GET", hetznerDNSAPI+"/records?zone_id="+url.QueryEscape(zoneID), headers, nil, &existing); err != nil {
+		return err
+	}
+	record := map[string]any{"zone_id": zoneID, "type": recordType, "name": relative, "value": value, "ttl": dnsRecordTTL}
+	for _, r := range existing.Records {
+		if r.Type == recordType && r.Name == relative {
+			return jsonRequest("PUT", hetznerDNSAPI+"/records/"+r.ID, headers, record, nil)
+		}
+	}
+	return jsonRequest("POST", hetznerDNSAPI+"/records", headers, record, nil)
+}
+
+const desecAPI = "https://desec.io/api/v1"
+
+// desecMinimumTTL is the lowest TTL deSEC accepts.
+const desecMinimumTTL = 3600
+
+func desecUpsert(token, name, recordType, value string) error {
+	headers := map[string]string{"Authorization": "Token " + token}
+
+	var domains []struct {
+		Name string `json:"name"`
+	}
+	if err := jsonRequest("GET", desecAPI+"/domains/?owns_qname="+url.QueryEscape(strings.TrimPrefix(name, "*.")), headers, nil, &domains); err != nil {
+		return err
+	}
+	if len(domains) == 0 {
+		return fmt.Errorf("no domain for %s in this deSEC account", name)
+	}
+	domain := domains[0].Name
+
+	subname := ""
+	if name != domain {
+		subname = strings.TrimSuffix(name, "."+domain)
+	}
+	// A bulk PUT creates the record set or replaces its records
+	rrsets := []map[string]any{{"subname": subname, "type": recordType, "ttl": desecMinimumTTL, "records": []string{value}}}
+	return jsonRequest("PUT", desecAPI+"/domains/"+domain+"/rrsets/", headers, rrsets, nil)
+}
+
+const route53API = "https://route53.amazonaws.com/2013-04-01"
+
+func route53Upsert(credential, name, recordType, value string) error {
+	keyID, secret, ok := strings.Cut(credential, ":")
+	if !ok {
+		return fmt.Errorf("enter the access key as ACCESS_KEY_ID:SECRET_ACCESS_KEY")
+	}
+
+	var zoneID string
+	for _, candidate := range dnsZoneCandidates(name) {
+		var zones struct {
+			HostedZones []struct {
+				ID   string `xml:"Id"`
+				Name string `xml:"Name"`
+			} `xml:"HostedZones>HostedZone"`
+		}
+		query := url.Values{"dnsname": {candidate}, "maxitems": {"1"}}
+		if err := route53Request(keyID, secret, "GET", "/hostedzonesbyname", query, nil, &zones); err != nil {
+			return err
+		}
+		// The list starts at dnsname, so the first zone may be a later one
+		if len(zones.HostedZones) > 0 && zones.HostedZones[0].Name == candidate+"." {
+			zoneID = strings.TrimPrefix(zones.HostedZones[0].ID, "/hostedzone/")
+			break
+		}
+	}
+	if zoneID == "" {
+		return fmt.Errorf("no hosted zone for %s in this AWS account", name)
+	}
+
+	type resourceRecordSet struct {
+		Name   string   `xml:"Name"`
+		Type   string   `xml:"Type"`
+		TTL    int      `xml:"TTL"`
+		Values []string `xml:"ResourceRecords>ResourceRecord>Value"`
+	}
+	type change struct {
+		Action string            `xml:"Action"`
+		Set    resourceRecordSet `xml:"ResourceRecordSet"`
+	}
+	request := struct {
+		XMLName xml.Name `xml:"https://route53.amazonaws.com/doc/2013-04-01/ ChangeResourceRecordSetsRequest"`
+		Changes []change `xml:"ChangeBatch>Changes>Change"`
+	}{
+		Changes: []change{{Action: "UPSERT", Set: resourceRecordSet{Name: name, Type: recordType, TTL: dnsRecordTTL, Values: []string{value}}}},
+	}
+	body, err := xml.Marshal(request)
+	if err != nil {
+		return err
+	}
+	return route53Request(keyID, secret, "POST", "/hostedzone/"+zoneID+"/rrset", nil, body, nil)
+}
+
+// route53Request calls the Route 53 API, signing the request with AWS
+// Signature Version 4, and decodes the XML response into out.
+func route53Request(keyID, secret, method, path string, query url.Values, body []byte, out any) error {
+	req, err := http.NewRequest(method, route53API+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.URL.RawQuery = query.Encode()
+	if body != nil {
+		req.Header.Set("Content-Type", "application/xml")
+	}
+	signAWSRequest(req, keyID, secret, "us-east-1", "route53", body, time.Now().UTC())
+
+	resp, err := apiHTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		var awsErr struct {
+			Message string `xml:"Error>Message"`
+		}
+		if xml.Unmarshal(data, &awsErr) == nil && awsErr.Message != "" {
+			return fmt.Errorf("%s %s: %s: %s", method, path, resp.Status, awsErr.Message)
+		}
+		return fmt.Errorf("%s %s: %s", method, path, resp.Status)
+	}
+	if out != nil {
+		return xml.Unmarshal(data, out)
+	}
+	return nil
+}
+
+// signAWSRequest adds the Signature Version 4 headers to req.
+func signAWSRequest(req *http.Request, keyID, secret, region, service string, body []byte, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	req.Header.Set("X-Amz-Date", amzDate)
+
+	payloadHash := sha256.Sum256(body)
+	headers := map[string]string{"host": req.URL.Host, "x-amz-date": amzDate}
+	if ct := req.Header.Get("Content-Type"); ct != "" {
+		headers["content-type"] = ct
+	}
+	var headerNames []string
+	for k := range headers {
+		headerNames = append(headerNames, k)
+	}
+	sort.Strings(headerNames)
+	var canonicalHeaders strings.Builder
+	for _, k := range headerNames {
+		canonicalHeaders.WriteString(k + ":" + headers[k] + "\n")
+	}
+	signedHeaders := strings.Join(headerNames, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		strings.ReplaceAll(req.URL.RawQuery, "+", "%20"),
+		canonicalHeaders.String(),
+		signedHeaders,
+		hex.EncodeToString(payloadHash[:]),
+	}, "\n")
+	scope := date + "/" + region + "/" + service + "/aws4_request"
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	key := []byte("AWS4" + secret)
+	for _, part := range []string{date, region, service, "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s", keyID, scope, signedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/fosrl/pangolin/install/pkg/installer"
+)
+
+// hostEngine is the Docker engine of the installation, detected once Docker
+// is chosen.
+var hostEngine installer.DockerEngine
+
+// nativeEngine reports whether the containers run on a native engine on
+// this host, which the host setup steps need.
+func nativeEngine(*installState) bool { return hostEngine.Native() }
+
+// confirmDockerEngine explains what changes on an engine that is not native
+// and, for a remote one, asks whether to go on.
+func confirmDockerEngine(config Config) bool {
+	fmt.Println("\n=== " + msg("sectionDockerEngine") + " ===")
+	fmt.Println(msg("dockerEngineDetected", hostEngine.Name, orUnknown(hostEngine.Host, "default context")))
+	fmt.Println(msg("dockerEngineHostSetupSkipped"))
+	if hostEngine.Container {
+		fmt.Println(msg("dockerEngineContainer"))
+		return true
+	}
+	if hostEngine.Remote {
+		fmt.Println(msg("dockerEngineRemote"))
+		return readBool(msg("promptRemoteDockerEngine"), false)
+	}
+	fmt.Println(msg("dockerEngineVM", hostEngine.Name))
+	if config.InstallGerbil {
+		fmt.Println(msg("dockerEngineVMUDP", config.WireGuardPort, config.ClientsWireGuardPort))
+	}
+	return true
+}
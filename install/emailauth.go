@@ -0,0 +1,198 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// spfLookupLimit is the number of DNS lookups an SPF evaluation may cause,
+// as in RFC 7208.
+const spfLookupLimit = 10
+
+// spfProviderDomains maps the domains of SMTP hosts to the domains their
+// operators publish SPF records on, for providers whose submission servers
+// are not the servers that deliver the mail.
+var spfProviderDomains = map[string]string{
+	"amazonaws.com": "amazonses.com",
+	"office365.com": "outlook.com",
+	"gmail.com":     "google.com",
+}
+
+// checkEmailAuthentication warns when the domain of the no-reply address
+// has no SPF record authorizing the SMTP host or no DMARC record, which
+// sends the invitation and password reset emails to spam. DNS errors skip
+// the check silently: it only advises.
+func checkEmailAuthentication(config Config) {
+	_, domain, ok := strings.Cut(config.EmailNoReply, "@")
+	if !ok || domain == "" || config.EmailSMTPHost == "" {
+		return
+	}
+
+	spf, err := lookupTXTRecord(domain, "v=spf1")
+	switch {
+	case err != nil:
+	case spf == "":
+		fmt.Println(msg("emailSPFMissing", domain, config.EmailNoReply))
+	default:
+		ips, err := net.LookupIP(config.EmailSMTPHost)
+		if err != nil {
+			break
+		}
+		lookups := 0
+		authorized, err := spfAuthorizes(domain, spf, ips, config.EmailSMTPHost, &lookups)
+		if err == nil && !authorized {
+			fmt.Println(msg("emailSPFNotAuthorized", domain, config.EmailSMTPHost, spf))
+		}
+	}
+
+	if dmarc, err := lookupTXTRecord("_dmarc."+domain, "v=DMARC1"); err == nil && dmarc == "" {
+		fmt.Println(msg("emailDMARCMissing", domain))
+	}
+}
+
+// lookupTXTRecord returns the TXT record of name starting with prefix, or an
+// empty string if it has none. A name that does not exist has none.
+func lookupTXTRecord(name, prefix string) (string, error) {
+	records, err := net.LookupTXT(name)
+	if err != nil {
+		if dnsErr, ok := err.(*net.DNSError); ok && dnsErr.IsNotFound {
+			return "", nil
+		}
+		return "", err
+	}
+	for _, record := range records {
+		if strings.HasPrefix(strings.ToLower(record), strings.ToLower(prefix)) {
+			return record, nil
+		}
+	}
+	return "", nil
+}
+
+// spfAuthorizes reports whether the SPF record of domain passes mail sent
+// from any of ips, or includes the SPF record of the SMTP host's operator. It
+// follows include and redirect up to spfLookupLimit lookups; exists and ptr
+// never match.
+func spfAuthorizes(domain, record string, ips []net.IP, smtpHost string, lookups *int) (bool, error) {
+	var redirect string
+	for _, term := range strings.Fields(record)[1:] {
+		qualifier := "+"
+		if strings.ContainsAny(term[:1], "+-~?") {
+			qualifier, term = term[:1], term[1:]
+		}
+		mechanism, value, _ := strings.Cut(term, ":")
+		if strings.HasPrefix(term, "redirect=") {
+			redirect = strings.TrimPrefix(term, "redirect=")
+			continue
+		}
+		// Prefix lengths on a and mx are ignored: the addresses match exactly
+		mechanism, _, _ = strings.Cut(mechanism, "/")
+		if mechanism == "a" || mechanism == "mx" {
+			value, _, _ = strings.Cut(value, "/")
+			if value == "" {
+				value = domain
+			}
+		}
+
+		var matched bool
+		switch mechanism {
+		case "all":
+			return qualifier == "+", nil
+		case "ip4", "ip6":
+			matched = spfAddressMatches(value, ips)
+		case "a", "mx":
+			*lookups++
+			if *lookups > spfLookupLimit {
+				return false, fmt.Errorf("too many DNS lookups")
+			}
+			hosts := []string{value}
+			if mechanism == "mx" {
+				mxs, err := net.LookupMX(value)
+				if err != nil {
+					continue
+				}
+				hosts = hosts[:0]
+				for _, mx := range mxs {
+					hosts = append(hosts, mx.Host)
+				}
+			}
+			for _, host := range hosts {
+				addrs, err := net.LookupIP(host)
+				if err != nil {
+					continue
+				}
+				for _, addr := range addrs {
+					matched = matched || spfAddressMatches(addr.String(), ips)
+				}
+			}
+		case "include":
+			if spfProviderDomain(value) == spfProviderDomain(smtpHost) {
+				matched = true
+				break
+			}
+			*lookups++
+			if *lookups > spfLookupLimit {
+				return false, fmt.Errorf("too many DNS lookups")
+			}
+			included, err := lookupTXTRecord(value, "v=spf1")
+			if err != nil || included == "" {
+				continue
+			}
+			if matched, err = spfAuthorizes(value, included, ips, smtpHost, lookups); err != nil {
+				return false, err
+			}
+		}
+		if matched {
+			return qualifier == "+", nil
+		}
+	}
+
+	if redirect == "" {
+		return false, nil
+	}
+	*lookups++
+	if *lookups > spfLookupLimit {
+		return false, fmt.Errorf("too many DNS lookups")
+	}
+	target, err := lookupTXTRecord(redirect, "v=spf1")
+	if err != nil || target == "" {
+		return false, err
+	}
+	return spfAuthorizes(redirect, target, ips, smtpHost, lookups)
+}
+
+// spfAddressMatches reports whether any of ips is the address or in the
+// network given by value.
+func spfAddressMatches(value string, ips []net.IP) bool {
+	if !strings.Contains(value, "/") {
+		if strings.Contains(value, ":") {
+			value += "/128"
+		} else {
+			value += "/32"
+		}
+	}
+	_, network, err := net.ParseCIDR(value)
+	if err != nil {
+		return false
+	}
+	for _, ip := range ips {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// spfProviderDomain returns the registered domain of host, approximated by
+// its last two labels, mapped through spfProviderDomains.
+func spfProviderDomain(host string) string {
+	labels := strings.Split(strings.TrimSuffix(strings.ToLower(host), "."), ".")
+	if len(labels) > 2 {
+		labels = labels[len(labels)-2:]
+	}
+	domain := strings.Join(labels, ".")
+	if mapped, ok := spfProviderDomains[domain]; ok {
+		return mapped
+	}
+	return domain
+}
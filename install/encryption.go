@@ -0,0 +1,213 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// Encryption methods for the config directory (Config.Encryption).
+const (
+	// encryptionLUKS keeps config/ in an ext4 filesystem inside a LUKS
+	// encrypted file next to it.
+	encryptionLUKS = "luks"
+	// encryptionFscrypt encrypts config/ in place with fscrypt, which needs
+	// a filesystem with the encrypt feature.
+	encryptionFscrypt = "fscrypt"
+)
+
+const (
+	luksContainerFile    = "config.luks"
+	luksContainerSize    = "2G"
+	luksMapperName       = "pangolin-config"
+	unlockUnitName       = "pangolin-unlock.service"
+	fscryptProtector     = "pangolin-config"
+	encryptionPassMinLen = 12
+)
+
+func init() {
+	registerStep(installStep{
+		Name:  "encrypt configuration directory",
+		Order: 18,
+		When: func(state *installState) bool {
+			return freshInstall(state) && state.Config.Encryption != ""
+		},
+		Run: func(state *installState) error {
+			return setupEncryptedConfig(state.InstallDir, state.Config.Encryption)
+		},
+	})
+}
+
+// collectEncryption offers to keep the config directory, which holds the
+// database, the secret key and the certificates, encrypted at rest. It needs
+// root and systemd, as the directory is unlocked by a unit on boot.
+func collectEncryption(config *Config) {
+	if runtime.GOOS != "linux" || os.Geteuid() != 0 || rootlessMode || devMode || !isSystemdRunning() {
+		return
+	}
+	var methods []string
+	for _, method := range []string{encryptionLUKS, encryptionFscrypt} {
+		if _, err := exec.LookPath(encryptionTool(method)); err == nil {
+			methods = append(methods, method)
+		}
+	}
+	if len(methods) == 0 || !readBool(msg("promptEncryption"), false) {
+		return
+	}
+
+	fmt.Println(msg("encryptionDescription"))
+	for {
+		method := strings.ToLower(readString(msg("promptEncryptionMethod", strings.Join(methods, "/")), methods[0]))
+		for _, m := range methods {
+			if method == m {
+				config.Encryption = method
+				return
+			}
+		}
+		fmt.Println(msg("encryptionMethodUnknown", method))
+	}
+}
+
+func encryptionTool(method string) string {
+	if method == encryptionFscrypt {
+		return "fscrypt"
+	}
+	return "cryptsetup"
+}
+
+func isSystemdRunning() bool {
+	_, err := os.Stat("/run/systemd/system")
+	return err == nil
+}
+
+// setupEncryptedConfig creates the encrypted config directory, unlocked, and
+// the unit that unlocks it on boot.
+func setupEncryptedConfig(installDir, method string) error {
+	fmt.Println("\n=== " + msg("sectionEncryption") + " ===")
+	fmt.Println(msg("encryptionPassphraseWarning"))
+	var passphrase string
+	for {
+		passphrase = readPassword(msg("promptEncryptionPassphrase"), "")
+		if len(passphrase) < encryptionPassMinLen {
+			fmt.Println(msg("encryptionPassphraseShort", encryptionPassMinLen))
+			continue
+		}
+		if readPassword(msg("promptEncryptionPassphraseConfirm"), "") == passphrase {
+			break
+		}
+		fmt.Println(msg("encryptionPassphraseMismatch"))
+	}
+
+	configDir := filepath.Join(installDir, "config")
+	var err error
+	if method == encryptionFscrypt {
+		err = encryptWithFscrypt(configDir, passphrase)
+	} else {
+		err = encryptWithLUKS(filepath.Join(installDir, luksContainerFile), configDir, passphrase)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to encrypt %s: %v", configDir, err)
+	}
+
+	if err := writeSystemdUnits(false, map[string]string{
+		unlockUnitName: renderUnlockUnit(installDir, method),
+	}); err != nil {
+		return err
+	}
+	if err := systemctl(false, "enable", unlockUnitName); err != nil {
+		return fmt.Errorf("failed to enable %s: %v", unlockUnitName, err)
+	}
+	fmt.Println(msg("encryptionEnabled", configDir, unlockUnitName))
+	return nil
+}
+
+// encryptWithLUKS creates the LUKS container, formats and mounts it on
+// configDir. The mount point is made immutable so that nothing, the
+// container runtime creating bind mount sources included, writes to the
+// unencrypted directory while the container is locked.
+func encryptWithLUKS(containerFile, configDir, passphrase string) error {
+	if err := os.MkdirAll(configDir, 0700); err != nil {
+		return err
+	}
+	if entries, _ := os.ReadDir(configDir); len(entries) > 0 {
+		return fmt.Errorf("%s is not empty", configDir)
+	}
+	script := fmt.Sprintf(`set -e
+fallocate -l %[3]s %[1]s 2>/dev/null || dd if=/dev/zero of=%[1]s bs=1M count=2048 status=none
+chmod 600 %[1]s
+printf '%%s\n' "$PASSPHRASE" | cryptsetup luksFormat --batch-mode --type luks2 %[1]s
+printf '%%s\n' "$PASSPHRASE" | cryptsetup open %[1]s %[4]s
+mkfs.ext4 -q /dev/mapper/%[4]s
+chattr +i %[2]s
+mount /dev/mapper/%[4]s %[2]s
+chmod 700 %[2]s`, shellQuote(containerFile), shellQuote(configDir), luksContainerSize, luksMapperName)
+	return runEncryptionScript(script, passphrase)
+}
+
+// encryptWithFscrypt sets up fscrypt on the filesystem of configDir if
+// needed and encrypts the empty directory with a passphrase protector.
+func encryptWithFscrypt(configDir, passphrase string) error {
+	if err := os.MkdirAll(configDir, 0700); err != nil {
+		return err
+	}
+	if entries, _ := os.ReadDir(configDir); len(entries) > 0 {
+		return fmt.Errorf("%s is not empty", configDir)
+	}
+	script := fmt.Sprintf(`set -e
+[ -e /etc/fscrypt.conf ] || fscrypt setup --quiet --force
+mountpoint=$(df --output=target %[1]s | tail -n 1)
+fscrypt status "$mountpoint" >/dev/null 2>&1 || fscrypt setup --quiet "$mountpoint"
+printf '%%s\n' "$PASSPHRASE" | fscrypt encrypt --quiet --source=custom_passphrase --name=%[2]s %[1]s`, shellQuote(configDir), fscryptProtector)
+	if err := runEncryptionScript(script, passphrase); err != nil {
+		return fmt.Errorf("%v (the filesystem needs the encrypt feature, see tune2fs -O encrypt)", err)
+	}
+	return nil
+}
+
+// runEncryptionScript runs script with the passphrase in its environment,
+// so it never appears on a command line.
+func runEncryptionScript(script, passphrase string) error {
+	cmd := exec.Command("sh", "-c", script)
+	cmd.Env = append(os.Environ(), "PASSPHRASE="+passphrase)
+	if out, err := hostOps.CombinedOutput(cmd); err != nil {
+		return fmt.Errorf("%v: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// renderUnlockUnit returns the unit that asks for the passphrase on boot and
+// unlocks the config directory before the container runtime starts the
+// stack. Answer the prompt on the console or over SSH with
+// systemd-tty-ask-password-agent.
+func renderUnlockUnit(installDir, method string) string {
+	configDir := shellQuote(filepath.Join(installDir, "config"))
+	ask := "systemd-ask-password --timeout=0 --id=pangolin " + shellQuote("Passphrase for "+filepath.Join(installDir, "config")+":")
+	var start, stop string
+	if method == encryptionFscrypt {
+		start = fmt.Sprintf(`%s | fscrypt unlock --quiet %s`, ask, configDir)
+		stop = fmt.Sprintf(`fscrypt lock %s`, configDir)
+	} else {
+		container := shellQuote(filepath.Join(installDir, luksContainerFile))
+		start = fmt.Sprintf(`%s | cryptsetup open %s %s && mount /dev/mapper/%s %s`, ask, container, luksMapperName, luksMapperName, configDir)
+		stop = fmt.Sprintf(`umount %s; cryptsetup close %s`, configDir, luksMapperName)
+	}
+
+	return fmt.Sprintf(`# Generated by the Pangolin installer.
+[Unit]
+Description=Unlock the encrypted Pangolin configuration
+Before=docker.service podman-restart.service
+After=local-fs.target
+
+[Service]
+Type=oneshot
+RemainAfterExit=yes
+ExecStart=%s
+ExecStop=%s
+
+[Install]
+WantedBy=multi-user.target
+`, systemdShellCommand(start), systemdShellCommand(stop))
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// TestUnlockUnitQuoting runs the commands of the unlock unit of an
+// installation directory with spaces, quotes and the characters systemd
+// expands in its path, and checks that every command gets the paths as
+// single arguments.
+func TestUnlockUnitQuoting(t *testing.T) {
+	installDir := filepath.Join(t.TempDir(), `it's a "test" $HOME 100% \ dir`)
+	configDir := filepath.Join(installDir, "config")
+	container := filepath.Join(installDir, luksContainerFile)
+
+	for _, tt := range []struct {
+		method      string
+		start, stop [][]string
+	}{
+		{
+			method: encryptionFscrypt,
+			start: [][]string{
+				{"systemd-ask-password", "--timeout=0", "--id=pangolin", "Passphrase for " + configDir + ":"},
+				{"fscrypt", "unlock", "--quiet", configDir},
+			},
+			stop: [][]string{{"fscrypt", "lock", configDir}},
+		},
+		{
+			method: encryptionLUKS,
+			start: [][]string{
+				{"systemd-ask-password", "--timeout=0", "--id=pangolin", "Passphrase for " + configDir + ":"},
+				{"cryptsetup", "open", container, luksMapperName},
+				{"mount", "/dev/mapper/" + luksMapperName, configDir},
+			},
+			stop: [][]string{{"umount", configDir}, {"cryptsetup", "close", luksMapperName}},
+		},
+	} {
+		t.Run(tt.method, func(t *testing.T) {
+			unit := renderUnlockUnit(installDir, tt.method)
+			for setting, want := range map[string][][]string{"ExecStart": tt.start, "ExecStop": tt.stop} {
+				got := runUnitScript(t, unitShellScript(t, unit, setting))
+				slices.SortFunc(got, func(a, b []string) int { return strings.Compare(a[0], b[0]) })
+				slices.SortFunc(want, func(a, b []string) int { return strings.Compare(a[0], b[0]) })
+				if !slices.EqualFunc(got, want, slices.Equal) {
+					t.Errorf("%s runs %q, want %q", setting, got, want)
+				}
+			}
+		})
+	}
+}
+
+// unitShellScript returns the script of a /bin/sh -c command line in unit
+// as systemd passes it to the shell: with the specifiers, quoting and
+// environment variables of the unit file resolved.
+func unitShellScript(t *testing.T, unit, setting string) string {
+	t.Helper()
+	var value string
+	for _, line := range strings.Split(unit, "\n") {
+		if v, ok := strings.CutPrefix(line, setting+"="); ok {
+			value = v
+		}
+	}
+	quoted, ok := strings.CutPrefix(value, "/bin/sh -c '")
+	if !ok || !strings.HasSuffix(quoted, "'") {
+		t.Fatalf("%s is not a quoted shell command: %s", setting, value)
+	}
+	quoted = strings.TrimSuffix(quoted, "'")
+
+	if strings.Count(quoted, "%")%2 != 0 {
+		t.Fatalf("%s has an unescaped specifier: %s", setting, value)
+	}
+	quoted = strings.ReplaceAll(quoted, "%%", "%")
+	var script strings.Builder
+	for i := 0; i < len(quoted); i++ {
+		switch quoted[i] {
+		case '\\':
+			i++
+			script.WriteByte(quoted[i])
+		case '\'':
+			t.Fatalf("%s ends its quoting early: %s", setting, value)
+		default:
+			script.WriteByte(quoted[i])
+		}
+	}
+	if strings.Count(script.String(), "$")%2 != 0 {
+		t.Fatalf("%s has an unescaped variable: %s", setting, value)
+	}
+	return strings.ReplaceAll(script.String(), "$$", "$")
+}
+
+// runUnitScript runs script with the commands of the unlock unit replaced
+// by ones that record their arguments, and returns the commands it ran.
+func runUnitScript(t *testing.T, script string) [][]string {
+	t.Helper()
+	bin := t.TempDir()
+	log := filepath.Join(bin, "log")
+	stub := "#!/bin/sh\n{ printf '%s\\0' \"${0##*/}\" \"$@\"; printf '\\n'; } >> \"$LOG\"\n"
+	for _, name := range []string{"systemd-ask-password", "fscrypt", "cryptsetup", "mount", "umount"} {
+		if err := os.WriteFile(filepath.Join(bin, name), []byte(stub), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cmd := exec.Command("/bin/sh", "-c", script)
+	cmd.Env = append(os.Environ(), "PATH="+bin+string(os.PathListSeparator)+os.Getenv("PATH"), "LOG="+log)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("%s: %v: %s", script, err, out)
+	}
+	data, err := os.ReadFile(log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var commands [][]string
+	for _, line := range strings.Split(strings.TrimSuffix(string(data), "\n"), "\n") {
+		commands = append(commands, strings.Split(strings.TrimSuffix(line, "\x00"), "\x00"))
+	}
+	return commands
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// exampleProfile is the compose profile of the containers behind the
+// example resources.
+const exampleProfile = "examples"
+
+// exampleResources are the demo resources offered after the install: a
+// whoami container that echoes the request, which shows the headers Pangolin
+// adds once the user is authenticated.
+func exampleResources(baseDomain string) []importedResource {
+	return []importedResource{
+		{
+			Name:     "whoami",
+			Hostname: "whoami." + baseDomain,
+			Protocol: "tcp",
+			HTTP:     true,
+			Targets:  []importedTarget{{Method: "http", Host: "whoami", Port: 80}},
+		},
+	}
+}
+
+func init() {
+	registerStep(installStep{
+		Name:  "example resources",
+		Order: 115,
+		When:  containersStarting,
+		Run: func(state *installState) error {
+			offerExampleResources(state.Config)
+			return nil
+		},
+		Live: true,
+	})
+}
+
+// offerExampleResources creates the example resources in an organization
+// of the admin, who has to complete the initial setup first. Failing is not
+// fatal: the installation works without them.
+func offerExampleResources(config Config) {
+	if !readBool(msg("promptExampleResources", "whoami."+config.BaseDomain), false) {
+		return
+	}
+	fmt.Println("\n=== " + msg("sectionExampleResources") + " ===")
+	fmt.Println(msg("exampleResourcesLoginHint", config.DashboardDomain))
+
+	api := newDashboardClient(config.InstallationContainerType)
+	for {
+		email := readString(msg("promptAdminEmail"), "")
+		if email == "" {
+			fmt.Println(msg("exampleResourcesSkipped"))
+			return
+		}
+		err := api.login(email, readPassword(msg("promptAdminPassword"), ""))
+		if err == nil {
+			break
+		}
+		fmt.Println(msg("exampleResourcesLoginFailed", err))
+	}
+
+	var orgs struct {
+		Orgs []struct {
+			OrgID string `json:"orgId"`
+		} `json:"orgs"`
+	}
+	if err := api.do("GET", "/orgs", nil, &orgs); err != nil || len(orgs.Orgs) == 0 {
+		fmt.Println(msg("exampleResourcesNoOrg"))
+		return
+	}
+	var ids []string
+	for _, org := range orgs.Orgs {
+		ids = append(ids, org.OrgID)
+	}
+	orgID := ids[0]
+	if len(ids) > 1 {
+		orgID = readString(msg("promptExampleOrg", strings.Join(ids, ", ")), ids[0])
+	}
+
+	if err := seedExampleResources(api, config, orgID); err != nil {
+		fmt.Println(msg("exampleResourcesFailed", err))
+		return
+	}
+	for _, r := range exampleResources(config.BaseDomain) {
+		fmt.Println(msg("exampleResourcesCreated", r.Hostname))
+	}
+}
+
+// seedExampleResources starts the example containers and creates their
+// resources behind a local site, whose targets Traefik reaches directly.
+func seedExampleResources(api *apiClient, config Config, orgID string) error {
+	if err := enableComposeProfile(composeFile, exampleProfile); err != nil {
+		return err
+	}
+	if err := composeCommand(config.InstallationContainerType, "up", "-d"); err != nil {
+		return fmt.Errorf("failed to start the example containers: %v", err)
+	}
+
+	var site struct {
+		SiteID int `json:"siteId"`
+	}
+	if err := api.do("PUT", "/org/"+orgID+"/site", map[string]any{"name": "Examples", "type": "local"}, &site); err != nil {
+		return fmt.Errorf("failed to create the site: %v", err)
+	}
+	return createImportedResources(api, orgID, site.SiteID, exampleResources(config.BaseDomain))
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+)
+
+// Exit codes of the installer and its subcommands, so wrappers and CI can
+// branch on the class of a failure rather than on the error text.
+const (
+	exitOK = 0
+	// exitFailure is a failure at run time: a container, command or file
+	// operation failed.
+	exitFailure = 1
+	// exitUsage is an unknown flag or invalid argument. The flag package
+	// exits with 2 as well.
+	exitUsage = 2
+	// exitPreflight is a requirement of the host or the installation that
+	// is not met, found before anything was changed.
+	exitPreflight = 3
+	// exitAborted is the user cancelling at a prompt or declining a
+	// confirmation.
+	exitAborted = 4
+	// exitNetwork is a download, API call or DNS lookup that failed.
+	exitNetwork = 5
+	// exitPartial is a completed main task whose follow-up steps were
+	// skipped or failed, e.g. a restore that was not started.
+	exitPartial = 6
+	// exitDrift is an installation that differs from its recorded
+	// configuration, as reported by check.
+	exitDrift = 7
+	// exitInterrupted is SIGINT or SIGTERM, as shells report it.
+	exitInterrupted = 130
+)
+
+// exitCodeHelp documents the exit codes in the usage output.
+const exitCodeHelp = `
+Exit codes:
+  0    success
+  1    runtime failure
+  2    usage error
+  3    preflight failure, nothing was changed
+  4    aborted by the user
+  5    network failure
+  6    partial success
+  7    installation differs from its configuration (check)
+  130  interrupted
+`
+
+// exitError attaches an exit code to an error.
+type exitError struct {
+	Code int
+	Err  error
+}
+
+func (e *exitError) Error() string { return e.Err.Error() }
+func (e *exitError) Unwrap() error { return e.Err }
+
+func withExitCode(code int, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &exitError{Code: code, Err: err}
+}
+
+func preflightErrorf(format string, args ...any) error {
+	return withExitCode(exitPreflight, fmt.Errorf(format, args...))
+}
+
+func usageErrorf(format string, args ...any) error {
+	return withExitCode(exitUsage, fmt.Errorf(format, args...))
+}
+
+// errAborted is returned by subcommands when the user declines to proceed.
+var errAborted = withExitCode(exitAborted, errors.New("aborted"))
+
+// exitCodeFor returns the exit code for an error: the code attached to it,
+// exitNetwork for network errors, and exitFailure otherwise.
+func exitCodeFor(err error) int {
+	if err == nil {
+		return exitOK
+	}
+	var coded *exitError
+	if errors.As(err, &coded) {
+		return coded.Code
+	}
+	var netErr net.Error
+	var urlErr *url.Error
+	var dnsErr *net.DNSError
+	var statusErr *httpStatusError
+	if errors.As(err, &netErr) || errors.As(err, &urlErr) || errors.As(err, &dnsErr) || errors.As(err, &statusErr) {
+		return exitNetwork
+	}
+	return exitFailure
+}
+
+// exitWithError prints err, unless it is a plain abort whose message was
+// already shown, and exits with its code.
+func exitWithError(err error) {
+	if err != errAborted {
+		fmt.Printf("Error: %v\n", err)
+	}
+	os.Exit(exitCodeFor(err))
+}
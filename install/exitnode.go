@@ -0,0 +1,296 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"text/template"
+
+	"github.com/fosrl/pangolin/install/pkg/installer"
+)
+
+// nodeName matches the names of exit and app nodes, which are templated into
+// file names and configs unquoted.
+var nodeName = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+
+// exitNodesDir holds the deployment artifacts of the additional exit nodes,
+// one directory per node.
+const exitNodesDir = "exit-nodes"
+
+// exitNode is an additional Gerbil exit node on another server. It runs
+// Pangolin in managed mode, which fetches its configuration from the main
+// instance, with Gerbil and Traefik next to it.
+type exitNode struct {
+	Name     string
+	ID       string
+	Secret   string
+	Endpoint string
+	// MainURL is the dashboard URL of the main instance the node registers
+	// with
+	MainURL              string
+	Email                string
+	PangolinImage        string
+	GerbilVersion        string
+	TraefikVersion       string
+	WireGuardPort        int
+	ClientsWireGuardPort int
+}
+
+var exitNodeTemplates = map[string]string{
+	"docker-compose.yml": `# Exit node {{.Name}}, generated by the Pangolin installer.
+name: pangolin-node
+services:
+  pangolin:
+    image: {{.PangolinImage}}
+    container_name: pangolin
+    restart: unless-stopped
+    volumes:
+      - ./config:/app/config
+    healthcheck:
+      test: ["CMD", "curl", "-f", "http://localhost:3001/api/v1/"]
+      interval: "10s"
+      timeout: "10s"
+      retries: 15
+
+  gerbil:
+    image: docker.io/fosrl/gerbil:{{.GerbilVersion}}
+    container_name: gerbil
+    restart: unless-stopped
+    depends_on:
+      pangolin:
+        condition: service_healthy
+    command:
+      - --reachableAt=http://gerbil:3004
+      - --generateAndSaveKeyTo=/var/config/key
+      - --remoteConfig=http://pangolin:3001/api/v1/
+    volumes:
+      - ./config/:/var/config
+    cap_add:
+      - NET_ADMIN
+      - SYS_MODULE
+    ports:
+      - {{.WireGuardPort}}:{{.WireGuardPort}}/udp
+      - {{.ClientsWireGuardPort}}:{{.ClientsWireGuardPort}}/udp
+      - 443:443
+      - 80:80
+
+  traefik:
+    image: docker.io/traefik:{{.TraefikVersion}}
+    container_name: traefik
+    restart: unless-stopped
+    network_mode: service:gerbil
+    depends_on:
+      pangolin:
+        condition: service_healthy
+    command:
+      - --configFile=/etc/traefik/traefik_config.yml
+    volumes:
+      - ./config/traefik:/etc/traefik:ro
+      - ./config/letsencrypt:/letsencrypt
+
+networks:
+  default:
+    driver: bridge
+    name: pangolin
+`,
+	"config/config.yml": `# Exit node {{.Name}}, generated by the Pangolin installer. The node
+# fetches everything else from {{.MainURL}}.
+gerbil:
+    start_port: {{.WireGuardPort}}
+    clients_start_port: {{.ClientsWireGuardPort}}
+    base_endpoint: "{{.Endpoint}}"
+
+managed:
+    id: "{{.ID}}"
+    secret: "{{.Secret}}"
+    endpoint: "{{.MainURL}}"
+`,
+	"config/traefik/traefik_config.yml": `# Exit node {{.Name}}, generated by the Pangolin installer.
+providers:
+  http:
+    endpoint: "http://pangolin:3001/api/v1/traefik-config"
+    pollInterval: "5s"
+
+entryPoints:
+  web:
+    address: ":80"
+  websecure:
+    address: ":443"
+    http:
+      tls:
+        certResolver: "letsencrypt"
+
+certificatesResolvers:
+  letsencrypt:
+    acme:
+      httpChallenge:
+        entryPoint: web
+      email: "{{.Email}}"
+      storage: "/letsencrypt/acme.json"
+      caServer: "https://acme-v02.api.letsencrypt.org/directory"
+
+log:
+  level: "INFO"
+`,
+}
+
+// runExitNode manages the additional exit nodes of the installation.
+func runExitNode(args []string) error {
+	usage := "usage: installer exit-node <add <name>|list> [flags]"
+	if len(args) == 0 {
+		return usageErrorf("%s", usage)
+	}
+	switch args[0] {
+	case "add":
+		return runExitNodeAdd(args[1:])
+	case "list":
+		return runExitNodeList(args[1:])
+	}
+	return usageErrorf("unknown exit-node command %q\n%s", args[0], usage)
+}
+
+// runExitNodeAdd registers an exit node with the main instance and writes
+// the files to deploy it with into exit-nodes/<name>.
+func runExitNodeAdd(args []string) error {
+	flags := flag.NewFlagSet("exit-node add", flag.ExitOnError)
+	common := addAPIFlags(flags)
+	endpoint := flags.String("endpoint", "", "Public domain or IP address of the node's server")
+	email := flags.String("email", "", "Email for the node's Let's Encrypt account (default: the one of the main instance)")
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		return usageErrorf("usage: installer exit-node add <name> --endpoint <domain or IP> [flags]")
+	}
+	name := args[0]
+	if err := flags.Parse(args[1:]); err != nil {
+		return err
+	}
+	if !nodeName.MatchString(name) {
+		return usageErrorf("the node name may only contain letters, digits, '.', '_' and '-'")
+	}
+	if *endpoint == "" {
+		return usageErrorf("--endpoint is required")
+	}
+
+	session, err := common.session()
+	if err != nil {
+		return err
+	}
+	dir := filepath.Join(exitNodesDir, name)
+	if _, err := os.Stat(dir); err == nil {
+		return usageErrorf("%s already exists; remove it to generate the node again", dir)
+	}
+
+	config, err := readAppConfigMap()
+	if err != nil {
+		return err
+	}
+	node := exitNode{
+		Name:                 name,
+		Endpoint:             *endpoint,
+		MainURL:              session.dashboardURL,
+		Email:                *email,
+		GerbilVersion:        gerbilVersion,
+		TraefikVersion:       traefikVersion,
+		WireGuardPort:        installer.DefaultWireGuardPort,
+		ClientsWireGuardPort: installer.DefaultClientsWireGuardPort,
+	}
+	if port, ok := lookup(config, "gerbil", "start_port"); ok {
+		node.WireGuardPort, _ = port.(int)
+	}
+	if port, ok := lookup(config, "gerbil", "clients_start_port"); ok {
+		node.ClientsWireGuardPort, _ = port.(int)
+	}
+	if node.Email == "" {
+		if installed, ok, err := loadInstallState(); err == nil && ok {
+			node.Email = installed.LetsEncryptEmail
+		} else if traefik, err := ReadTraefikConfig(traefikStaticFile); err == nil {
+			node.Email = traefik.LetsEncryptEmail
+		}
+	}
+	if node.Email == "" {
+		return usageErrorf("--email is required, the installation has no Let's Encrypt email")
+	}
+	tag, err := ReadComposeImageTag(composeFile, "pangolin")
+	if err != nil || tag == "" {
+		return fmt.Errorf("could not read the Pangolin image of the installation: %v", err)
+	}
+	// The node keeps no database of its own
+	node.PangolinImage = "docker.io/fosrl/pangolin:" + strings.Replace(tag, "postgresql-", "", 1)
+
+	var defaults struct {
+		RemoteExitNodeID string `json:"remoteExitNodeId"`
+		Secret           string `json:"secret"`
+	}
+	if err := session.api.do("GET", "/org/"+session.org+"/pick-remote-exit-node-defaults", nil, &defaults); err != nil {
+		return fmt.Errorf("failed to get exit node defaults: %v", err)
+	}
+	if err := session.api.do("PUT", "/org/"+session.org+"/remote-exit-node", map[string]any{
+		"name": name, "remoteExitNodeId": defaults.RemoteExitNodeID, "secret": defaults.Secret,
+	}, nil); err != nil {
+		return fmt.Errorf("failed to register the exit node: %v", err)
+	}
+	node.ID, node.Secret = defaults.RemoteExitNodeID, defaults.Secret
+
+	for _, path := range sortedKeys(exitNodeTemplates) {
+		var out bytes.Buffer
+		if err := template.Must(template.New(path).Parse(exitNodeTemplates[path])).Execute(&out, node); err != nil {
+			return err
+		}
+		full := filepath.Join(dir, path)
+		if err := os.MkdirAll(filepath.Dir(full), 0700); err != nil {
+			return err
+		}
+		// The config holds the node secret
+		if err := os.WriteFile(full, out.Bytes(), 0600); err != nil {
+			return fmt.Errorf("failed to write %s: %v", full, err)
+		}
+	}
+	recordChange(fmt.Sprintf("Add exit node %s at %s", name, *endpoint))
+
+	fmt.Printf("Registered exit node %s (%s) and wrote its files to %s.\n\n", name, node.ID, dir)
+	fmt.Println("To deploy it:")
+	fmt.Printf("  1. Point %s at the node's server.\n", *endpoint)
+	fmt.Printf("  2. Open 80/tcp, 443/tcp, %d/udp and %d/udp on it.\n", node.WireGuardPort, node.ClientsWireGuardPort)
+	fmt.Printf("  3. Copy the directory: scp -r %s root@%s:/opt/pangolin-node\n", dir, *endpoint)
+	fmt.Printf("  4. Start it there: cd /opt/pangolin-node && docker compose up -d\n")
+	fmt.Println("The node shows as online in the organization settings once it connected.")
+	return nil
+}
+
+func runExitNodeList(args []string) error {
+	flags := flag.NewFlagSet("exit-node list", flag.ExitOnError)
+	common := addAPIFlags(flags)
+	jsonOutput := flags.Bool("json", false, "Print the API response as JSON")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	session, err := common.session()
+	if err != nil {
+		return err
+	}
+	session.json = *jsonOutput
+
+	var response struct {
+		Nodes []struct {
+			ID      string `json:"remoteExitNodeId"`
+			Name    string `json:"name"`
+			Address string `json:"address"`
+			Online  bool   `json:"online"`
+		} `json:"remoteExitNodes"`
+	}
+	if err := session.api.do("GET", "/org/"+session.org+"/remote-exit-nodes", nil, &response); err != nil {
+		return err
+	}
+	var rows [][]string
+	for _, node := range response.Nodes {
+		state := "offline"
+		if node.Online {
+			state = "online"
+		}
+		rows = append(rows, []string{node.ID, node.Name, node.Address, state})
+	}
+	return printAPIList(session, response, "ID\tNAME\tADDRESS\tSTATE", rows)
+}
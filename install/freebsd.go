@@ -0,0 +1,137 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// On FreeBSD the stack runs under Podman, which runs the Linux images in
+// jails through ocijail and the Linux binary compatibility layer. Docker is
+// not available there, the Linux sysctl and docker group setup does not
+// apply (Podman runs as root and may bind low ports), and the stack is
+// started at boot by an rc.d script instead of a systemd unit.
+
+const (
+	rcScriptName = "pangolin"
+	rcScriptPath = "/usr/local/etc/rc.d/" + rcScriptName
+)
+
+func init() {
+	registerStep(installStep{
+		Name:  "rc.d service",
+		Order: 80,
+		When: func(state *installState) bool {
+			return containersStarting(state) && isFreeBSD()
+		},
+		Run: func(state *installState) error {
+			if confirmHostChange(msg("promptRcScript"), true) {
+				if err := installRcScript(state.InstallDir); err != nil {
+					fmt.Printf("Error setting up the rc.d service: %v\n", err)
+				}
+			}
+			return nil
+		},
+	})
+}
+
+func isFreeBSD() bool {
+	return runtime.GOOS == "freebsd"
+}
+
+// freeBSDContainer checks that Podman can run the Linux images of the stack
+// and offers to load the Linux compatibility layer if it is missing.
+func freeBSDContainer() SupportedContainer {
+	fmt.Println(msg("freeBSDPodmanOnly"))
+	if !isPodmanInstalled() {
+		fmt.Println("Podman or podman-compose is not installed. Install them with:")
+		fmt.Println("   pkg install podman-suite py311-podman-compose")
+		os.Exit(exitPreflight)
+	}
+
+	if exec.Command("kldstat", "-q", "-m", "linux64").Run() != nil {
+		const load = "kldload linux64 && sysrc kld_list+=linux64"
+		if confirmHostChange(msg("freeBSDLoadLinux", load), true) {
+			if !canBecomeRoot() {
+				fmt.Println(msg("podmanUnprivilegedPortsNeedsRoot"))
+				os.Exit(exitPreflight)
+			}
+			if err := runAsRoot("kldload", "sh", "-c", load); err != nil {
+				fmt.Printf("Error loading the Linux compatibility layer: %v\n", err)
+				os.Exit(1)
+			}
+		} else {
+			fmt.Println(msg("freeBSDLinuxDeclined"))
+		}
+	}
+
+	// Container networking relies on pf for NAT, see podman(8) on FreeBSD
+	if out, err := exec.Command("sysctl", "-n", "net.pf.filter_local").Output(); err != nil || strings.TrimSpace(string(out)) != "1" {
+		fmt.Println("Note: Podman needs pf with NAT for the containers' network. If the containers cannot reach each other, set up /etc/pf.conf as")
+		fmt.Println("described in /usr/local/etc/containers/pf.conf.sample and run: sysctl net.pf.filter_local=1 && service pf enable && service pf start")
+	}
+	return Podman
+}
+
+// renderRcScript returns an rc.d script that starts the compose stack in
+// installDir at boot and stops it at shutdown.
+func renderRcScript(installDir string) string {
+	compose := composeCommandLine(Podman)
+	if path, err := exec.LookPath(compose[0]); err == nil {
+		compose[0] = path
+	}
+	composeCmd := strings.Join(compose, " ") + " -f docker-compose.yml"
+
+	return fmt.Sprintf(`#!/bin/sh
+# Generated by the Pangolin installer.
+
+# PROVIDE: %[1]s
+# REQUIRE: LOGIN NETWORKING podman
+# KEYWORD: shutdown
+
+. /etc/rc.subr
+
+name="%[1]s"
+rcvar="%[1]s_enable"
+start_cmd="${name}_start"
+stop_cmd="${name}_stop"
+status_cmd="${name}_status"
+
+: ${%[1]s_enable:="NO"}
+: ${%[1]s_dir:=%[2]s}
+
+%[1]s_start()
+{
+	cd "${%[1]s_dir}" && %[3]s up -d
+}
+
+%[1]s_stop()
+{
+	cd "${%[1]s_dir}" && %[3]s down
+}
+
+%[1]s_status()
+{
+	cd "${%[1]s_dir}" && %[3]s ps
+}
+
+load_rc_config $name
+run_rc_command "$1"
+`, rcScriptName, shellQuote(installDir), composeCmd)
+}
+
+// installRcScript writes and enables the rc.d script for the stack.
+func installRcScript(installDir string) error {
+	if err := hostOps.WriteFile(rcScriptPath, []byte(renderRcScript(installDir)), 0755); err != nil {
+		return fmt.Errorf("failed to write %s: %v", rcScriptPath, err)
+	}
+	fmt.Printf("Wrote %s\n", rcScriptPath)
+
+	if err := run("sysrc", rcScriptName+"_enable=YES"); err != nil {
+		return fmt.Errorf("failed to enable %s: %v", rcScriptName, err)
+	}
+	fmt.Printf("The stack will start at boot. Manage it with: service %s start|stop|status\n", rcScriptName)
+	return nil
+}
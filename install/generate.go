@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/fosrl/pangolin/install/pkg/installer"
+)
+
+// generator turns an answers file into provisioning artifacts for tooling
+// that installs Pangolin without the interactive installer.
+type generator struct {
+	Description string
+	Run         func(args []string) error
+}
+
+var generators = map[string]generator{
+	"ansible": {
+		Description: "Ansible playbook with the rendered configuration",
+		Run:         runGenerateAnsible,
+	},
+	"cloud-init": {
+		Description: "cloud-config user data that installs Pangolin on first boot",
+		Run:         runGenerateCloudInit,
+	},
+	"ha": {
+		Description: "Answers files of app nodes sharing an external database, with a load-balancing plan",
+		Run:         runGenerateHA,
+	},
+	"keepalived": {
+		Description: "keepalived configuration and health check moving a virtual IP between two nodes",
+		Run:         runGenerateKeepalived,
+	},
+	"terraform": {
+		Description: "Terraform module for a server, its DNS records and the install over SSH",
+		Run:         runGenerateTerraform,
+	},
+}
+
+// runGenerate dispatches `generate <kind>`.
+func runGenerate(args []string) error {
+	var names []string
+	for name, g := range generators {
+		names = append(names, fmt.Sprintf("  %-12s %s", name, g.Description))
+	}
+	slices.Sort(names)
+	usage := "usage: installer generate <kind> --answers answers.yml [flags]\n\nKinds:\n" + strings.Join(names, "\n")
+
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		return fmt.Errorf("%s", usage)
+	}
+	g, ok := generators[args[0]]
+	if !ok {
+		return fmt.Errorf("unknown kind %q\n%s", args[0], usage)
+	}
+	return g.Run(args[1:])
+}
+
+// provisionPackages returns the distribution packages provisionCommands
+// needs, by their Debian and Ubuntu names.
+func provisionPackages(config Config) []string {
+	packages := []string{"curl", "ca-certificates", "tar"}
+	if config.InstallationContainerType == Podman {
+		packages = append(packages, "podman", "podman-compose")
+	}
+	return packages
+}
+
+// provisionCommands returns the shell commands that install Pangolin on a
+// fresh server once provisionPackages are installed and the answers file is
+// in installDir: they set up the container runtime, fetch the installer,
+// render the configuration and start the stack.
+func provisionCommands(config Config, installDir string) []string {
+	var commands []string
+	up := "docker compose up -d"
+	if config.InstallationContainerType == Podman {
+		commands = append(commands, "echo 'net.ipv4.ip_unprivileged_port_start=80' > /etc/sysctl.d/99-podman.conf && sysctl --system")
+		up = "podman-compose up -d"
+	} else {
+		commands = append(commands, "curl -fsSL https://get.docker.com | sh", "systemctl enable --now docker")
+	}
+
+	cd := "cd " + shellQuote(installDir) + " && "
+	commands = append(commands,
+		cd+"curl -fsSL "+getInstallerURL+" | bash",
+		cd+skipUpdateCheckEnv+"=1 ./installer render --answers answers.yml --out .")
+	if config.EnableMaxMind {
+		for _, url := range []string{maxMindCountryURL, maxMindASNURL} {
+			commands = append(commands, cd+"curl -fsSL "+url+" | tar -xz --strip-components=1 -C config --wildcards '*.mmdb'")
+		}
+	}
+	return append(commands, cd+up)
+}
+
+// loadProvisioningAnswers reads an answers file for a generator. Unlike
+// render, a missing secret is generated: the artifact carries it to the
+// server, so it stays the single source of the configuration.
+func loadProvisioningAnswers(path string) (Config, error) {
+	if path == "" {
+		return Config{}, usageErrorf("--answers is required")
+	}
+	config, err := loadAnswers(path)
+	if err != nil {
+		return Config{}, err
+	}
+	if missing := installer.MissingAnswers(config); len(missing) > 0 {
+		return Config{}, fmt.Errorf("answers file is missing required keys: %s", strings.Join(missing, ", "))
+	}
+	if config.Secret == "" {
+		config.Secret = generateRandomSecretKey()
+	}
+	if err := installer.Validate(config); err != nil {
+		return Config{}, localizeError(err)
+	}
+	if config.InstallationContainerType != Docker && config.InstallationContainerType != Podman {
+		return Config{}, fmt.Errorf("invalid container_type %q: use docker or podman", config.InstallationContainerType)
+	}
+	return config, nil
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/fosrl/pangolin/install/pkg/installer"
+)
+
+// collectGeoblocking asks whether the websecure entry point filters
+// requests by country, and which countries.
+func collectGeoblocking(config *Config) {
+	if !readBool(msg("promptGeoblock"), false) {
+		return
+	}
+	fmt.Println(installer.GeoblockAllow + ": " + msg("geoblockAllowDescription"))
+	fmt.Println(installer.GeoblockBlock + ": " + msg("geoblockBlockDescription"))
+	for {
+		mode := strings.ToLower(readString(msg("promptGeoblockMode"), installer.GeoblockAllow))
+		if mode == installer.GeoblockAllow || mode == installer.GeoblockBlock {
+			config.GeoblockMode = mode
+			break
+		}
+		fmt.Println(msg("geoblockModeUnknown", mode))
+	}
+	config.GeoblockCountries = readCountries(msg("promptGeoblockCountries"), config.GeoblockCountries)
+}
@@ -0,0 +1,284 @@
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"golang.org/x/term"
+)
+
+const (
+	maxMindCountryURL = "https://github.com/GitSquared/node-geolite2-redist/raw/refs/heads/master/redist/GeoLite2-Country.tar.gz"
+	maxMindASNURL     = "https://github.com/GitSquared/node-geolite2-redist/raw/refs/heads/master/redist/GeoLite2-ASN.tar.gz"
+)
+
+// geoIPEditions are the GeoLite2 databases Pangolin uses, for geoblocking by
+// country and by ASN.
+var geoIPEditions = []string{"GeoLite2-Country", "GeoLite2-ASN"}
+
+// geoIPProvider is where the GeoLite2 databases are downloaded from. Both
+// serve a tar.gz with the .mmdb in a directory named after the edition and
+// its release date.
+type geoIPProvider struct {
+	Description string
+	NeedsKey    bool
+	URL         func(edition, licenseKey string) string
+}
+
+const defaultGeoIPProvider = "redist"
+
+var geoIPProviders = map[string]geoIPProvider{
+	"redist": {
+		Description: "redistribution of the GeoLite2 databases on GitHub, no account needed",
+		URL: func(edition, _ string) string {
+			return map[string]string{"GeoLite2-Country": maxMindCountryURL, "GeoLite2-ASN": maxMindASNURL}[edition]
+		},
+	},
+	"maxmind": {
+		Description: "MaxMind directly, with the license key of a free GeoLite2 account",
+		NeedsKey:    true,
+		URL: func(edition, licenseKey string) string {
+			return "https://download.maxmind.com/app/geoip_download?edition_id=" + edition +
+				"&license_key=" + url.QueryEscape(licenseKey) + "&suffix=tar.gz"
+		},
+	},
+}
+
+// runUpdateGeoIP downloads the GeoLite2 databases into the installation,
+// from cron or by hand.
+func runUpdateGeoIP(args []string) error {
+	var names []string
+	for name, p := range geoIPProviders {
+		names = append(names, fmt.Sprintf("%s (%s)", name, p.Description))
+	}
+	slices.Sort(names)
+
+	flags := flag.NewFlagSet("update-geoip", flag.ExitOnError)
+	dir := flags.String("dir", "", "Installation directory")
+	providerName := flags.String("provider", defaultGeoIPProvider, "Where to download from: "+strings.Join(names, ", "))
+	licenseKey := flags.String("license-key", os.Getenv("MAXMIND_LICENSE_KEY"), "MaxMind license key for the maxmind provider (default: $MAXMIND_LICENSE_KEY)")
+	quiet := flags.Bool("quiet", false, "Only print errors, for cron")
+	restart := flags.Bool("restart", false, "Restart Pangolin afterwards so it loads the new databases")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	provider, ok := geoIPProviders[*providerName]
+	if !ok {
+		return usageErrorf("unknown provider %q: use %s", *providerName, strings.Join(sortedKeys(geoIPProviders), " or "))
+	}
+	// Run by hand, the key is asked for rather than passed on the command
+	// line, where it would end up in the shell history
+	if provider.NeedsKey && *licenseKey == "" && !*quiet && term.IsTerminal(int(os.Stdin.Fd())) {
+		*licenseKey = readPassword(msg("promptMaxMindLicenseKey"), "")
+	}
+	if provider.NeedsKey && *licenseKey == "" {
+		return usageErrorf("the %s provider needs --license-key or $MAXMIND_LICENSE_KEY", *providerName)
+	}
+	if err := enterInstallDir(*dir); err != nil {
+		return err
+	}
+
+	if err := downloadGeoIP(provider, *licenseKey, *quiet); err != nil {
+		return withExitCode(exitNetwork, err)
+	}
+	if !*quiet {
+		if _, err := enableGeoIPConfig(); err != nil {
+			return err
+		}
+	}
+	if *restart {
+		containerType := detectContainerType()
+		if containerType == Undefined {
+			return preflightErrorf("could not detect the container runtime of the installation")
+		}
+		if err := composeCommand(containerType, "restart", "pangolin"); err != nil {
+			return fmt.Errorf("failed to restart Pangolin: %v", err)
+		}
+	} else if !*quiet {
+		fmt.Println("Pangolin loads the databases when it starts; run with --restart or restart it to use them now.")
+	}
+	return nil
+}
+
+// downloadMaxMindDatabase downloads the GeoLite2 databases of the default
+// provider into config/.
+func downloadMaxMindDatabase() error {
+	return downloadGeoIP(geoIPProviders[defaultGeoIPProvider], "", false)
+}
+
+// downloadGeoIP downloads and unpacks the GeoLite2 databases into config/,
+// replacing those already there. It runs in the installation directory.
+func downloadGeoIP(provider geoIPProvider, licenseKey string, quiet bool) error {
+	// The databases are only fetched for real; running the plan leaves
+	// them to update-geoip
+	if simulating() {
+		fmt.Println("Skipping the MaxMind GeoLite2 download in the simulation.")
+		return nil
+	}
+	for _, edition := range geoIPEditions {
+		if !quiet {
+			fmt.Printf("Downloading the MaxMind %s database...\n", edition)
+		}
+		if err := downloadGeoIPEdition(provider.URL(edition, licenseKey), edition); err != nil {
+			return err
+		}
+	}
+
+	if !quiet {
+		fmt.Println("MaxMind GeoLite2 Country and ASN database downloaded successfully!")
+	}
+	return nil
+}
+
+// geoIPDownloadTimeout bounds the download of one database archive, a few
+// megabytes each.
+const geoIPDownloadTimeout = 5 * time.Minute
+
+// downloadGeoIPEdition downloads the archive of edition from rawURL to a
+// temporary file and unpacks its .mmdb into config/.
+func downloadGeoIPEdition(rawURL, edition string) error {
+	archive, err := os.CreateTemp("", edition+"-*.tar.gz")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(archive.Name())
+	defer archive.Close()
+
+	req, err := http.NewRequest(http.MethodGet, rawURL, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("User-Agent", "pangolin-installer/"+orUnknown(installerVersion, "dev"))
+	client := &http.Client{Timeout: geoIPDownloadTimeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		// The URL of the maxmind provider holds the license key
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return fmt.Errorf("failed to download %s database: %v", edition, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to download %s database: %s", edition, resp.Status)
+	}
+	if _, err := io.Copy(archive, resp.Body); err != nil {
+		return fmt.Errorf("failed to download %s database: %v", edition, err)
+	}
+
+	if _, err := archive.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	if err := extractGeoIPDatabase(archive, edition); err != nil {
+		return fmt.Errorf("failed to extract %s database: %v", edition, err)
+	}
+	return nil
+}
+
+// extractGeoIPDatabase writes the <edition>.mmdb in a tar.gz archive to
+// config/. The archive holds it in a directory named after the edition and
+// its release date, which changes with every release, so the file is found
+// by name wherever it is.
+func extractGeoIPDatabase(archive io.Reader, edition string) error {
+	gz, err := gzip.NewReader(archive)
+	if err != nil {
+		return err
+	}
+	defer gz.Close()
+
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return fmt.Errorf("the archive contains no %s.mmdb", edition)
+		}
+		if err != nil {
+			return err
+		}
+		if header.Typeflag == tar.TypeReg && path.Base(header.Name) == edition+".mmdb" {
+			return replaceFile(filepath.Join("config", edition+".mmdb"), tr, 0644)
+		}
+	}
+}
+
+// replaceFile writes the contents of r to target through a temporary file in
+// the same directory, so target is either replaced completely or left alone.
+func replaceFile(target string, r io.Reader, mode os.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(target), "."+filepath.Base(target)+"-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), mode); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), target)
+}
+
+// geoIPConfigKeys are the settings under server in config.yml that point
+// Pangolin at the databases.
+var geoIPConfigKeys = map[string]string{
+	"maxmind_db_path":  "./config/GeoLite2-Country.mmdb",
+	"maxmind_asn_path": "./config/GeoLite2-ASN.mmdb",
+}
+
+// enableGeoIPConfig adds the database paths missing from config.yml, after
+// a confirmation and a backup of the configuration, and reports whether it
+// changed the file. Pangolin has to be restarted to pick them up.
+func enableGeoIPConfig() (bool, error) {
+	file, err := readYAMLFile(appConfigFile)
+	if err != nil {
+		return false, err
+	}
+
+	changed := false
+	for _, key := range sortedKeys(geoIPConfigKeys) {
+		if setDefault(file.Doc, []string{"server", key}, geoIPConfigKeys[key]) {
+			changed = true
+		}
+	}
+	if !changed {
+		return false, nil
+	}
+	if !readBool(msg("promptGeoIPConfig", appConfigFile), true) {
+		fmt.Println(msg("geoIPConfigManual"))
+		for _, key := range sortedKeys(geoIPConfigKeys) {
+			fmt.Printf("  %s: %q\n", key, geoIPConfigKeys[key])
+		}
+		return false, nil
+	}
+
+	if err := backupConfig(); err != nil {
+		return false, err
+	}
+	if _, err := file.save(); err != nil {
+		return false, err
+	}
+	recordChange("Enable geoblocking with the MaxMind databases")
+	if err := updateStoredAnswers(func(config *Config) { config.EnableMaxMind = true }); err != nil {
+		return true, err
+	}
+	fmt.Println(msg("geoIPConfigUpdated", appConfigFile))
+	return true, nil
+}
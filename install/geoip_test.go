@@ -0,0 +1,130 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// geoIPArchive returns a tar.gz laid out like the GeoLite2 releases, with
+// the database in a directory named after the edition and a release date.
+func geoIPArchive(t *testing.T, edition, release string, database []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	dir := edition + "_" + release + "/"
+	files := []struct {
+		name string
+		data []byte
+	}{
+		{dir + "COPYRIGHT.txt", []byte("Database and Contents Copyright (c) MaxMind, Inc.\n")},
+		{dir + edition + ".mmdb", database},
+	}
+	if err := tw.WriteHeader(&tar.Header{Name: dir, Typeflag: tar.TypeDir, Mode: 0755}); err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range files {
+		if err := tw.WriteHeader(&tar.Header{Name: f.name, Typeflag: tar.TypeReg, Mode: 0644, Size: int64(len(f.data))}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write(f.data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// testGeoIPProvider serves the archives by edition from a test server.
+func testGeoIPProvider(t *testing.T, archives map[string][]byte) geoIPProvider {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		archive, ok := archives[strings.TrimPrefix(r.URL.Path, "/")]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(archive)
+	}))
+	t.Cleanup(server.Close)
+	return geoIPProvider{URL: func(edition, _ string) string { return server.URL + "/" + edition }}
+}
+
+func TestDownloadGeoIP(t *testing.T) {
+	t.Chdir(t.TempDir())
+	if err := os.Mkdir("config", 0755); err != nil {
+		t.Fatal(err)
+	}
+	country, asn := []byte("country database"), []byte("asn database")
+	// The releases are named by date and the two editions need not match
+	provider := testGeoIPProvider(t, map[string][]byte{
+		"GeoLite2-Country": geoIPArchive(t, "GeoLite2-Country", "20261014", country),
+		"GeoLite2-ASN":     geoIPArchive(t, "GeoLite2-ASN", "20261013", asn),
+	})
+
+	if err := downloadGeoIP(provider, "", true); err != nil {
+		t.Fatal(err)
+	}
+	for file, want := range map[string][]byte{"config/GeoLite2-Country.mmdb": country, "config/GeoLite2-ASN.mmdb": asn} {
+		got, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("%s = %q, want %q", file, got, want)
+		}
+	}
+	assertOnlyDatabases(t)
+}
+
+func TestDownloadGeoIPFailures(t *testing.T) {
+	t.Chdir(t.TempDir())
+	if err := os.Mkdir("config", 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile("config/GeoLite2-Country.mmdb", []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, archives := range map[string]map[string][]byte{
+		"not found": {},
+		"no mmdb":   {"GeoLite2-Country": geoIPArchive(t, "GeoLite2-City", "20261014", []byte("city"))},
+		"not gzip":  {"GeoLite2-Country": []byte("<html>rate limited</html>")},
+		"truncated": {"GeoLite2-Country": geoIPArchive(t, "GeoLite2-Country", "20261014", bytes.Repeat([]byte("x"), 4096))[:100]},
+	} {
+		t.Run(name, func(t *testing.T) {
+			if err := downloadGeoIP(testGeoIPProvider(t, archives), "", true); err == nil {
+				t.Fatal("downloadGeoIP succeeded")
+			}
+			got, err := os.ReadFile("config/GeoLite2-Country.mmdb")
+			if err != nil || string(got) != "old" {
+				t.Errorf("the existing database was changed: %q, %v", got, err)
+			}
+			assertOnlyDatabases(t)
+		})
+	}
+}
+
+// assertOnlyDatabases fails if anything but the databases was left in the
+// installation directory.
+func assertOnlyDatabases(t *testing.T) {
+	t.Helper()
+	entries, _ := filepath.Glob("*")
+	configEntries, _ := filepath.Glob("config/*")
+	for _, entry := range append(entries, configEntries...) {
+		if entry != "config" && !strings.HasSuffix(entry, ".mmdb") {
+			t.Errorf("%s was left behind", entry)
+		}
+	}
+}
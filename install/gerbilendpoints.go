@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fosrl/pangolin/install/pkg/installer"
+)
+
+func init() {
+	registerStep(installStep{
+		Name:  "verify Gerbil endpoints",
+		Order: 65,
+		When: func(state *installState) bool {
+			return containersStarting(state) && state.Config.InstallGerbil &&
+				(state.Config.GerbilIPv4 != "" || state.Config.GerbilIPv6 != "")
+		},
+		Run: func(state *installState) error {
+			verifyGerbilEndpoints(state.Config)
+			return nil
+		},
+		Live: true,
+	})
+}
+
+// collectGerbilEndpoints detects the public IPv4 and IPv6 addresses sites
+// reach Gerbil on and lets the user correct them. Pangolin hands sites a
+// single base endpoint, so both families work when its name resolves to
+// both addresses: the DNS records of the dashboard domain are created from
+// them.
+func collectGerbilEndpoints(config *Config) {
+	fmt.Println("\n=== " + msg("sectionGerbilEndpoints") + " ===")
+	if !config.IPv6Only {
+		config.GerbilIPv4 = readGerbilAddress(installer.IPv4, publicIPv4)
+	}
+	if config.EnableIPv6 {
+		config.GerbilIPv6 = readGerbilAddress(installer.IPv6, publicIPv6)
+	}
+}
+
+// readGerbilAddress asks for the address of the family, offering the
+// detected one. A family that cannot be detected is left out.
+func readGerbilAddress(family installer.IPFamily, detect func() (string, error)) string {
+	detected, err := detect()
+	if err != nil {
+		fmt.Println(msg("gerbilAddressNotDetected", family, err))
+		return ""
+	}
+	for {
+		value := readString(msg("promptGerbilAddress", family), detected)
+		if err := installer.CheckGerbilAddress(family, value); err != nil {
+			fmt.Println(localizeError(err))
+			continue
+		}
+		return value
+	}
+}
+
+// verifyGerbilEndpoints checks that sites can reach Gerbil on each of its
+// addresses: the base endpoint has to resolve to the address, and Traefik,
+// which shares Gerbil's network, has to answer on it. WireGuard itself
+// cannot be probed, as it ignores packets from unknown peers.
+func verifyGerbilEndpoints(config Config) {
+	fmt.Println("\n=== " + msg("sectionGerbilEndpoints") + " ===")
+	endpoint := strings.Trim(config.GerbilBaseEndpoint(), "[]")
+	resolved := []string{endpoint}
+	if net.ParseIP(endpoint) == nil {
+		resolved, _ = net.LookupHost(endpoint)
+	}
+
+	for _, ip := range []string{config.GerbilIPv4, config.GerbilIPv6} {
+		if ip == "" {
+			continue
+		}
+		if !slices.Contains(resolved, ip) {
+			fmt.Println(msg("gerbilEndpointNotResolving", endpoint, ip))
+			continue
+		}
+		conn, err := net.DialTimeout("tcp", net.JoinHostPort(ip, strconv.Itoa(config.HTTPSPort)), 5*time.Second)
+		if err != nil {
+			fmt.Println(msg("gerbilEndpointUnreachable", ip, err))
+			fmt.Println(msg("gerbilEndpointFirewall", config.HTTPSPort, config.WireGuardPort, config.ClientsWireGuardPort))
+			continue
+		}
+		conn.Close()
+		fmt.Println(msg("gerbilEndpointReachable", ip))
+	}
+}
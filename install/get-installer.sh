@@ -64,11 +64,12 @@ get_latest_version() {
 detect_platform() {
     local os arch
     
-    # Detect OS - only support Linux
+    # Detect OS - only support Linux and FreeBSD
     case "$(uname -s)" in
         Linux*)     os="linux" ;;
+        FreeBSD*)   os="freebsd" ;;
         *)
-            print_error "Unsupported operating system: $(uname -s). Only Linux is supported."
+            print_error "Unsupported operating system: $(uname -s). Only Linux and FreeBSD are supported."
             exit 1
             ;;
     esac
@@ -78,7 +79,7 @@ detect_platform() {
         x86_64|amd64)   arch="amd64" ;;
         arm64|aarch64)  arch="arm64" ;;
         *)
-            print_error "Unsupported architecture: $(uname -m). Only amd64 and arm64 are supported on Linux."
+            print_error "Unsupported architecture: $(uname -m). Only amd64 and arm64 are supported."
             exit 1
             ;;
     esac
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	githubAPIURL      = "https://api.github.com"
+	githubDownloadURL = "https://github.com"
+	// githubTokenEnv raises the GitHub API limit from 60 requests an hour
+	// per address to 5000 per token.
+	githubTokenEnv = "GITHUB_TOKEN"
+	// releasesMirrorEnv is the base URL of a mirror that serves the paths of
+	// the GitHub API and of the release downloads, e.g. an internal proxy
+	// for a fleet of servers behind one address.
+	releasesMirrorEnv = "PANGOLIN_RELEASES_MIRROR"
+	// releaseCacheTTL is how long release metadata is used without asking
+	// again. Older entries are revalidated, which GitHub does not count
+	// against the limit while they are unchanged.
+	releaseCacheTTL = time.Hour
+)
+
+// githubAPIBase returns the base URL release metadata is fetched from.
+func githubAPIBase() string {
+	if mirror := os.Getenv(releasesMirrorEnv); mirror != "" {
+		return strings.TrimSuffix(mirror, "/")
+	}
+	return githubAPIURL
+}
+
+// githubDownloadBase returns the base URL release assets are downloaded
+// from.
+func githubDownloadBase() string {
+	if mirror := os.Getenv(releasesMirrorEnv); mirror != "" {
+		return strings.TrimSuffix(mirror, "/")
+	}
+	return githubDownloadURL
+}
+
+// releaseCacheEntry is a response of the GitHub API stored on disk.
+type releaseCacheEntry struct {
+	URL       string    `json:"url"`
+	ETag      string    `json:"etag,omitempty"`
+	FetchedAt time.Time `json:"fetched_at"`
+	Body      string    `json:"body"`
+}
+
+// githubRateLimit is when the exhausted limit of this address or token
+// resets; no requests are sent before then.
+type githubRateLimit struct {
+	Reset time.Time `json:"reset"`
+}
+
+// releaseCacheDir returns where release metadata is cached, or an empty
+// string when there is no cache directory.
+func releaseCacheDir() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "pangolin-installer", "github")
+}
+
+func releaseCachePath(rawURL string) string {
+	sum := sha256.Sum256([]byte(rawURL))
+	return filepath.Join(releaseCacheDir(), hex.EncodeToString(sum[:8])+".json")
+}
+
+// fetchGitHubJSON returns the body of a GET of path on the GitHub API, e.g.
+// /repos/fosrl/pangolin/releases/latest. Responses are cached on disk: a
+// fresh entry is returned without a request, and a stale one is returned
+// when GitHub cannot be asked, e.g. while the rate limit is exhausted.
+func fetchGitHubJSON(path string, timeout time.Duration) ([]byte, error) {
+	rawURL := githubAPIBase() + path
+	var cached *releaseCacheEntry
+	if releaseCacheDir() != "" {
+		cached = readReleaseCache(rawURL)
+	}
+	if cached != nil && time.Since(cached.FetchedAt) < releaseCacheTTL {
+		return []byte(cached.Body), nil
+	}
+
+	body, err := requestGitHubJSON(rawURL, cached, timeout)
+	if err != nil {
+		if cached != nil {
+			return []byte(cached.Body), nil
+		}
+		return nil, err
+	}
+	return body, nil
+}
+
+// requestGitHubJSON asks GitHub for rawURL, revalidating the cached entry if
+// there is one, and updates the cache.
+func requestGitHubJSON(rawURL string, cached *releaseCacheEntry, timeout time.Duration) ([]byte, error) {
+	limitPath := filepath.Join(releaseCacheDir(), "rate-limit.json")
+	var limit githubRateLimit
+	if data, err := os.ReadFile(limitPath); err == nil && json.Unmarshal(data, &limit) == nil && time.Now().Before(limit.Reset) {
+		return nil, fmt.Errorf("the GitHub API rate limit is exhausted until %s; set %s or %s", limit.Reset.Local().Format(time.Kitchen), githubTokenEnv, releasesMirrorEnv)
+	}
+
+	req, err := http.NewRequest(http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("User-Agent", "pangolin-installer/"+orUnknown(installerVersion, "dev"))
+	// The token is for GitHub, not for whoever runs the mirror
+	if token := os.Getenv(githubTokenEnv); token != "" && isGitHubURL(rawURL) {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	if cached != nil && cached.ETag != "" {
+		req.Header.Set("If-None-Match", cached.ETag)
+	}
+
+	client := &http.Client{Timeout: timeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if reset, limited := rateLimitReset(resp); limited {
+		if data, err := json.Marshal(githubRateLimit{Reset: reset}); err == nil {
+			writeReleaseCacheFile(limitPath, data)
+		}
+		if resp.StatusCode == http.StatusForbidden || resp.StatusCode == http.StatusTooManyRequests {
+			return nil, fmt.Errorf("the GitHub API rate limit is exhausted until %s; set %s or %s", reset.Local().Format(time.Kitchen), githubTokenEnv, releasesMirrorEnv)
+		}
+	}
+
+	switch resp.StatusCode {
+	case http.StatusNotModified:
+		if cached == nil {
+			return nil, fmt.Errorf("unexpected status %s", resp.Status)
+		}
+		cached.FetchedAt = time.Now()
+		storeReleaseCache(*cached)
+		return []byte(cached.Body), nil
+	case http.StatusOK:
+		body, err := io.ReadAll(io.LimitReader(resp.Body, 4<<20))
+		if err != nil {
+			return nil, err
+		}
+		storeReleaseCache(releaseCacheEntry{URL: rawURL, ETag: resp.Header.Get("ETag"), FetchedAt: time.Now(), Body: string(body)})
+		return body, nil
+	default:
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+}
+
+// rateLimitReset reports whether a response says the rate limit is used up,
+// and when it resets: from Retry-After for the secondary limits, else from
+// X-RateLimit-Reset.
+func rateLimitReset(resp *http.Response) (time.Time, bool) {
+	if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+		return time.Now().Add(time.Duration(seconds) * time.Second), true
+	}
+	if resp.Header.Get("X-RateLimit-Remaining") != "0" {
+		return time.Time{}, false
+	}
+	reset, err := strconv.ParseInt(resp.Header.Get("X-RateLimit-Reset"), 10, 64)
+	if err != nil {
+		return time.Now().Add(time.Hour), true
+	}
+	return time.Unix(reset, 0), true
+}
+
+func isGitHubURL(rawURL string) bool {
+	u, err := url.Parse(rawURL)
+	return err == nil && (u.Host == "api.github.com" || u.Host == "github.com")
+}
+
+func readReleaseCache(rawURL string) *releaseCacheEntry {
+	data, err := os.ReadFile(releaseCachePath(rawURL))
+	if err != nil {
+		return nil
+	}
+	var entry releaseCacheEntry
+	if json.Unmarshal(data, &entry) != nil || entry.URL != rawURL {
+		return nil
+	}
+	return &entry
+}
+
+func storeReleaseCache(entry releaseCacheEntry) {
+	if releaseCacheDir() == "" {
+		return
+	}
+	if data, err := json.Marshal(entry); err == nil {
+		writeReleaseCacheFile(releaseCachePath(entry.URL), data)
+	}
+}
+
+// writeReleaseCacheFile writes a cache file. The cache is an optimization,
+// so failures are ignored.
+func writeReleaseCacheFile(path string, data []byte) {
+	if releaseCacheDir() == "" || os.MkdirAll(filepath.Dir(path), 0755) != nil {
+		return
+	}
+	tmp := path + ".tmp"
+	if os.WriteFile(tmp, data, 0644) == nil {
+		os.Rename(tmp, path)
+	}
+}
@@ -0,0 +1,272 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+)
+
+// gitignoreData keeps certificates, databases and runtime data out of the
+// configuration history.
+const gitignoreData = `exit-nodes/
+config/letsencrypt/
+config/db/
+config/logs/
+config/traefik/logs/
+config/crowdsec/db/
+config/prometheus/data/
+config/*.mmdb
+postgres18/
+redis8/
+config/postgres18/
+config/redis8/
+config.luks
+*.backup
+backups/
+`
+
+// secretMaterial are the files that hold nothing but keys, credentials or
+// archives of them. They are never tracked.
+var secretMaterial = []string{
+	"api-credentials.yml",
+	installSecretsFile,
+	"config/key",
+	"config/traefik/certs/dev.key",
+	"config.tar.gz",
+}
+
+// redactedFiles are configuration files with secrets among their settings.
+// They are tracked through the redact filter, so the history records every
+// change to them with the secret values replaced by redactedValue. A file
+// restored from the history needs its secrets put back from
+// pangolin-secrets.yaml.
+var redactedFiles = []string{
+	storedAnswersFile,
+	"docker-compose.yml",
+	"config/config.yml",
+	"config/privateConfig.yml",
+	"config/traefik/dynamic_config.yml",
+	"config/alertmanager/alertmanager.yml",
+}
+
+const (
+	redactFilter  = "pangolin-redact"
+	redactedValue = "REDACTED"
+)
+
+// redactScript is the sed -E script of the redact filter. It replaces the
+// values of the secret settings, the passwords in URLs and the Redis
+// password on the command lines of docker-compose.yml.
+var redactScript = strings.Join([]string{
+	`s/^([[:space:]]*(secret|smtp_pass|auth_password|password|crowdsecLapiKey|BOUNCER_KEY_traefik|POSTGRES_PASSWORD|traefik_bouncer_key|postgresql_pass|redis_pass):[[:space:]]*)("[^"]*"|[^[:space:]#]+)/\1"` + redactedValue + `"/`,
+	`s#(://[^:/@[:space:]]+:)[^@/[:space:]]+@#\1` + redactedValue + `@#g`,
+	`s/(--requirepass[[:space:]]+)[^[:space:]]+/\1` + redactedValue + `/`,
+	`s/("-a",[[:space:]]*)"[^"]*"/\1"` + redactedValue + `"/`,
+}, ";")
+
+// redactCommand is the clean command of the redact filter. The script has
+// no single quotes, so it can be quoted as a whole for the shell git runs
+// the filter with.
+func redactCommand() string {
+	return "sed -E -e '" + redactScript + "'"
+}
+
+// gitignoreContents returns the .gitignore of a tracked installation.
+func gitignoreContents() string {
+	var b strings.Builder
+	b.WriteString("# Generated by the Pangolin installer.\n")
+	b.WriteString("# Keys, certificates and runtime data are not tracked.\n")
+	for _, path := range secretMaterial {
+		b.WriteString(path + "\n")
+	}
+	b.WriteString(gitignoreData)
+	return b.String()
+}
+
+// gitattributesContents returns the .gitattributes of a tracked
+// installation, which sends the files with secrets through the redact
+// filter.
+func gitattributesContents() string {
+	var b strings.Builder
+	b.WriteString("# Generated by the Pangolin installer.\n")
+	b.WriteString("# Secret values are replaced by " + redactedValue + " in the history.\n")
+	for _, line := range redactAttributes() {
+		b.WriteString(line + "\n")
+	}
+	return b.String()
+}
+
+func redactAttributes() []string {
+	var lines []string
+	for _, path := range redactedFiles {
+		lines = append(lines, "/"+path+" filter="+redactFilter)
+	}
+	return lines
+}
+
+func isGitInstalled() bool {
+	return exec.Command("git", "--version").Run() == nil
+}
+
+// isGitTracked reports whether the installation directory (the current
+// working directory) has been put under git by the installer or the user.
+func isGitTracked() bool {
+	if _, err := os.Stat(".git"); err != nil {
+		return false
+	}
+	return isGitInstalled()
+}
+
+func init() {
+	registerStep(installStep{
+		Name:  "git tracking",
+		Order: 30,
+		When:  freshInstall,
+		Run:   func(*installState) error { offerGitTracking(); return nil },
+	})
+}
+
+// offerGitTracking asks whether to track the installation directory in git
+// and initializes the repository if the user agrees.
+func offerGitTracking() {
+	if isGitTracked() || !isGitInstalled() {
+		return
+	}
+
+	fmt.Println("\n=== " + msg("sectionGitTracking") + " ===")
+	fmt.Println(msg("gitTrackingDescription"))
+	fmt.Println(msg("gitTrackingBenefit"))
+	if !readBool(msg("promptGitTracking"), false) {
+		return
+	}
+
+	if err := initGitRepo(); err != nil {
+		fmt.Printf("Warning: could not initialize git repository: %v\n", err)
+		return
+	}
+
+	fmt.Println("Initialized git repository. Secret values are replaced by " + redactedValue + " in the history; keys, certificates and databases are excluded via .gitignore.")
+}
+
+func initGitRepo() error {
+	if err := hostOps.Run(exec.Command("git", "init", "-q")); err != nil {
+		return fmt.Errorf("git init failed: %v", err)
+	}
+
+	return gitCommit("Initial Pangolin installation")
+}
+
+// gitCommit stages and commits all changes in the installation directory if
+// it is tracked in git. It is a no-op when nothing changed.
+func gitCommit(message string) error {
+	if !isGitTracked() {
+		return nil
+	}
+
+	if err := protectSecrets(); err != nil {
+		return err
+	}
+	if err := hostOps.Run(exec.Command("git", "add", "-A")); err != nil {
+		return fmt.Errorf("git add failed: %v", err)
+	}
+
+	// Exit status 0 means there is nothing staged
+	if err := exec.Command("git", "diff", "--cached", "--quiet").Run(); err == nil {
+		return nil
+	}
+
+	args := []string{"commit", "-q", "-m", message}
+	// Fall back to a generic identity so commits work on fresh servers
+	if exec.Command("git", "config", "user.email").Run() != nil {
+		args = append([]string{"-c", "user.name=Pangolin Installer", "-c", "user.email=installer@localhost"}, args...)
+	}
+
+	if out, err := hostOps.CombinedOutput(exec.Command("git", args...)); err != nil {
+		return fmt.Errorf("git commit failed: %v: %s", err, out)
+	}
+
+	return nil
+}
+
+// recordChange commits the current state with the given message, printing a
+// warning rather than failing the calling operation.
+func recordChange(message string) {
+	if err := gitCommit(message); err != nil {
+		fmt.Printf("Warning: could not record configuration change in git: %v\n", err)
+	}
+}
+
+// protectSecrets sets up the ignored files and the redact filter of the
+// repository, also in repositories made by older installers or by the
+// user. Files older installers ignored are tracked redacted from then on;
+// earlier versions of the files stay in the history as they were.
+func protectSecrets() error {
+	if err := ensureLines(".gitignore", gitignoreContents(), secretMaterial, redactedFiles); err != nil {
+		return err
+	}
+	if err := ensureLines(".gitattributes", gitattributesContents(), redactAttributes(), nil); err != nil {
+		return err
+	}
+
+	for key, value := range map[string]string{
+		"filter." + redactFilter + ".clean":    redactCommand(),
+		"filter." + redactFilter + ".smudge":   "cat",
+		"filter." + redactFilter + ".required": "true",
+	} {
+		if out, err := hostOps.CombinedOutput(exec.Command("git", "config", key, value)); err != nil {
+			return fmt.Errorf("git config failed: %v: %s", err, out)
+		}
+	}
+
+	// Unstage the redacted files so git add runs them through the filter
+	// even when they did not change since they were staged unfiltered
+	untrack := append(append([]string{}, secretMaterial...), redactedFiles...)
+	args := append([]string{"rm", "-q", "--cached", "--ignore-unmatch", "--"}, untrack...)
+	if out, err := hostOps.CombinedOutput(exec.Command("git", args...)); err != nil {
+		return fmt.Errorf("git rm failed: %v: %s", err, out)
+	}
+	return nil
+}
+
+// ensureLines writes contents to path if it does not exist, and otherwise
+// appends the missing lines of want and drops the lines of unwanted, with
+// or without a leading slash.
+func ensureLines(path, contents string, want, unwanted []string) error {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		if err := os.WriteFile(path, []byte(contents), 0644); err != nil {
+			return fmt.Errorf("failed to write %s: %v", path, err)
+		}
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var lines []string
+	changed := false
+	for _, line := range strings.Split(strings.TrimSuffix(string(data), "\n"), "\n") {
+		if slices.Contains(unwanted, strings.TrimPrefix(strings.TrimSpace(line), "/")) {
+			changed = true
+			continue
+		}
+		lines = append(lines, line)
+	}
+	for _, line := range want {
+		if !slices.Contains(lines, line) && !slices.Contains(lines, "/"+line) {
+			lines = append(lines, line)
+			changed = true
+		}
+	}
+	if !changed {
+		return nil
+	}
+	if err := os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0644); err != nil {
+		return fmt.Errorf("failed to update %s: %v", path, err)
+	}
+	return nil
+}
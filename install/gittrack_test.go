@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+// TestRedactFilter runs the clean command of the redact filter over the
+// tracked files of an installation with every secret set.
+func TestRedactFilter(t *testing.T) {
+	t.Chdir(t.TempDir())
+	config := Config{
+		BaseDomain:        "example.com",
+		DashboardDomain:   "pangolin.example.com",
+		LetsEncryptEmail:  "admin@example.com",
+		InstallGerbil:     true,
+		EnableEmail:       true,
+		EmailSMTPHost:     "smtp.example.com",
+		EmailSMTPPort:     587,
+		EmailSMTPUser:     "mailer",
+		EmailNoReply:      "noreply@example.com",
+		EnableMonitoring:  true,
+		AlertEmail:        "alerts@example.com",
+		IsPostgreSQL:      true,
+		IsRedis:           true,
+		PangolinVersion:   "1.10.0",
+		GerbilVersion:     "1.2.0",
+		BadgerVersion:     "v1.2.0",
+		TraefikVersion:    "v3.6",
+		Secret:            "secret-server-0123456789",
+		EmailSMTPPass:     "secret-smtp-pass",
+		TraefikBouncerKey: "secret-bouncer-key",
+		IsPostgreSQLPass:  "secret-postgres-pass",
+		IsRedisPass:       "secret-redis-pass",
+	}
+	if err := renderConfigFiles(config, "."); err != nil {
+		t.Fatal(err)
+	}
+	// The CrowdSec templates are rendered on their own and merged in, as
+	// addCrowdsecConfig does
+	crowdsec := config
+	crowdsec.DoCrowdsecInstall = true
+	if err := renderConfigFiles(crowdsec, "."); err != nil {
+		t.Fatal(err)
+	}
+	if err := MergeYAML(traefikDynamicFile, "config/crowdsec/dynamic_config.yml"); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename("config/docker-compose.yml", "docker-compose.yml"); err != nil {
+		t.Fatal(err)
+	}
+	if err := saveStoredAnswers(config); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range redactedFiles {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Contains(data, []byte("secret-")) {
+			t.Errorf("%s holds no secret to redact", path)
+			continue
+		}
+		cmd := exec.Command("sh", "-c", redactCommand())
+		cmd.Stdin = bytes.NewReader(data)
+		redacted, err := cmd.Output()
+		if err != nil {
+			t.Fatalf("redacting %s: %v", path, err)
+		}
+
+		lines, redactedLines := strings.Split(string(data), "\n"), strings.Split(string(redacted), "\n")
+		if len(lines) != len(redactedLines) {
+			t.Fatalf("redacting %s changed its number of lines", path)
+		}
+		for i, line := range redactedLines {
+			switch {
+			case strings.Contains(line, "secret-"):
+				t.Errorf("%s:%d keeps a secret: %s", path, i+1, line)
+			case line != lines[i] && !strings.Contains(line, redactedValue):
+				t.Errorf("%s:%d changed without a placeholder: %s", path, i+1, line)
+			}
+		}
+	}
+}
@@ -1,4 +1,4 @@
-module installer
+module github.com/fosrl/pangolin/install
 
 go 1.25.0
 
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/fosrl/pangolin/install/pkg/installer"
+)
+
+// haNode is an app node of a high-availability installation.
+type haNode struct {
+	Name    string
+	Address string
+}
+
+// haProxyConfig balances the dashboard and the resources over the app nodes.
+// TLS is passed through, so every node serves its own certificates.
+var haProxyConfig = template.Must(template.New("haproxy.cfg").Parse(`# Generated by the Pangolin installer for {{.Config.DashboardDomain}}.
+global
+    log stdout format raw local0
+
+defaults
+    mode tcp
+    log global
+    option tcplog
+    timeout connect 5s
+    timeout client 1h
+    timeout server 1h
+
+# ACME HTTP challenges and the redirect to HTTPS. A challenge is answered by
+# the node that requested the certificate, so HTTP goes to the first node
+# while it is up.
+frontend http
+    bind :80
+    default_backend pangolin_http
+
+backend pangolin_http
+{{- range $i, $node := .Nodes}}
+    server {{$node.Name}} {{$node.Address}}:{{$.Config.HTTPPort}} check{{if $i}} backup{{end}}
+{{- end}}
+
+frontend https
+    bind :443
+    default_backend pangolin_https
+
+backend pangolin_https
+    balance source
+{{- range .Nodes}}
+    server {{.Name}} {{.Address}}:{{$.Config.HTTPSPort}} check
+{{- end}}
+`))
+
+// haPlan is the README of the generated directory.
+var haPlan = template.Must(template.New("LB-PLAN.md").Parse(`# Load-balancing plan for {{.Config.DashboardDomain}}
+
+Generated by the Pangolin installer. The app nodes share the PostgreSQL
+database at {{.Config.PostgreSQLHost}}{{if .Config.IsRedis}} and Redis at {{.Config.RedisHost}}{{end}}, so any of them
+can serve the dashboard and the resources.
+
+## Nodes
+
+| Node | Address | WireGuard endpoint |
+| ---- | ------- | ------------------ |
+{{- range .Nodes}}
+| {{.Name}} | {{.Address}} | {{.Address}}:{{$.Config.WireGuardPort}}/udp |
+{{- end}}
+
+Every node has the same server secret and database credentials in its
+answers.yml; the WireGuard key of its Gerbil is generated on the node when
+it first starts. Keep the answers files secret.
+
+## Load balancer
+
+Point {{.Config.DashboardDomain}} and *.{{.Config.BaseDomain}} at the load balancer, not
+at the nodes. haproxy.cfg passes TCP through:
+
+- 443/tcp is balanced by source address over all nodes.
+- 80/tcp goes to the first node while it is up. Let's Encrypt HTTP
+  challenges only succeed on the node that requested the certificate; to
+  issue certificates on every node, switch Traefik to a DNS challenge.
+
+WireGuard cannot be balanced: each Gerbil registers as its own exit node and
+sites connect to the nodes directly. Open {{.Config.WireGuardPort}}/udp and {{.Config.ClientsWireGuardPort}}/udp on every
+node and give each node a public address.
+
+## Installing a node
+
+Copy the node's directory to {{.InstallDir}} on the node and run there:
+
+{{range .Commands}}    {{.}}
+{{end}}
+Back up the database on its own host: the installer only snapshots
+databases that run inside the stack.
+`))
+
+// runGenerateHA writes the answers files of the app nodes of a
+// high-availability installation and the plan of the load balancer in
+// front of them.
+func runGenerateHA(args []string) error {
+	flags := flag.NewFlagSet("generate ha", flag.ExitOnError)
+	answersPath := flags.String("answers", "", "Path to the YAML answers file (required)")
+	nodesFlag := flags.String("nodes", "", "App nodes as name=address pairs, separated by commas (at least two)")
+	postgresHost := flags.String("postgres-host", "", "host:port of the shared PostgreSQL (default: postgresql_host of the answers)")
+	redisHost := flags.String("redis-host", "", "host[:port] of the shared Redis (default: redis_host of the answers)")
+	out := flags.String("out", "ha", "Directory to write the node files and the plan to")
+	dir := flags.String("dir", defaultInstallDir, "Installation directory on the nodes")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	nodes, err := parseHANodes(*nodesFlag)
+	if err != nil {
+		return usageErrorf("%v", err)
+	}
+	config, err := loadProvisioningAnswers(*answersPath)
+	if err != nil {
+		return err
+	}
+	if *postgresHost != "" {
+		config.IsPostgreSQL, config.PostgreSQLHost = true, *postgresHost
+	}
+	if *redisHost != "" {
+		config.IsRedis, config.RedisHost = true, *redisHost
+	}
+	if !config.IsPostgreSQL || config.PostgreSQLHost == "" {
+		return usageErrorf("the nodes need a shared database: set --postgres-host or postgresql and postgresql_host in the answers")
+	}
+	if config.IsRedis && config.RedisHost == "" {
+		return usageErrorf("the nodes need a shared Redis: set --redis-host or redis_host in the answers")
+	}
+	if missing := installer.MissingAnswers(config); len(missing) > 0 {
+		return fmt.Errorf("answers file is missing required keys: %s", strings.Join(missing, ", "))
+	}
+
+	for _, node := range nodes {
+		nodeConfig := config
+		nodeConfig.GerbilEndpoint = node.Address
+		answers, err := yaml.Marshal(nodeConfig)
+		if err != nil {
+			return err
+		}
+		nodeDir := filepath.Join(*out, node.Name)
+		if err := os.MkdirAll(nodeDir, 0700); err != nil {
+			return err
+		}
+		path := filepath.Join(nodeDir, "answers.yml")
+		// The answers hold the shared secret and the database passwords
+		if err := os.WriteFile(path, answers, 0600); err != nil {
+			return fmt.Errorf("failed to write %s: %v", path, err)
+		}
+		fmt.Printf("Wrote %s\n", path)
+	}
+
+	data := map[string]any{
+		"Config":     config,
+		"Nodes":      nodes,
+		"InstallDir": *dir,
+		"Commands":   provisionCommands(config, *dir),
+	}
+	for _, tmpl := range []*template.Template{haProxyConfig, haPlan} {
+		var content bytes.Buffer
+		if err := tmpl.Execute(&content, data); err != nil {
+			return err
+		}
+		path := filepath.Join(*out, tmpl.Name())
+		if err := os.WriteFile(path, content.Bytes(), 0644); err != nil {
+			return fmt.Errorf("failed to write %s: %v", path, err)
+		}
+		fmt.Printf("Wrote %s\n", path)
+	}
+
+	fmt.Printf("\nInstall every node from its directory, then set up the load balancer as %s describes.\n", filepath.Join(*out, "LB-PLAN.md"))
+	return nil
+}
+
+// parseHANodes parses the --nodes flag of generate ha.
+func parseHANodes(value string) ([]haNode, error) {
+	var nodes []haNode
+	seen := map[string]bool{}
+	for _, pair := range strings.Split(value, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		name, address, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok || address == "" || !nodeName.MatchString(name) {
+			return nil, fmt.Errorf("node %q is not name=address", pair)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("node %s is listed twice", name)
+		}
+		seen[name] = true
+		nodes = append(nodes, haNode{Name: name, Address: address})
+	}
+	if len(nodes) < 2 {
+		return nil, fmt.Errorf("--nodes needs at least two nodes, e.g. --nodes app1=203.0.113.10,app2=203.0.113.11")
+	}
+	return nodes, nil
+}
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// containerState is the subset of the State object returned by
+// `docker inspect` and `podman inspect` that readiness checks need.
+type containerState struct {
+	Status     string    `json:"Status"`
+	Running    bool      `json:"Running"`
+	Restarting bool      `json:"Restarting"`
+	ExitCode   int       `json:"ExitCode"`
+	StartedAt  time.Time `json:"StartedAt"`
+	Health     *struct {
+		Status string `json:"Status"`
+		Log    []struct {
+			ExitCode int    `json:"ExitCode"`
+			Output   string `json:"Output"`
+		} `json:"Log"`
+	} `json:"Health"`
+}
+
+// composeService is a service from docker-compose.yml and the name of the
+// container it runs in.
+type composeService struct {
+	Name      string
+	Container string
+}
+
+// inspectContainer returns the state of a container.
+func inspectContainer(containerType SupportedContainer, container string) (containerState, error) {
+	out, err := containerCommand(containerType, "inspect", "--format", "{{json .State}}", container).Output()
+	if err != nil {
+		return containerState{}, fmt.Errorf("failed to inspect container %s: %v", container, err)
+	}
+
+	var state containerState
+	if err := json.Unmarshal(out, &state); err != nil {
+		return containerState{}, fmt.Errorf("failed to parse state of container %s: %v", container, err)
+	}
+	return state, nil
+}
+
+// ready reports whether the container is running and, if it has a
+// healthcheck, healthy.
+func (s containerState) ready() bool {
+	if !s.Running || s.Restarting {
+		return false
+	}
+	return s.Health == nil || s.Health.Status == "" || s.Health.Status == "healthy"
+}
+
+// failure describes why the container can no longer become ready, or returns
+// an empty string while it still might.
+func (s containerState) failure() string {
+	switch {
+	case s.Status == "exited" || s.Status == "dead":
+		return fmt.Sprintf("exited with code %d", s.ExitCode)
+	case s.Health != nil && s.Health.Status == "unhealthy":
+		reason := "failed its healthcheck"
+		if n := len(s.Health.Log); n > 0 {
+			if output := strings.TrimSpace(s.Health.Log[n-1].Output); output != "" {
+				reason += ": " + output
+			}
+		}
+		return reason
+	}
+	return ""
+}
+
+// composeServices lists the services in docker-compose.yml with their
+// container names, leaving out those of compose profiles that are not
+// enabled.
+func composeServices(composePath string) ([]composeService, error) {
+	data, err := os.ReadFile(composePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %v", composePath, err)
+	}
+
+	var compose map[string]any
+	if err := yaml.Unmarshal(data, &compose); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %v", composePath, err)
+	}
+
+	project, _ := compose["name"].(string)
+	if project == "" {
+		project = "pangolin"
+	}
+
+	services, _ := compose["services"].(map[string]any)
+	profiles := readComposeProfiles(composePath)
+	var result []composeService
+	for _, name := range sortedKeys(services) {
+		container := fmt.Sprintf("%s-%s-1", project, name)
+		if service, ok := services[name].(map[string]any); ok {
+			if !serviceProfileActive(service, profiles) {
+				continue
+			}
+			if containerName, ok := service["container_name"].(string); ok && containerName != "" {
+				container = containerName
+			}
+		}
+		result = append(result, composeService{Name: name, Container: container})
+	}
+	return result, nil
+}
+
+// containerLogTail returns the last lines of a container's logs.
+func containerLogTail(containerType SupportedContainer, container string, lines int) string {
+	out, _ := containerCommand(containerType, "logs", "--tail", fmt.Sprint(lines), container).CombinedOutput()
+	return strings.TrimRight(string(out), "\n")
+}
+
+// waitForServices waits until every service in docker-compose.yml is running
+// and healthy. If a service exits or fails its healthcheck, or the wait
+// times out, the error names the service and includes its last log lines.
+func waitForServices(containerType SupportedContainer) error {
+	services, err := composeServices("docker-compose.yml")
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("Waiting for the containers to become healthy...")
+
+	var failed *composeService
+	var reason string
+	ready := waitUntil(waitTimeout, func() bool {
+		allReady := true
+		for _, service := range services {
+			state, err := inspectContainer(containerType, service.Container)
+			if err != nil {
+				allReady = false
+				continue
+			}
+			if msg := state.failure(); msg != "" {
+				failed, reason = &service, msg
+				return true
+			}
+			if !state.ready() {
+				allReady = false
+			}
+		}
+		return allReady
+	})
+
+	if failed == nil && !ready {
+		// Report the first service that is still not ready
+		for _, service := range services {
+			state, err := inspectContainer(containerType, service.Container)
+			if err != nil {
+				failed, reason = &service, "was not created"
+				break
+			}
+			if !state.ready() {
+				failed, reason = &service, fmt.Sprintf("is still %s after %v", describeState(state), waitTimeout)
+				break
+			}
+		}
+	}
+
+	if failed == nil {
+		fmt.Println("All containers are healthy.")
+		return nil
+	}
+
+	msg := fmt.Sprintf("service %s %s", failed.Name, reason)
+	if logs := containerLogTail(containerType, failed.Container, 20); logs != "" {
+		msg += "\nLast log lines of " + failed.Container + ":\n" + logs
+	}
+	return fmt.Errorf("%s", msg)
+}
+
+// describeState summarizes a container state for messages.
+func describeState(state containerState) string {
+	if state.Running && state.Health != nil && state.Health.Status != "" {
+		return state.Health.Status
+	}
+	return state.Status
+}
+
+// pangolinAPIURL is Pangolin's external API health endpoint as seen from
+// inside the pangolin container.
+const pangolinAPIURL = "http://localhost:3000/api/v1/"
+
+// probePangolinAPI requests Pangolin's health endpoint from inside the
+// container, so it tests the application itself rather than the container.
+func probePangolinAPI(containerType SupportedContainer) error {
+	out, err := containerCommand(containerType, "exec", serviceContainer("pangolin"), "curl", "-fsS", "--max-time", "5", pangolinAPIURL).Output()
+	if err != nil {
+		return fmt.Errorf("the Pangolin API at %s did not respond: %v", pangolinAPIURL, err)
+	}
+
+	var response struct {
+		Message string `json:"message"`
+	}
+	if err := json.Unmarshal(out, &response); err != nil || response.Message != "Healthy" {
+		return fmt.Errorf("the Pangolin API returned an unexpected response: %s", strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// waitForPangolinAPI waits until Pangolin answers on its API. While it does
+// not, the container logs tell apart an application that is still migrating
+// its database from one that crashed.
+func waitForPangolinAPI(containerType SupportedContainer) error {
+	fmt.Println("Waiting for the Pangolin API to respond...")
+
+	var probeErr error
+	var failure string
+	migrating := false
+	container := serviceContainer("pangolin")
+	ready := waitUntil(waitTimeout, func() bool {
+		if probeErr = probePangolinAPI(containerType); probeErr == nil {
+			return true
+		}
+
+		// A failing healthcheck is expected while migrating; only a stopped
+		// container is final
+		state, err := inspectContainer(containerType, container)
+		if err == nil && (state.Status == "exited" || state.Status == "dead") {
+			failure = state.failure()
+			return true
+		}
+
+		if !migrating && isMigrating(containerLogTail(containerType, container, 50)) {
+			migrating = true
+			fmt.Println("Pangolin is running database migrations, this may take a while...")
+		}
+		return false
+	})
+
+	switch {
+	case failure != "":
+		return fmt.Errorf("the pangolin container %s\nLast log lines:\n%s", failure, containerLogTail(containerType, container, 20))
+	case !ready && migrating:
+		return fmt.Errorf("pangolin is still migrating its database after %v (use --wait-timeout to wait longer)", waitTimeout)
+	case !ready:
+		return fmt.Errorf("the pangolin container is up but the application is not responding: %v\nLast log lines:\n%s", probeErr, containerLogTail(containerType, container, 20))
+	}
+
+	fmt.Println("The Pangolin API is responding.")
+	return nil
+}
+
+// isMigrating reports whether Pangolin's logs show database migrations in
+// progress.
+func isMigrating(logs string) bool {
+	started := strings.LastIndex(logs, "Running migration")
+	if started == -1 {
+		started = strings.LastIndex(logs, "Starting migrations")
+	}
+	return started != -1 && !strings.Contains(logs[started:], "Migrations completed")
+}
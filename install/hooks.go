@@ -0,0 +1,154 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// hooksDir holds user-defined hook scripts, one directory per lifecycle
+// point, e.g. hooks/pre-upgrade.d/10-notify-users.sh.
+const hooksDir = "hooks"
+
+// Lifecycle points hooks can be attached to. A failing pre- hook aborts the
+// operation before anything is changed; a failing post- hook only warns.
+const (
+	hookPreInstall   = "pre-install"
+	hookPostInstall  = "post-install"
+	hookPreUpgrade   = "pre-upgrade"
+	hookPostUpgrade  = "post-upgrade"
+	hookPreRollback  = "pre-rollback"
+	hookPostRollback = "post-rollback"
+)
+
+func init() {
+	registerStep(installStep{
+		Name:  "pre-install hooks",
+		Order: 15,
+		When:  freshInstall,
+		Run:   func(state *installState) error { return runHooks(hookPreInstall, state.Config) },
+	})
+	registerStep(installStep{
+		Name:  "post-install hooks",
+		Order: 85,
+		When:  freshInstall,
+		Run: func(state *installState) error {
+			runPostHooks(hookPostInstall, state.Config)
+			return nil
+		},
+	})
+}
+
+// runHooks runs the executable *.sh files in hooks/<point>.d in lexical
+// order from the installation directory. The Config is passed as PANGOLIN_*
+// environment variables named after its yaml keys, e.g. PANGOLIN_BASE_DOMAIN,
+// along with PANGOLIN_HOOK and PANGOLIN_INSTALL_DIR. Secrets are included,
+// so the hooks directory deserves the same care as the config directory.
+func runHooks(point string, config Config) error {
+	scripts, err := filepath.Glob(filepath.Join(hooksDir, point+".d", "*.sh"))
+	if err != nil || len(scripts) == 0 {
+		return nil
+	}
+	slices.Sort(scripts)
+
+	installDir, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	env := append(os.Environ(), hookEnv(config)...)
+	env = append(env, "PANGOLIN_HOOK="+point, "PANGOLIN_INSTALL_DIR="+installDir)
+
+	fmt.Printf("\n=== Running %s hooks ===\n", point)
+	for _, script := range scripts {
+		info, err := os.Stat(script)
+		if err != nil {
+			return err
+		}
+		if info.Mode()&0111 == 0 {
+			fmt.Printf("Skipping %s: not executable\n", script)
+			continue
+		}
+
+		fmt.Printf("Running %s...\n", script)
+		cmd := exec.Command(filepath.Join(installDir, script))
+		cmd.Env = env
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		if err := hostOps.Run(cmd); err != nil {
+			return fmt.Errorf("hook %s failed: %v", script, err)
+		}
+	}
+	return nil
+}
+
+// runPostHooks runs post- hooks, which cannot undo the operation they follow,
+// so a failure is reported as a warning.
+func runPostHooks(point string, config Config) {
+	if err := runHooks(point, config); err != nil {
+		fmt.Printf("Warning: %v\n", err)
+	}
+}
+
+// hookEnv returns the Config fields as PANGOLIN_<YAML_KEY>=value pairs.
+// Booleans are "true" or "false".
+func hookEnv(config Config) []string {
+	var env []string
+	value := reflect.ValueOf(config)
+	for i := range value.NumField() {
+		key, _, _ := strings.Cut(value.Type().Field(i).Tag.Get("yaml"), ",")
+		if key == "" || key == "-" {
+			continue
+		}
+
+		var s string
+		switch field := value.Field(i); field.Kind() {
+		case reflect.Bool:
+			s = strconv.FormatBool(field.Bool())
+		case reflect.Int:
+			s = strconv.FormatInt(field.Int(), 10)
+		case reflect.String:
+			s = field.String()
+		default:
+			continue
+		}
+		env = append(env, "PANGOLIN_"+strings.ToUpper(key)+"="+s)
+	}
+	return env
+}
+
+// existingConfig returns the Config of an existing installation, for hooks
+// run by upgrade and rollback. Without a state file it reconstructs the
+// parts that can be read back from the generated files, leaving the answers
+// that leave no trace there empty.
+func existingConfig(containerType SupportedContainer) Config {
+	if config, ok, err := loadInstallState(); err == nil && ok {
+		config.InstallationContainerType = containerType
+		return config
+	}
+	config := Config{InstallationContainerType: containerType}
+
+	if versions, err := installedVersions(); err == nil {
+		config.PangolinVersion = versions["pangolin"]
+		config.GerbilVersion = versions["gerbil"]
+		config.BadgerVersion = versions["badger"]
+		config.InstallGerbil = versions["gerbil"] != ""
+	}
+	if appConfig, err := ReadAppConfig("config/config.yml"); err == nil {
+		if u, err := url.Parse(appConfig.DashboardURL); err == nil {
+			config.DashboardDomain = u.Hostname()
+		}
+		config.BaseDomain = appConfig.BaseDomain
+	}
+	if traefikConfig, err := ReadTraefikConfig(traefikStaticFile); err == nil {
+		config.LetsEncryptEmail = traefikConfig.LetsEncryptEmail
+	}
+	config.DoCrowdsecInstall = checkIsCrowdsecInstalledInCompose()
+	config.IsPostgreSQL = isPostgresInstall()
+	return config
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+)
+
+// hostRunner carries out the changes the installer makes to the host:
+// commands that change its state and files written outside the installation
+// directory. Commands that only look at the host, such as docker info, run
+// directly.
+type hostRunner interface {
+	// Run runs cmd with the standard streams it was given.
+	Run(cmd *exec.Cmd) error
+	// CombinedOutput runs cmd and returns its stdout and stderr.
+	CombinedOutput(cmd *exec.Cmd) ([]byte, error)
+	WriteFile(path string, data []byte, mode os.FileMode) error
+	MkdirAll(path string, mode os.FileMode) error
+	Chown(path string, uid, gid int) error
+}
+
+// hostOps is where host changes go. --simulate replaces it with a recorder.
+var hostOps hostRunner = systemHost{}
+
+// systemHost changes the host it runs on.
+type systemHost struct{}
+
+func (systemHost) Run(cmd *exec.Cmd) error { return runCommand(cmd) }
+
+func (systemHost) CombinedOutput(cmd *exec.Cmd) ([]byte, error) { return cmd.CombinedOutput() }
+
+func (systemHost) WriteFile(path string, data []byte, mode os.FileMode) error {
+	return os.WriteFile(path, data, mode)
+}
+
+func (systemHost) MkdirAll(path string, mode os.FileMode) error { return os.MkdirAll(path, mode) }
+
+func (systemHost) Chown(path string, uid, gid int) error { return os.Chown(path, uid, gid) }
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/fosrl/pangolin/install/pkg/installer"
+)
+
+// defaultLanguage is the catalog every other catalog falls back to.
+const defaultLanguage = "en-US"
+
+// messageFiles holds one catalog per locale, keyed like the web UI's
+// messages/*.json. Values are fmt format strings.
+//
+//go:embed messages/*.json
+var messageFiles embed.FS
+
+var (
+	fallbackMessages map[string]string
+	messages         map[string]string
+)
+
+// The language defaults to the locale of the environment; the install
+// overrides it with --lang.
+func init() {
+	if err := setLanguage(environmentLanguage()); err != nil {
+		panic(err)
+	}
+}
+
+// supportedLanguages returns the locales that have a catalog.
+func supportedLanguages() []string {
+	entries, _ := messageFiles.ReadDir("messages")
+	var languages []string
+	for _, entry := range entries {
+		languages = append(languages, strings.TrimSuffix(entry.Name(), ".json"))
+	}
+	return languages
+}
+
+// setLanguage selects the catalog for a locale such as "de-DE", "de_DE.UTF-8"
+// or "de". An empty or unknown locale selects English.
+func setLanguage(locale string) error {
+	if fallbackMessages == nil {
+		var err error
+		if fallbackMessages, err = loadCatalog(defaultLanguage); err != nil {
+			return err
+		}
+	}
+	messages = fallbackMessages
+
+	language := matchLanguage(locale)
+	if language == "" || language == defaultLanguage {
+		return nil
+	}
+	catalog, err := loadCatalog(language)
+	if err != nil {
+		return err
+	}
+	messages = catalog
+	return nil
+}
+
+// matchLanguage returns the supported locale matching a locale name, first
+// by language and region, then by language alone.
+func matchLanguage(locale string) string {
+	locale, _, _ = strings.Cut(locale, ".")
+	locale = strings.ReplaceAll(locale, "_", "-")
+	if locale == "" || locale == "C" || locale == "POSIX" {
+		return ""
+	}
+
+	language, _, _ := strings.Cut(locale, "-")
+	var byLanguage string
+	for _, supported := range supportedLanguages() {
+		if strings.EqualFold(supported, locale) {
+			return supported
+		}
+		if prefix, _, _ := strings.Cut(supported, "-"); byLanguage == "" && strings.EqualFold(prefix, language) {
+			byLanguage = supported
+		}
+	}
+	return byLanguage
+}
+
+func loadCatalog(language string) (map[string]string, error) {
+	data, err := messageFiles.ReadFile(path.Join("messages", language+".json"))
+	if err != nil {
+		return nil, fmt.Errorf("no messages for language %s", language)
+	}
+	var catalog map[string]string
+	if err := json.Unmarshal(data, &catalog); err != nil {
+		return nil, fmt.Errorf("invalid messages for language %s: %v", language, err)
+	}
+	return catalog, nil
+}
+
+// environmentLanguage returns the locale from the environment, following the
+// precedence of gettext.
+func environmentLanguage() string {
+	for _, name := range []string{"LC_ALL", "LC_MESSAGES", "LANG"} {
+		if value := os.Getenv(name); value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// msg returns the message for key in the selected language, formatted with
+// args. Keys missing from a translation fall back to English.
+func msg(key string, args ...any) string {
+	format, ok := messages[key]
+	if !ok {
+		if format, ok = fallbackMessages[key]; !ok {
+			format = key
+		}
+	}
+	if len(args) == 0 {
+		return format
+	}
+	return fmt.Sprintf(format, args...)
+}
+
+// localizeError returns a validation error of the installer package in the
+// selected language, translating the errors it wraps as well. Other errors
+// are returned as they are.
+func localizeError(err error) error {
+	var invalid *installer.ValidationError
+	if !errors.As(err, &invalid) {
+		return err
+	}
+	args := make([]any, len(invalid.Args))
+	for i, arg := range invalid.Args {
+		if wrapped, ok := arg.(error); ok {
+			arg = localizeError(wrapped)
+		}
+		args[i] = arg
+	}
+	return errors.New(msg(invalid.Key, args...))
+}
+
+// localizedCheck returns check with its errors translated, for the prompts.
+func localizedCheck(check func(string) error) func(string) error {
+	return func(value string) error {
+		return localizeError(check(value))
+	}
+}
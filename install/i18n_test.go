@@ -0,0 +1,39 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/fosrl/pangolin/install/pkg/installer"
+)
+
+// TestValidationMessages checks that every catalog translates the
+// validation errors of the installer package, and the English one with
+// the package's own texts.
+func TestValidationMessages(t *testing.T) {
+	for _, language := range supportedLanguages() {
+		catalog, err := loadCatalog(language)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for key, english := range installer.ValidationMessages {
+			text, ok := catalog[key]
+			switch {
+			case !ok:
+				t.Errorf("%s has no message %s", language, key)
+			case language == defaultLanguage && text != english:
+				t.Errorf("%s: %s is %q, the installer package has %q", language, key, text, english)
+			}
+		}
+	}
+
+	if err := setLanguage("de-DE"); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { setLanguage(defaultLanguage) })
+	config := installer.DefaultConfig()
+	config.BaseDomain = "example.com."
+	want := `ungültiger Wert für base_domain: "example.com." endet mit einem Punkt: lassen Sie ihn weg`
+	if err := localizeError(installer.Validate(config)); err == nil || err.Error() != want {
+		t.Errorf("localizeError(Validate()) = %v, want %s", err, want)
+	}
+}
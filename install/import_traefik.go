@@ -0,0 +1,272 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	// traefikHostRule matches rules made only of Host matchers, e.g.
+	// Host(`a.example.com`) || Host(`b.example.com`)
+	traefikHostRule = regexp.MustCompile("^\\s*Host\\(`[^`]+`(\\s*,\\s*`[^`]+`)*\\)(\\s*\\|\\|\\s*Host\\(`[^`]+`(\\s*,\\s*`[^`]+`)*\\))*\\s*$")
+	traefikRuleArg  = regexp.MustCompile("`([^`]+)`")
+)
+
+// traefikDynamic is the merged content of Traefik dynamic configuration
+// files, plus the entry points of any static configuration among them.
+type traefikDynamic struct {
+	HTTPRouters  map[string]map[string]any
+	HTTPServices map[string]map[string]any
+	TCPRouters   map[string]map[string]any
+	TCPServices  map[string]map[string]any
+	UDPRouters   map[string]map[string]any
+	UDPServices  map[string]map[string]any
+	EntryPoints  map[string]int
+}
+
+// parseTraefikDynamicConfig translates the routers and services of Traefik
+// dynamic configuration files, given as a file or a directory of them, such
+// as a hand-rolled file provider setup. Routers are matched on Host rules
+// only; anything Pangolin cannot express is listed as unmapped.
+func parseTraefikDynamicConfig(path string) (*importPlan, error) {
+	plan := &importPlan{}
+	config, err := readTraefikDynamic(path, plan)
+	if err != nil {
+		return nil, err
+	}
+
+	plan.Sites = append(plan.Sites, suggestedSite{
+		Name: filepath.Base(strings.TrimSuffix(path, string(filepath.Separator))),
+		Note: "Targets are addressed as Traefik reached them; run Newt on the same host, in the same Docker network if they are container names.",
+	})
+
+	for _, name := range sortedKeys(config.HTTPRouters) {
+		importHTTPRouter(plan, config, name)
+	}
+	for _, name := range sortedKeys(config.TCPRouters) {
+		importRawRouter(plan, config, "tcp", name)
+	}
+	for _, name := range sortedKeys(config.UDPRouters) {
+		importRawRouter(plan, config, "udp", name)
+	}
+	return plan, nil
+}
+
+// readTraefikDynamic reads and merges the YAML files at path. Files that
+// cannot be read as YAML are noted in the plan and skipped.
+func readTraefikDynamic(path string, plan *importPlan) (*traefikDynamic, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	if info.IsDir() {
+		err = filepath.WalkDir(path, func(file string, d fs.DirEntry, err error) error {
+			if err == nil && !d.IsDir() {
+				files = append(files, file)
+			}
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		files = []string{path}
+	}
+
+	config := &traefikDynamic{
+		HTTPRouters: map[string]map[string]any{}, HTTPServices: map[string]map[string]any{},
+		TCPRouters: map[string]map[string]any{}, TCPServices: map[string]map[string]any{},
+		UDPRouters: map[string]map[string]any{}, UDPServices: map[string]map[string]any{},
+		EntryPoints: map[string]int{},
+	}
+	for _, file := range files {
+		switch filepath.Ext(file) {
+		case ".yml", ".yaml":
+		case ".toml":
+			plan.Unmapped = append(plan.Unmapped, file+": TOML is not supported; convert it to YAML")
+			continue
+		default:
+			continue
+		}
+
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		var doc map[string]any
+		if err := yaml.Unmarshal(data, &doc); err != nil {
+			plan.Unmapped = append(plan.Unmapped, fmt.Sprintf("%s: not valid YAML, e.g. because of Go templates: %v", file, err))
+			continue
+		}
+
+		for protocol, sections := range map[string][2]map[string]map[string]any{
+			"http": {config.HTTPRouters, config.HTTPServices},
+			"tcp":  {config.TCPRouters, config.TCPServices},
+			"udp":  {config.UDPRouters, config.UDPServices},
+		} {
+			for i, kind := range []string{"routers", "services"} {
+				entries, _ := lookup(doc, protocol, kind)
+				m, _ := entries.(map[string]any)
+				for name, raw := range m {
+					if entry, ok := raw.(map[string]any); ok {
+						sections[i][name] = entry
+					}
+				}
+			}
+		}
+
+		// Entry points come from the static configuration, if it is included
+		entryPoints, _ := doc["entryPoints"].(map[string]any)
+		for name, raw := range entryPoints {
+			entryPoint, _ := raw.(map[string]any)
+			address, _ := entryPoint["address"].(string)
+			if _, port, err := net.SplitHostPort(address); err == nil {
+				if p, err := strconv.Atoi(strings.TrimSuffix(strings.TrimSuffix(port, "/udp"), "/tcp")); err == nil {
+					config.EntryPoints[name] = p
+				}
+			}
+		}
+	}
+	return config, nil
+}
+
+func importHTTPRouter(plan *importPlan, config *traefikDynamic, name string) {
+	router := config.HTTPRouters[name]
+	source := "http router " + name
+	rule, _ := router["rule"].(string)
+	serviceName, _ := router["service"].(string)
+
+	if !traefikHostRule.MatchString(rule) {
+		plan.Unmapped = append(plan.Unmapped, fmt.Sprintf("%s: rule %q; only Host matchers map to resources, use resource rules for the rest", source, rule))
+		return
+	}
+	if middlewares, ok := router["middlewares"].([]any); ok && len(middlewares) > 0 {
+		plan.Unmapped = append(plan.Unmapped, fmt.Sprintf("%s: middlewares %v were not carried over; Pangolin's authentication and rules replace most of them", source, middlewares))
+	}
+
+	service, targets, problem := traefikServiceTargets(config.HTTPServices, serviceName, true)
+	if problem != "" {
+		plan.Unmapped = append(plan.Unmapped, fmt.Sprintf("%s: %s", source, problem))
+		return
+	}
+	if _, sticky := lookup(service, "loadBalancer", "sticky"); sticky {
+		plan.Unmapped = append(plan.Unmapped, fmt.Sprintf("%s: sticky sessions of service %s were not carried over", source, serviceName))
+	}
+
+	hosts := traefikRuleArg.FindAllStringSubmatch(rule, -1)
+	for _, match := range hosts {
+		resourceName := name
+		if len(hosts) > 1 {
+			resourceName = fmt.Sprintf("%s (%s)", name, match[1])
+		}
+		plan.Resources = append(plan.Resources, importedResource{
+			Name:     resourceName,
+			Hostname: match[1],
+			Protocol: "tcp",
+			HTTP:     true,
+			Targets:  targets,
+			Source:   source,
+		})
+	}
+}
+
+// importRawRouter translates a TCP or UDP router into a raw resource on the
+// port of its entry point.
+func importRawRouter(plan *importPlan, config *traefikDynamic, protocol, name string) {
+	router := config.TCPRouters[name]
+	services := config.TCPServices
+	if protocol == "udp" {
+		router, services = config.UDPRouters[name], config.UDPServices
+	}
+	source := protocol + " router " + name
+
+	if rule, _ := router["rule"].(string); protocol == "tcp" && strings.ReplaceAll(rule, " ", "") != "HostSNI(`*`)" {
+		plan.Unmapped = append(plan.Unmapped, fmt.Sprintf("%s: rule %q; routing by SNI has no Pangolin equivalent", source, rule))
+		return
+	}
+
+	entryPoints, _ := router["entryPoints"].([]any)
+	if len(entryPoints) != 1 {
+		plan.Unmapped = append(plan.Unmapped, source+": needs exactly one entry point to know its port")
+		return
+	}
+	entryPoint := fmt.Sprint(entryPoints[0])
+	port, ok := config.EntryPoints[entryPoint]
+	if !ok {
+		plan.Unmapped = append(plan.Unmapped, fmt.Sprintf("%s: port of entry point %s unknown; include the static configuration", source, entryPoint))
+		return
+	}
+
+	serviceName, _ := router["service"].(string)
+	_, targets, problem := traefikServiceTargets(services, serviceName, false)
+	if problem != "" {
+		plan.Unmapped = append(plan.Unmapped, fmt.Sprintf("%s: %s", source, problem))
+		return
+	}
+
+	plan.Resources = append(plan.Resources, importedResource{
+		Name:      name,
+		ProxyPort: port,
+		Protocol:  protocol,
+		Targets:   targets,
+		Source:    source,
+	})
+}
+
+// traefikServiceTargets returns a load balancer service and its servers as
+// targets, or why it cannot be imported.
+func traefikServiceTargets(services map[string]map[string]any, name string, http bool) (map[string]any, []importedTarget, string) {
+	if base, provider, ok := strings.Cut(name, "@"); ok {
+		if provider != "file" {
+			return nil, nil, fmt.Sprintf("service %s is provided by %s, not the files", name, provider)
+		}
+		name = base
+	}
+
+	service, ok := services[name]
+	if !ok {
+		return nil, nil, fmt.Sprintf("service %q not found", name)
+	}
+	servers, ok := lookup(service, "loadBalancer", "servers")
+	list, _ := servers.([]any)
+	if !ok || len(list) == 0 {
+		return nil, nil, fmt.Sprintf("service %s is not a load balancer with servers (weighted, mirroring and failover services are not supported)", name)
+	}
+
+	var targets []importedTarget
+	for _, raw := range list {
+		server, _ := raw.(map[string]any)
+		if http {
+			address, _ := server["url"].(string)
+			u, err := url.Parse(address)
+			if err != nil || u.Hostname() == "" {
+				return nil, nil, fmt.Sprintf("service %s has an invalid server URL %q", name, address)
+			}
+			port := map[string]int{"http": 80, "https": 443}[u.Scheme]
+			if p := u.Port(); p != "" {
+				port, _ = strconv.Atoi(p)
+			}
+			targets = append(targets, importedTarget{Method: u.Scheme, Host: u.Hostname(), Port: port})
+			continue
+		}
+
+		address, _ := server["address"].(string)
+		host, p, err := net.SplitHostPort(address)
+		port, _ := strconv.Atoi(p)
+		if err != nil || port == 0 {
+			return nil, nil, fmt.Sprintf("service %s has an invalid server address %q", name, address)
+		}
+		targets = append(targets, importedTarget{Host: host, Port: port})
+	}
+	return service, targets, ""
+}
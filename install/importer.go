@@ -0,0 +1,336 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// importedResource is a public resource translated from the configuration of
+// another reverse proxy or tunnel.
+type importedResource struct {
+	Name     string
+	Hostname string // for HTTP resources
+	// ProxyPort is the public port of a raw TCP or UDP resource
+	ProxyPort int
+	Protocol  string // "tcp" or "udp"
+	HTTP      bool
+	Targets   []importedTarget
+	// Source names the rule the resource was translated from
+	Source string
+}
+
+// importedTarget is a backend of an imported resource.
+type importedTarget struct {
+	Method string // "http" or "https", for HTTP resources
+	Host   string
+	Port   int
+}
+
+func (t importedTarget) String() string {
+	address := net.JoinHostPort(t.Host, strconv.Itoa(t.Port))
+	if t.Method != "" {
+		return t.Method + "://" + address
+	}
+	return address
+}
+
+// suggestedSite is a site the imported resources could be reached through,
+// e.g. one per tunnel.
+type suggestedSite struct {
+	Name string
+	Note string
+}
+
+// importPlan is what an importer found in the configuration.
+type importPlan struct {
+	Sites     []suggestedSite
+	Resources []importedResource
+	// Unmapped lists the constructs that have no Pangolin equivalent and
+	// need to be recreated by hand
+	Unmapped []string
+}
+
+// importSource parses one kind of configuration into an importPlan.
+type importSource struct {
+	Description string
+	DefaultPath string
+	Parse       func(path string) (*importPlan, error)
+}
+
+var importSources = map[string]importSource{
+	"cloudflared": {
+		Description: "Cloudflare Tunnel config.yml with ingress rules",
+		DefaultPath: "~/.cloudflared/config.yml",
+		Parse:       parseCloudflaredConfig,
+	},
+	"traefik": {
+		Description: "Traefik dynamic configuration, a file or a directory of YAML files",
+		DefaultPath: "/etc/traefik/dynamic",
+		Parse:       parseTraefikDynamicConfig,
+	},
+}
+
+// runImport translates the configuration of another reverse proxy or tunnel
+// into Pangolin resources and creates them through the integration API.
+func runImport(args []string) error {
+	var names []string
+	for name, source := range importSources {
+		names = append(names, fmt.Sprintf("  %-12s %s", name, source.Description))
+	}
+	slices.Sort(names)
+	usage := "usage: installer import <source> [flags]\n\nSources:\n" + strings.Join(names, "\n")
+
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		return fmt.Errorf("%s", usage)
+	}
+	source, ok := importSources[args[0]]
+	if !ok {
+		return fmt.Errorf("unknown import source %q\n%s", args[0], usage)
+	}
+
+	flags := flag.NewFlagSet("import "+args[0], flag.ExitOnError)
+	from := flags.String("from", source.DefaultPath, "Configuration to import")
+	dir := flags.String("dir", "", "Installation directory")
+	org := flags.String("org", "", "ID of the organization to create the resources in")
+	apiKey := flags.String("api-key", os.Getenv("PANGOLIN_API_KEY"), "Integration API key with access to the organization (default $PANGOLIN_API_KEY)")
+	apiURL := flags.String("api-url", "", "Integration API base URL, e.g. https://api.example.com/v1 (default: call it inside the pangolin container)")
+	siteID := flags.Int("site", 0, "ID of the site the targets are reached through")
+	createSite := flags.Bool("create-site", false, "Create a Newt site for the targets, named after the suggested site")
+	dryRun := flags.Bool("dry-run", false, "Only show what would be imported")
+	if err := flags.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	path, err := expandPath(*from)
+	if err != nil {
+		return err
+	}
+	plan, err := source.Parse(path)
+	if err != nil {
+		return err
+	}
+	printImportPlan(plan)
+
+	if *dryRun || len(plan.Resources) == 0 {
+		return nil
+	}
+	if *org == "" || *apiKey == "" {
+		return usageErrorf("--org and --api-key are required to create the resources; use --dry-run to only review them")
+	}
+	if *siteID == 0 && !*createSite {
+		return fmt.Errorf("pass --site with an existing site ID, or --create-site")
+	}
+
+	if err := enterInstallDir(*dir); err != nil {
+		return err
+	}
+	api, dashboardURL, err := installAPIClient(*apiURL, *apiKey)
+	if err != nil {
+		return err
+	}
+
+	if *createSite {
+		name := "imported"
+		if len(plan.Sites) > 0 {
+			name = plan.Sites[0].Name
+		}
+		if *siteID, err = createNewtSite(api, *org, name, dashboardURL); err != nil {
+			return err
+		}
+	}
+
+	return createImportedResources(api, *org, *siteID, plan.Resources)
+}
+
+func printImportPlan(plan *importPlan) {
+	fmt.Println("\n=== Import Plan ===")
+	for _, site := range plan.Sites {
+		fmt.Printf("Suggested site: %s\n", site.Name)
+		if site.Note != "" {
+			fmt.Printf("  %s\n", site.Note)
+		}
+	}
+
+	if len(plan.Resources) == 0 {
+		fmt.Println("No resources to import.")
+	} else {
+		fmt.Println("Resources:")
+	}
+	for _, r := range plan.Resources {
+		var targets []string
+		for _, t := range r.Targets {
+			targets = append(targets, t.String())
+		}
+		if r.HTTP {
+			fmt.Printf("  https://%s -> %s  (%s)\n", r.Hostname, strings.Join(targets, ", "), r.Source)
+		} else {
+			fmt.Printf("  %s port %d -> %s  (%s)\n", r.Protocol, r.ProxyPort, strings.Join(targets, ", "), r.Source)
+		}
+	}
+
+	if len(plan.Unmapped) > 0 {
+		fmt.Println("\nNot imported, recreate by hand:")
+		for _, u := range plan.Unmapped {
+			fmt.Printf("  - %s\n", u)
+		}
+	}
+}
+
+// createNewtSite creates a Newt site and prints the credentials to start
+// Newt with.
+func createNewtSite(api *apiClient, orgID, name, endpoint string) (int, error) {
+	var defaults struct {
+		ExitNodeID    int    `json:"exitNodeId"`
+		Subnet        string `json:"subnet"`
+		NewtID        string `json:"newtId"`
+		NewtSecret    string `json:"newtSecret"`
+		ClientAddress string `json:"clientAddress"`
+	}
+	if err := api.do("GET", "/org/"+orgID+"/pick-site-defaults", nil, &defaults); err != nil {
+		return 0, fmt.Errorf("failed to get site defaults: %v", err)
+	}
+
+	var site struct {
+		SiteID int `json:"siteId"`
+	}
+	err := api.do("PUT", "/org/"+orgID+"/site", map[string]any{
+		"name":       name,
+		"type":       "newt",
+		"exitNodeId": defaults.ExitNodeID,
+		"subnet":     defaults.Subnet,
+		"newtId":     defaults.NewtID,
+		"secret":     defaults.NewtSecret,
+		"address":    defaults.ClientAddress,
+	}, &site)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create site: %v", err)
+	}
+
+	fmt.Printf("\nCreated site %s (%d). Start Newt next to the imported services with:\n", name, site.SiteID)
+	fmt.Printf("  newt --id %s --secret %s --endpoint %s\n", defaults.NewtID, defaults.NewtSecret, endpoint)
+	return site.SiteID, nil
+}
+
+// createImportedResources creates the resources and their targets. A
+// resource that fails is reported and skipped so one bad rule does not stop
+// the rest.
+func createImportedResources(api *apiClient, orgID string, siteID int, resources []importedResource) error {
+	domains, err := listOrgDomains(api, orgID)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("\n=== Creating Resources ===")
+	failed := 0
+	for _, r := range resources {
+		label := r.label()
+		body, err := resourceBody(r, domains)
+		if err != nil {
+			fmt.Printf("Skipping %s: %v\n", label, err)
+			failed++
+			continue
+		}
+
+		var resource struct {
+			ResourceID int `json:"resourceId"`
+		}
+		if err := api.do("PUT", "/org/"+orgID+"/resource", body, &resource); err != nil {
+			fmt.Printf("Failed to create %s: %v\n", label, err)
+			failed++
+			continue
+		}
+
+		var targetErr error
+		for _, t := range r.Targets {
+			if err := addResourceTarget(api, resource.ResourceID, siteID, t); err != nil {
+				targetErr = err
+				break
+			}
+		}
+		if targetErr != nil {
+			fmt.Printf("Created %s but failed to add its targets: %v\n", label, targetErr)
+			failed++
+			continue
+		}
+		fmt.Printf("Created %s\n", label)
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d resources were not imported", failed, len(resources))
+	}
+	fmt.Printf("\nCreated %d resources.\n", len(resources))
+	return nil
+}
+
+func (r importedResource) label() string {
+	if r.HTTP {
+		return r.Hostname
+	}
+	return fmt.Sprintf("%s port %d", r.Protocol, r.ProxyPort)
+}
+
+// orgDomain is a domain of an organization that resources are created under.
+type orgDomain struct {
+	DomainID   string `json:"domainId"`
+	BaseDomain string `json:"baseDomain"`
+}
+
+func listOrgDomains(api *apiClient, orgID string) ([]orgDomain, error) {
+	var response struct {
+		Domains []orgDomain `json:"domains"`
+	}
+	if err := api.do("GET", "/org/"+orgID+"/domains", nil, &response); err != nil {
+		return nil, fmt.Errorf("failed to list domains: %v", err)
+	}
+	return response.Domains, nil
+}
+
+// resourceDomain returns the domain ID and subdomain of an HTTP resource:
+// the longest matching base domain holds it.
+func resourceDomain(hostname string, domains []orgDomain) (string, string, error) {
+	domainID, baseDomain := "", ""
+	for _, d := range domains {
+		if (hostname == d.BaseDomain || strings.HasSuffix(hostname, "."+d.BaseDomain)) && len(d.BaseDomain) > len(baseDomain) {
+			domainID, baseDomain = d.DomainID, d.BaseDomain
+		}
+	}
+	if domainID == "" {
+		return "", "", fmt.Errorf("no domain of the organization matches it")
+	}
+	return domainID, strings.TrimSuffix(strings.TrimSuffix(hostname, baseDomain), "."), nil
+}
+
+// resourceBody returns the request body that creates r.
+func resourceBody(r importedResource, domains []orgDomain) (map[string]any, error) {
+	body := map[string]any{"name": r.Name, "http": r.HTTP, "protocol": r.Protocol}
+	if !r.HTTP {
+		body["proxyPort"] = r.ProxyPort
+		return body, nil
+	}
+	domainID, subdomain, err := resourceDomain(r.Hostname, domains)
+	if err != nil {
+		return nil, err
+	}
+	body["domainId"] = domainID
+	if subdomain != "" {
+		body["subdomain"] = subdomain
+	}
+	return body, nil
+}
+
+// addResourceTarget adds a target reached through siteID to a resource.
+func addResourceTarget(api *apiClient, resourceID, siteID int, t importedTarget) error {
+	target := map[string]any{"siteId": siteID, "ip": t.Host, "port": t.Port}
+	if t.Method != "" {
+		target["method"] = t.Method
+	}
+	if err := api.do("PUT", fmt.Sprintf("/resource/%d/target", resourceID), target, nil); err != nil {
+		return fmt.Errorf("target %s: %v", t, err)
+	}
+	return nil
+}
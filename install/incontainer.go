@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// containerMount is a mount of the installer container, as the engine
+// reports it.
+type containerMount struct {
+	Type        string `json:"Type"`
+	Source      string `json:"Source"`
+	Destination string `json:"Destination"`
+}
+
+// ownMounts returns the mounts of the installer container. Docker names the
+// hostname of a container after its ID.
+func ownMounts() ([]containerMount, error) {
+	id, err := os.Hostname()
+	if err != nil {
+		return nil, err
+	}
+	out, err := dockerCommand("docker", "inspect", "--format", "{{json .Mounts}}", id).Output()
+	if err != nil {
+		return nil, fmt.Errorf("could not inspect the installer container %s: %v (run it without --hostname)", id, err)
+	}
+	var mounts []containerMount
+	if err := json.Unmarshal(out, &mounts); err != nil {
+		return nil, fmt.Errorf("error parsing the mounts of the installer container: %v", err)
+	}
+	return mounts, nil
+}
+
+// hostPathOf returns the path on the host of a path in the container,
+// through the innermost bind mount it is under.
+func hostPathOf(path string, mounts []containerMount) (string, bool) {
+	var best *containerMount
+	for i, m := range mounts {
+		if m.Type != "bind" {
+			continue
+		}
+		if path != m.Destination && !strings.HasPrefix(path, strings.TrimSuffix(m.Destination, "/")+"/") {
+			continue
+		}
+		if best == nil || len(m.Destination) > len(best.Destination) {
+			best = &mounts[i]
+		}
+	}
+	if best == nil {
+		return "", false
+	}
+	rel, err := filepath.Rel(best.Destination, path)
+	if err != nil {
+		return "", false
+	}
+	return filepath.Join(best.Source, rel), true
+}
+
+// enterHostPath changes into the installation directory under the path it
+// has on the host, and returns that path. Compose resolves the relative
+// bind mounts of docker-compose.yml against the directory it runs in and
+// hands them to the engine, which looks them up on the host; where the
+// directory is mounted at another path, a symlink from the host path makes
+// both agree.
+func enterHostPath(dir string) (string, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	mounts, err := ownMounts()
+	if err != nil {
+		return "", err
+	}
+	hostDir, ok := hostPathOf(dir, mounts)
+	if !ok {
+		return "", preflightErrorf("%s is not mounted from the host, so the containers could not see their configuration: run the installer image with -v <host directory>:%s", dir, dir)
+	}
+
+	if hostDir != dir {
+		_, err := os.Lstat(hostDir)
+		switch {
+		case errors.Is(err, fs.ErrNotExist):
+			if err := os.MkdirAll(filepath.Dir(hostDir), 0755); err != nil {
+				return "", err
+			}
+			if err := os.Symlink(dir, hostDir); err != nil {
+				return "", fmt.Errorf("failed to link %s to %s: %v", hostDir, dir, err)
+			}
+		case err != nil:
+			return "", err
+		default:
+			if !sameDir(dir, hostDir) {
+				return "", preflightErrorf("%s, the host path of %s, is taken in the installer container: mount the directory at %s instead", hostDir, dir, hostDir)
+			}
+		}
+	}
+	if err := os.Chdir(hostDir); err != nil {
+		return "", fmt.Errorf("error changing to installation directory: %w", err)
+	}
+	// The working directory of Go programs, compose among them, is $PWD
+	// where it leads to the same directory, which keeps the symlink
+	os.Setenv("PWD", hostDir)
+	return hostDir, nil
+}
+
+func sameDir(a, b string) bool {
+	infoA, errA := os.Stat(a)
+	infoB, errB := os.Stat(b)
+	return errA == nil && errB == nil && os.SameFile(infoA, infoB)
+}
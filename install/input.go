@@ -3,19 +3,27 @@ package main
 import (
 	"errors"
 	"fmt"
+	"io"
 	"os"
+	"slices"
 	"strconv"
+	"strings"
 
 	"github.com/charmbracelet/huh"
 	"golang.org/x/term"
+
+	"github.com/fosrl/pangolin/install/pkg/installer"
 )
 
 // pangolinTheme is the custom theme using brand colors
 var pangolinTheme = ThemePangolin()
 
 // isAccessibleMode checks if we should use accessible mode (simple prompts)
-// This is true for: non-TTY, TERM=dumb, or ACCESSIBLE env var set
+// This is true for: non-TTY, TERM=dumb, --plain, or ACCESSIBLE or NO_COLOR env var set
 func isAccessibleMode() bool {
+	if plainMode {
+		return true
+	}
 	// Check if stdin is not a terminal (piped input, CI, etc.)
 	if !term.IsTerminal(int(os.Stdin.Fd())) {
 		return true
@@ -25,7 +33,7 @@ func isAccessibleMode() bool {
 		return true
 	}
 	// Check for explicit accessible mode request
-	if os.Getenv("ACCESSIBLE") != "" {
+	if os.Getenv("ACCESSIBLE") != "" || os.Getenv("NO_COLOR") != "" {
 		return true
 	}
 	return false
@@ -34,47 +42,106 @@ func isAccessibleMode() bool {
 // handleAbort checks if the error is a user abort (Ctrl+C) and exits if so
 func handleAbort(err error) {
 	if err != nil && errors.Is(err, huh.ErrUserAborted) {
-		fmt.Println("\nInstallation cancelled.")
-		os.Exit(0)
+		fmt.Println()
+		cancelRun()
+		os.Exit(exitAborted)
 	}
 }
 
 // runField runs a single field with the Pangolin theme, handling accessible mode
 func runField(field huh.Field) error {
 	if isAccessibleMode() {
-		return field.RunAccessible(os.Stdout, os.Stdin)
+		return field.RunAccessible(os.Stdout, lineReader{os.Stdin})
 	}
 	form := huh.NewForm(huh.NewGroup(field)).WithTheme(pangolinTheme)
 	return form.Run()
 }
 
+// lineReader hands out its input a byte at a time. huh reads an accessible
+// answer through a new bufio.Scanner for every field, which would otherwise
+// swallow the answers to the following questions when they are piped in.
+type lineReader struct{ r io.Reader }
+
+func (l lineReader) Read(p []byte) (int, error) {
+	if len(p) > 1 {
+		p = p[:1]
+	}
+	return l.r.Read(p)
+}
+
 func readString(prompt string, defaultValue string) string {
+	return readValidString(prompt, defaultValue, nil)
+}
+
+// readValidString asks like readString, and while check rejects the answer
+// shows why and asks again, so one typo does not end the install.
+func readValidString(prompt string, defaultValue string, check func(string) error) string {
+	return askString(prompt, defaultValue, false, check)
+}
+
+// clearAnswer is typed at an optional question to leave it empty rather
+// than keep its default.
+const clearAnswer = "-"
+
+// readOptionalString asks for a value that may be left empty. Enter keeps
+// defaultValue, which may be empty, and clearAnswer empties it.
+func readOptionalString(prompt string, defaultValue string, check func(string) error) string {
+	return askString(prompt, defaultValue, true, check)
+}
+
+func askString(prompt string, defaultValue string, optional bool, check func(string) error) string {
+	if nonInteractive {
+		if defaultValue == "" && !optional {
+			unanswerable(prompt)
+		}
+		defaultAnswer(prompt, defaultValue)
+		return defaultValue
+	}
 	var value string
 
 	title := prompt
-	if defaultValue != "" {
-		title = fmt.Sprintf("%s (default: %s)", prompt, defaultValue)
+	switch {
+	case optional && defaultValue != "":
+		title = msg("inputOptionalDefault", prompt, defaultValue, clearAnswer)
+	case defaultValue != "":
+		title = msg("inputDefault", prompt, defaultValue)
 	}
 
 	input := huh.NewInput().
 		Title(title).
 		Value(&value)
 
-	// If no default value, this field is required
-	if defaultValue == "" {
-		input = input.Validate(func(s string) error {
-			if s == "" {
-				return fmt.Errorf("this field is required")
-			}
+	// Without a default a field is required unless it is optional; huh asks
+	// again with the reason while the validation fails
+	validate := func(s string) error {
+		s = strings.TrimSpace(s)
+		switch {
+		case s == "" && defaultValue == "" && !optional:
+			return errors.New(msg("inputRequired"))
+		case s == "" || check == nil:
 			return nil
-		})
+		case optional && s == clearAnswer:
+			return nil
+		}
+		return check(s)
 	}
+	input = input.Validate(validate)
 
 	err := runField(input)
 	handleAbort(err)
 
-	if value == "" {
+	// Read from a pipe, huh gives up asking when the input ends and returns
+	// whatever it has
+	if err := validate(value); err != nil {
+		fmt.Println(msg("errorInputEnded", prompt, err))
+		os.Exit(exitUsage)
+	}
+	value = strings.TrimSpace(value)
+	switch {
+	case value == "":
 		value = defaultValue
+	case optional && value == clearAnswer:
+		value = ""
 	}
 
 	// Print the answer so it remains visible in terminal history (skip in accessible mode as it already shows)
@@ -85,86 +152,178 @@ func readString(prompt string, defaultValue string) string {
 	return value
 }
 
-func readPassword(prompt string) string {
-	var value string
+// readDomain asks for a domain name such as example.com and asks again
+// while the answer is not one, e.g. a pasted URL.
+func readDomain(prompt string, defaultValue string) string {
+	return strings.ToLower(readValidString(prompt, defaultValue, localizedCheck(installer.CheckDomain)))
+}
 
-	for {
-		input := huh.NewInput().
-			Title(prompt).
-			Value(&value).
-			EchoMode(huh.EchoModePassword).
-			Validate(func(s string) error {
-				if s == "" {
-					return fmt.Errorf("password is required")
-				}
-				return nil
-			})
+// readEmail asks for an email address and asks again while the answer is
+// not one.
+func readEmail(prompt string, defaultValue string) string {
+	return readValidString(prompt, defaultValue, localizedCheck(installer.CheckEmail))
+}
 
-		err := runField(input)
-		handleAbort(err)
+// hiddenSecret stands in for a secret wherever an answer is shown.
+const hiddenSecret = "********"
+
+// readPassword asks for a secret without echoing it, so it stays out of the
+// scrollback and of screen recordings. Enter keeps defaultValue; without one
+// a value is required.
+func readPassword(prompt string, defaultValue string) string {
+	if nonInteractive {
+		if defaultValue == "" {
+			unanswerable(prompt)
+		}
+		defaultAnswer(prompt, hiddenSecret)
+		return defaultValue
+	}
 
+	title := prompt
+	if defaultValue != "" {
+		title = msg("inputDefault", prompt, hiddenSecret)
+	}
+	for {
+		var value string
+		if isAccessibleMode() {
+			// huh reads accessible passwords from the terminal only
+			line, err := readSecretLine(os.Stdin, title)
+			if err != nil {
+				exitWithError(fmt.Errorf("failed to read %q: %w", prompt, err))
+			}
+			value = line
+		} else {
+			input := huh.NewInput().
+				Title(title).
+				Value(&value).
+				EchoMode(huh.EchoModePassword)
+			err := runField(input)
+			handleAbort(err)
+		}
+
+		if value == "" {
+			value = defaultValue
+		}
 		if value != "" {
 			// Print confirmation without revealing the password
 			if !isAccessibleMode() {
-				fmt.Printf("%s: %s\n", prompt, "********")
+				fmt.Printf("%s: %s\n", prompt, hiddenSecret)
 			}
 			return value
 		}
+		fmt.Println(msg("inputPasswordRequired"))
+	}
+}
+
+// readSecretLine prints prompt and reads a line from in. A terminal does not
+// echo it; piped input is read a byte at a time, so the answers to the
+// questions after this one are left for them.
+func readSecretLine(in *os.File, prompt string) (string, error) {
+	fmt.Print(prompt + " ")
+	defer fmt.Println()
+	if term.IsTerminal(int(in.Fd())) {
+		value, err := term.ReadPassword(int(in.Fd()))
+		return string(value), err
+	}
+
+	var line []byte
+	b := make([]byte, 1)
+	for {
+		n, err := in.Read(b)
+		if n > 0 && b[0] == '\n' {
+			break
+		}
+		line = append(line, b[:n]...)
+		if err == io.EOF && len(line) > 0 {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
 	}
+	return strings.TrimSuffix(string(line), "\r"), nil
 }
 
 func readBool(prompt string, defaultValue bool) bool {
+	if nonInteractive {
+		defaultAnswer(prompt, boolAnswer(defaultValue))
+		return defaultValue
+	}
 	var value = defaultValue
 
 	confirm := huh.NewConfirm().
 		Title(prompt).
 		Value(&value).
-		Affirmative("Yes").
-		Negative("No")
+		Affirmative(msg("answerYes")).
+		Negative(msg("answerNo"))
 
 	err := runField(confirm)
 	handleAbort(err)
 
 	// Print the answer so it remains visible in terminal history
 	if !isAccessibleMode() {
-		answer := "No"
-		if value {
-			answer = "Yes"
-		}
-		fmt.Printf("%s: %s\n", prompt, answer)
+		fmt.Printf("%s: %s\n", prompt, boolAnswer(value))
 	}
 
 	return value
 }
 
+// boolAnswer returns the label of a yes/no answer.
+func boolAnswer(value bool) string {
+	if value {
+		return msg("answerYes")
+	}
+	return msg("answerNo")
+}
+
 func readBoolNoDefault(prompt string) bool {
+	if nonInteractive {
+		unanswerable(prompt)
+	}
 	var value bool
 
 	confirm := huh.NewConfirm().
 		Title(prompt).
 		Value(&value).
-		Affirmative("Yes").
-		Negative("No")
+		Affirmative(msg("answerYes")).
+		Negative(msg("answerNo"))
 
 	err := runField(confirm)
 	handleAbort(err)
 
 	// Print the answer so it remains visible in terminal history
 	if !isAccessibleMode() {
-		answer := "No"
-		if value {
-			answer = "Yes"
-		}
-		fmt.Printf("%s: %s\n", prompt, answer)
+		fmt.Printf("%s: %s\n", prompt, boolAnswer(value))
 	}
 
 	return value
 }
 
 func readInt(prompt string, defaultValue int) int {
+	return readValidInt(prompt, defaultValue, nil)
+}
+
+// readPort asks for a TCP or UDP port and asks again while the answer is
+// outside 1-65535.
+func readPort(prompt string, defaultValue int) int {
+	return readValidInt(prompt, defaultValue, func(port int) error {
+		if port < 1 || port > 65535 {
+			return errors.New(msg("inputInvalidPort"))
+		}
+		return nil
+	})
+}
+
+// readValidInt asks like readInt, and while check rejects the number shows
+// why and asks again.
+func readValidInt(prompt string, defaultValue int, check func(int) error) int {
+	if nonInteractive {
+		defaultAnswer(prompt, strconv.Itoa(defaultValue))
+		return defaultValue
+	}
 	var value string
 
-	title := fmt.Sprintf("%s (default: %d)", prompt, defaultValue)
+	title := msg("inputDefault", prompt, strconv.Itoa(defaultValue))
 
 	input := huh.NewInput().
 		Title(title).
@@ -173,9 +332,12 @@ func readInt(prompt string, defaultValue int) int {
 			if s == "" {
 				return nil
 			}
-			_, err := strconv.Atoi(s)
+			n, err := strconv.Atoi(s)
 			if err != nil {
-				return fmt.Errorf("please enter a valid number")
+				return errors.New(msg("inputInvalidNumber"))
+			}
+			if check != nil {
+				return check(n)
 			}
 			return nil
 		})
@@ -206,3 +368,67 @@ func readInt(prompt string, defaultValue int) int {
 
 	return result
 }
+
+// readCountries asks for one or more countries, preselecting those given.
+// Terminals get a list that filters as you type; accessible mode asks for
+// ISO codes separated by commas instead.
+func readCountries(prompt string, selected []string) []string {
+	if nonInteractive {
+		if len(selected) == 0 {
+			unanswerable(prompt)
+		}
+		defaultAnswer(prompt, strings.Join(selected, ","))
+		return selected
+	}
+	var value []string
+
+	if isAccessibleMode() {
+		var text string
+		input := huh.NewInput().
+			Title(msg("inputCountryCodes", prompt)).
+			Value(&text).
+			Validate(func(s string) error {
+				codes, err := installer.ParseCountryCodes(s)
+				if err != nil {
+					return err
+				}
+				if len(codes) == 0 {
+					return errors.New(msg("inputCountryRequired"))
+				}
+				return nil
+			})
+
+		err := runField(input)
+		handleAbort(err)
+
+		value, _ = installer.ParseCountryCodes(text)
+		return value
+	}
+
+	options := make([]huh.Option[string], len(installer.Countries))
+	for i, c := range installer.Countries {
+		options[i] = huh.NewOption(fmt.Sprintf("%s (%s)", c.Name, c.Code), c.Code).
+			Selected(slices.Contains(selected, c.Code))
+	}
+	multiSelect := huh.NewMultiSelect[string]().
+		Title(prompt).
+		Description(msg("inputCountryFilter")).
+		Options(options...).
+		Filterable(true).
+		Height(12).
+		Value(&value).
+		Validate(func(codes []string) error {
+			if len(codes) == 0 {
+				return errors.New(msg("inputCountryRequired"))
+			}
+			return nil
+		})
+
+	err := runField(multiSelect)
+	handleAbort(err)
+
+	// Print the answer so it remains visible in terminal history
+	fmt.Printf("%s: %s\n", prompt, strings.Join(value, ", "))
+
+	return value
+}
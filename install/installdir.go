@@ -0,0 +1,162 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/fosrl/pangolin/install/pkg/installer"
+)
+
+const defaultInstallDir = "/opt/pangolin"
+
+// systemInstallDirRecord is where the installation directory is recorded
+// when the installer runs as root.
+const systemInstallDirRecord = "/etc/pangolin-installer/install-dir"
+
+// installDirRecordPaths returns the files the installation directory may be
+// recorded in, most specific first.
+func installDirRecordPaths() []string {
+	var paths []string
+	if os.Geteuid() != 0 {
+		if dir, err := os.UserConfigDir(); err == nil {
+			paths = append(paths, filepath.Join(dir, "pangolin-installer", "install-dir"))
+		}
+	}
+	return append(paths, systemInstallDirRecord)
+}
+
+// recordInstallDir remembers the installation directory so later commands
+// find it regardless of the directory they are invoked from.
+func recordInstallDir(dir string) {
+	for _, record := range installDirRecordPaths() {
+		if err := hostOps.MkdirAll(filepath.Dir(record), 0755); err != nil {
+			continue
+		}
+		if err := hostOps.WriteFile(record, []byte(dir+"\n"), 0644); err == nil {
+			return
+		}
+	}
+	fmt.Printf("Warning: could not record the installation directory; pass --dir %s to later commands.\n", dir)
+}
+
+// recordedInstallDir returns the previously recorded installation directory
+// if it still contains an installation.
+func recordedInstallDir() string {
+	for _, record := range installDirRecordPaths() {
+		data, err := os.ReadFile(record)
+		if err != nil {
+			continue
+		}
+		dir := strings.TrimSpace(string(data))
+		if dir != "" && hasExistingInstall(dir) {
+			return dir
+		}
+	}
+	return ""
+}
+
+// labeledInstallDirs returns the directories of installs found through the
+// compose labels of their pangolin containers, running or stopped, so an
+// install is found even if its directory was never recorded.
+func labeledInstallDirs() []string {
+	var dirs []string
+	for _, runtime := range []string{"docker", "podman"} {
+		if _, err := exec.LookPath(runtime); err != nil {
+			continue
+		}
+		ids, err := exec.Command(runtime, "ps", "-aq", "--filter", "label=com.docker.compose.service=pangolin").Output()
+		if err != nil {
+			continue
+		}
+		for _, id := range strings.Fields(string(ids)) {
+			out, err := exec.Command(runtime, "inspect", "--format",
+				`{{index .Config.Labels "com.docker.compose.project.working_dir"}}`, id).Output()
+			if err != nil {
+				continue
+			}
+			dir := strings.TrimSpace(string(out))
+			if dir != "" && hasExistingInstall(dir) && !slices.Contains(dirs, dir) {
+				dirs = append(dirs, dir)
+			}
+		}
+	}
+	slices.Sort(dirs)
+	return dirs
+}
+
+// knownInstallDirs returns the existing installs outside the current
+// directory: the recorded one, those found through container labels and the
+// default location, in that order.
+func knownInstallDirs() []string {
+	cwd, _ := os.Getwd()
+	var dirs []string
+	add := func(dir string) {
+		if dir != "" && dir != cwd && !slices.Contains(dirs, dir) && hasExistingInstall(dir) {
+			dirs = append(dirs, dir)
+		}
+	}
+	add(recordedInstallDir())
+	for _, dir := range labeledInstallDirs() {
+		add(dir)
+	}
+	add(defaultInstallDir)
+	return dirs
+}
+
+// expandPath expands a leading ~ and makes the path absolute.
+func expandPath(path string) (string, error) {
+	if strings.HasPrefix(path, "~") {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", fmt.Errorf("error getting home directory: %w", err)
+		}
+		path = filepath.Join(home, path[1:])
+	}
+	return filepath.Abs(path)
+}
+
+// resolveInstallDir finds the installation a command should operate on: the
+// explicit --dir value, the current directory, the recorded directory or the
+// default location, in that order.
+func resolveInstallDir(dir string) (string, error) {
+	if dir != "" {
+		absDir, err := expandPath(dir)
+		if err != nil {
+			return "", err
+		}
+		if !hasExistingInstall(absDir) {
+			return "", preflightErrorf("no Pangolin installation found in %s", absDir)
+		}
+		return absDir, nil
+	}
+
+	if cwd, err := os.Getwd(); err == nil && hasExistingInstall(cwd) {
+		return cwd, nil
+	}
+
+	if dirs := knownInstallDirs(); len(dirs) > 0 {
+		return dirs[0], nil
+	}
+
+	return "", preflightErrorf("no Pangolin installation found; run the installer from the installation directory or pass --dir")
+}
+
+// enterInstallDir resolves the installation directory and changes into it.
+func enterInstallDir(dir string) error {
+	installDir, err := resolveInstallDir(dir)
+	if err != nil {
+		return err
+	}
+	if installer.InInstallerContainer() {
+		_, err := enterHostPath(installDir)
+		return err
+	}
+	if err := os.Chdir(installDir); err != nil {
+		return fmt.Errorf("error changing to installation directory: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// The installer records the answers it installed with in the installation
+// directory, so later runs read them back instead of deriving them from the
+// generated Traefik and Pangolin configs. The secrets among them are kept in
+// a separate file only the owner can read, which leaves the state file safe
+// to share when asking for help.
+const (
+	installStateFile   = "pangolin-install.yaml"
+	installSecretsFile = "pangolin-secrets.yaml"
+)
+
+// secretAnswers are the answer keys written to the secrets file instead of
+// the state file.
+var secretAnswers = []string{"secret", "smtp_pass", "postgresql_pass", "redis_pass", "traefik_bouncer_key"}
+
+// installRecord is the contents of the state file.
+type installRecord struct {
+	InstallerVersion string         `yaml:"installer_version"`
+	Updated          time.Time      `yaml:"updated"`
+	Answers          map[string]any `yaml:"answers"`
+}
+
+// saveInstallState writes config to the state and secrets files of the
+// installation in the current directory.
+func saveInstallState(config Config) error {
+	answers, err := answersMap(config)
+	if err != nil {
+		return err
+	}
+	secrets := map[string]any{}
+	for _, key := range secretAnswers {
+		if value, ok := answers[key]; ok && value != "" {
+			secrets[key] = value
+		}
+		delete(answers, key)
+	}
+
+	record := installRecord{
+		InstallerVersion: orUnknown(installerVersion, "dev"),
+		Updated:          time.Now().UTC().Truncate(time.Second),
+		Answers:          answers,
+	}
+	if err := writeYAML(installSecretsFile, secrets, 0600); err != nil {
+		return err
+	}
+	return writeYAML(installStateFile, record, 0644)
+}
+
+// loadInstallState reads the answers recorded in the installation in the
+// current directory, with their secrets. ok is false for installations made
+// before the state file existed.
+func loadInstallState() (config Config, ok bool, err error) {
+	data, err := os.ReadFile(installStateFile)
+	if os.IsNotExist(err) {
+		return Config{}, false, nil
+	} else if err != nil {
+		return Config{}, false, err
+	}
+	var record installRecord
+	if err := yaml.Unmarshal(data, &record); err != nil {
+		return Config{}, false, fmt.Errorf("error parsing %s: %v", installStateFile, err)
+	}
+	if record.Answers == nil {
+		record.Answers = map[string]any{}
+	}
+
+	if data, err := os.ReadFile(installSecretsFile); err == nil {
+		secrets := map[string]any{}
+		if err := yaml.Unmarshal(data, &secrets); err != nil {
+			return Config{}, false, fmt.Errorf("error parsing %s: %v", installSecretsFile, err)
+		}
+		for _, key := range secretAnswers {
+			if value, ok := secrets[key]; ok {
+				record.Answers[key] = value
+			}
+		}
+	} else if !os.IsNotExist(err) {
+		return Config{}, false, err
+	}
+
+	data, err = yaml.Marshal(record.Answers)
+	if err != nil {
+		return Config{}, false, err
+	}
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return Config{}, false, fmt.Errorf("error parsing %s: %v", installStateFile, err)
+	}
+	return config, true, nil
+}
+
+// updateInstallState applies update to the recorded answers. Installations
+// without a state file are left alone.
+func updateInstallState(update func(config *Config)) error {
+	config, ok, err := loadInstallState()
+	if err != nil || !ok {
+		return err
+	}
+	update(&config)
+	return saveInstallState(config)
+}
+
+// answersMap returns config as a map keyed by answer keys.
+func answersMap(config Config) (map[string]any, error) {
+	data, err := yaml.Marshal(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode the answers: %v", err)
+	}
+	answers := map[string]any{}
+	if err := yaml.Unmarshal(data, &answers); err != nil {
+		return nil, err
+	}
+	return answers, nil
+}
+
+func writeYAML(path string, value any, mode os.FileMode) error {
+	data, err := yaml.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("failed to encode %s: %v", path, err)
+	}
+	if err := os.WriteFile(path, data, mode); err != nil {
+		return fmt.Errorf("failed to write %s: %v", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/fosrl/pangolin/install/pkg/installer"
+)
+
+// publicIPv4 and publicIPv6 detect the addresses of the server; tests
+// replace them to stay off the network.
+var publicIPv4, publicIPv6 = installer.PublicIPv4, installer.PublicIPv6
+
+// collectIPv6Only detects a server without a public IPv4 address and, once
+// the user confirms, sets the installation up to be reached over IPv6
+// alone.
+func collectIPv6Only(config *Config) {
+	if _, err := publicIPv4(); err == nil {
+		return
+	}
+	ip, err := publicIPv6()
+	if err != nil {
+		// Without any connectivity there is nothing to tell from it
+		return
+	}
+	fmt.Println(msg("ipv6OnlyDetected", ip))
+	fmt.Println(msg("ipv6OnlyReachability"))
+	if readBool(msg("promptIPv6Only"), true) {
+		config.IPv6Only, config.EnableIPv6 = true, true
+	}
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"text/template"
+)
+
+// keepalivedConfig moves the virtual IP to the backup node when the
+// dashboard of the primary stops answering. The peers talk unicast, which
+// works on providers that drop multicast.
+var keepalivedConfig = template.Must(template.New("keepalived.conf").Parse(`# Generated by the Pangolin installer for node {{.Node.Name}} of {{.Config.DashboardDomain}}.
+global_defs {
+    router_id pangolin_{{.Node.Name}}
+    enable_script_security
+    script_user root
+}
+
+vrrp_script check_pangolin {
+    script "/etc/keepalived/check-pangolin.sh"
+    interval 5
+    timeout 10
+    fall 3
+    rise 2
+}
+
+vrrp_instance pangolin {
+    state {{if .Primary}}MASTER{{else}}BACKUP{{end}}
+    interface {{.Interface}}
+    virtual_router_id {{.RouterID}}
+    priority {{if .Primary}}150{{else}}100{{end}}
+    advert_int 1
+    unicast_src_ip {{.Node.Address}}
+    unicast_peer {
+        {{.Peer.Address}}
+    }
+    virtual_ipaddress {
+        {{.VIP}}
+    }
+    track_script {
+        check_pangolin
+    }
+}
+`))
+
+// keepalivedCheck is the health check of the node: the dashboard has to
+// answer through Traefik, which also proves Pangolin and Gerbil are up.
+var keepalivedCheck = template.Must(template.New("check-pangolin.sh").Parse(`#!/bin/sh
+# Generated by the Pangolin installer. Fails when the dashboard of this node
+# does not answer, which moves the virtual IP to the other node.
+exec curl -fsk --max-time 5 \
+    --resolve {{.Config.DashboardDomain}}:{{.Config.HTTPSPort}}:127.0.0.1 \
+    -o /dev/null https://{{.Config.DashboardDomain}}:{{.Config.HTTPSPort}}/api/v1/
+`))
+
+// runGenerateKeepalived writes the keepalived configuration and health
+// check of a two-node active/passive installation.
+func runGenerateKeepalived(args []string) error {
+	flags := flag.NewFlagSet("generate keepalived", flag.ExitOnError)
+	answersPath := flags.String("answers", "", "Path to the YAML answers file (required)")
+	nodesFlag := flags.String("nodes", "", "The primary and the backup node as name=address pairs, separated by a comma")
+	vip := flags.String("vip", "", "Virtual IP address that moves between the nodes (required)")
+	iface := flags.String("interface", "eth0", "Network interface of the nodes that carries the virtual IP")
+	routerID := flags.Int("router-id", 51, "VRRP router ID, unique within the network (1-255)")
+	out := flags.String("out", "keepalived", "Directory to write the node files to")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	nodes, err := parseHANodes(*nodesFlag)
+	if err != nil {
+		return usageErrorf("%v", err)
+	}
+	if len(nodes) != 2 {
+		return usageErrorf("--nodes needs exactly two nodes: the primary and the backup")
+	}
+	if net.ParseIP(*vip) == nil {
+		return usageErrorf("--vip must be an IP address")
+	}
+	if *routerID < 1 || *routerID > 255 {
+		return usageErrorf("--router-id must be between 1 and 255")
+	}
+	config, err := loadProvisioningAnswers(*answersPath)
+	if err != nil {
+		return err
+	}
+
+	for i, node := range nodes {
+		data := map[string]any{
+			"Config":    config,
+			"Node":      node,
+			"Peer":      nodes[1-i],
+			"Primary":   i == 0,
+			"VIP":       *vip,
+			"Interface": *iface,
+			"RouterID":  *routerID,
+		}
+		nodeDir := filepath.Join(*out, node.Name)
+		if err := os.MkdirAll(nodeDir, 0755); err != nil {
+			return err
+		}
+		files := []struct {
+			tmpl *template.Template
+			mode os.FileMode
+		}{
+			{keepalivedConfig, 0644},
+			{keepalivedCheck, 0755},
+		}
+		for _, f := range files {
+			var content bytes.Buffer
+			if err := f.tmpl.Execute(&content, data); err != nil {
+				return err
+			}
+			path := filepath.Join(nodeDir, f.tmpl.Name())
+			if err := os.WriteFile(path, content.Bytes(), f.mode); err != nil {
+				return fmt.Errorf("failed to write %s: %v", path, err)
+			}
+			fmt.Printf("Wrote %s\n", path)
+		}
+	}
+
+	fmt.Printf("\nPoint %s and *.%s at %s and install both nodes with the same answers.\n", config.DashboardDomain, config.BaseDomain, *vip)
+	fmt.Println("Then, on each node:")
+	fmt.Println("  apt-get install -y keepalived")
+	fmt.Printf("  cp %s/<node>/keepalived.conf %s/<node>/check-pangolin.sh /etc/keepalived/\n", *out, *out)
+	fmt.Println("  systemctl enable --now keepalived")
+	fmt.Printf("%s holds the virtual IP while its dashboard answers; %s takes over after three failed checks.\n", nodes[0].Name, nodes[1].Name)
+	if !config.IsPostgreSQL || config.PostgreSQLHost == "" {
+		fmt.Println("The nodes do not share a database: the backup serves its own, so keep it in sync or use generate ha with an external PostgreSQL.")
+	}
+	return nil
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/fosrl/pangolin/install/pkg/installer"
+)
+
+// collectLogDriver asks whether the containers log to journald or syslog, so
+// the host's log tooling sees the stack like any other service.
+func collectLogDriver(config *Config) {
+	if !readBool(msg("promptLogDriver"), false) {
+		return
+	}
+	fmt.Println("journald: " + msg("logDriverJournaldDescription"))
+	fmt.Println("syslog:   " + msg("logDriverSyslogDescription"))
+	for {
+		driver := strings.ToLower(readString(msg("promptLogDriverName"), installer.LogDriverJournald))
+		if driver == installer.LogDriverJournald || driver == installer.LogDriverSyslog {
+			config.LogDriver = driver
+			return
+		}
+		fmt.Println(msg("logDriverUnknown", driver))
+	}
+}
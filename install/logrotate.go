@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+
+	"github.com/fosrl/pangolin/install/pkg/installer"
+)
+
+const logrotateConfigPath = "/etc/logrotate.d/pangolin"
+
+// legacyLogrotateConfigPath only covered the access log, for CrowdSec.
+const legacyLogrotateConfigPath = "/etc/logrotate.d/pangolin-traefik"
+
+func init() {
+	registerStep(installStep{
+		Name:  "log rotation",
+		Order: 82,
+		When: func(state *installState) bool {
+			return freshInstall(state) && runtime.GOOS == "linux" && !devMode && !installer.InInstallerContainer()
+		},
+		Run: func(state *installState) error {
+			installLogrotateConfig(state.InstallDir)
+			return nil
+		},
+	})
+}
+
+// renderLogrotateConfig returns a logrotate configuration for the log files
+// Pangolin and Traefik write into the installation directory. Neither
+// reopens its files on a signal, so they are truncated in place.
+func renderLogrotateConfig(installDir string) string {
+	return fmt.Sprintf(`# Generated by the Pangolin installer.
+%s %s {
+	daily
+	rotate 7
+	maxsize 100M
+	missingok
+	notifempty
+	compress
+	delaycompress
+	copytruncate
+}
+`, filepath.Join(installDir, "config", "logs", "*.log"), filepath.Join(installDir, "config", "traefik", "logs", "*.log"))
+}
+
+// installLogrotateConfig writes the logrotate configuration when logrotate
+// is set up on the host. The access log otherwise grows until the disk is
+// full, a month or so into a busy installation.
+func installLogrotateConfig(installDir string) {
+	if _, err := os.Stat(filepath.Dir(logrotateConfigPath)); err != nil {
+		fmt.Println(msg("logrotateMissing", filepath.Join(installDir, "config", "traefik", "logs")))
+		return
+	}
+	if !canBecomeRoot() {
+		fmt.Println(msg("logrotateNeedsRoot", logrotateConfigPath))
+		fmt.Print(renderLogrotateConfig(installDir))
+		return
+	}
+	if err := writeFileAsRoot(logrotateConfigPath, []byte(renderLogrotateConfig(installDir)), 0644); err != nil {
+		fmt.Printf("Error writing %s: %v\n", logrotateConfigPath, err)
+		return
+	}
+	// logrotate rejects a file listed in two configs
+	if _, err := os.Stat(legacyLogrotateConfigPath); err == nil {
+		hostOps.Run(rootCommand("rm", "-f", legacyLogrotateConfigPath))
+	}
+	fmt.Println(msg("logrotateInstalled", logrotateConfigPath))
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+
+	"github.com/fosrl/pangolin/install/pkg/installer"
+)
+
+const (
+	swapfilePath = "/swapfile"
+	swapfileSize = "2G"
+)
+
+func init() {
+	registerStep(installStep{
+		Name:  "memory check",
+		Order: 17,
+		When: func(state *installState) bool {
+			return freshInstall(state) && runtime.GOOS == "linux" && !devMode && !installer.InInstallerContainer()
+		},
+		Run: func(state *installState) error {
+			checkMemory(&state.Config)
+			return nil
+		},
+	})
+}
+
+// checkMemory switches to the low-memory settings on small servers and
+// offers a swapfile when there is no swap. Without either, the kernel kills
+// PostgreSQL or CrowdSec under load, and the install that worked breaks a
+// few days later.
+func checkMemory(config *Config) {
+	memory, swap, err := installer.ReadMemInfo()
+	if err != nil || memory >= installer.LowMemoryThreshold {
+		return
+	}
+
+	fmt.Println("\n=== " + msg("sectionMemory") + " ===")
+	fmt.Println(msg("lowMemoryDetected", memory>>20))
+	config.LowMemory = true
+	fmt.Println(msg("lowMemorySettings"))
+
+	if swap > 0 {
+		return
+	}
+	fmt.Println(msg("noSwapDetected"))
+	if !confirmHostChange(msg("promptCreateSwapfile", swapfileSize, swapfilePath), true) {
+		return
+	}
+	if !canBecomeRoot() {
+		fmt.Println(msg("swapfileNeedsRoot"))
+		return
+	}
+	if err := createSwapfile(); err != nil {
+		fmt.Printf("Error creating the swapfile: %v\n", err)
+		return
+	}
+	fmt.Println(msg("swapfileCreated", swapfilePath))
+}
+
+// createSwapfile creates, enables and persists the swapfile. fallocate is
+// not supported on every filesystem, so dd is the fallback.
+func createSwapfile() error {
+	script := fmt.Sprintf(`set -e
+fallocate -l %[2]s %[1]s 2>/dev/null || dd if=/dev/zero of=%[1]s bs=1M count=%[3]d status=none
+chmod 600 %[1]s
+mkswap %[1]s >/dev/null
+swapon %[1]s
+grep -q '^%[1]s ' /etc/fstab || echo '%[1]s none swap sw 0 0' >> /etc/fstab`, swapfilePath, swapfileSize, 2048)
+	if tool := privilegeTool(); tool != "" {
+		fmt.Printf("Creating the swapfile as root through %s...\n", tool)
+	}
+	if out, err := hostOps.CombinedOutput(rootCommand("sh", "-c", script)); err != nil {
+		return fmt.Errorf("%v: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
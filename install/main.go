@@ -1,23 +1,24 @@
 package main
 
 import (
+	"cmp"
 	"crypto/rand"
-	"embed"
 	"encoding/base64"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
-	"io/fs"
-	"net"
-	"net/url"
 	"os"
 	"os/exec"
 	"path/filepath"
-	"runtime"
+	"slices"
 	"strconv"
 	"strings"
-	"text/template"
 	"time"
+
+	"golang.org/x/term"
+
+	"github.com/fosrl/pangolin/install/pkg/installer"
 )
 
 // Version variables injected at build time via -ldflags
@@ -25,283 +26,265 @@ var (
 	pangolinVersion string
 	gerbilVersion   string
 	badgerVersion   string
+
+	installerVersion string
+	buildCommit      string
+	buildDate        string
 )
 
 func loadVersions(config *Config) {
-	config.PangolinVersion = pangolinVersion
-	config.GerbilVersion = gerbilVersion
-	config.BadgerVersion = badgerVersion
-}
-
-//go:embed config/*
-var configFiles embed.FS
-
-type Config struct {
-	InstallationContainerType SupportedContainer
-	PangolinVersion           string
-	GerbilVersion             string
-	BadgerVersion             string
-	BaseDomain                string
-	DashboardDomain           string
-	EnableIPv6                bool
-	LetsEncryptEmail          string
-	EnableEmail               bool
-	EmailSMTPHost             string
-	EmailSMTPPort             int
-	EmailSMTPUser             string
-	EmailSMTPPass             string
-	EmailNoReply              string
-	InstallGerbil             bool
-	TraefikBouncerKey         string
-	DoCrowdsecInstall         bool
-	EnableMaxMind             bool
-	Secret                    string
-	IsEnterprise              bool
-    IsPostgreSQL              bool
-	IsPostgreSQLPass          string
-    IsRedis                   bool
-	IsRedisPass               string
+	componentVersions().Apply(config)
 }
 
-type SupportedContainer string
+// The answers and the runtimes are defined by the library the installer is
+// built on.
+type (
+	Config             = installer.Config
+	SupportedContainer = installer.SupportedContainer
+)
 
 const (
-	Docker    SupportedContainer = "docker"
-	Podman    SupportedContainer = "podman"
-	Undefined SupportedContainer = "undefined"
+	Docker    = installer.Docker
+	Podman    = installer.Podman
+	Undefined = installer.Undefined
 )
 
-func main() {
-
-	crowdsecFlag := flag.Bool("crowdsec", false, "Enable the CrowdSec installation prompt")
-	flag.Parse()
-
-	// print a banner about prerequisites - opening port 80, 443, 51820, and 21820 on the VPS and firewall and pointing your domain to the VPS IP with a records. Docs are at http://localhost:3000/Getting%20Started/dns-networking
-
-	fmt.Println("Welcome to the Pangolin installer!")
-	fmt.Println("This installer will help you set up Pangolin on your server.")
-	fmt.Println("\nPlease make sure you have the following prerequisites:")
-	fmt.Println("- Open TCP ports 80 and 443 and UDP ports 51820 and 21820 on your VPS and firewall.")
-	fmt.Println("\nLets get started!")
-
-	if os.Geteuid() == 0 { // WE NEED TO BE SUDO TO CHECK THIS
-		for _, p := range []int{80, 443} {
-			if err := checkPortsAvailable(p); err != nil {
-				fmt.Fprintln(os.Stderr, err)
+// commands maps subcommand names to their entry points. Running the
+// installer without a subcommand starts the interactive install.
+var commands = map[string]func(args []string) error{
+	"api":             runAPI,
+	"apply":           runApply,
+	"apply-resources": runApplyResources,
+	"check":           runCheck,
+	"bootstrap":       runBootstrap,
+	"cert-status":     runCertStatus,
+	"disk-usage":      runDiskUsage,
+	"exit-node":       runExitNode,
+	"generate":        runGenerate,
+	"import":          runImport,
+	"maintenance":     runMaintenance,
+	"repair":          runRepair,
+	"migrate":         runMigrate,
+	"preflight":       runPreflight,
+	"profiles":        runProfiles,
+	"render":          runRender,
+	"rollback":        runRollback,
+	"update-geoip":    runUpdateGeoIP,
+	"upgrade":         runUpgrade,
+	"validate":        runValidate,
+	"verify-tunnel":   runVerifyTunnel,
+	"watchdog":        runWatchdog,
+}
 
-				fmt.Printf("Please close any services on ports 80/443 in order to run the installation smoothly. If you already have the Pangolin stack running, shut them down before proceeding.\n")
-				os.Exit(1)
+func main() {
+	handleInterrupts()
+	checkForInstallerUpdate(os.Args[1:])
+
+	if len(os.Args) > 1 {
+		if cmd, ok := commands[os.Args[1]]; ok {
+			setSubcommand(os.Args[1])
+			if err := cmd(os.Args[2:]); err != nil {
+				exitWithError(err)
 			}
+			return
 		}
 	}
 
-	var config Config
-	var alreadyInstalled = false
-
-	// Determine installation directory
-	installDir := findOrSelectInstallDirectory()
-	if err := os.Chdir(installDir); err != nil {
-		fmt.Printf("Error changing to installation directory: %v\n", err)
-		os.Exit(1)
+	crowdsecFlag := flag.Bool("crowdsec", false, "Enable the CrowdSec installation prompt")
+	flag.StringVar(&templatesDir, "templates-dir", "", "Directory of templates that override the embedded config files")
+	provisionFlag := flag.String("provision", "", "Provisioning file with the admin account, organizations, roles and invites to set up once the stack is healthy")
+	dirFlag := flag.String("dir", "", "Installation directory (default: detect or prompt, "+defaultInstallDir+" suggested)")
+	flag.DurationVar(&waitTimeout, "wait-timeout", waitTimeout, "How long to wait for Docker and the containers to become ready")
+	flag.DurationVar(&setupTokenTimeout, "setup-token-timeout", setupTokenTimeout, "How long to wait for Pangolin to print the setup token, which includes its first database migration")
+	flag.BoolVar(&rootlessMode, "rootless", false, "Install without root using rootless Podman or Docker and unprivileged ports")
+	devModeFlag(flag.CommandLine)
+	flag.StringVar(&simulatePath, "simulate", "", "Record the host changes of the install to a reviewable plan file, a shell script or JSON when it ends in .json, instead of making them")
+	flag.BoolVar(&sandboxMode, "sandbox", false, "Bring up the full stack on localhost with example resources, without any questions (default directory "+sandboxInstallDir+")")
+	telemetryFlag(flag.CommandLine)
+	plainFlag(flag.CommandLine)
+	flag.StringVar(&qrMode, "qr", qrMode, "QR code for the initial setup page: url, token (embeds the setup token in the link) or off")
+	langFlag := flag.String("lang", "", "Language of the prompts, e.g. de-DE (default: from LC_ALL, LC_MESSAGES or LANG)")
+	versionFlag := flag.Bool("version", false, "Print the installer version and the component versions it installs")
+	flag.BoolVar(&nonInteractive, "non-interactive", false, "Install without asking: the answers come from --answers and the answer flags, the remaining questions take their default and changes to the host outside the installation directory are declined")
+	answersFlag := flag.String("answers", "", "YAML answers file for --non-interactive, with the keys the render subcommand reads")
+	flag.BoolVar(&startContainersAnswer, "start-containers", false, "With --non-interactive, start the containers once the configuration is generated")
+	flag.BoolVar(&installCrowdsecAnswer, "install-crowdsec", false, "With --non-interactive, add CrowdSec to the installation")
+	// Registered last so they leave the names of the flags above alone
+	givenAnswers := answerFlags(flag.CommandLine)
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] | %s <%s> [flags]\n", os.Args[0], os.Args[0], strings.Join(sortedKeys(commands), "|"))
+		flag.PrintDefaults()
+		fmt.Fprint(flag.CommandLine.Output(), exitCodeHelp)
 	}
+	flag.Parse()
 
-	// check if there is already a config file
-	if _, err := os.Stat("config/config.yml"); err != nil {
-		config = collectUserInput()
+	if *versionFlag {
+		printVersion()
+		return
+	}
 
-		loadVersions(&config)
-		config.DoCrowdsecInstall = false
-		config.Secret = generateRandomSecretKey()
+	enablePlainOutput()
 
-		fmt.Println("\n=== Generating Configuration Files ===")
+	if qrMode != qrURL && qrMode != qrToken && qrMode != qrOff {
+		fmt.Printf("Error: invalid --qr %q: use url, token or off\n", qrMode)
+		os.Exit(exitUsage)
+	}
 
-		if err := createConfigFiles(config); err != nil {
-			fmt.Printf("Error creating config files: %v\n", err)
+	if *langFlag != "" {
+		if matchLanguage(*langFlag) == "" {
+			fmt.Printf("Error: unsupported language %q, available: %s\n", *langFlag, strings.Join(supportedLanguages(), ", "))
+			os.Exit(exitUsage)
+		}
+		if err := setLanguage(*langFlag); err != nil {
+			fmt.Printf("Error: %v\n", err)
 			os.Exit(1)
 		}
+	}
 
-		if err := moveFile("config/docker-compose.yml", "docker-compose.yml"); err != nil {
-			fmt.Printf("Error moving docker-compose.yml: %v\n", err)
-			os.Exit(1)
+	if !nonInteractive && (*answersFlag != "" || len(givenAnswers) > 0 || startContainersAnswer || installCrowdsecAnswer) {
+		fmt.Println("Error: --answers, --start-containers, --install-crowdsec and the answer flags need --non-interactive.")
+		os.Exit(exitUsage)
+	}
+	if nonInteractive {
+		config, err := nonInteractiveAnswers(*answersFlag, givenAnswers)
+		if err != nil {
+			exitWithError(err)
 		}
+		answeredConfig = config
+	}
 
-		fmt.Println("\nConfiguration files created successfully!")
+	if rootlessMode && isFreeBSD() {
+		fmt.Println("Error: --rootless is not supported on FreeBSD, where Podman runs as root.")
+		os.Exit(exitUsage)
+	}
+	if rootlessMode && os.Geteuid() == 0 {
+		fmt.Println("Error: --rootless must be run as the unprivileged user that will own the containers, not as root.")
+		os.Exit(exitPreflight)
+	}
 
-		// Download MaxMind Country / ASN database if requested
-		if config.EnableMaxMind {
-			fmt.Println("\n=== Downloading MaxMind Country and ASN Databases ===")
-			if err := downloadMaxMindDatabase(); err != nil {
-				fmt.Printf("Error downloading MaxMind databases: %v\n", err)
-				fmt.Println("You can download it manually later if needed.")
-			}
+	if simulatePath != "" {
+		if sandboxMode {
+			fmt.Println("Error: --simulate cannot be combined with --sandbox.")
+			os.Exit(exitUsage)
 		}
+		path, err := filepath.Abs(simulatePath)
+		if err != nil {
+			fmt.Printf("Error resolving the plan file: %v\n", err)
+			os.Exit(exitUsage)
+		}
+		simulatePath = path
+		hostOps = &hostRecorder{}
+		fmt.Println("Simulating the install: host changes are recorded to " + simulatePath + " instead of being made.")
+	}
 
-		fmt.Println("\n=== Starting installation ===")
-
-		if readBool("Would you like to install and start the containers?", true) {
-
-			config.InstallationContainerType = podmanOrDocker()
-
-			if !isDockerInstalled() && runtime.GOOS == "linux" && config.InstallationContainerType == Docker {
-				if readBool("Docker is not installed. Would you like to install it?", true) {
-					if err := installDocker(); err != nil {
-						fmt.Printf("Error installing Docker: %v\n", err)
-						return
-					}
-
-					// try to start docker service but ignore errors
-					if err := startDockerService(); err != nil {
-						fmt.Println("Error starting Docker service:", err)
-					} else {
-						fmt.Println("Docker service started successfully!")
-					}
-					// wait 10 seconds for docker to start checking if docker is running every 2 seconds
-					fmt.Println("Waiting for Docker to start...")
-					for range 5 {
-						if isDockerRunning() {
-							fmt.Println("Docker is running!")
-							break
-						}
-						fmt.Println("Docker is not running yet, waiting...")
-						time.Sleep(2 * time.Second)
-					}
-					if !isDockerRunning() {
-						fmt.Println("Docker is still not running after 10 seconds. Please check the installation.")
-						os.Exit(1)
-					}
-					fmt.Println("Docker installed successfully!")
-				}
-			}
-
-			if err := pullContainers(config.InstallationContainerType); err != nil {
-				fmt.Println("Error: ", err)
-				return
-			}
+	if sandboxMode {
+		devMode = true
+		if err := runSandbox(*dirFlag); err != nil {
+			exitWithError(err)
+		}
+		return
+	}
 
-			if err := startContainers(config.InstallationContainerType); err != nil {
-				fmt.Println("Error: ", err)
-				return
-			}
+	if templatesDir != "" {
+		absDir, err := filepath.Abs(templatesDir)
+		if err != nil {
+			fmt.Printf("Error resolving templates directory: %v\n", err)
+			os.Exit(exitUsage)
+		}
+		templatesDir = absDir
+		if _, err := installer.TemplateFS(templatesDir); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(exitUsage)
 		}
+		fmt.Printf("Using custom templates from %s\n", templatesDir)
+	}
 
-	} else {
-		alreadyInstalled = true
-		fmt.Println("Looks like you already installed Pangolin!")
-
-		// Check if MaxMind database exists and offer to update it
-		fmt.Println("\n=== MaxMind Database Update ===")
-		if _, err := os.Stat("config/GeoLite2-Country.mmdb"); err == nil {
-			fmt.Println("MaxMind GeoLite2 Country database found.")
-			if readBool("Would you like to update the MaxMind databases (Country and ASN) to the latest version?", false) {
-				if err := downloadMaxMindDatabase(); err != nil {
-					fmt.Printf("Error updating MaxMind database: %v\n", err)
-					fmt.Println("You can try updating it manually later if needed.")
-				}
-			}
-		} else {
-			fmt.Println("MaxMind GeoLite2 Country and ASN databases not found.")
-			if readBool("Would you like to download the MaxMind GeoLite2 databases for blocking functionality?", false) {
-				if err := downloadMaxMindDatabase(); err != nil {
-					fmt.Printf("Error downloading MaxMind database: %v\n", err)
-					fmt.Println("You can try downloading it manually later if needed.")
-				}
-				// Now you need to update your config file accordingly to enable geoblocking
-				fmt.Print("Please remember to update your config/config.yml file to enable geoblocking! \n\n")
-				// add   maxmind_db_path: "./config/GeoLite2-Country.mmdb" under server
-				// add   maxmind_asn_path: "./config/GeoLite2-ASN.mmdb" under server
-				fmt.Println("Add the following lines under the 'server' section:")
-				fmt.Println("  maxmind_db_path: \"./config/GeoLite2-Country.mmdb\"")
-				fmt.Println("  maxmind_asn_path: \"./config/GeoLite2-ASN.mmdb\"")
-			}
+	var provisioning *provisioningFile
+	if *provisionFlag != "" {
+		path, err := expandPath(*provisionFlag)
+		if err == nil {
+			provisioning, err = loadProvisioningFile(path)
+		}
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(exitUsage)
 		}
 	}
 
-	if *crowdsecFlag && !checkIsCrowdsecInstalledInCompose() {
-		fmt.Println("\n=== CrowdSec Install ===")
-		// check if crowdsec is installed
-		if readBool("Would you like to install CrowdSec?", false) {
-			fmt.Println("This installer constitutes a minimal viable CrowdSec deployment. CrowdSec will add extra complexity to your Pangolin installation and may not work to the best of its abilities out of the box. Users are expected to implement configuration adjustments on their own to achieve the best security posture. Consult the CrowdSec documentation for detailed configuration instructions.")
-
-			// BUG: crowdsec installation will be skipped if the user chooses to install on the first installation.
-			if readBool("Are you willing to manage CrowdSec?", false) {
-				if config.DashboardDomain == "" {
-					traefikConfig, err := ReadTraefikConfig("config/traefik/traefik_config.yml")
-					if err != nil {
-						fmt.Printf("Error reading config: %v\n", err)
-						return
-					}
-					appConfig, err := ReadAppConfig("config/config.yml")
-					if err != nil {
-						fmt.Printf("Error reading config: %v\n", err)
-						return
-					}
-
-					parsedURL, err := url.Parse(appConfig.DashboardURL)
-					if err != nil {
-						fmt.Printf("Error parsing URL: %v\n", err)
-						return
-					}
-
-					config.DashboardDomain = parsedURL.Hostname()
-					config.LetsEncryptEmail = traefikConfig.LetsEncryptEmail
-					config.BadgerVersion = traefikConfig.BadgerVersion
-
-					// print the values and check if they are right
-					fmt.Println("Detected values:")
-					fmt.Printf("Dashboard Domain: %s\n", config.DashboardDomain)
-					fmt.Printf("Let's Encrypt Email: %s\n", config.LetsEncryptEmail)
-					fmt.Printf("Badger Version: %s\n", config.BadgerVersion)
-
-					if !readBool("Are these values correct?", true) {
-						config = collectUserInput()
-					}
-				}
+	// print a banner about prerequisites - opening port 80, 443, 51820, and 21820 on the VPS and firewall and pointing your domain to the VPS IP with a records. Docs are at http://localhost:3000/Getting%20Started/dns-networking
 
-				// Try to detect container type from existing installation
-				detectedType := detectContainerType()
-				if detectedType == Undefined {
-					// If detection fails, prompt the user
-					fmt.Println("Unable to detect container type from existing installation.")
-					config.InstallationContainerType = podmanOrDocker()
-				} else {
-					config.InstallationContainerType = detectedType
-					fmt.Printf("Detected container type: %s\n", config.InstallationContainerType)
-				}
+	fmt.Println(msg("welcomeTitle"))
+	fmt.Println(msg("welcomeDescription"))
+	if devMode {
+		fmt.Println("\n" + msg("welcomeDevMode"))
+	} else {
+		fmt.Println("\n" + msg("welcomePrerequisites"))
+		fmt.Println("- " + msg("welcomePrerequisitePorts"))
+	}
+	fmt.Println("\n" + msg("welcomeStart"))
 
-				config.DoCrowdsecInstall = true
-				err := installCrowdsec(config, installDir)
-				if err != nil {
-					fmt.Printf("Error installing CrowdSec: %v\n", err)
-					return
-				}
+	// In the installer container the ports are those of its own network
+	if os.Geteuid() == 0 && !rootlessMode && !devMode && !installer.InInstallerContainer() { // WE NEED TO BE SUDO TO CHECK THIS
+		resolveWebServerConflict()
+	}
 
-				fmt.Println("CrowdSec installed successfully!")
-			}
+	// Determine installation directory
+	var installDir string
+	if *dirFlag != "" {
+		dir, err := prepareInstallDirectory(*dirFlag)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		confirmSecondInstall(dir)
+		installDir = dir
+	} else {
+		installDir = findOrSelectInstallDirectory()
+	}
+	if installer.InInstallerContainer() {
+		dir, err := enterHostPath(installDir)
+		if err != nil {
+			exitWithError(err)
 		}
+		installDir = dir
 	}
-
-	if !alreadyInstalled || config.DoCrowdsecInstall {
-		// Setup Token Section
-		fmt.Println("\n=== Setup Token ===")
-
-		// Check if containers were started during this installation
-		containersStarted := false
-		if (isDockerInstalled() && config.InstallationContainerType == Docker) ||
-			(isPodmanInstalled() && config.InstallationContainerType == Podman) {
-			// Try to fetch and display the token if containers are running
-			containersStarted = true
-			printSetupToken(config.InstallationContainerType, config.DashboardDomain)
+	recorder, _ := hostOps.(*hostRecorder)
+	if recorder != nil {
+		if err := recorder.enterScratch(installDir); err != nil {
+			fmt.Printf("Error preparing the simulation: %v\n", err)
+			os.Exit(1)
 		}
+	} else if err := os.Chdir(installDir); err != nil {
+		fmt.Printf("Error changing to installation directory: %v\n", err)
+		os.Exit(1)
+	}
 
-		// If containers weren't started or token wasn't found, show instructions
-		if !containersStarted {
-			showSetupTokenInstructions(config.InstallationContainerType, config.DashboardDomain)
+	state := &installState{InstallDir: installDir, CrowdsecRequested: *crowdsecFlag || installCrowdsecAnswer, Provisioning: provisioning}
+	if _, err := os.Stat("config/config.yml"); err == nil {
+		state.AlreadyInstalled = true
+	}
+	stepsErr := runInstallSteps(state)
+	if recorder != nil {
+		if err := recorder.finishSimulation(); err != nil {
+			exitWithError(err)
 		}
 	}
+	if stepsErr != nil {
+		exitWithError(stepsErr)
+	}
+	if recorder != nil {
+		return
+	}
+
+	// Containers may have created keys and certificates in the meantime
+	secureInstallFiles()
 
-	fmt.Println("\nInstallation complete!")
+	fmt.Println("\n" + msg("installComplete"))
 
-	fmt.Printf("\nTo complete the initial setup, please visit:\nhttps://%s/auth/initial-setup\n", config.DashboardDomain)
+	if state.Provisioned {
+		return
+	}
+	fmt.Printf("\n%s\nhttps://%s/auth/initial-setup\n", msg("installCompleteVisit"), state.Config.DashboardDomain)
 }
 
 func hasExistingInstall(dir string) bool {
@@ -310,9 +293,48 @@ func hasExistingInstall(dir string) bool {
 	return err == nil
 }
 
-func findOrSelectInstallDirectory() string {
-	const defaultInstallDir = "/opt/pangolin"
+// confirmSecondInstall asks for confirmation before installing into a new
+// directory while another install exists, which would compete with it for
+// ports and container names.
+func confirmSecondInstall(dir string) {
+	if hasExistingInstall(dir) {
+		return
+	}
+	others := slices.DeleteFunc(knownInstallDirs(), func(other string) bool { return other == dir })
+	if len(others) == 0 {
+		return
+	}
+	fmt.Println("\n" + msg("installDirOtherInstalls", strings.Join(others, ", ")))
+	if !confirmHostChange(msg("promptSecondInstall", dir), false) {
+		fmt.Println(msg("installDirUseDir"))
+		if nonInteractive {
+			os.Exit(exitPreflight)
+		}
+		os.Exit(exitAborted)
+	}
+}
+
+// prepareInstallDirectory resolves the directory given with --dir and
+// creates it if needed.
+func prepareInstallDirectory(dir string) (string, error) {
+	installDir, err := expandPath(dir)
+	if err != nil {
+		return "", fmt.Errorf("error resolving path: %w", err)
+	}
+
+	if _, err := os.Stat(installDir); os.IsNotExist(err) {
+		if err := hostOps.MkdirAll(installDir, 0755); err != nil {
+			return "", fmt.Errorf("error creating directory: %w", err)
+		}
+		fmt.Printf("Created directory: %s\n", installDir)
+		changeDirectoryOwnership(installDir)
+	}
 
+	fmt.Println(msg("installDirSelected", installDir))
+	return installDir, nil
+}
+
+func findOrSelectInstallDirectory() string {
 	// Get current working directory
 	cwd, err := os.Getwd()
 	if err != nil {
@@ -322,61 +344,53 @@ func findOrSelectInstallDirectory() string {
 
 	// 1. Check current directory for existing install
 	if hasExistingInstall(cwd) {
-		fmt.Printf("Found existing Pangolin installation in current directory: %s\n", cwd)
+		fmt.Println(msg("installDirFoundCurrent", cwd))
 		return cwd
 	}
 
-	// 2. Check default location (/opt/pangolin) for existing install
-	if cwd != defaultInstallDir && hasExistingInstall(defaultInstallDir) {
-		fmt.Printf("\nFound existing Pangolin installation at: %s\n", defaultInstallDir)
-		if readBool(fmt.Sprintf("Would you like to use the existing installation at %s?", defaultInstallDir), true) {
-			return defaultInstallDir
-		}
+	// A non-interactive install neither picks nor creates a directory
+	if nonInteractive {
+		exitWithError(usageErrorf("--non-interactive needs --dir outside an installation directory"))
 	}
 
-	// 3. No existing install found, prompt for installation directory
-	fmt.Println("\n=== Installation Directory ===")
-	fmt.Println("No existing Pangolin installation detected.")
-
-	installDir := readString("Enter the installation directory", defaultInstallDir)
-
-	// Expand ~ to home directory if present
-	if strings.HasPrefix(installDir, "~") {
-		home, err := os.UserHomeDir()
-		if err != nil {
-			fmt.Printf("Error getting home directory: %v\n", err)
-			os.Exit(1)
+	// 2. Check the directory recorded by a previous run, the directories of
+	// existing Pangolin containers and the default location
+	for _, dir := range knownInstallDirs() {
+		fmt.Println("\n" + msg("installDirFound", dir))
+		if readBool(msg("installDirUseExisting", dir), true) {
+			return dir
 		}
-		installDir = filepath.Join(home, installDir[1:])
 	}
 
-	// Convert to absolute path
-	absPath, err := filepath.Abs(installDir)
+	// 3. No existing install found, prompt for installation directory
+	fmt.Println("\n=== " + msg("sectionInstallDir") + " ===")
+	fmt.Println(msg("installDirNoneFound"))
+
+	installDir, err := expandPath(readString(msg("installDirPrompt"), suggestedInstallDir()))
 	if err != nil {
 		fmt.Printf("Error resolving path: %v\n", err)
 		os.Exit(1)
 	}
-	installDir = absPath
 
 	// Check if directory exists
 	if _, err := os.Stat(installDir); os.IsNotExist(err) {
 		// Directory doesn't exist, create it
-		if readBool(fmt.Sprintf("Directory %s does not exist. Create it?", installDir), true) {
-			if err := os.MkdirAll(installDir, 0755); err != nil {
+		if readBool(msg("installDirCreate", installDir), true) {
+			if err := hostOps.MkdirAll(installDir, 0755); err != nil {
 				fmt.Printf("Error creating directory: %v\n", err)
 				os.Exit(1)
 			}
-			fmt.Printf("Created directory: %s\n", installDir)
+			fmt.Println(msg("installDirCreated", installDir))
 
 			// Offer to change ownership if running via sudo
 			changeDirectoryOwnership(installDir)
 		} else {
-			fmt.Println("Installation cancelled.")
-			os.Exit(0)
+			fmt.Println(msg("installCancelled"))
+			os.Exit(exitAborted)
 		}
 	}
 
-	fmt.Printf("Installation directory: %s\n", installDir)
+	fmt.Println(msg("installDirSelected", installDir))
 	return installDir
 }
 
@@ -394,8 +408,8 @@ func changeDirectoryOwnership(dir string) {
 		return
 	}
 
-	fmt.Printf("\nRunning as root via sudo (original user: %s)\n", sudoUser)
-	if readBool(fmt.Sprintf("Would you like to change ownership of %s to user '%s'? This makes it easier to manage config files without sudo.", dir, sudoUser), true) {
+	fmt.Println("\n" + msg("sudoDetected", sudoUser))
+	if confirmHostChange(msg("sudoChangeOwnership", dir, sudoUser), true) {
 		uid, err := strconv.Atoi(sudoUID)
 		if err != nil {
 			fmt.Printf("Warning: Could not parse SUDO_UID: %v\n", err)
@@ -407,7 +421,7 @@ func changeDirectoryOwnership(dir string) {
 			return
 		}
 
-		if err := os.Chown(dir, uid, gid); err != nil {
+		if err := hostOps.Chown(dir, uid, gid); err != nil {
 			fmt.Printf("Warning: Could not change ownership: %v\n", err)
 		} else {
 			fmt.Printf("Changed ownership of %s to %s\n", dir, sudoUser)
@@ -416,7 +430,23 @@ func changeDirectoryOwnership(dir string) {
 }
 
 func podmanOrDocker() SupportedContainer {
-	inputContainer := readString("Would you like to run Pangolin as Docker or Podman containers?", "docker")
+	if isFreeBSD() && !devMode {
+		return freeBSDContainer()
+	}
+	// The installer image has the docker CLI only
+	if installer.InInstallerContainer() {
+		if !isDockerRunning() {
+			fmt.Println(msg("installerContainerNoEngine"))
+			os.Exit(exitPreflight)
+		}
+		hostEngine = installer.DetectDockerEngine()
+		return Docker
+	}
+
+	inputContainer := string(answeredConfig.InstallationContainerType)
+	if !nonInteractive {
+		inputContainer = readString(msg("containerRuntimePrompt"), "docker")
+	}
 
 	chosenContainer := Docker
 	if strings.EqualFold(inputContainer, "docker") {
@@ -424,56 +454,80 @@ func podmanOrDocker() SupportedContainer {
 	} else if strings.EqualFold(inputContainer, "podman") {
 		chosenContainer = Podman
 	} else {
-		fmt.Printf("Unrecognized container type: %s. Valid options are 'docker' or 'podman'.\n", inputContainer)
-		os.Exit(1)
+		fmt.Println(msg("containerRuntimeUnknown", inputContainer))
+		os.Exit(exitUsage)
+	}
+
+	if rootlessMode {
+		return rootlessContainer(chosenContainer)
+	}
+	if devMode {
+		// Docker Desktop, OrbStack and Podman machines run the containers in
+		// a VM, so none of the host setup below applies
+		if chosenContainer == Docker {
+			ensureDesktopDocker()
+		} else if !isPodmanInstalled() {
+			fmt.Println(msg("podmanNotInstalled"))
+			os.Exit(exitPreflight)
+		}
+		return chosenContainer
 	}
 
 	switch chosenContainer {
 	case Podman:
 		if !isPodmanInstalled() {
-			fmt.Println("Podman or podman-compose is not installed. Please install both manually. Automated installation will be available in a later release.")
-			os.Exit(1)
+			fmt.Println(msg("podmanNotInstalled"))
+			os.Exit(exitPreflight)
 		}
 
 		if err := exec.Command("bash", "-c", "cat /etc/sysctl.d/99-podman.conf 2>/dev/null | grep 'net.ipv4.ip_unprivileged_port_start=' || cat /etc/sysctl.conf 2>/dev/null | grep 'net.ipv4.ip_unprivileged_port_start='").Run(); err != nil {
-			fmt.Println("Would you like to configure ports >= 80 as unprivileged ports? This enables podman containers to listen on low-range ports.")
-			fmt.Println("Pangolin will experience startup issues if this is not configured, because it needs to listen on port 80/443 by default.")
-			approved := readBool("The installer is about to execute \"echo 'net.ipv4.ip_unprivileged_port_start=80' > /etc/sysctl.d/99-podman.conf && sysctl --system\". Approve?", true)
+			fmt.Println(msg("podmanUnprivilegedPorts"))
+			fmt.Println(msg("podmanUnprivilegedPortsReason"))
+			approved := confirmHostChange(msg("podmanUnprivilegedPortsApprove", "echo 'net.ipv4.ip_unprivileged_port_start=80' > /etc/sysctl.d/99-podman.conf && sysctl --system"), true)
 			if approved {
-				if os.Geteuid() != 0 {
-					fmt.Println("You need to run the installer as root for such a configuration.")
-					os.Exit(1)
+				if !canBecomeRoot() {
+					fmt.Println(msg("podmanUnprivilegedPortsNeedsRoot"))
+					os.Exit(exitPreflight)
 				}
 
 				// Podman containers are not able to listen on privileged ports. The official recommendation is to
 				// container low-range ports as unprivileged ports.
 				// Linux only.
 
-				if err := run("bash", "-c", "echo 'net.ipv4.ip_unprivileged_port_start=80' > /etc/sysctl.d/99-podman.conf && sysctl --system"); err != nil {
+				if err := runAsRoot("the sysctl change", "bash", "-c", "echo 'net.ipv4.ip_unprivileged_port_start=80' > /etc/sysctl.d/99-podman.conf && sysctl --system"); err != nil {
 					fmt.Printf("Error configuring unprivileged ports: %v\n", err)
 					os.Exit(1)
 				}
 			} else {
-				fmt.Println("You need to configure port forwarding or adjust the listening ports before running pangolin.")
+				fmt.Println(msg("podmanUnprivilegedPortsDeclined"))
 			}
 		} else {
-			fmt.Println("Unprivileged ports have been configured.")
+			fmt.Println(msg("podmanUnprivilegedPortsConfigured"))
 		}
 
 	case Docker:
-		// check if docker is not installed and the user is root
+		// Docker Desktop and the like bring their own setup, and a remote
+		// engine does not run on this host
+		if hostEngine = installer.DetectDockerEngine(); !hostEngine.Native() {
+			return chosenContainer
+		}
+
+		// check if docker is not installed and the user can become root to
+		// install it
 		if !isDockerInstalled() {
-			if os.Geteuid() != 0 {
-				fmt.Println("Docker is not installed. Please install Docker manually or run this installer as root.")
-				os.Exit(1)
+			if !canBecomeRoot() {
+				fmt.Println(msg("dockerNotInstalledNotRoot"))
+				os.Exit(exitPreflight)
 			}
 		}
 
 		// check if the user is in the docker group (linux only)
-		if !isUserInDockerGroup() {
-			fmt.Println("You are not in the docker group.")
-			fmt.Println("The installer will not be able to run docker commands without running it as root.")
-			os.Exit(1)
+		if !installer.InDockerGroup() {
+			fmt.Println(msg("dockerGroupMissing"))
+			if !resolveDockerGroup() {
+				fmt.Println(msg("dockerGroupMissingReason"))
+				os.Exit(exitPreflight)
+			}
 		}
 	default:
 		// This shouldn't happen unless there's a third container runtime.
@@ -483,163 +537,163 @@ func podmanOrDocker() SupportedContainer {
 	return chosenContainer
 }
 
+// telemetryChoice is the anonymous telemetry setting forced by --telemetry,
+// or nil to ask.
+var telemetryChoice *bool
+
+// telemetryFlag registers --telemetry, which forces the anonymous telemetry
+// setting of the generated config instead of asking.
+func telemetryFlag(flags *flag.FlagSet) {
+	flags.BoolFunc("telemetry", "Enable (--telemetry) or disable (--telemetry=false) anonymous usage telemetry without asking", func(s string) error {
+		enabled, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		telemetryChoice = &enabled
+		return nil
+	})
+}
+
 func collectUserInput() Config {
 	config := Config{}
 
 	// Basic configuration
-	fmt.Println("\n=== Basic Configuration ===")
+	fmt.Println("\n=== " + msg("sectionBasic") + " ===")
 
-	config.IsEnterprise = readBoolNoDefault("Do you want to install the Enterprise version of Pangolin? The EE is free for personal use or for businesses making less than 100k USD annually.")
-    if config.IsEnterprise {
-        config.IsRedis = readBool("Do you want to run the Redis containers locally? Required for HA.")
-        if config.IsRedis {
-            config.IsRedisPass = readPassword("Enter a unique password for the Redis service.")
-        }
-    }
+	config.IsEnterprise = readBoolNoDefault(msg("promptEnterprise"))
+	if config.IsEnterprise {
+		config.IsRedis = readBool(msg("promptRedis"), false)
+		if config.IsRedis {
+			config.IsRedisPass = readPassword(msg("promptRedisPassword"), "")
+		}
+	}
 
-    config.IsPostgreSQL = readBool("Do you want to run the PostgreSQL containers locally? Otherwise, default to the local SQLite database only.", false)
+	config.IsPostgreSQL = readBool(msg("promptPostgreSQL"), false)
 	if config.IsPostgreSQL {
-		config.IsPostgreSQLPass = readPassword("Enter a unique password for the PostgreSQL pangolin user.")
+		config.IsPostgreSQLPass = readPassword(msg("promptPostgreSQLPassword"), "")
 	}
 
-	config.BaseDomain = readString("Enter your base domain (no subdomain e.g. example.com)", "")
+	defaultBaseDomain := ""
+	if devMode {
+		defaultBaseDomain = devBaseDomain
+	}
+	config.BaseDomain = readDomain(msg("promptBaseDomain"), defaultBaseDomain)
 
 	// Set default dashboard domain after base domain is collected
-	defaultDashboardDomain := ""
-	if config.BaseDomain != "" {
-		defaultDashboardDomain = "pangolin." + config.BaseDomain
+	defaultDashboardDomain := "pangolin." + config.BaseDomain
+	config.DashboardDomain = readDomain(msg("promptDashboardDomain"), defaultDashboardDomain)
+	for !installer.DashboardUnderBase(config.DashboardDomain, config.BaseDomain) {
+		fmt.Println(msg("warningDashboardOutsideBase", config.DashboardDomain, config.BaseDomain))
+		if readBool(msg("promptKeepDashboardDomain"), false) {
+			break
+		}
+		config.DashboardDomain = readDomain(msg("promptDashboardDomain"), defaultDashboardDomain)
+	}
+	if devMode {
+		config.SelfSignedTLS = true
+	} else {
+		config.LetsEncryptEmail = readEmail(msg("promptLetsEncryptEmail"), "")
 	}
-	config.DashboardDomain = readString("Enter the domain for the Pangolin dashboard", defaultDashboardDomain)
-	config.LetsEncryptEmail = readString("Enter email for Let's Encrypt certificates", "")
-	config.InstallGerbil = readBool("Do you want to use Gerbil to allow tunneled connections", true)
+	// Gerbil manages WireGuard through Linux netlink, which the FreeBSD
+	// Linux compatibility layer does not provide
+	config.InstallGerbil = readBool(msg("promptGerbil"), !devMode && !isFreeBSD())
 
 	// Email configuration
-	fmt.Println("\n=== Email Configuration ===")
-	config.EnableEmail = readBool("Enable email functionality (SMTP)", false)
+	fmt.Println("\n=== " + msg("sectionEmail") + " ===")
+	config.EnableEmail = readBool(msg("promptEnableEmail"), false)
 
 	if config.EnableEmail {
-		config.EmailSMTPHost = readString("Enter SMTP host", "")
-		config.EmailSMTPPort = readInt("Enter SMTP port (default 587)", 587)
-		config.EmailSMTPUser = readString("Enter SMTP username", "")
-		config.EmailSMTPPass = readPassword("Enter SMTP password")
-		config.EmailNoReply = readString("Enter no-reply email address (often the same as SMTP username)", "")
-	}
-
-	// Validate required fields
-	if config.BaseDomain == "" {
-		fmt.Println("Error: Domain name is required")
-		os.Exit(1)
-	}
-	if config.LetsEncryptEmail == "" {
-		fmt.Println("Error: Let's Encrypt email is required")
-		os.Exit(1)
-	}
-	if config.EnableEmail && config.EmailNoReply == "" {
-		fmt.Println("Error: No-reply email address is required when email is enabled")
-		os.Exit(1)
+		config.EmailSMTPHost = readString(msg("promptSMTPHost"), "")
+		config.EmailSMTPPort = readPort(msg("promptSMTPPort"), 587)
+		config.EmailSMTPUser = readString(msg("promptSMTPUser"), "")
+		config.EmailSMTPPass = readPassword(msg("promptSMTPPassword"), "")
+		config.EmailNoReply = readEmail(msg("promptNoReply"), "")
+		checkEmailAuthentication(config)
 	}
 
 	// Advanced configuration
 
-	fmt.Println("\n=== Advanced Configuration ===")
-
-	config.EnableIPv6 = readBool("Is your server IPv6 capable?", true)
-	config.EnableMaxMind = readBool("Do you want to download the MaxMind GeoLite2 Country and ADN databases for blocking functionality?", true)
-
-	if config.DashboardDomain == "" {
-		fmt.Println("Error: Dashboard Domain name is required")
-		os.Exit(1)
-	}
-
-	return config
-}
+	fmt.Println("\n=== " + msg("sectionAdvanced") + " ===")
 
-func createConfigFiles(config Config) error {
-	if err := os.MkdirAll("config", 0755); err != nil {
-		return fmt.Errorf("failed to create config directory: %v", err)
-	}
-	if err := os.MkdirAll("config/letsencrypt", 0755); err != nil {
-		return fmt.Errorf("failed to create letsencrypt directory: %v", err)
+	if !devMode {
+		collectIPv6Only(&config)
 	}
-	if err := os.MkdirAll("config/db", 0755); err != nil {
-		return fmt.Errorf("failed to create db directory: %v", err)
+	if !config.IPv6Only {
+		config.EnableIPv6 = readBool(msg("promptIPv6"), !devMode)
 	}
-	if err := os.MkdirAll("config/logs", 0755); err != nil {
-		return fmt.Errorf("failed to create logs directory: %v", err)
-	}
-
-	// Walk through all embedded files
-	err := fs.WalkDir(configFiles, "config", func(path string, d fs.DirEntry, walkErr error) (err error) {
-		if walkErr != nil {
-			return walkErr
-		}
-
-		// Skip the root fs directory itself
-		if path == "config" {
-			return nil
-		}
-
-		if !config.DoCrowdsecInstall && strings.Contains(path, "crowdsec") {
-			return nil
-		}
-
-		if config.DoCrowdsecInstall && !strings.Contains(path, "crowdsec") {
-			return nil
-		}
-
-		// skip .DS_Store
-		if strings.Contains(path, ".DS_Store") {
-			return nil
-		}
+	config.EnableMaxMind = readBool(msg("promptMaxMind"), !devMode)
+	collectGeoblocking(&config)
 
-		if d.IsDir() {
-			// Create directory
-			if err := os.MkdirAll(path, 0755); err != nil {
-				return fmt.Errorf("failed to create directory %s: %v", path, err)
+	if telemetryChoice != nil {
+		config.Telemetry = *telemetryChoice
+	} else {
+		config.Telemetry = readBool(msg("promptTelemetry"), false)
+	}
+
+	if !devMode {
+		collectAutoUpdate(&config)
+		collectMonitoring(&config)
+	}
+	collectLogDriver(&config)
+	collectEncryption(&config)
+	collectBadgerOptions(&config)
+
+	config.Rootless = rootlessMode
+	config.HTTPPort, config.HTTPSPort = 80, 443
+	if rootlessMode || coexistingWebServer != nil {
+		collectAlternatePorts(&config)
+		for _, p := range []int{config.HTTPPort, config.HTTPSPort} {
+			if err := installer.CheckPortAvailable(p); err != nil {
+				fmt.Println(err)
+				fmt.Println(msg("errorPortsInUse"))
+				os.Exit(exitPreflight)
 			}
-			return nil
 		}
+	}
 
-		// Read the template file
-		content, err := configFiles.ReadFile(path)
-		if err != nil {
-			return fmt.Errorf("failed to read %s: %v", path, err)
-		}
+	config.WireGuardPort, config.ClientsWireGuardPort = installer.DefaultWireGuardPort, installer.DefaultClientsWireGuardPort
+	if config.InstallGerbil {
+		collectWireGuardPorts(&config)
+		collectGerbilEndpoints(&config)
+	}
 
-		// Parse template
-		tmpl, err := template.New(d.Name()).Parse(string(content))
-		if err != nil {
-			return fmt.Errorf("failed to parse template %s: %v", path, err)
-		}
+	return config
+}
 
-		// Ensure parent directory exists
-		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
-			return fmt.Errorf("failed to create parent directory for %s: %v", path, err)
-		}
+func createConfigFiles(config Config) error {
+	return renderConfigFiles(config, ".")
+}
 
-		// Create output file
-		outFile, err := os.Create(path)
-		if err != nil {
-			return fmt.Errorf("failed to create %s: %v", path, err)
-		}
-		defer func() {
-			if cerr := outFile.Close(); cerr != nil && err == nil {
-				err = cerr
-			}
-		}()
+// templatesDir is an optional directory whose files override the embedded
+// config templates, see installer.TemplateFS. Set via --templates-dir.
+var templatesDir string
 
-		// Execute template
-		if err := tmpl.Execute(outFile, config); err != nil {
-			return fmt.Errorf("failed to execute template %s: %v", path, err)
-		}
+// renderConfigFiles renders the config templates into root/config.
+func renderConfigFiles(config Config, root string) error {
+	return installer.Render(config, root, installer.RenderOptions{TemplatesDir: templatesDir})
+}
 
-		return nil
-	})
+// renderScratchConfig renders the configuration of an existing installation
+// into a temporary directory, which the caller removes, to take single files
+// or compose services from.
+func renderScratchConfig(config Config) (string, error) {
+	dir, err := os.MkdirTemp("", "pangolin-render-")
 	if err != nil {
-		return fmt.Errorf("error walking config files: %v", err)
-	}
-
-	return nil
+		return "", err
+	}
+	// Installations without a state file do not record all the versions the
+	// compose file is rendered with
+	versions := componentVersions()
+	config.PangolinVersion = cmp.Or(config.PangolinVersion, versions.Pangolin)
+	config.GerbilVersion = cmp.Or(config.GerbilVersion, versions.Gerbil)
+	config.BadgerVersion = cmp.Or(config.BadgerVersion, versions.Badger)
+	config.TraefikVersion = cmp.Or(config.TraefikVersion, versions.Traefik)
+	config.DoCrowdsecInstall = false
+	if err := renderConfigFiles(config, dir); err != nil {
+		os.RemoveAll(dir)
+		return "", err
+	}
+	return dir, nil
 }
 
 func copyFile(src, dst string) (err error) {
@@ -653,7 +707,13 @@ func copyFile(src, dst string) (err error) {
 		}
 	}()
 
-	destination, err := os.Create(dst)
+	info, err := source.Stat()
+	if err != nil {
+		return err
+	}
+
+	// Keep the source permissions so secret files stay private
+	destination, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, info.Mode().Perm())
 	if err != nil {
 		return err
 	}
@@ -676,62 +736,153 @@ func moveFile(src, dst string) error {
 }
 
 func printSetupToken(containerType SupportedContainer, dashboardDomain string) {
-	fmt.Println("Waiting for Pangolin to generate setup token...")
+	fmt.Println(msg("setupTokenWaiting"))
 
 	// Wait for Pangolin to be healthy
-	if err := waitForContainer("pangolin", containerType); err != nil {
-		fmt.Println("Warning: Pangolin container did not become healthy in time.")
+	container := serviceContainer("pangolin")
+	if err := waitForContainer(container, containerType); err != nil {
+		fmt.Println(msg("setupTokenUnhealthy"))
 		return
 	}
 
-	// Give a moment for the setup token to be generated
-	time.Sleep(2 * time.Second)
+	token, err := waitForSetupToken(containerType, container)
+	if token == "" {
+		var logsErr *setupTokenLogsError
+		if errors.As(err, &logsErr) {
+			fmt.Println(msg("setupTokenNoLogs"))
+		} else {
+			fmt.Println(msg("setupTokenNotFound"))
+		}
+		fmt.Println(err)
+		return
+	}
 
-	// Fetch logs
-	var cmd *exec.Cmd
-	if containerType == Docker {
-		cmd = exec.Command("docker", "logs", "pangolin")
-	} else {
-		cmd = exec.Command("podman", "logs", "pangolin")
+	fmt.Println(msg("setupToken", token))
+	fmt.Println("")
+	fmt.Println(msg("setupTokenPurpose"))
+	fmt.Printf("https://%s/auth/initial-setup\n", dashboardDomain)
+	fmt.Println("")
+	printSetupQRCode(dashboardDomain, token)
+	offerCopySetupToken(token)
+	fmt.Println(msg("setupTokenSave"))
+}
+
+// setupTokenTimeout bounds the wait for the setup token
+// (--setup-token-timeout). Pangolin prints it after migrating its database,
+// which takes minutes on slow disks.
+var setupTokenTimeout = 5 * time.Minute
+
+// setupTokenLogsError is the error of reading the logs of Pangolin, when the
+// last attempt of the wait for the setup token failed.
+type setupTokenLogsError struct{ Err error }
+
+func (e *setupTokenLogsError) Error() string {
+	return fmt.Sprintf("could not read the logs of Pangolin: %v", e.Err)
+}
+func (e *setupTokenLogsError) Unwrap() error { return e.Err }
+
+// waitForSetupToken polls the logs of the pangolin container until the setup
+// token has been generated, showing how long it has waited and whether
+// Pangolin is still migrating its database. If the token does not show up
+// in time, the error has the last log lines, which tell what blocks the
+// start.
+func waitForSetupToken(containerType SupportedContainer, container string) (string, error) {
+	start := time.Now()
+	status := newStatusLine()
+	var token string
+	var logsErr error
+	waitUntil(setupTokenTimeout, func() bool {
+		output, err := containerCommand(containerType, "logs", container).CombinedOutput()
+		logsErr = err
+		if err != nil {
+			status.update("Waiting for the logs of Pangolin... %v", time.Since(start).Round(time.Second))
+			return false
+		}
+		if token = findSetupToken(string(output)); token != "" {
+			return true
+		}
+		phase := "Waiting for Pangolin to start"
+		if isMigrating(string(output)) {
+			phase = "Pangolin is migrating its database"
+		}
+		status.update("%s... %v", phase, time.Since(start).Round(time.Second))
+		return false
+	})
+	status.done()
+
+	switch {
+	case token != "":
+		return token, nil
+	case logsErr != nil:
+		return "", &setupTokenLogsError{logsErr}
 	}
-	output, err := cmd.Output()
-	if err != nil {
-		fmt.Println("Warning: Could not fetch Pangolin logs to find setup token.")
+	err := fmt.Sprintf("no setup token in the logs after %v (use --setup-token-timeout to wait longer)", setupTokenTimeout)
+	if logs := containerLogTail(containerType, container, 20); logs != "" {
+		err += "\nLast log lines of " + container + ":\n" + logs
+	}
+	return "", errors.New(err)
+}
+
+// statusLine shows the progress of a wait. On a terminal it rewrites one
+// line in place; with --plain or without a terminal it prints a line when
+// the status changes and otherwise once every statusLineInterval.
+type statusLine struct {
+	inPlace bool
+	last    string
+	printed time.Time
+}
+
+const statusLineInterval = 30 * time.Second
+
+func newStatusLine() *statusLine {
+	return &statusLine{inPlace: !plainMode && term.IsTerminal(int(os.Stdout.Fd()))}
+}
+
+func (s *statusLine) update(format string, args ...any) {
+	line := fmt.Sprintf(format, args...)
+	if s.inPlace {
+		fmt.Printf("\r\033[K%s", line)
+		s.last = line
 		return
 	}
+	// The elapsed time at the end changes every time
+	phase, _, _ := strings.Cut(line, "...")
+	if phase != s.last || time.Since(s.printed) >= statusLineInterval {
+		fmt.Println(line)
+		s.last, s.printed = phase, time.Now()
+	}
+}
 
-	// Parse for setup token
-	lines := strings.Split(string(output), "\n")
+// done ends the line rewritten in place.
+func (s *statusLine) done() {
+	if s.inPlace && s.last != "" {
+		fmt.Println()
+	}
+}
+
+// findSetupToken extracts the setup token from Pangolin's logs.
+func findSetupToken(logs string) string {
+	lines := strings.Split(logs, "\n")
 	for i, line := range lines {
 		if strings.Contains(line, "=== SETUP TOKEN GENERATED ===") || strings.Contains(line, "=== SETUP TOKEN EXISTS ===") {
 			// Look for "Token: ..." in the next few lines
 			for j := i + 1; j < i+5 && j < len(lines); j++ {
 				trimmedLine := strings.TrimSpace(lines[j])
-				if strings.Contains(trimmedLine, "Token:") {
-					// Extract token after "Token:"
-					tokenStart := strings.Index(trimmedLine, "Token:")
-					if tokenStart != -1 {
-						token := strings.TrimSpace(trimmedLine[tokenStart+6:])
-						fmt.Printf("Setup token: %s\n", token)
-						fmt.Println("")
-						fmt.Println("This token is required to register the first admin account in the web UI at:")
-						fmt.Printf("https://%s/auth/initial-setup\n", dashboardDomain)
-						fmt.Println("")
-						fmt.Println("Save this token securely. It will be invalid after the first admin is created.")
-						return
-					}
+				// Extract token after "Token:"
+				if tokenStart := strings.Index(trimmedLine, "Token:"); tokenStart != -1 {
+					return strings.TrimSpace(trimmedLine[tokenStart+6:])
 				}
 			}
 		}
 	}
-	fmt.Println("Warning: Could not find a setup token in Pangolin logs.")
+	return ""
 }
 
 func showSetupTokenInstructions(containerType SupportedContainer, dashboardDomain string) {
-	fmt.Println("\n=== Setup Token Instructions ===")
-	fmt.Println("To get your setup token, you need to:")
+	fmt.Println("\n=== " + msg("sectionSetupTokenInstructions") + " ===")
+	fmt.Println(msg("setupTokenSteps"))
 	fmt.Println("")
-	fmt.Println("1. Start the containers")
+	fmt.Println("1. " + msg("setupTokenStepStart"))
 	switch containerType {
 	case Docker:
 		fmt.Println("   docker compose up -d")
@@ -740,9 +891,9 @@ func showSetupTokenInstructions(containerType SupportedContainer, dashboardDomai
 	}
 
 	fmt.Println("")
-	fmt.Println("2. Wait for the Pangolin container to start and generate the token")
+	fmt.Println("2. " + msg("setupTokenStepWait"))
 	fmt.Println("")
-	fmt.Println("3. Check the container logs for the setup token")
+	fmt.Println("3. " + msg("setupTokenStepLogs"))
 	switch containerType {
 	case Docker:
 		fmt.Println("   docker logs pangolin | grep -A 2 -B 2 'SETUP TOKEN'")
@@ -751,16 +902,16 @@ func showSetupTokenInstructions(containerType SupportedContainer, dashboardDomai
 	}
 
 	fmt.Println("")
-	fmt.Println("4. Look for output like")
+	fmt.Println("4. " + msg("setupTokenStepLookFor"))
 	fmt.Println("   === SETUP TOKEN GENERATED ===")
 	fmt.Println("   Token: [your-token-here]")
 	fmt.Println("   Use this token on the initial setup page")
 	fmt.Println("")
-	fmt.Println("5. Use the token to complete initial setup at")
+	fmt.Println("5. " + msg("setupTokenStepUse"))
 	fmt.Printf("   https://%s/auth/initial-setup\n", dashboardDomain)
 	fmt.Println("")
-	fmt.Println("The setup token is required to register the first admin account.")
-	fmt.Println("Save it securely - it will be invalid after the first admin is created.")
+	fmt.Println(msg("setupTokenRequired"))
+	fmt.Println(msg("setupTokenSave"))
 	fmt.Println("================================")
 }
 
@@ -778,61 +929,5 @@ func run(name string, args ...string) error {
 	cmd := exec.Command(name, args...)
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
-	return cmd.Run()
-}
-
-func checkPortsAvailable(port int) error {
-	addr := fmt.Sprintf(":%d", port)
-	ln, err := net.Listen("tcp", addr)
-	if err != nil {
-		return fmt.Errorf("ERROR: port %d is occupied or cannot be bound: %w", port, err)
-	}
-	if closeErr := ln.Close(); closeErr != nil {
-		fmt.Fprintf(os.Stderr,
-			"WARNING: failed to close test listener on port %d: %v\n",
-			port, closeErr,
-		)
-	}
-	return nil
-}
-
-func downloadMaxMindDatabase() error {
-	fmt.Println("Downloading MaxMind GeoLite2 Country and ASN databases...")
-
-	// Download the GeoLite2 Country databases
-	if err := run("curl", "-L", "-o", "GeoLite2-Country.tar.gz",
-		"https://github.com/GitSquared/node-geolite2-redist/raw/refs/heads/master/redist/GeoLite2-Country.tar.gz"); err != nil {
-		return fmt.Errorf("failed to download GeoLite2 Country database: %v", err)
-	}
-	if err := run("curl", "-L", "-o", "GeoLite2-ASN.tar.gz",
-		"https://github.com/GitSquared/node-geolite2-redist/raw/refs/heads/master/redist/GeoLite2-ASN.tar.gz"); err != nil {
-		return fmt.Errorf("failed to download GeoLite2 ASN database: %v", err)
-	}
-
-	// Extract the Country database
-	if err := run("tar", "-xzf", "GeoLite2-Country.tar.gz"); err != nil {
-		return fmt.Errorf("failed to extract GeoLite2 Country database: %v", err)
-	}
-	if err := run("tar", "-xzf", "GeoLite2-ASN.tar.gz"); err != nil {
-		return fmt.Errorf("failed to extract GeoLite2 ASN database: %v", err)
-	}
-
-	// Find the .mmdb file and move it to the config directory
-	if err := run("bash", "-c", "mv GeoLite2-Country_*/GeoLite2-Country.mmdb config/"); err != nil {
-		return fmt.Errorf("failed to move GeoLite2 Country database to config directory: %v", err)
-	}
-	if err := run("bash", "-c", "mv GeoLite2-ASN_*/GeoLite2-ASN.mmdb config/"); err != nil {
-		return fmt.Errorf("failed to move GeoLite2 ASN database to config directory: %v", err)
-	}
-
-	// Clean up the downloaded files
-	if err := run("sh", "-c", "rm -rf GeoLite2-Country.tar.gz GeoLite2-Country_*"); err != nil {
-		fmt.Printf("Warning: failed to clean up temporary country files: %v\n", err)
-	}
-	if err := run("sh", "-c", "rm -rf GeoLite2-ASN.tar.gz GeoLite2-ASN_*"); err != nil {
-		fmt.Printf("Warning: failed to clean up temporary ASN files: %v\n", err)
-	}
-
-	fmt.Println("MaxMind GeoLite2 Country and ASN database downloaded successfully!")
-	return nil
+	return hostOps.Run(cmd)
 }
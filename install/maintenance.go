@@ -0,0 +1,224 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+)
+
+// Maintenance mode routes the dashboard domain to a static page served by
+// the maintenance compose service while Pangolin is down. Traefik picks the
+// router up from its dynamic config without a restart, and Gerbil is left
+// running, so the tunnels and the resources behind them stay up.
+const (
+	maintenanceProfile = "maintenance"
+	maintenanceRouter  = "maintenance-router"
+	maintenanceService = "maintenance-service"
+	// maintenancePriority puts the router ahead of the dashboard routers,
+	// whose priority is the length of their rule
+	maintenancePriority = 10000
+)
+
+// maintenanceFiles are the templates the maintenance service mounts.
+var maintenanceFiles = []string{"config/maintenance/index.html", "config/maintenance/default.conf"}
+
+// runMaintenance turns maintenance mode on or off, or reports whether it is
+// on.
+func runMaintenance(args []string) error {
+	flags := flag.NewFlagSet("maintenance", flag.ExitOnError)
+	dir := flags.String("dir", "", "Installation directory")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: installer maintenance [on|off]")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() > 1 || (flags.NArg() == 1 && flags.Arg(0) != "on" && flags.Arg(0) != "off") {
+		flags.Usage()
+		return usageErrorf("expected on or off")
+	}
+	if err := enterInstallDir(*dir); err != nil {
+		return err
+	}
+
+	if flags.NArg() == 0 {
+		if maintenanceEnabled() {
+			fmt.Println("Maintenance mode is on.")
+		} else {
+			fmt.Println("Maintenance mode is off.")
+		}
+		return nil
+	}
+
+	containerType := detectContainerType()
+	if containerType == Undefined {
+		return preflightErrorf("could not detect the container runtime of the installation")
+	}
+	if flags.Arg(0) == "on" {
+		if err := enableMaintenance(containerType); err != nil {
+			return err
+		}
+		recordChange("Turn maintenance mode on")
+		fmt.Println("Maintenance mode is on: the dashboard shows the maintenance page, the tunnels stay up.")
+		return nil
+	}
+	if err := disableMaintenance(containerType); err != nil {
+		return err
+	}
+	recordChange("Turn maintenance mode off")
+	fmt.Println("Maintenance mode is off.")
+	return nil
+}
+
+// maintenanceEnabled reports whether Traefik routes the dashboard to the
+// maintenance page.
+func maintenanceEnabled() bool {
+	f, err := readYAMLFile(traefikDynamicFile)
+	if err != nil {
+		return false
+	}
+	http, _ := f.Doc["http"].(map[string]any)
+	routers, _ := http["routers"].(map[string]any)
+	_, ok := routers[maintenanceRouter]
+	return ok
+}
+
+// enableMaintenance starts the maintenance service, then routes the
+// dashboard domain to it. Installations from before maintenance mode get
+// the page and the service first.
+func enableMaintenance(containerType SupportedContainer) error {
+	config := existingConfig(containerType)
+	if config.DashboardDomain == "" {
+		return fmt.Errorf("could not determine the dashboard domain of the installation")
+	}
+	if err := addMaintenanceFiles(config); err != nil {
+		return err
+	}
+
+	if err := enableComposeProfile(composeFile, maintenanceProfile); err != nil {
+		return err
+	}
+	if err := composeCommand(containerType, "up", "-d", "maintenance"); err != nil {
+		return fmt.Errorf("failed to start the maintenance page: %v", err)
+	}
+
+	_, err := editYAMLFile(traefikDynamicFile, func(doc map[string]any) bool {
+		http := yamlSection(doc, "http")
+		routers := yamlSection(http, "routers")
+		services := yamlSection(http, "services")
+
+		// The page is served with the certificate the dashboard uses
+		var tls any = map[string]any{"certResolver": "letsencrypt"}
+		if next, ok := routers["next-router"].(map[string]any); ok && next["tls"] != nil {
+			tls = next["tls"]
+		}
+		routers[maintenanceRouter] = map[string]any{
+			"rule":        fmt.Sprintf("Host(`%s`)", config.DashboardDomain),
+			"priority":    maintenancePriority,
+			"service":     maintenanceService,
+			"entryPoints": []any{"websecure"},
+			"tls":         tls,
+		}
+		services[maintenanceService] = map[string]any{
+			"loadBalancer": map[string]any{
+				"servers": []any{map[string]any{"url": "http://maintenance:80"}},
+			},
+		}
+		return true
+	})
+	return err
+}
+
+// disableMaintenance routes the dashboard back to Pangolin, then removes
+// the maintenance service.
+func disableMaintenance(containerType SupportedContainer) error {
+	_, err := editYAMLFile(traefikDynamicFile, func(doc map[string]any) bool {
+		http, _ := doc["http"].(map[string]any)
+		routers, _ := http["routers"].(map[string]any)
+		services, _ := http["services"].(map[string]any)
+		_, routed := routers[maintenanceRouter]
+		_, served := services[maintenanceService]
+		delete(routers, maintenanceRouter)
+		delete(services, maintenanceService)
+		return routed || served
+	})
+	if err != nil {
+		return err
+	}
+
+	profiles := readComposeProfiles(composeFile)
+	if !slices.Contains(profiles, maintenanceProfile) {
+		return nil
+	}
+	// The container is looked up while the profile is still enabled
+	running, err := composeServices(composeFile)
+	if err != nil {
+		return err
+	}
+	profiles = slices.DeleteFunc(profiles, func(p string) bool { return p == maintenanceProfile })
+	if err := writeComposeProfiles(composeFile, profiles); err != nil {
+		return err
+	}
+	for _, service := range running {
+		if service.Name != "maintenance" {
+			continue
+		}
+		cmd := containerCommand(containerType, "rm", "--force", service.Container)
+		cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+		if err := runCommand(cmd); err != nil {
+			return fmt.Errorf("failed to remove the maintenance page container: %v", err)
+		}
+	}
+	return nil
+}
+
+// addMaintenanceFiles renders the maintenance page and adds the maintenance
+// service to the compose file where they are missing. Files that exist are
+// left alone, so an edited page is kept.
+func addMaintenanceFiles(config Config) error {
+	services, _ := profileServices(composeFile, maintenanceProfile)
+	var missing []string
+	for _, path := range maintenanceFiles {
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			missing = append(missing, path)
+		}
+	}
+	if len(services) > 0 && len(missing) == 0 {
+		return nil
+	}
+
+	rendered, err := renderScratchConfig(config)
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(rendered)
+
+	for _, path := range missing {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return err
+		}
+		if err := copyFile(filepath.Join(rendered, path), path); err != nil {
+			return fmt.Errorf("error adding %s: %v", path, err)
+		}
+	}
+	if len(services) == 0 {
+		if err := copyDockerService(filepath.Join(rendered, "config", composeFile), composeFile, "maintenance"); err != nil {
+			return fmt.Errorf("error adding the maintenance service: %v", err)
+		}
+	}
+	return nil
+}
+
+// yamlSection returns the mapping under key in doc, adding an empty one if
+// there is none.
+func yamlSection(doc map[string]any, key string) map[string]any {
+	section, ok := doc[key].(map[string]any)
+	if !ok {
+		section = map[string]any{}
+		doc[key] = section
+	}
+	return section
+}
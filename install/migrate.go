@@ -0,0 +1,323 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/fosrl/pangolin/install/pkg/installer"
+)
+
+// migrationManifest is stored as migration.yml in a migration bundle, next
+// to the files of the backup it was made from.
+type migrationManifest struct {
+	Created         time.Time          `yaml:"created"`
+	SourceHost      string             `yaml:"source_host"`
+	SourceAddresses []string           `yaml:"source_addresses"`
+	ContainerType   SupportedContainer `yaml:"container_type"`
+	DashboardDomain string             `yaml:"dashboard_domain"`
+	Backup          upgradeBackup      `yaml:"backup"`
+}
+
+const migrationManifestFile = "migration.yml"
+
+// hostBoundFiles are the files that may bind to addresses of the server.
+var hostBoundFiles = []string{composeFile, traefikStaticFile}
+
+// runMigrate moves an installation to another server: export bundles the
+// configuration, certificates, secrets and database, import restores them.
+func runMigrate(args []string) error {
+	usage := "usage: installer migrate export|import [flags]"
+	if len(args) == 0 {
+		return fmt.Errorf("%s", usage)
+	}
+	switch args[0] {
+	case "export":
+		return runMigrateExport(args[1:])
+	case "import":
+		return runMigrateImport(args[1:])
+	}
+	return fmt.Errorf("unknown migrate command %q\n%s", args[0], usage)
+}
+
+func runMigrateExport(args []string) error {
+	flags := flag.NewFlagSet("migrate export", flag.ExitOnError)
+	dir := flags.String("dir", "", "Installation directory")
+	out := flags.String("out", "", "Bundle to write (default: pangolin-migration-<time>.tar.gz in the current directory)")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if *out == "" {
+		*out = fmt.Sprintf("pangolin-migration-%s.tar.gz", time.Now().UTC().Format("20060102-150405"))
+	}
+	bundle, err := filepath.Abs(*out)
+	if err != nil {
+		return err
+	}
+
+	if err := enterInstallDir(*dir); err != nil {
+		return err
+	}
+	containerType := detectContainerType()
+	if containerType == Undefined {
+		return fmt.Errorf("unable to detect the container runtime of the installation")
+	}
+	versions, err := installedVersions()
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("\n=== Migration Export ===")
+	backup, err := createUpgradeBackup(containerType, "migrate", versions)
+	if err != nil {
+		return fmt.Errorf("backup failed: %w", err)
+	}
+
+	hostname, _ := os.Hostname()
+	manifest := migrationManifest{
+		Created:         backup.Created,
+		SourceHost:      hostname,
+		SourceAddresses: installer.LocalAddresses(),
+		ContainerType:   containerType,
+		DashboardDomain: existingConfig(containerType).DashboardDomain,
+		Backup:          *backup,
+	}
+	for _, ip := range installer.PublicAddresses() {
+		if !slices.Contains(manifest.SourceAddresses, ip) {
+			manifest.SourceAddresses = append(manifest.SourceAddresses, ip)
+		}
+	}
+	data, err := yaml.Marshal(manifest)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(backup.Dir, migrationManifestFile), data, 0600); err != nil {
+		return fmt.Errorf("failed to write %s: %v", migrationManifestFile, err)
+	}
+
+	if out, err := exec.Command("tar", "-czf", bundle, "-C", backup.Dir, ".").CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to write %s: %v: %s", bundle, err, strings.TrimSpace(string(out)))
+	}
+	if err := os.Chmod(bundle, 0600); err != nil {
+		return err
+	}
+
+	fmt.Printf("\nWrote %s\n", bundle)
+	fmt.Println("It holds the secrets, certificates and database of this installation: copy it over a secure channel, e.g.")
+	fmt.Printf("  scp %s root@new-server:\n", bundle)
+	fmt.Printf("and run on the new server:\n  ./installer migrate import --dir %s %s\n", defaultInstallDir, filepath.Base(bundle))
+	return nil
+}
+
+func runMigrateImport(args []string) error {
+	flags := flag.NewFlagSet("migrate import", flag.ExitOnError)
+	dir := flags.String("dir", defaultInstallDir, "Installation directory to restore into; must not hold an installation")
+	yes := flags.Bool("yes", false, "Do not ask for confirmation")
+	skipDNS := flags.Bool("skip-dns-check", false, "Start the stack even if DNS does not point to this server yet")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return fmt.Errorf("usage: installer migrate import [flags] <bundle>")
+	}
+
+	bundle, err := filepath.Abs(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	installDir, err := expandPath(*dir)
+	if err != nil {
+		return err
+	}
+	if hasExistingInstall(installDir) {
+		return fmt.Errorf("%s already holds an installation", installDir)
+	}
+	if err := os.MkdirAll(installDir, 0755); err != nil {
+		return err
+	}
+	if err := os.Chdir(installDir); err != nil {
+		return err
+	}
+
+	// Unpack into a backup directory, which also leaves the imported state
+	// available to rollback
+	staging := filepath.Join(backupsDir, "migrated-"+time.Now().UTC().Format("20060102-150405"))
+	if err := os.MkdirAll(staging, 0700); err != nil {
+		return err
+	}
+	if out, err := exec.Command("tar", "-xzf", bundle, "-C", staging).CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to unpack %s: %v: %s", bundle, err, strings.TrimSpace(string(out)))
+	}
+	data, err := os.ReadFile(filepath.Join(staging, migrationManifestFile))
+	if err != nil {
+		return fmt.Errorf("%s is not a migration bundle: %v", bundle, err)
+	}
+	var manifest migrationManifest
+	if err := yaml.Unmarshal(data, &manifest); err != nil {
+		return fmt.Errorf("invalid %s: %v", migrationManifestFile, err)
+	}
+	backup := manifest.Backup
+
+	fmt.Println("\n=== Migration Import ===")
+	fmt.Printf("Bundle from %s, created %s: Pangolin %s\n", manifest.SourceHost, manifest.Created.Local().Format("2006-01-02 15:04"), backup.Versions["pangolin"])
+	fmt.Printf("Restoring into %s\n", installDir)
+	if !*yes && !readBool(msg("promptProceedMigration"), true) {
+		return errAborted
+	}
+
+	fmt.Println("Restoring configuration...")
+	if err := copyFile(filepath.Join(staging, backup.Compose), composeFile); err != nil {
+		return fmt.Errorf("failed to restore %s: %v", composeFile, err)
+	}
+	for _, file := range backup.Files {
+		// The names come from the bundle, which must not write elsewhere
+		if !slices.Contains(installerFiles, file) {
+			continue
+		}
+		if err := copyFile(filepath.Join(staging, file), file); err != nil {
+			return fmt.Errorf("failed to restore %s: %v", file, err)
+		}
+	}
+	if out, err := exec.Command("tar", "-xzf", filepath.Join(staging, backup.Config)).CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to restore the config directory: %v: %s", err, strings.TrimSpace(string(out)))
+	}
+	if err := os.MkdirAll(filepath.Dir(sqliteDBFile), installer.DirModeFor(filepath.Dir(sqliteDBFile))); err != nil {
+		return err
+	}
+	secureInstallFiles()
+
+	if err := rebindAddresses(manifest.SourceAddresses, *yes); err != nil {
+		return err
+	}
+
+	containerType := manifest.ContainerType
+	if _, err := exec.LookPath(string(containerType)); err != nil {
+		containerType = podmanOrDocker()
+	}
+
+	if backup.Database != "" {
+		fmt.Println("Restoring the database...")
+		if err := restoreDatabase(containerType, filepath.Join(staging, backup.Database)); err != nil {
+			return fmt.Errorf("database restore failed: %w", err)
+		}
+	}
+
+	recordInstallDir(installDir)
+	recordChange(fmt.Sprintf("Import installation migrated from %s", manifest.SourceHost))
+
+	if !*skipDNS && !dnsPointsHere(manifest.DashboardDomain) {
+		if *yes || !readBool(msg("promptStartDespiteDNS"), false) {
+			fmt.Println("\nThe installation is restored but not started. Once DNS points to this server, start it with:")
+			fmt.Printf("  cd %s && %s\n", installDir, strings.Join(append(composeCommandLine(containerType), "up", "-d"), " "))
+			return withExitCode(exitPartial, fmt.Errorf("restored but not started: DNS does not point to this server yet"))
+		}
+	}
+
+	if err := pullContainers(containerType); err != nil {
+		return err
+	}
+	if err := startContainers(containerType); err != nil {
+		return err
+	}
+	if err := waitForServices(containerType); err != nil {
+		return fmt.Errorf("the migrated containers are not healthy: %v", err)
+	}
+	if err := waitForPangolinAPI(containerType); err != nil {
+		return fmt.Errorf("the migrated Pangolin is not ready: %v", err)
+	}
+
+	fmt.Printf("\nMigrated Pangolin from %s. Stop the stack on the old server so its sites reconnect here.\n", manifest.SourceHost)
+	return nil
+}
+
+// rebindAddresses replaces addresses of the old server that the compose file
+// or Traefik bind to, and which this server does not have.
+func rebindAddresses(oldAddresses []string, yes bool) error {
+	current := installer.LocalAddresses()
+	for _, file := range hostBoundFiles {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			continue
+		}
+		content := string(data)
+		for _, old := range oldAddresses {
+			if slices.Contains(current, old) || !strings.Contains(content, addressPrefix(old)) {
+				continue
+			}
+
+			replacement := ""
+			if len(current) > 0 {
+				replacement = current[0]
+			}
+			if !yes {
+				fmt.Printf("%s binds to %s, an address of the old server.\n", file, old)
+				replacement = readOptionalString(msg("promptReplacementAddress"), replacement, checkBindAddress)
+			}
+			if replacement == "" {
+				// An empty host binds to all addresses
+				content = strings.ReplaceAll(content, addressPrefix(old), "")
+			} else {
+				content = strings.ReplaceAll(content, addressPrefix(old), addressPrefix(replacement))
+			}
+			fmt.Printf("Updated %s: %s -> %s\n", file, old, orNone(replacement))
+		}
+		if content != string(data) {
+			if err := os.WriteFile(file, []byte(content), 0600); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// checkBindAddress accepts an IP address to bind to.
+func checkBindAddress(address string) error {
+	if net.ParseIP(address) == nil {
+		return errors.New(msg("replacementAddressInvalid"))
+	}
+	return nil
+}
+
+// addressPrefix is how an address is written in front of a port, e.g.
+// 192.0.2.1: or [2001:db8::1]:.
+func addressPrefix(ip string) string {
+	if strings.Contains(ip, ":") {
+		return "[" + ip + "]:"
+	}
+	return ip + ":"
+}
+
+// dnsPointsHere reports whether domain resolves to an address of this
+// server, printing what it found.
+func dnsPointsHere(domain string) bool {
+	if domain == "" {
+		return true
+	}
+	fmt.Printf("Checking that %s points to this server...\n", domain)
+
+	ours := append(installer.LocalAddresses(), installer.PublicAddresses()...)
+	resolved, err := net.LookupHost(domain)
+	if err != nil {
+		fmt.Printf("Could not resolve %s: %v\n", domain, err)
+		return false
+	}
+	for _, addr := range resolved {
+		if slices.Contains(ours, addr) {
+			fmt.Printf("%s resolves to %s.\n", domain, addr)
+			return true
+		}
+	}
+	fmt.Printf("%s resolves to %s, not to this server (%s). Update its DNS records, and those of the resources, before going live.\n",
+		domain, strings.Join(resolved, ", "), strings.Join(ours, ", "))
+	return false
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestUpgradeBackupKeepsInstallerFiles(t *testing.T) {
+	t.Chdir(t.TempDir())
+	if err := os.MkdirAll("config", 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range append([]string{composeFile, "config/config.yml"}, installerFiles...) {
+		if err := os.WriteFile(file, []byte(file+"\n"), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	backup, err := createUpgradeBackup(Docker, "migrate", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(backup.Files, installerFiles) {
+		t.Errorf("the backup lists %v, want %v", backup.Files, installerFiles)
+	}
+	for _, file := range installerFiles {
+		data, err := os.ReadFile(filepath.Join(backup.Dir, file))
+		if err != nil || string(data) != file+"\n" {
+			t.Errorf("the backup has no copy of %s: %v", file, err)
+		}
+	}
+}
+
+func TestRebindAddresses(t *testing.T) {
+	const old = "192.0.2.1"
+	for _, tt := range []struct {
+		name    string
+		answers []string
+		want    string
+	}{
+		{"all addresses", []string{clearAnswer}, "80:80"},
+		{"other address", []string{"198.51.100.7"}, "198.51.100.7:80:80"},
+		{"invalid address asked again", []string{"198.51.100", "198.51.100.7"}, "198.51.100.7:80:80"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Chdir(t.TempDir())
+			if err := os.WriteFile(composeFile, []byte("ports:\n  - "+old+":80:80\n"), 0600); err != nil {
+				t.Fatal(err)
+			}
+			answerPrompts(t, tt.answers...)
+
+			if err := rebindAddresses([]string{old}, false); err != nil {
+				t.Fatal(err)
+			}
+			data, err := os.ReadFile(composeFile)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := "ports:\n  - " + tt.want + "\n"; string(data) != want {
+				t.Errorf("%s = %q, want %q", composeFile, data, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/fosrl/pangolin/install/pkg/installer"
+)
+
+// configMigration is a single change to a generated config file introduced
+// by a Pangolin release. Migrations run in order during upgrade for every
+// release newer than the installed version and at most the target version.
+type configMigration struct {
+	// Version is the Pangolin release that requires the change.
+	Version     string
+	File        string
+	Description string
+	// Apply edits the parsed file in place and reports whether it changed
+	// anything. It must be safe to run on an already migrated file.
+	Apply func(doc map[string]any) bool
+}
+
+// configMigrations mirrors the config changes made by Pangolin's own setup
+// scripts (server/setup/scripts*), so configs are already in the expected
+// shape before the new containers start.
+var configMigrations = []configMigration{
+	{
+		Version:     "1.0.0",
+		File:        appConfigFile,
+		Description: "rename app.base_url to app.dashboard_url",
+		Apply: func(doc map[string]any) bool {
+			return moveKey(doc, []string{"app", "base_url"}, []string{"app", "dashboard_url"})
+		},
+	},
+	{
+		Version:     "1.0.0",
+		File:        appConfigFile,
+		Description: "remove server.resource_session_cookie_name in favor of server.session_cookie_name",
+		Apply: func(doc map[string]any) bool {
+			return deleteKey(doc, []string{"server", "resource_session_cookie_name"})
+		},
+	},
+	{
+		Version:     "1.0.0",
+		File:        appConfigFile,
+		Description: "remove server.secure_cookies",
+		Apply: func(doc map[string]any) bool {
+			return deleteKey(doc, []string{"server", "secure_cookies"})
+		},
+	},
+	{
+		Version:     "1.0.0",
+		File:        appConfigFile,
+		Description: "move app.base_domain and the traefik certificate settings to domains.domain1",
+		Apply: func(doc map[string]any) bool {
+			moved := moveKey(doc, []string{"app", "base_domain"}, []string{"domains", "domain1", "base_domain"})
+			if _, ok := lookup(doc, "domains", "domain1"); !ok {
+				return moved
+			}
+			if moveKey(doc, []string{"traefik", "cert_resolver"}, []string{"domains", "domain1", "cert_resolver"}) {
+				moved = true
+			}
+			if moveKey(doc, []string{"traefik", "prefer_wildcard_cert"}, []string{"domains", "domain1", "prefer_wildcard_cert"}) {
+				moved = true
+			}
+			return moved
+		},
+	},
+	{
+		Version:     "1.3.0",
+		File:        appConfigFile,
+		Description: "add a server secret",
+		Apply: func(doc map[string]any) bool {
+			return setDefault(doc, []string{"server", "secret"}, generateRandomSecretKey())
+		},
+	},
+	{
+		Version:     "1.5.0",
+		File:        appConfigFile,
+		Description: "rename server.cors.headers to server.cors.allowed_headers",
+		Apply: func(doc map[string]any) bool {
+			return moveKey(doc, []string{"server", "cors", "headers"}, []string{"server", "cors", "allowed_headers"})
+		},
+	},
+	{
+		Version:     "1.6.0",
+		File:        appConfigFile,
+		Description: "server.trust_proxy is now the number of trusted proxies",
+		Apply: func(doc map[string]any) bool {
+			if value, ok := lookup(doc, "server", "trust_proxy"); ok && value == true {
+				setKey(doc, []string{"server", "trust_proxy"}, 1)
+				return true
+			}
+			return false
+		},
+	},
+}
+
+// pendingMigrations returns the migrations needed to go from the installed
+// version to the target version.
+func pendingMigrations(installed, target string) []configMigration {
+	var pending []configMigration
+	for _, m := range configMigrations {
+		if installer.CompareVersions(m.Version, installed) > 0 && installer.CompareVersions(m.Version, target) <= 0 {
+			pending = append(pending, m)
+		}
+	}
+	return pending
+}
+
+// applyMigrations runs the given migrations against the installation in the
+// current directory, rewriting each file at most once.
+func applyMigrations(migrations []configMigration) error {
+	files := make(map[string]*yamlFile)
+	var order []string
+
+	for _, m := range migrations {
+		file, ok := files[m.File]
+		if !ok {
+			var err error
+			if file, err = readYAMLFile(m.File); err != nil {
+				return err
+			}
+			files[m.File] = file
+			order = append(order, m.File)
+		}
+
+		if m.Apply(file.Doc) {
+			fmt.Printf("  [%s] %s: %s\n", m.Version, m.File, m.Description)
+		}
+	}
+
+	for _, path := range order {
+		if _, err := files[path].save(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// moveKey moves the value at from to to, unless to is already set.
+func moveKey(doc map[string]any, from, to []string) bool {
+	value, ok := lookup(doc, from...)
+	if !ok {
+		return false
+	}
+	if _, exists := lookup(doc, to...); !exists {
+		setKey(doc, to, value)
+	}
+	return deleteKey(doc, from)
+}
+
+// setDefault sets the value at path if it is missing or empty.
+func setDefault(doc map[string]any, path []string, value any) bool {
+	if current, ok := lookup(doc, path...); ok && current != nil && current != "" {
+		return false
+	}
+	setKey(doc, path, value)
+	return true
+}
+
+// setKey sets the value at path, creating intermediate maps as needed.
+func setKey(doc map[string]any, path []string, value any) {
+	current := doc
+	for _, key := range path[:len(path)-1] {
+		next, ok := current[key].(map[string]any)
+		if !ok {
+			next = make(map[string]any)
+			current[key] = next
+		}
+		current = next
+	}
+	current[path[len(path)-1]] = value
+}
+
+func deleteKey(doc map[string]any, path []string) bool {
+	parent := doc
+	if len(path) > 1 {
+		value, ok := lookup(doc, path[:len(path)-1]...)
+		if !ok {
+			return false
+		}
+		if parent, ok = value.(map[string]any); !ok {
+			return false
+		}
+	}
+	key := path[len(path)-1]
+	if _, ok := parent[key]; !ok {
+		return false
+	}
+	delete(parent, key)
+	return true
+}
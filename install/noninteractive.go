@@ -0,0 +1,162 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/fosrl/pangolin/install/pkg/installer"
+)
+
+// Non-interactive install. With --non-interactive the answers come from the
+// file given with --answers and from the answer flags, one per answers file
+// key such as --base-domain, which override the file. The questions asked
+// after the answers take their default, except for starting the containers
+// and adding CrowdSec, which --start-containers and --install-crowdsec
+// answer, and for the confirmations of changes to the host outside the
+// installation directory, such as installing Docker or a systemd service,
+// which are declined. A question without a default stops the install, as
+// does a missing --dir outside an installation directory.
+var (
+	nonInteractive        bool
+	startContainersAnswer bool
+	installCrowdsecAnswer bool
+	// answeredConfig holds the answers of a non-interactive install.
+	answeredConfig Config
+)
+
+// answerFlags registers a flag for every answers file key on flags, named
+// after the key with dashes, e.g. --smtp-host for smtp_host. Keys that
+// already have a flag of that name, such as --rootless, are left to it. The
+// returned map holds the values given, by key.
+func answerFlags(flags *flag.FlagSet) map[string]any {
+	given := map[string]any{}
+	t := reflect.TypeFor[Config]()
+	for i := range t.NumField() {
+		field := t.Field(i)
+		key := field.Tag.Get("yaml")
+		name := strings.ReplaceAll(key, "_", "-")
+		if flags.Lookup(name) != nil {
+			continue
+		}
+		usage := fmt.Sprintf("Answer for %s with --non-interactive", key)
+		switch field.Type.Kind() {
+		case reflect.Bool:
+			flags.BoolFunc(name, usage, func(s string) error {
+				value, err := strconv.ParseBool(s)
+				given[key] = value
+				return err
+			})
+		case reflect.Int:
+			flags.Func(name, usage, func(s string) error {
+				value, err := strconv.Atoi(s)
+				given[key] = value
+				return err
+			})
+		case reflect.Slice:
+			flags.Func(name, usage+" (comma-separated)", func(s string) error {
+				given[key] = strings.Split(s, ",")
+				return nil
+			})
+		default:
+			flags.Func(name, usage, func(s string) error {
+				given[key] = s
+				return nil
+			})
+		}
+	}
+	return given
+}
+
+// nonInteractiveAnswers returns the answers of a non-interactive install
+// from the answers file at path, if any, and the answer flags given. It
+// fails listing the required keys that have no value.
+func nonInteractiveAnswers(path string, given map[string]any) (Config, error) {
+	config := installer.DefaultConfig()
+	loadVersions(&config)
+	if path != "" {
+		var err error
+		if config, err = loadAnswers(path); err != nil {
+			return Config{}, withExitCode(exitUsage, err)
+		}
+	}
+	fileBaseDomain := config.BaseDomain
+	if len(given) > 0 {
+		data, err := yaml.Marshal(given)
+		if err != nil {
+			return Config{}, err
+		}
+		if err := yaml.Unmarshal(data, &config); err != nil {
+			return Config{}, usageErrorf("invalid answer flag: %v", err)
+		}
+	}
+
+	// The dashboard domain defaults to one below the base domain, also when
+	// a flag overrides the base domain of the file
+	if _, ok := given["dashboard_domain"]; !ok && config.BaseDomain != "" &&
+		(config.DashboardDomain == "" || config.DashboardDomain == "pangolin."+fileBaseDomain) {
+		config.DashboardDomain = "pangolin." + config.BaseDomain
+	}
+	if config.IPv6Only {
+		config.EnableIPv6 = true
+	}
+	if devMode {
+		config.SelfSignedTLS = true
+	}
+	rootlessMode = rootlessMode || config.Rootless
+	config.Rootless = rootlessMode
+	if telemetryChoice != nil {
+		config.Telemetry = *telemetryChoice
+	}
+
+	if missing := installer.MissingAnswers(config); len(missing) > 0 {
+		return Config{}, usageErrorf("--non-interactive needs answers for: %s (set them in --answers or with the flags of the same name, e.g. --%s)",
+			strings.Join(missing, ", "), strings.ReplaceAll(missing[0], "_", "-"))
+	}
+	if config.InstallationContainerType != Docker && config.InstallationContainerType != Podman {
+		return Config{}, usageErrorf("invalid container_type %q: use docker or podman", config.InstallationContainerType)
+	}
+	if err := installer.Validate(config); err != nil {
+		return Config{}, withExitCode(exitUsage, localizeError(err))
+	}
+	if !installer.DashboardUnderBase(config.DashboardDomain, config.BaseDomain) {
+		fmt.Println(msg("warningDashboardOutsideBase", config.DashboardDomain, config.BaseDomain))
+	}
+	return config, nil
+}
+
+// answeredBool asks a yes/no question that a flag answers in a
+// non-interactive install.
+func answeredBool(answer bool, prompt string, defaultValue bool) bool {
+	if nonInteractive {
+		defaultAnswer(prompt, boolAnswer(answer))
+		return answer
+	}
+	return readBool(prompt, defaultValue)
+}
+
+// confirmHostChange asks before changing the host outside the installation
+// directory. A non-interactive install makes no such change unasked and
+// declines.
+func confirmHostChange(prompt string, defaultValue bool) bool {
+	if nonInteractive {
+		defaultAnswer(prompt, boolAnswer(false))
+		return false
+	}
+	return readBool(prompt, defaultValue)
+}
+
+// defaultAnswer prints the answer a question takes without being asked.
+func defaultAnswer(prompt, answer string) {
+	fmt.Printf("%s: %s\n", prompt, answer)
+}
+
+// unanswerable stops a non-interactive install at a question that has no
+// default.
+func unanswerable(prompt string) {
+	exitWithError(usageErrorf("%q has no default and cannot be answered with --non-interactive", prompt))
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/fosrl/pangolin/install/pkg/installer"
+)
+
+// TestDefaultConfigMatchesPrompts answers the interactive questions with
+// their defaults and checks that a non-interactive install with the same
+// required answers renders the same configuration files.
+func TestDefaultConfigMatchesPrompts(t *testing.T) {
+	t.Chdir(t.TempDir())
+	hostOps = &hostRecorder{}
+	offline := func() (string, error) { return "", errors.New("offline") }
+	publicIPv4, publicIPv6 = offline, offline
+	pangolinVersion, gerbilVersion, badgerVersion = "1.10.0", "1.2.0", "v1.2.0"
+	traefikVersion, crowdsecBouncerVersion = "v3.6", "v1.4.2"
+	t.Cleanup(func() {
+		hostOps = systemHost{}
+		publicIPv4, publicIPv6 = installer.PublicIPv4, installer.PublicIPv6
+		pangolinVersion, gerbilVersion, badgerVersion = "", "", ""
+		traefikVersion, crowdsecBouncerVersion = "", ""
+	})
+
+	// No enterprise edition, then the base domain and the Let's Encrypt
+	// email; every other question is answered with Enter
+	answerPrompts(t, append([]string{"n", "", "example.com", "", "admin@example.com"}, make([]string, 50)...)...)
+	interactive := collectUserInput()
+	loadVersions(&interactive)
+	answered, err := nonInteractiveAnswers("", map[string]any{"base_domain": "example.com", "letsencrypt_email": "admin@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rendered := map[string]map[string][]byte{}
+	for name, config := range map[string]Config{"interactive": interactive, "non-interactive": answered} {
+		config.InstallationContainerType = Docker
+		config.Secret = "0123456789abcdef0123456789abcdef"
+		if err := renderConfigFiles(config, name); err != nil {
+			t.Fatal(err)
+		}
+		rendered[name] = readTree(t, name)
+	}
+	for path, want := range rendered["interactive"] {
+		got, ok := rendered["non-interactive"][path]
+		switch {
+		case !ok:
+			t.Errorf("%s is only rendered by the interactive install", path)
+		case !bytes.Equal(got, want):
+			t.Errorf("%s differs:\ninteractive:\n%s\nnon-interactive:\n%s", path, want, got)
+		}
+	}
+	for path := range rendered["non-interactive"] {
+		if _, ok := rendered["interactive"][path]; !ok {
+			t.Errorf("%s is only rendered by the non-interactive install", path)
+		}
+	}
+}
+
+// readTree returns the files below root by their path relative to it.
+func readTree(t *testing.T, root string) map[string][]byte {
+	t.Helper()
+	files := map[string][]byte{}
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(root, path)
+		files[filepath.ToSlash(rel)] = data
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
+
+// TestNonInteractiveDeclinesHostChanges runs the steps that offer to
+// change the host outside the installation directory, which a
+// non-interactive install declines without reading an answer.
+func TestNonInteractiveDeclinesHostChanges(t *testing.T) {
+	recorder := &hostRecorder{}
+	hostOps, nonInteractive = recorder, true
+	t.Cleanup(func() { hostOps, nonInteractive = systemHost{}, false })
+	answerPrompts(t, "y", "y", "y")
+
+	state := &installState{InstallDir: t.TempDir(), StartContainers: true}
+	for _, step := range installSteps {
+		switch step.Name {
+		case "systemd service", "systemd user service", "rc.d service":
+			if err := step.Run(state); err != nil {
+				t.Errorf("%s: %v", step.Name, err)
+			}
+		}
+	}
+	if len(recorder.ops) > 0 {
+		t.Errorf("the declined steps changed the host:\n%s", planScript(recorder.ops))
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"syscall"
+
+	"github.com/fosrl/pangolin/install/pkg/installer"
+)
+
+// dataDirs are written to by the containers. Their contents are left alone
+// when fixing ownership so container-owned files keep their owner.
+var dataDirs = []string{
+	"config/db",
+	"config/letsencrypt",
+	"config/logs",
+	"config/traefik/logs",
+	"config/crowdsec/db",
+	"config/prometheus/data",
+	"postgres18",
+	"redis8",
+	"config/postgres18",
+	"config/redis8",
+	"scheduled-backups",
+	"exit-nodes",
+}
+
+// secureInstallFiles tightens the permissions of secret-bearing files and
+// private directories in the installation directory (the current working
+// directory), and hands generated files to the invoking user when running
+// under sudo in a directory that user owns.
+func secureInstallFiles() {
+	for _, file := range installer.SecretFiles {
+		if err := os.Chmod(file, 0600); err != nil && !os.IsNotExist(err) {
+			fmt.Printf("Warning: could not restrict permissions of %s: %v\n", file, err)
+		}
+	}
+	for _, dir := range installer.PrivateDirs {
+		if err := os.Chmod(dir, 0700); err != nil && !os.IsNotExist(err) {
+			fmt.Printf("Warning: could not restrict permissions of %s: %v\n", dir, err)
+		}
+	}
+
+	uid, gid, ok := sudoUserIDs()
+	if !ok || !ownedBy(".", uid) {
+		return
+	}
+	if err := chownGeneratedFiles(".", uid, gid); err != nil {
+		fmt.Printf("Warning: could not change ownership of generated files: %v\n", err)
+	}
+}
+
+// sudoUserIDs returns the uid and gid of the user that invoked the
+// installer through sudo.
+func sudoUserIDs() (int, int, bool) {
+	if os.Geteuid() != 0 || os.Getenv("SUDO_USER") == "" {
+		return 0, 0, false
+	}
+	uid, err := strconv.Atoi(os.Getenv("SUDO_UID"))
+	if err != nil {
+		return 0, 0, false
+	}
+	gid, err := strconv.Atoi(os.Getenv("SUDO_GID"))
+	if err != nil {
+		return 0, 0, false
+	}
+	return uid, gid, true
+}
+
+// chownGeneratedFiles changes the owner of everything the installer
+// generated under root, skipping the contents of container data directories.
+func chownGeneratedFiles(root string, uid, gid int) error {
+	return filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		if rel == ".git" {
+			return filepath.SkipDir
+		}
+
+		if err := os.Lchown(path, uid, gid); err != nil {
+			return err
+		}
+
+		if d.IsDir() && slices.Contains(dataDirs, filepath.ToSlash(rel)) {
+			return filepath.SkipDir
+		}
+		return nil
+	})
+}
+
+// ownedBy reports whether path is owned by the given uid.
+func ownedBy(path string, uid int) bool {
+	info, err := os.Stat(path)
+	if err != nil {
+		return false
+	}
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	return ok && int(stat.Uid) == uid
+}
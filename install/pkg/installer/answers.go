@@ -0,0 +1,111 @@
+package installer
+
+import (
+	"fmt"
+	"os"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Versions are the component versions an installation deploys when its
+// answers do not pin them; the installer binary passes the ones it was
+// built with.
+type Versions struct {
+	Pangolin        string
+	Gerbil          string
+	Badger          string
+	Traefik         string
+	CrowdsecBouncer string
+}
+
+// Apply sets the versions of config, overriding any it has.
+func (v Versions) Apply(config *Config) {
+	config.PangolinVersion = v.Pangolin
+	config.GerbilVersion = v.Gerbil
+	config.BadgerVersion = v.Badger
+	config.TraefikVersion = v.Traefik
+	config.CrowdsecBouncerVersion = v.CrowdsecBouncer
+}
+
+// LoadAnswers reads a YAML answers file into a Config. Keys match the yaml
+// tags on Config; anything left out falls back to the defaults of
+// DefaultConfig, and versions left out to defaults.
+func LoadAnswers(path string, defaults Versions) (Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Config{}, fmt.Errorf("error reading answers file: %w", err)
+	}
+
+	config := DefaultConfig()
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return Config{}, fmt.Errorf("error parsing answers file: %w", err)
+	}
+
+	if config.DashboardDomain == "" && config.BaseDomain != "" {
+		config.DashboardDomain = "pangolin." + config.BaseDomain
+	}
+	if config.IPv6Only {
+		config.EnableIPv6 = true
+	}
+
+	if config.PangolinVersion == "" {
+		config.PangolinVersion = defaults.Pangolin
+	}
+	if config.GerbilVersion == "" {
+		config.GerbilVersion = defaults.Gerbil
+	}
+	if config.BadgerVersion == "" {
+		config.BadgerVersion = defaults.Badger
+	}
+	if config.TraefikVersion == "" {
+		config.TraefikVersion = defaults.Traefik
+	}
+	if config.CrowdsecBouncerVersion == "" {
+		config.CrowdsecBouncerVersion = defaults.CrowdsecBouncer
+	}
+
+	return config, nil
+}
+
+// DefaultConfig returns a Config populated with the defaults offered by the
+// interactive prompts of the installer.
+func DefaultConfig() Config {
+	return Config{
+		InstallationContainerType: Docker,
+		EnableIPv6:                true,
+		EmailSMTPPort:             587,
+		InstallGerbil:             true,
+		HTTPPort:                  80,
+		HTTPSPort:                 443,
+		WireGuardPort:             DefaultWireGuardPort,
+		ClientsWireGuardPort:      DefaultClientsWireGuardPort,
+		AutoUpdateWindow:          DefaultUpdateWindow,
+		EnableMaxMind:             true,
+	}
+}
+
+// MissingAnswers returns the answer keys that are required but empty.
+func MissingAnswers(config Config) []string {
+	var missing []string
+
+	if config.BaseDomain == "" {
+		missing = append(missing, "base_domain")
+	}
+	if config.DashboardDomain == "" {
+		missing = append(missing, "dashboard_domain")
+	}
+	if config.LetsEncryptEmail == "" && !config.SelfSignedTLS {
+		missing = append(missing, "letsencrypt_email")
+	}
+	if config.EnableEmail && config.EmailNoReply == "" {
+		missing = append(missing, "no_reply")
+	}
+	if config.IsPostgreSQL && config.IsPostgreSQLPass == "" {
+		missing = append(missing, "postgresql_pass")
+	}
+	if config.IsRedis && config.IsRedisPass == "" {
+		missing = append(missing, "redis_pass")
+	}
+
+	return missing
+}
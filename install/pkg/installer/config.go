@@ -0,0 +1,211 @@
+package installer
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+)
+
+// Config holds the answers an installation is rendered from. The yaml tags
+// are the keys of an answers file.
+type Config struct {
+	InstallationContainerType SupportedContainer `yaml:"container_type"`
+	PangolinVersion           string             `yaml:"pangolin_version"`
+	TraefikVersion            string             `yaml:"traefik_version"`
+	GerbilVersion             string             `yaml:"gerbil_version"`
+	BadgerVersion             string             `yaml:"badger_version"`
+	CrowdsecBouncerVersion    string             `yaml:"crowdsec_bouncer_version"`
+	BadgerAPIBaseURL          string             `yaml:"badger_api_base_url"`
+	BadgerSessionCookie       string             `yaml:"badger_session_cookie"`
+	BadgerSessionParam        string             `yaml:"badger_session_param"`
+	BadgerTimeout             string             `yaml:"badger_timeout"`
+	BaseDomain                string             `yaml:"base_domain"`
+	DashboardDomain           string             `yaml:"dashboard_domain"`
+	EnableIPv6                bool               `yaml:"enable_ipv6"`
+	IPv6Only                  bool               `yaml:"ipv6_only"`
+	LetsEncryptEmail          string             `yaml:"letsencrypt_email"`
+	SelfSignedTLS             bool               `yaml:"self_signed_tls"`
+	Sandbox                   bool               `yaml:"sandbox"`
+	EnableEmail               bool               `yaml:"enable_email"`
+	EmailSMTPHost             string             `yaml:"smtp_host"`
+	EmailSMTPPort             int                `yaml:"smtp_port"`
+	EmailSMTPUser             string             `yaml:"smtp_user"`
+	EmailSMTPPass             string             `yaml:"smtp_pass"`
+	EmailNoReply              string             `yaml:"no_reply"`
+	InstallGerbil             bool               `yaml:"install_gerbil"`
+	TraefikBouncerKey         string             `yaml:"traefik_bouncer_key"`
+	DoCrowdsecInstall         bool               `yaml:"install_crowdsec"`
+	EnableMaxMind             bool               `yaml:"enable_maxmind"`
+	GeoblockMode              string             `yaml:"geoblock_mode"`
+	GeoblockCountries         []string           `yaml:"geoblock_countries"`
+	Secret                    string             `yaml:"secret"`
+	IsEnterprise              bool               `yaml:"enterprise"`
+	IsPostgreSQL              bool               `yaml:"postgresql"`
+	IsPostgreSQLPass          string             `yaml:"postgresql_pass"`
+	IsRedis                   bool               `yaml:"redis"`
+	IsRedisPass               string             `yaml:"redis_pass"`
+	PostgreSQLHost            string             `yaml:"postgresql_host"`
+	RedisHost                 string             `yaml:"redis_host"`
+	GerbilEndpoint            string             `yaml:"gerbil_endpoint"`
+	GerbilIPv4                string             `yaml:"gerbil_ipv4"`
+	GerbilIPv6                string             `yaml:"gerbil_ipv6"`
+	Rootless                  bool               `yaml:"rootless"`
+	LowMemory                 bool               `yaml:"low_memory"`
+	LogDriver                 string             `yaml:"log_driver"`
+	Encryption                string             `yaml:"encryption"`
+	HTTPPort                  int                `yaml:"http_port"`
+	HTTPSPort                 int                `yaml:"https_port"`
+	WireGuardPort             int                `yaml:"wireguard_port"`
+	ClientsWireGuardPort      int                `yaml:"clients_wireguard_port"`
+	AutoUpdate                string             `yaml:"auto_update"`
+	AutoUpdateWindow          string             `yaml:"auto_update_window"`
+	AutoUpdateNotifyURL       string             `yaml:"auto_update_notify_url"`
+	EnableMonitoring          bool               `yaml:"monitoring"`
+	AlertEmail                string             `yaml:"alert_email"`
+	AlertWebhookURL           string             `yaml:"alert_webhook_url"`
+	Telemetry                 bool               `yaml:"telemetry"`
+}
+
+// SupportedContainer is the container runtime the stack runs on.
+type SupportedContainer string
+
+const (
+	Docker    SupportedContainer = "docker"
+	Podman    SupportedContainer = "podman"
+	Undefined SupportedContainer = "undefined"
+)
+
+// Default UDP ports Gerbil accepts WireGuard connections on, from sites and
+// from clients respectively.
+const (
+	DefaultWireGuardPort        = 51820
+	DefaultClientsWireGuardPort = 21820
+)
+
+// Automatic update methods (Config.AutoUpdate).
+const (
+	// AutoUpdateTimer installs a systemd timer that downloads the latest
+	// installer and runs `installer upgrade --yes`, moving the stack to new
+	// Pangolin, Gerbil and Badger releases including config migrations.
+	AutoUpdateTimer = "timer"
+	// AutoUpdateWatchtower adds a Watchtower service scoped to the stack's
+	// containers by label. It only pulls rebuilt images for the pinned tags
+	// and never moves to a new release.
+	AutoUpdateWatchtower = "watchtower"
+)
+
+// DefaultUpdateWindow is the time of day automatic updates run at.
+const DefaultUpdateWindow = "04:00"
+
+// Modes of the geoblock middleware (Config.GeoblockMode): let only the
+// listed countries in, or keep them out.
+const (
+	GeoblockAllow = "allow"
+	GeoblockBlock = "block"
+)
+
+// Logging drivers the compose services can use instead of the runtime's
+// default of JSON files (Config.LogDriver).
+const (
+	LogDriverJournald = "journald"
+	LogDriverSyslog   = "syslog"
+)
+
+// GeoblockPluginVersion is the version of the geoblock Traefik plugin the
+// templates pin. Like the component versions it can be injected at build
+// time via -ldflags.
+var GeoblockPluginVersion = "v0.3.3"
+
+// ParseUpdateWindow parses an HH:MM time of day.
+func ParseUpdateWindow(window string) (time.Time, error) {
+	return time.Parse("15:04", window)
+}
+
+// WatchtowerSchedule returns the update window as a Watchtower cron
+// expression (with seconds).
+func (c Config) WatchtowerSchedule() string {
+	t, err := ParseUpdateWindow(c.AutoUpdateWindow)
+	if err != nil {
+		t, _ = ParseUpdateWindow(DefaultUpdateWindow)
+	}
+	return fmt.Sprintf("0 %d %d * * *", t.Minute(), t.Hour())
+}
+
+// GeoblockVersion returns the version of the geoblock plugin the templates
+// pin.
+func (c Config) GeoblockVersion() string {
+	return GeoblockPluginVersion
+}
+
+// GeoblockBlackList reports whether the listed countries are blocked rather
+// than the only ones allowed.
+func (c Config) GeoblockBlackList() bool {
+	return c.GeoblockMode == GeoblockBlock
+}
+
+// BundledPostgreSQL reports whether PostgreSQL runs as a service of the
+// stack rather than on an external host.
+func (c Config) BundledPostgreSQL() bool {
+	return c.IsPostgreSQL && c.PostgreSQLHost == ""
+}
+
+// BundledRedis reports whether Redis runs as a service of the stack rather
+// than on an external host.
+func (c Config) BundledRedis() bool {
+	return c.IsRedis && c.RedisHost == ""
+}
+
+// RedisHostname returns the host Pangolin connects to Redis on.
+func (c Config) RedisHostname() string {
+	host, _ := splitRedisHost(c.RedisHost)
+	return host
+}
+
+// RedisPort returns the port Pangolin connects to Redis on.
+func (c Config) RedisPort() int {
+	_, port := splitRedisHost(c.RedisHost)
+	return port
+}
+
+// splitRedisHost splits a redis_host answer, which may leave out the port.
+func splitRedisHost(hostPort string) (string, int) {
+	if hostPort == "" {
+		return "redis", 6379
+	}
+	host, p, err := net.SplitHostPort(hostPort)
+	if err != nil {
+		return hostPort, 6379
+	}
+	port, _ := strconv.Atoi(p)
+	return host, port
+}
+
+// PublishedPort returns the ports entry of a compose service that publishes
+// container on host. On an IPv6-only server it is bound to the IPv6
+// wildcard, so runtimes that bind IPv4 by default listen where the clients
+// are.
+func (c Config) PublishedPort(host int, container string) string {
+	if c.IPv6Only {
+		return strconv.Quote("[::]:" + strconv.Itoa(host) + ":" + container)
+	}
+	return strconv.Itoa(host) + ":" + container
+}
+
+// DashboardOnApex reports whether the dashboard is served on the base domain
+// itself rather than on a subdomain of it.
+func (c Config) DashboardOnApex() bool {
+	return c.BaseDomain != "" && SameDomain(c.DashboardDomain, c.BaseDomain)
+}
+
+// GerbilBaseEndpoint returns the address sites connect to Gerbil on, with
+// an IPv6 address in brackets as Pangolin appends the port.
+func (c Config) GerbilBaseEndpoint() string {
+	if c.GerbilEndpoint == "" {
+		return c.DashboardDomain
+	}
+	if ip := net.ParseIP(c.GerbilEndpoint); ip != nil && ip.To4() == nil {
+		return "[" + c.GerbilEndpoint + "]"
+	}
+	return c.GerbilEndpoint
+}
@@ -0,0 +1,84 @@
+package installer
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+	"time"
+)
+
+// DNSRecord is a record an installation needs, such as the A record of
+// the dashboard domain.
+type DNSRecord struct {
+	Name  string
+	Type  string
+	Value string
+}
+
+// DNSRecordsTo returns the records pointing the dashboard domain and the
+// wildcard of the base domain at ips.
+func DNSRecordsTo(config Config, ips []string) []DNSRecord {
+	var records []DNSRecord
+	names := slices.Compact([]string{config.DashboardDomain, "*." + config.BaseDomain})
+	for _, name := range slices.DeleteFunc(names, func(name string) bool { return name == "" }) {
+		for _, ip := range ips {
+			recordType := "A"
+			if strings.Contains(ip, ":") {
+				recordType = "AAAA"
+			}
+			records = append(records, DNSRecord{Name: name, Type: recordType, Value: ip})
+		}
+	}
+	return records
+}
+
+// PublicResolvers answer the propagation check; the system resolver may
+// still have cached the name as missing. Each is reached over IPv6 where the
+// server has no IPv4 route.
+var PublicResolvers = []struct{ IPv4, IPv6 string }{
+	{"1.1.1.1:53", "[2606:4700:4700::1111]:53"},
+	{"8.8.8.8:53", "[2001:4860:4860::8888]:53"},
+}
+
+// DNSRecordsPropagated reports whether every public resolver returns the
+// value of every record.
+func DNSRecordsPropagated(records []DNSRecord) bool {
+	for _, r := range records {
+		if DNSRecordProblem(r) != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// DNSRecordProblem describes why a public resolver does not return the value
+// of r yet, or returns an empty string once all of them do. The wildcard is
+// checked through a name below it.
+func DNSRecordProblem(r DNSRecord) string {
+	name := strings.Replace(r.Name, "*", "pangolin-dns-check", 1)
+	for _, server := range PublicResolvers {
+		resolver := &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+				var d net.Dialer
+				conn, err := d.DialContext(ctx, network, server.IPv4)
+				if err != nil {
+					return d.DialContext(ctx, network, server.IPv6)
+				}
+				return conn, nil
+			},
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		addrs, err := resolver.LookupHost(ctx, name)
+		cancel()
+		if err != nil {
+			return fmt.Sprintf("not found at %s", strings.TrimSuffix(server.IPv4, ":53"))
+		}
+		if !slices.Contains(addrs, r.Value) {
+			return fmt.Sprintf("resolves to %s at %s", strings.Join(addrs, ", "), strings.TrimSuffix(server.IPv4, ":53"))
+		}
+	}
+	return ""
+}
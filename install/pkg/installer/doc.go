@@ -0,0 +1,41 @@
+// Package installer holds the parts of the Pangolin installer that do not
+// need a terminal: reading and validating answers, rendering the
+// configuration of a stack and checking a host before it is installed on.
+// Hosting providers and internal tooling can embed it to provision Pangolin
+// without running the interactive binary:
+//
+//	import "github.com/fosrl/pangolin/install/pkg/installer"
+//
+// The package generates an installation but does not run one. The install
+// and upgrade flows are deliberately not part of it: they install Docker,
+// start and wait for the containers, register CrowdSec, back up and migrate
+// databases and roll back on failure, and they ask the user whenever one of
+// those steps needs a decision. They stay in the installer binary, which
+// embedders run without a terminal on the directory they rendered:
+//
+//	installer --non-interactive --answers answers.yml --dir /opt/pangolin --start-containers
+//	installer upgrade --yes --dir /opt/pangolin
+//
+// The binary exits with a code per class of failure, listed by
+// installer --help, and appends the outcome of every install step to
+// pangolin-install.log in the installation directory.
+//
+// A Config goes in and events come out:
+//
+//	config, err := installer.LoadAnswers("answers.yml", installer.Versions{Pangolin: "1.12.0"})
+//	if err != nil {
+//		return err
+//	}
+//	if err := installer.Validate(config); err != nil {
+//		return err
+//	}
+//	report := installer.Preflight(config, func(e installer.Event) {
+//		log.Printf("%s: %s %s", e.Section, e.Status, e.Message)
+//	})
+//	if report.Count(installer.StatusFail) == 0 {
+//		err = installer.Render(config, "/opt/pangolin", installer.RenderOptions{})
+//	}
+//
+// Functions of the package do not prompt and do not print; what they find
+// is returned or reported through an EventHandler.
+package installer
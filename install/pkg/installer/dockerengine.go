@@ -0,0 +1,96 @@
+package installer
+
+import (
+	"cmp"
+	"net"
+	"net/url"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// InstallerContainerEnv is set in the installer image (see Dockerfile). The
+// installer then runs in a container and drives the Docker engine of the
+// host through its mounted socket: nothing on the host but the containers
+// and the mounted directories can be changed from there, so the packages,
+// systemd units and sysctl settings of the host setup are left alone.
+const InstallerContainerEnv = "PANGOLIN_INSTALLER_CONTAINER"
+
+// InInstallerContainer reports whether this runs in the installer image.
+func InInstallerContainer() bool { return os.Getenv(InstallerContainerEnv) != "" }
+
+// DockerEngine is the engine the docker CLI talks to, when it is not a
+// native engine on this host: Docker Desktop, Colima, OrbStack and Rancher
+// Desktop run the containers in a virtual machine, and a DOCKER_HOST or
+// context may point at another host altogether. The host setup of the
+// installer (docker group, systemd units, firewall rules) does not apply to
+// either.
+type DockerEngine struct {
+	Name string
+	Host string
+	// VM is set for engines that run the containers in a virtual machine on
+	// this host, Remote for engines on another host.
+	VM     bool
+	Remote bool
+	// Container is set when the installer runs in its container image and
+	// reaches the engine of the host through the mounted socket.
+	Container bool
+}
+
+// Native reports whether the containers run on a native engine on this
+// host, which the host setup steps need.
+func (e DockerEngine) Native() bool { return !e.VM && !e.Remote && !e.Container }
+
+// DetectDockerEngine finds out what kind of engine the docker CLI uses. An
+// engine that cannot be asked is assumed to be native.
+func DetectDockerEngine() DockerEngine {
+	if InInstallerContainer() {
+		return DockerEngine{Name: "the Docker engine of the host", Host: cmp.Or(os.Getenv("DOCKER_HOST"), "/var/run/docker.sock"), Container: true}
+	}
+	host := os.Getenv("DOCKER_HOST")
+	if host == "" {
+		if out, err := exec.Command("docker", "context", "inspect", "--format", "{{.Endpoints.docker.Host}}").Output(); err == nil {
+			host = strings.TrimSpace(string(out))
+		}
+	}
+	if isRemoteDockerHost(host) {
+		return DockerEngine{Name: "a remote Docker engine", Host: host, Remote: true}
+	}
+
+	out, err := exec.Command("docker", "info", "--format", "{{.OperatingSystem}}\t{{.Name}}").Output()
+	if err != nil {
+		return DockerEngine{}
+	}
+	operatingSystem, name, _ := strings.Cut(strings.TrimSpace(string(out)), "\t")
+	engine := DockerEngine{Host: host, VM: true}
+	switch {
+	case strings.Contains(operatingSystem, "Docker Desktop"):
+		engine.Name = "Docker Desktop"
+	case strings.HasPrefix(name, "colima"):
+		engine.Name = "Colima"
+	case strings.Contains(operatingSystem, "OrbStack") || name == "orbstack":
+		engine.Name = "OrbStack"
+	case strings.Contains(name, "rancher-desktop"):
+		engine.Name = "Rancher Desktop"
+	default:
+		return DockerEngine{}
+	}
+	return engine
+}
+
+// isRemoteDockerHost reports whether a DOCKER_HOST value points at another
+// host. Sockets are local, even when they lead into a VM.
+func isRemoteDockerHost(host string) bool {
+	u, err := url.Parse(host)
+	if err != nil {
+		return false
+	}
+	switch u.Scheme {
+	case "ssh":
+		return true
+	case "tcp", "http", "https":
+		ip := net.ParseIP(u.Hostname())
+		return u.Hostname() != "localhost" && (ip == nil || !ip.IsLoopback())
+	}
+	return false
+}
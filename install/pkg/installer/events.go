@@ -0,0 +1,41 @@
+package installer
+
+// EventKind says what an Event reports.
+type EventKind string
+
+const (
+	// EventFileWritten is sent by Render for every file it writes
+	EventFileWritten EventKind = "file-written"
+	// EventCheck is sent by Preflight for every check it runs
+	EventCheck EventKind = "check"
+)
+
+// Status is the outcome of a preflight check.
+type Status string
+
+const (
+	StatusPass Status = "pass"
+	// StatusWarn is for things the installer works around or asks about
+	StatusWarn Status = "warn"
+	StatusFail Status = "fail"
+)
+
+// Event reports the progress of Render and Preflight.
+type Event struct {
+	Kind EventKind
+	// Section, Status and Message describe a check
+	Section string
+	Status  Status
+	Message string
+	// Path is the file written
+	Path string
+}
+
+// EventHandler receives events as they happen. A nil handler drops them.
+type EventHandler func(Event)
+
+func (h EventHandler) emit(e Event) {
+	if h != nil {
+		h(e)
+	}
+}
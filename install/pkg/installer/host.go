@@ -0,0 +1,159 @@
+package installer
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"os/user"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// LowMemoryThreshold is the memory below which the stack runs with the
+// low-memory settings. A 2 GB server reports somewhat less than 2 GiB, as
+// the kernel reserves part of it.
+const LowMemoryThreshold = 1900 << 20
+
+// ReadMemInfo returns the total memory and swap in bytes from /proc/meminfo.
+func ReadMemInfo() (memory, swap uint64, err error) {
+	f, err := os.Open("/proc/meminfo")
+	if err != nil {
+		return 0, 0, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		kb, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			continue
+		}
+		switch fields[0] {
+		case "MemTotal:":
+			memory = kb << 10
+		case "SwapTotal:":
+			swap = kb << 10
+		}
+	}
+	if memory == 0 {
+		return 0, 0, fmt.Errorf("no MemTotal in /proc/meminfo")
+	}
+	return memory, swap, scanner.Err()
+}
+
+// FreeDiskSpace returns the space available on the file system of path, as
+// df reports it.
+func FreeDiskSpace(path string) (int64, error) {
+	out, err := exec.Command("df", "-Pk", path).Output()
+	if err != nil {
+		return 0, err
+	}
+	lines := strings.Split(strings.TrimSpace(string(out)), "\n")
+	fields := strings.Fields(lines[len(lines)-1])
+	if len(fields) < 4 {
+		return 0, fmt.Errorf("unexpected df output %q", lines[len(lines)-1])
+	}
+	kilobytes, err := strconv.ParseInt(fields[3], 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("unexpected df output %q", lines[len(lines)-1])
+	}
+	return kilobytes << 10, nil
+}
+
+// FormatBytes formats a size with a binary unit.
+func FormatBytes(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(size)/float64(div), "KMGTPE"[exp])
+}
+
+// CheckPortAvailable returns an error if the TCP port cannot be bound,
+// usually because another service listens on it.
+func CheckPortAvailable(port int) error {
+	ln, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
+	if err != nil {
+		return fmt.Errorf("ERROR: port %d is occupied or cannot be bound: %w", port, err)
+	}
+	ln.Close()
+	return nil
+}
+
+// UDPPortFree reports whether the UDP port can be bound.
+func UDPPortFree(port int) bool {
+	conn, err := net.ListenPacket("udp", fmt.Sprintf(":%d", port))
+	if err != nil {
+		return false
+	}
+	conn.Close()
+	return true
+}
+
+// WireGuardInterfaceOn returns the WireGuard interface listening on port.
+// Listing listen ports needs wg and usually root; without them it returns an
+// empty string.
+func WireGuardInterfaceOn(port int) string {
+	out, err := exec.Command("wg", "show", "all", "listen-port").Output()
+	if err != nil {
+		return ""
+	}
+	for _, line := range strings.Split(string(out), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 2 && fields[1] == strconv.Itoa(port) {
+			return fields[0]
+		}
+	}
+	return ""
+}
+
+// CommandInstalled reports whether the command, such as docker or
+// podman-compose, is installed and runs.
+func CommandInstalled(command string) bool {
+	cmd := exec.Command(command, "--version")
+	if err := cmd.Run(); err != nil {
+		return false
+	}
+	return true
+}
+
+// InDockerGroup reports whether the current user can run Docker commands
+// without sudo: as root, on macOS or as a member of the docker group.
+func InDockerGroup() bool {
+	if runtime.GOOS == "darwin" {
+		// Docker group is not applicable on macOS
+		// So we assume that the user can run Docker commands
+		return true
+	}
+
+	if os.Geteuid() == 0 {
+		return true // Root user can run Docker commands anyway
+	}
+
+	currentUser, err := user.Current()
+	return err == nil && UserInDockerGroup(currentUser)
+}
+
+// UserInDockerGroup reports whether u is a member of the docker group. If
+// any of the checks fail, we assume the user cannot run Docker commands.
+func UserInDockerGroup(u *user.User) bool {
+	dockerGroup, err := user.LookupGroup("docker")
+	if err != nil {
+		return false
+	}
+	groupIds, err := u.GroupIds()
+	return err == nil && slices.Contains(groupIds, dockerGroup.Gid)
+}
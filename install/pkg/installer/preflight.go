@@ -0,0 +1,282 @@
+package installer
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// Oldest container engines the stack is known to work with: compose files
+// with healthcheck conditions and the host-gateway alias need them.
+const (
+	MinDockerVersion = "20.10.0"
+	MinPodmanVersion = "4.0.0"
+)
+
+// MinFreeDisk is the free space the images, the database and the logs of a
+// small installation need for its first months.
+const MinFreeDisk = 5 << 30
+
+// preflightEndpoints are the services the install downloads from; each has
+// to answer over HTTPS, with any status.
+var preflightEndpoints = []struct{ Name, URL string }{
+	{"Docker Hub", "https://registry-1.docker.io/v2/"},
+	{"GitHub", "https://api.github.com/"},
+	{"Let's Encrypt", "https://acme-v02.api.letsencrypt.org/directory"},
+}
+
+// Check is the result of one preflight check.
+type Check struct {
+	Section string
+	Status  Status
+	Message string
+}
+
+// PreflightReport holds the results of Preflight in the order the checks
+// ran.
+type PreflightReport struct {
+	Checks []Check
+}
+
+// Count returns the number of checks with status.
+func (r PreflightReport) Count(status Status) int {
+	n := 0
+	for _, check := range r.Checks {
+		if check.Status == status {
+			n++
+		}
+	}
+	return n
+}
+
+// preflight collects the checks of one section and sends them as events.
+type preflight struct {
+	report  *PreflightReport
+	events  EventHandler
+	section string
+}
+
+func (p *preflight) add(status Status, format string, args ...any) {
+	check := Check{Section: p.section, Status: status, Message: fmt.Sprintf(format, args...)}
+	p.report.Checks = append(p.report.Checks, check)
+	p.events.emit(Event{Kind: EventCheck, Section: check.Section, Status: check.Status, Message: check.Message})
+}
+
+func (p *preflight) pass(format string, args ...any) { p.add(StatusPass, format, args...) }
+func (p *preflight) warn(format string, args ...any) { p.add(StatusWarn, format, args...) }
+func (p *preflight) fail(format string, args ...any) { p.add(StatusFail, format, args...) }
+
+// Preflight runs the environment checks of the install on this host without
+// changing anything, so a server can be validated before it is committed
+// to: the system, the ports, the container runtime of config, the
+// connectivity and the DNS records of its domains. Each check is sent to
+// events as it completes.
+func Preflight(config Config, events EventHandler) PreflightReport {
+	report := PreflightReport{}
+	p := &preflight{report: &report, events: events}
+
+	p.section = "System"
+	p.system()
+	p.section = "Ports"
+	p.ports(config)
+	p.section = "Container runtime"
+	p.runtime(config.InstallationContainerType)
+	p.section = "Connectivity"
+	ips := p.connectivity(config)
+	p.section = "DNS"
+	p.dns(config, ips)
+	return report
+}
+
+// system checks the operating system, the memory and the free disk space.
+func (p *preflight) system() {
+	switch runtime.GOOS {
+	case "linux", "freebsd":
+		p.pass("%s on %s", runtime.GOOS, runtime.GOARCH)
+	default:
+		p.warn("%s is not supported for production installs, only with --dev", runtime.GOOS)
+	}
+	if runtime.GOARCH != "amd64" && runtime.GOARCH != "arm64" {
+		p.fail("no images are published for %s", runtime.GOARCH)
+	}
+
+	if runtime.GOOS == "linux" {
+		memory, swap, err := ReadMemInfo()
+		switch {
+		case err != nil:
+			p.warn("could not read the memory size: %v", err)
+		case memory < LowMemoryThreshold && swap == 0:
+			p.warn("%d MiB of memory and no swap: the install uses the low-memory settings and offers a swapfile", memory>>20)
+		case memory < LowMemoryThreshold:
+			p.warn("%d MiB of memory: the install uses the low-memory settings", memory>>20)
+		default:
+			p.pass("%d MiB of memory", memory>>20)
+		}
+	}
+	p.pass("%d CPU(s)", runtime.NumCPU())
+
+	if free, err := FreeDiskSpace("."); err != nil {
+		p.warn("could not read the free disk space: %v", err)
+	} else if free < MinFreeDisk {
+		p.fail("%s free on the disk, %s needed", FormatBytes(free), FormatBytes(MinFreeDisk))
+	} else {
+		p.pass("%s free on the disk", FormatBytes(free))
+	}
+}
+
+// ports checks that the TCP ports of Traefik and the UDP ports of Gerbil
+// are free.
+func (p *preflight) ports(config Config) {
+	for _, port := range []int{config.HTTPPort, config.HTTPSPort} {
+		if err := CheckPortAvailable(port); err == nil {
+			p.pass("TCP port %d is free", port)
+		} else if server := DetectWebServer([]int{port}); server != nil {
+			p.warn("TCP port %d is held by %s: the install offers to stop it or to run behind it", port, server.Name)
+		} else {
+			p.fail("TCP port %d is in use", port)
+		}
+	}
+	if !config.InstallGerbil {
+		return
+	}
+	for _, port := range []int{config.WireGuardPort, config.ClientsWireGuardPort} {
+		switch iface := WireGuardInterfaceOn(port); {
+		case UDPPortFree(port):
+			p.pass("UDP port %d is free", port)
+		case iface != "":
+			p.warn("UDP port %d is used by the WireGuard interface %s: the install asks for another one", port, iface)
+		default:
+			p.warn("UDP port %d is used by another service: the install asks for another one", port)
+		}
+	}
+}
+
+// runtime checks that the container runtime is installed, recent enough
+// and, for Docker, reachable and runs on this host.
+func (p *preflight) runtime(containerType SupportedContainer) {
+	if !CommandInstalled(string(containerType)) {
+		if containerType == Docker && runtime.GOOS == "linux" {
+			p.warn("Docker is not installed: the install offers to install it")
+		} else {
+			p.fail("%s is not installed", containerType)
+		}
+		return
+	}
+
+	minVersion, format := MinDockerVersion, "{{.Server.Version}}"
+	if containerType == Podman {
+		minVersion, format = MinPodmanVersion, "{{.Client.Version}}"
+	}
+	out, err := exec.Command(string(containerType), "version", "--format", format).Output()
+	version := strings.TrimSpace(string(out))
+	switch {
+	case err != nil && containerType == Docker && !InDockerGroup():
+		p.warn("cannot reach the Docker engine: you are not in the docker group, the install offers to add you")
+	case err != nil:
+		p.fail("cannot reach the %s engine: %v", containerType, err)
+	case CompareVersions(version, minVersion) < 0:
+		p.fail("%s %s is older than %s", containerType, version, minVersion)
+	default:
+		p.pass("%s %s", containerType, version)
+	}
+
+	if containerType == Docker {
+		if exec.Command("docker", "compose", "version").Run() == nil || exec.Command("docker-compose", "version").Run() == nil {
+			p.pass("Docker Compose is available")
+		} else {
+			p.fail("neither docker compose nor docker-compose is available")
+		}
+		if engine := DetectDockerEngine(); !engine.Native() {
+			p.warn("the containers run in %s: the host setup steps are skipped", engine.Name)
+		}
+	} else if !CommandInstalled("podman-compose") {
+		p.fail("podman-compose is not installed")
+	}
+}
+
+// connectivity detects the public addresses of the host and checks that
+// the services the install downloads from answer. It returns the detected
+// addresses.
+func (p *preflight) connectivity(config Config) []string {
+	var ips []string
+	if ip, err := PublicIPv4(); err == nil {
+		p.pass("public IPv4 address %s", ip)
+		ips = append(ips, ip)
+	} else {
+		p.warn("%v", err)
+	}
+	if ip, err := PublicIPv6(); err == nil {
+		p.pass("public IPv6 address %s", ip)
+		ips = append(ips, ip)
+	} else if config.EnableIPv6 || config.IPv6Only {
+		p.warn("%v", err)
+	}
+	if len(ips) == 0 {
+		p.fail("no public address: the server cannot be reached from the internet")
+	}
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	for _, endpoint := range preflightEndpoints {
+		resp, err := client.Head(endpoint.URL)
+		if err != nil {
+			p.fail("cannot reach %s: %v", endpoint.Name, err)
+			continue
+		}
+		resp.Body.Close()
+		p.pass("%s answers", endpoint.Name)
+	}
+
+	// WireGuard and the DNS checks need UDP out; a firewall that drops it
+	// usually drops the tunnels too
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	resolver := &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			conn, err := d.DialContext(ctx, "udp", PublicResolvers[0].IPv4)
+			if err != nil {
+				return d.DialContext(ctx, "udp", PublicResolvers[0].IPv6)
+			}
+			return conn, nil
+		},
+	}
+	if _, err := resolver.LookupHost(ctx, "github.com"); err != nil {
+		p.fail("outbound UDP is blocked: %v", err)
+	} else {
+		p.pass("outbound UDP works")
+	}
+	return ips
+}
+
+// dns checks that the records of the dashboard domain and of the resource
+// wildcard point at the public addresses of this host. Missing records are
+// a warning, as the install can create them.
+func (p *preflight) dns(config Config, ips []string) {
+	if config.DashboardDomain == "" && config.BaseDomain == "" {
+		p.warn("no domain given: pass --domain and --base-domain or --answers to check the DNS records")
+		return
+	}
+	if len(ips) == 0 {
+		p.warn("no public address to compare the DNS records with")
+		return
+	}
+	for _, record := range DNSRecordsTo(config, ips) {
+		if record.Name == "*." {
+			continue
+		}
+		switch problem := DNSRecordProblem(record); {
+		case problem == "":
+			p.pass("%s %s points at %s", record.Name, record.Type, record.Value)
+		case strings.HasPrefix(problem, "not found"):
+			p.warn("%s %s is %s: create it before the certificates are requested", record.Name, record.Type, problem)
+		default:
+			p.fail("%s %s %s instead of %s", record.Name, record.Type, problem, record.Value)
+		}
+	}
+}
@@ -0,0 +1,302 @@
+package installer
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"maps"
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+// IPFamily is the address family a public address is detected for.
+type IPFamily int
+
+const (
+	IPv4 IPFamily = 4
+	IPv6 IPFamily = 6
+)
+
+func (f IPFamily) String() string { return fmt.Sprintf("IPv%d", int(f)) }
+
+// Network returns the name of proto ("tcp", "udp" or "ip") restricted to the
+// family, such as tcp4.
+func (f IPFamily) Network(proto string) string { return fmt.Sprintf("%s%d", proto, int(f)) }
+
+// Matches reports whether ip is of the family.
+func (f IPFamily) Matches(ip net.IP) bool { return (ip.To4() != nil) == (f == IPv4) }
+
+// publicIPTimeout bounds the detection as a whole; the sources are queried
+// at the same time.
+const publicIPTimeout = 5 * time.Second
+
+// publicIPSource is a way to learn the address this server reaches the
+// internet from.
+type publicIPSource struct {
+	Name string
+	// Optional sources only answer in some environments, such as the
+	// metadata services of cloud providers; their failures are not reported.
+	Optional bool
+	Lookup   func(ctx context.Context, family IPFamily) (net.IP, error)
+}
+
+var publicIPSources = []publicIPSource{
+	{Name: "ipify", Lookup: httpIPSource("https://api64.ipify.org", nil)},
+	{Name: "icanhazip", Lookup: httpIPSource("https://icanhazip.com", nil)},
+	{Name: "ifconfig.co", Lookup: httpIPSource("https://ifconfig.co/ip", nil)},
+	{Name: "OpenDNS", Lookup: openDNSIP},
+	{Name: "Google DNS", Lookup: googleDNSIP},
+	{Name: "cloud metadata", Optional: true, Lookup: cloudMetadataIP},
+}
+
+// PublicIPv4 returns the IPv4 address this server reaches the internet
+// from.
+func PublicIPv4() (string, error) {
+	return detectPublicIP(IPv4)
+}
+
+// PublicIPv6 returns the IPv6 address this server reaches the internet
+// from, which may differ from the addresses of its interfaces behind NAT66
+// or with temporary addresses.
+func PublicIPv6() (string, error) {
+	return detectPublicIP(IPv6)
+}
+
+// PublicAddresses returns the public IPv4 and IPv6 addresses of this server
+// that could be detected.
+func PublicAddresses() []string {
+	var addresses []string
+	for _, detect := range []func() (string, error){PublicIPv4, PublicIPv6} {
+		if ip, err := detect(); err == nil {
+			addresses = append(addresses, ip)
+		}
+	}
+	return addresses
+}
+
+// detectPublicIP asks every source at once and returns the address most of
+// the answers agree on. Sources that disagree without a majority, as behind
+// load-balanced NAT, are an error: the caller cannot know which address the
+// DNS records should point to.
+func detectPublicIP(family IPFamily) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), publicIPTimeout)
+	defer cancel()
+
+	type answer struct {
+		source publicIPSource
+		ip     net.IP
+		err    error
+	}
+	answers := make(chan answer, len(publicIPSources))
+	for _, source := range publicIPSources {
+		go func() {
+			ip, err := source.Lookup(ctx, family)
+			if err == nil && (ip == nil || !ip.IsGlobalUnicast() || ip.IsPrivate() || !family.Matches(ip)) {
+				err = fmt.Errorf("returned %v, not a public %s address", ip, family)
+			}
+			answers <- answer{source, ip, err}
+		}()
+	}
+
+	votes := map[string][]string{}
+	var failures []string
+	for range publicIPSources {
+		a := <-answers
+		switch {
+		case a.err == nil:
+			votes[a.ip.String()] = append(votes[a.ip.String()], a.source.Name)
+		case !a.source.Optional:
+			failures = append(failures, fmt.Sprintf("%s: %v", a.source.Name, a.err))
+		}
+	}
+	if len(votes) == 0 {
+		slices.Sort(failures)
+		return "", fmt.Errorf("no source could detect the public %s address (%s)", family, strings.Join(failures, "; "))
+	}
+
+	total := 0
+	best := ""
+	for _, ip := range slices.Sorted(maps.Keys(votes)) {
+		total += len(votes[ip])
+		if len(votes[ip]) > len(votes[best]) {
+			best = ip
+		}
+	}
+	if 2*len(votes[best]) <= total {
+		var seen []string
+		for _, ip := range slices.Sorted(maps.Keys(votes)) {
+			seen = append(seen, fmt.Sprintf("%s from %s", ip, strings.Join(votes[ip], ", ")))
+		}
+		return "", fmt.Errorf("the sources disagree on the public %s address: %s", family, strings.Join(seen, "; "))
+	}
+	return best, nil
+}
+
+// httpIPSource returns a lookup that reads the address from the body of a
+// GET of url, connecting over the family asked for. headers are sent along.
+func httpIPSource(url string, headers map[string]string) func(context.Context, IPFamily) (net.IP, error) {
+	return func(ctx context.Context, family IPFamily) (net.IP, error) {
+		body, err := httpGetFamily(ctx, family, http.MethodGet, url, headers)
+		if err != nil {
+			return nil, err
+		}
+		ip := net.ParseIP(strings.TrimSpace(body))
+		if ip == nil {
+			return nil, fmt.Errorf("unexpected response %q", strings.TrimSpace(body))
+		}
+		return ip, nil
+	}
+}
+
+// httpGetFamily sends a request over the family and returns the start of the
+// body of a 200 response.
+func httpGetFamily(ctx context.Context, family IPFamily, method, url string, headers map[string]string) (string, error) {
+	// No proxy: the address a proxy reaches the internet from is its own
+	dialer := &net.Dialer{}
+	client := &http.Client{Transport: &http.Transport{
+		DisableKeepAlives: true,
+		DialContext: func(ctx context.Context, _, addr string) (net.Conn, error) {
+			return dialer.DialContext(ctx, family.Network("tcp"), addr)
+		},
+	}}
+	req, err := http.NewRequestWithContext(ctx, method, url, nil)
+	if err != nil {
+		return "", err
+	}
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 256))
+	return string(body), err
+}
+
+// resolverAt returns a resolver that sends its queries to one of servers,
+// the one of the family.
+func resolverAt(family IPFamily, servers map[IPFamily]string) *net.Resolver {
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, family.Network("udp"), servers[family])
+		},
+	}
+}
+
+// openDNSIP asks the OpenDNS resolvers, which answer myip.opendns.com with
+// the address the query came from.
+func openDNSIP(ctx context.Context, family IPFamily) (net.IP, error) {
+	resolver := resolverAt(family, map[IPFamily]string{
+		IPv4: "208.67.222.222:53",
+		IPv6: "[2620:119:35::35]:53",
+	})
+	ips, err := resolver.LookupIP(ctx, family.Network("ip"), "myip.opendns.com")
+	if err != nil {
+		return nil, err
+	}
+	return ips[0], nil
+}
+
+// googleDNSIP asks the Google name servers, which answer a TXT query for
+// o-o.myaddr.l.google.com with the address the query came from.
+func googleDNSIP(ctx context.Context, family IPFamily) (net.IP, error) {
+	resolver := resolverAt(family, map[IPFamily]string{
+		IPv4: "216.239.32.10:53",
+		IPv6: "[2001:4860:4802:32::a]:53",
+	})
+	records, err := resolver.LookupTXT(ctx, "o-o.myaddr.l.google.com")
+	if err != nil {
+		return nil, err
+	}
+	for _, record := range records {
+		if ip := net.ParseIP(strings.Trim(record, `"`)); ip != nil {
+			return ip, nil
+		}
+	}
+	return nil, fmt.Errorf("unexpected response %q", strings.Join(records, " "))
+}
+
+// cloudMetadataIP asks the metadata services of the common cloud providers
+// for the public IPv4 address of the instance, which still answer where
+// outbound traffic to the other sources is filtered.
+func cloudMetadataIP(ctx context.Context, family IPFamily) (net.IP, error) {
+	if family != IPv4 {
+		return nil, fmt.Errorf("no %s address", family)
+	}
+	const base = "http://169.254.169.254"
+	lookups := []func(ctx context.Context) (net.IP, error){
+		awsMetadataIP,
+		func(ctx context.Context) (net.IP, error) {
+			return httpIPSource(base+"/computeMetadata/v1/instance/network-interfaces/0/access-configs/0/external-ip",
+				map[string]string{"Metadata-Flavor": "Google"})(ctx, family)
+		},
+		func(ctx context.Context) (net.IP, error) {
+			return httpIPSource(base+"/metadata/instance/network/interface/0/ipv4/ipAddress/0/publicIpAddress?api-version=2021-02-01&format=text",
+				map[string]string{"Metadata": "true"})(ctx, family)
+		},
+		func(ctx context.Context) (net.IP, error) {
+			return httpIPSource(base+"/metadata/v1/interfaces/public/0/ipv4/address", nil)(ctx, family)
+		},
+		func(ctx context.Context) (net.IP, error) {
+			return httpIPSource(base+"/hetzner/v1/metadata/public-ipv4", nil)(ctx, family)
+		},
+	}
+
+	// Only the provider the instance runs on answers
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+	ips := make(chan net.IP, len(lookups))
+	for _, lookup := range lookups {
+		go func() {
+			ip, err := lookup(ctx)
+			if err != nil {
+				ip = nil
+			}
+			ips <- ip
+		}()
+	}
+	for range lookups {
+		if ip := <-ips; ip != nil {
+			return ip, nil
+		}
+	}
+	return nil, fmt.Errorf("no metadata service answered")
+}
+
+// awsMetadataIP asks the EC2 metadata service, which wants a session token
+// first (IMDSv2).
+func awsMetadataIP(ctx context.Context) (net.IP, error) {
+	token, err := httpGetFamily(ctx, IPv4, http.MethodPut, "http://169.254.169.254/latest/api/token",
+		map[string]string{"X-aws-ec2-metadata-token-ttl-seconds": "60"})
+	if err != nil {
+		return nil, err
+	}
+	return httpIPSource("http://169.254.169.254/latest/meta-data/public-ipv4",
+		map[string]string{"X-aws-ec2-metadata-token": token})(ctx, IPv4)
+}
+
+// LocalAddresses returns the global unicast addresses of this host's
+// interfaces.
+func LocalAddresses() []string {
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return nil
+	}
+	var result []string
+	for _, addr := range addrs {
+		if ipNet, ok := addr.(*net.IPNet); ok && ipNet.IP.IsGlobalUnicast() {
+			result = append(result, ipNet.IP.String())
+		}
+	}
+	return result
+}
@@ -0,0 +1,176 @@
+package installer
+
+import (
+	"bytes"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"text/template"
+)
+
+// SecretFiles are installation files, relative to the installation
+// directory, that contain passwords, keys or tokens and must only be
+// readable by their owner.
+var SecretFiles = []string{
+	"answers.yml",
+	"api-credentials.yml",
+	"pangolin-secrets.yaml",
+	"docker-compose.yml",
+	"docker-compose.yml.backup",
+	"config.tar.gz",
+	"config/config.yml",
+	"config/privateConfig.yml",
+	"config/key",
+	"config/letsencrypt/acme.json",
+	"config/traefik/dynamic_config.yml",
+	"config/alertmanager/alertmanager.yml",
+	"config/traefik/certs/dev.key",
+}
+
+// PrivateDirs hold databases and certificates and are only accessible by
+// their owner. The containers run as root and are unaffected.
+var PrivateDirs = []string{
+	"config/db",
+	"config/letsencrypt",
+	"config/crowdsec/db",
+	"backups",
+	"scheduled-backups",
+	"exit-nodes",
+}
+
+// FileModeFor returns the mode a generated file should be created with.
+func FileModeFor(relPath string) os.FileMode {
+	if slices.Contains(SecretFiles, filepath.ToSlash(relPath)) {
+		return 0600
+	}
+	return 0644
+}
+
+// DirModeFor returns the mode a generated directory should be created with.
+func DirModeFor(relPath string) os.FileMode {
+	if slices.Contains(PrivateDirs, filepath.ToSlash(relPath)) {
+		return 0700
+	}
+	return 0755
+}
+
+// RenderOptions change how Render renders a configuration.
+type RenderOptions struct {
+	// TemplatesDir overrides embedded templates, see TemplateFS
+	TemplatesDir string
+	// Events receives an EventFileWritten for every file written
+	Events EventHandler
+}
+
+// Render renders the config templates into root/config. docker-compose.yml
+// is rendered into config/ too; the installer moves it to root once the
+// rest of the configuration is in place.
+func Render(config Config, root string, options RenderOptions) error {
+	configDir := filepath.Join(root, "config")
+
+	if err := os.MkdirAll(configDir, 0755); err != nil {
+		return fmt.Errorf("failed to create config directory: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Join(configDir, "letsencrypt"), DirModeFor("config/letsencrypt")); err != nil {
+		return fmt.Errorf("failed to create letsencrypt directory: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Join(configDir, "db"), DirModeFor("config/db")); err != nil {
+		return fmt.Errorf("failed to create db directory: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Join(configDir, "logs"), 0755); err != nil {
+		return fmt.Errorf("failed to create logs directory: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Join(configDir, "traefik", "logs"), 0755); err != nil {
+		return fmt.Errorf("failed to create traefik logs directory: %v", err)
+	}
+
+	templates, err := TemplateFS(options.TemplatesDir)
+	if err != nil {
+		return fmt.Errorf("failed to load templates: %v", err)
+	}
+
+	// Walk through all template files
+	err = fs.WalkDir(templates, ".", func(path string, d fs.DirEntry, walkErr error) error {
+		if walkErr != nil {
+			return walkErr
+		}
+
+		// Skip the root fs directory itself
+		if path == "." {
+			return nil
+		}
+
+		if !config.DoCrowdsecInstall && strings.Contains(path, "crowdsec") {
+			return nil
+		}
+
+		if config.DoCrowdsecInstall && !strings.Contains(path, "crowdsec") {
+			return nil
+		}
+
+		// skip .DS_Store
+		if strings.Contains(path, ".DS_Store") {
+			return nil
+		}
+
+		outPath := filepath.Join(configDir, path)
+		relPath := filepath.Join("config", path)
+
+		if d.IsDir() {
+			// Create directory
+			if err := os.MkdirAll(outPath, DirModeFor(relPath)); err != nil {
+				return fmt.Errorf("failed to create directory %s: %v", outPath, err)
+			}
+			return nil
+		}
+
+		// Read the template file
+		content, err := fs.ReadFile(templates, path)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %v", outPath, err)
+		}
+
+		// Parse template
+		tmpl, err := template.New(d.Name()).Parse(string(content))
+		if err != nil {
+			return fmt.Errorf("failed to parse template %s: %v", outPath, err)
+		}
+
+		// Execute template
+		var rendered bytes.Buffer
+		if err := tmpl.Execute(&rendered, config); err != nil {
+			return fmt.Errorf("failed to execute template %s: %v", outPath, err)
+		}
+
+		// Refuse to write files that would only fail once the containers start
+		if err := checkRenderedTemplate(path, rendered.Bytes()); err != nil {
+			return err
+		}
+
+		// Ensure parent directory exists
+		if err := os.MkdirAll(filepath.Dir(outPath), 0755); err != nil {
+			return fmt.Errorf("failed to create parent directory for %s: %v", outPath, err)
+		}
+
+		// docker-compose.yml is rendered into config/ and moved afterwards
+		mode := FileModeFor(relPath)
+		if d.Name() == "docker-compose.yml" {
+			mode = FileModeFor(d.Name())
+		}
+
+		if err := os.WriteFile(outPath, rendered.Bytes(), mode); err != nil {
+			return fmt.Errorf("failed to create %s: %v", outPath, err)
+		}
+		options.Events.emit(Event{Kind: EventFileWritten, Path: outPath})
+
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("error walking config files: %v", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,187 @@
+package installer
+
+import (
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+//go:embed config/*
+var configFiles embed.FS
+
+// TemplateFS returns the file system config templates are rendered from,
+// rooted at the contents of the embedded config/ directory. dir is an
+// optional directory whose files override the embedded templates. It
+// mirrors the layout of the embedded config/ tree, so e.g.
+// <dir>/traefik/dynamic_config.yml replaces
+// config/traefik/dynamic_config.yml.
+func TemplateFS(dir string) (fs.FS, error) {
+	embedded, err := fs.Sub(configFiles, "config")
+	if err != nil {
+		return nil, err
+	}
+
+	if dir == "" {
+		return embedded, nil
+	}
+
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, fmt.Errorf("templates directory %s: %w", dir, err)
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("templates directory %s is not a directory", dir)
+	}
+
+	return overlayFS{upper: os.DirFS(dir), lower: embedded}, nil
+}
+
+// overlayFS layers one file system over another. Files present in upper take
+// precedence over files with the same path in lower, and directory listings
+// are the union of both.
+type overlayFS struct {
+	upper fs.FS
+	lower fs.FS
+}
+
+func (o overlayFS) Open(name string) (fs.File, error) {
+	f, err := o.upper.Open(name)
+	if err == nil {
+		return f, nil
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	return o.lower.Open(name)
+}
+
+func (o overlayFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	upperEntries, upperErr := fs.ReadDir(o.upper, name)
+	lowerEntries, lowerErr := fs.ReadDir(o.lower, name)
+
+	if upperErr != nil && lowerErr != nil {
+		return nil, lowerErr
+	}
+
+	merged := make(map[string]fs.DirEntry)
+	for _, e := range lowerEntries {
+		merged[e.Name()] = e
+	}
+	for _, e := range upperEntries {
+		merged[e.Name()] = e
+	}
+
+	entries := make([]fs.DirEntry, 0, len(merged))
+	for _, e := range merged {
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+
+	return entries, nil
+}
+
+func (o overlayFS) ReadFile(name string) ([]byte, error) {
+	data, err := fs.ReadFile(o.upper, name)
+	if err == nil {
+		return data, nil
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	return fs.ReadFile(o.lower, name)
+}
+
+// yamlErrorLine extracts the line number from a yaml.v3 error message.
+var yamlErrorLine = regexp.MustCompile(`line (\d+)`)
+
+// checkRenderedTemplate parses a rendered YAML template and returns an error
+// naming the template, the offending line and the surrounding rendered text
+// if the output is not valid. Compose files are additionally checked for the
+// structure Docker Compose expects.
+func checkRenderedTemplate(name string, content []byte) error {
+	ext := filepath.Ext(name)
+	if ext != ".yml" && ext != ".yaml" {
+		return nil
+	}
+
+	var doc map[string]any
+	if err := yaml.Unmarshal(content, &doc); err != nil {
+		line := 0
+		if m := yamlErrorLine.FindStringSubmatch(err.Error()); m != nil {
+			line, _ = strconv.Atoi(m[1])
+		}
+		return fmt.Errorf("template %s rendered invalid YAML: %v\n%s", name, err, renderedSnippet(content, line))
+	}
+
+	if filepath.Base(name) == "docker-compose.yml" {
+		if err := checkComposeStructure(doc); err != nil {
+			return fmt.Errorf("template %s rendered an invalid compose file: %v", name, err)
+		}
+	}
+
+	return nil
+}
+
+// checkComposeStructure performs the subset of the compose schema checks
+// that catch templating mistakes: unknown top-level keys, services without
+// an image and images with an empty tag.
+func checkComposeStructure(compose map[string]any) error {
+	for key := range compose {
+		switch key {
+		case "name", "version", "services", "networks", "volumes", "configs", "secrets", "include":
+		default:
+			if !strings.HasPrefix(key, "x-") {
+				return fmt.Errorf("unknown top-level key %q", key)
+			}
+		}
+	}
+
+	services, ok := compose["services"].(map[string]any)
+	if !ok || len(services) == 0 {
+		return fmt.Errorf("no services defined")
+	}
+
+	for name, value := range services {
+		service, ok := value.(map[string]any)
+		if !ok {
+			return fmt.Errorf("service %q is not a mapping", name)
+		}
+		image, hasImage := service["image"].(string)
+		if _, hasBuild := service["build"]; !hasImage && !hasBuild {
+			return fmt.Errorf("service %q has neither image nor build", name)
+		}
+		if hasImage && strings.HasSuffix(image, ":") {
+			return fmt.Errorf("service %q has an image without a tag: %q", name, image)
+		}
+	}
+
+	return nil
+}
+
+// renderedSnippet returns the lines around line (1-based) with line numbers,
+// marking the offending line.
+func renderedSnippet(content []byte, line int) string {
+	lines := strings.Split(string(content), "\n")
+	if line < 1 || line > len(lines) {
+		return ""
+	}
+
+	var b strings.Builder
+	for i := max(1, line-3); i <= min(len(lines), line+3); i++ {
+		marker := "  "
+		if i == line {
+			marker = "> "
+		}
+		fmt.Fprintf(&b, "%s%4d | %s\n", marker, i, lines[i-1])
+	}
+	return b.String()
+}
@@ -0,0 +1,320 @@
+package installer
+
+import (
+	"fmt"
+	"net"
+	"net/mail"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// ValidationError is a problem with an answer. Key names the problem in the
+// message catalogs of the installer, which translates it, and Args are the
+// arguments of the message; Error returns the English text.
+type ValidationError struct {
+	Key  string
+	Args []any
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf(ValidationMessages[e.Key], e.Args...)
+}
+
+func invalid(key string, args ...any) error {
+	return &ValidationError{Key: key, Args: args}
+}
+
+// ValidationMessages are the English format strings of the validation
+// errors by key.
+var ValidationMessages = map[string]string{
+	"validationAnswer":            "invalid %s: %v",
+	"validationAutoUpdate":        "invalid auto_update %q: use timer or watchtower",
+	"validationNotifyURL":         "invalid auto_update_notify_url %q",
+	"validationDomainScheme":      "%q includes a scheme: enter the domain alone, e.g. example.com",
+	"validationDomainSpaces":      "%q contains spaces",
+	"validationDomainUnderscore":  "%q contains an underscore, which is not allowed in host names",
+	"validationDomainTrailingDot": "%q ends with a dot: leave it out",
+	"validationDomainIP":          "%q is an IP address: Pangolin needs a domain name",
+	"validationDomainWildcard":    "%q is a wildcard: enter a single host name",
+	"validationDomainUnicode":     "%q is an internationalized domain name: enter it in its xn-- form",
+	"validationDomainLength":      "%q is longer than 253 characters",
+	"validationDomainSingleLabel": "%q is not a fully qualified domain name such as example.com",
+	"validationDomainLabel":       "%q is not a valid domain name: %q may only contain letters, digits and inner hyphens, at most 63",
+	"validationEmail":             "%q is not an email address such as admin@example.com",
+	"validationEmailDomain":       "%q does not end in a valid domain: %v",
+	"validationSMTPPort":          "invalid smtp_port %d: use a port between 1 and 65535",
+	"validationHTTPURL":           "%q is not an http or https URL",
+	"validationDuration":          "%q is not a duration such as 5s",
+	"validationTokenName":         "%q may only contain letters, digits, '.', '_' and '-'",
+	"validationAlertEmail":        "alert_email needs enable_email: alerts are sent through Pangolin's SMTP server",
+	"validationAlertWebhookURL":   "invalid alert_webhook_url %q",
+	"validationLogDriverPodman":   "log_driver syslog is not supported by Podman: use journald",
+	"validationLogDriver":         "invalid log_driver %q: use journald or syslog",
+	"validationGeoblockMode":      "invalid geoblock_mode %q: use allow or block",
+	"validationGeoblockCountry":   "invalid geoblock_countries entry %q: use ISO 3166-1 alpha-2 codes such as DE",
+	"validationGerbilAddress":     "%q is not a public %s address",
+}
+
+// Validate checks the settings of an answers file that the templates cannot
+// render safely, returning the first problem found. Required keys are
+// checked by MissingAnswers.
+func Validate(config Config) error {
+	switch config.AutoUpdate {
+	case "", AutoUpdateTimer, AutoUpdateWatchtower:
+	default:
+		return invalid("validationAutoUpdate", config.AutoUpdate)
+	}
+	if config.AutoUpdateNotifyURL != "" && !ValidNotifyURL(config.AutoUpdateNotifyURL) {
+		return invalid("validationNotifyURL", config.AutoUpdateNotifyURL)
+	}
+	for _, check := range []func(Config) error{checkDomains, checkBadgerOptions, checkAlertReceivers, checkLogDriver, checkGeoblocking, checkGerbilEndpoints} {
+		if err := check(config); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SameDomain reports whether a and b name the same domain, ignoring case and
+// a trailing dot.
+func SameDomain(a, b string) bool {
+	return strings.EqualFold(strings.TrimSuffix(a, "."), strings.TrimSuffix(b, "."))
+}
+
+// CheckDomain validates a domain name as typed at a prompt or in an answers
+// file: a host name of letters, digits and hyphens in dot-separated labels,
+// without a scheme, path, port or trailing dot. Internationalized names are
+// taken in their xn-- form. Single labels other than localhost, which
+// development installs use, and IP addresses are rejected, as certificates
+// are issued for names under a public domain.
+func CheckDomain(name string) error {
+	switch {
+	case strings.Contains(name, "://"):
+		return invalid("validationDomainScheme", name)
+	case strings.ContainsAny(name, " \t"):
+		return invalid("validationDomainSpaces", name)
+	case strings.Contains(name, "_"):
+		return invalid("validationDomainUnderscore", name)
+	case strings.HasSuffix(name, "."):
+		return invalid("validationDomainTrailingDot", name)
+	case net.ParseIP(strings.Trim(name, "[]")) != nil:
+		return invalid("validationDomainIP", name)
+	case strings.Contains(name, "*"):
+		return invalid("validationDomainWildcard", name)
+	case strings.ContainsFunc(name, func(r rune) bool { return r > unicode.MaxASCII }):
+		return invalid("validationDomainUnicode", name)
+	case name == "localhost":
+		return nil
+	case len(name) > 253:
+		return invalid("validationDomainLength", name)
+	}
+	labels := strings.Split(name, ".")
+	if len(labels) < 2 {
+		return invalid("validationDomainSingleLabel", name)
+	}
+	for _, label := range labels {
+		if !domainLabel.MatchString(label) {
+			return invalid("validationDomainLabel", name, label)
+		}
+	}
+	return nil
+}
+
+// domainLabel matches a label of a host name.
+var domainLabel = regexp.MustCompile(`^[A-Za-z0-9]([A-Za-z0-9-]{0,61}[A-Za-z0-9])?$`)
+
+// CheckEmail validates a bare email address such as admin@example.com, as
+// Let's Encrypt and SMTP servers expect it.
+func CheckEmail(address string) error {
+	parsed, err := mail.ParseAddress(address)
+	if err != nil || parsed.Name != "" || parsed.Address != address {
+		return invalid("validationEmail", address)
+	}
+	domain := address[strings.LastIndex(address, "@")+1:]
+	if err := CheckDomain(domain); err != nil {
+		return invalid("validationEmailDomain", address, err)
+	}
+	return nil
+}
+
+// DashboardUnderBase reports whether the dashboard domain is the base domain
+// itself or a subdomain of it at any depth, such as apps.internal.example.com.
+// A dashboard elsewhere needs DNS records and certificates the installer
+// does not plan for.
+func DashboardUnderBase(dashboard, base string) bool {
+	d := strings.ToLower(strings.TrimSuffix(dashboard, "."))
+	b := strings.ToLower(strings.TrimSuffix(base, "."))
+	return d == b || strings.HasSuffix(d, "."+b)
+}
+
+// checkDomains validates the domains and email addresses of an answers file.
+// Missing ones are reported by MissingAnswers.
+func checkDomains(config Config) error {
+	for key, value := range map[string]string{"base_domain": config.BaseDomain, "dashboard_domain": config.DashboardDomain} {
+		if value == "" {
+			continue
+		}
+		if err := CheckDomain(value); err != nil {
+			return invalid("validationAnswer", key, err)
+		}
+	}
+	for key, value := range map[string]string{"letsencrypt_email": config.LetsEncryptEmail, "no_reply": config.EmailNoReply, "alert_email": config.AlertEmail} {
+		if value == "" {
+			continue
+		}
+		if err := CheckEmail(value); err != nil {
+			return invalid("validationAnswer", key, err)
+		}
+	}
+	if config.EnableEmail && (config.EmailSMTPPort < 1 || config.EmailSMTPPort > 65535) {
+		return invalid("validationSMTPPort", config.EmailSMTPPort)
+	}
+	return nil
+}
+
+// ValidNotifyURL reports whether a notification URL is usable. Quotes,
+// dollar signs and whitespace are rejected since the URL ends up in a
+// compose file and a systemd command line.
+func ValidNotifyURL(raw string) bool {
+	if strings.ContainsAny(raw, "'\"$`\\ \t\n") {
+		return false
+	}
+	u, err := url.Parse(raw)
+	return err == nil && u.Scheme != "" && (u.Host != "" || u.Opaque != "")
+}
+
+// badgerTokenName matches cookie and query parameter names that are safe to
+// template into the Traefik config unquoted.
+var badgerTokenName = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+
+// BadgerOption is a setting of the Badger middleware that is templated into
+// config/traefik/dynamic_config.yml. Empty values keep the plugin's default.
+type BadgerOption struct {
+	// Key is the answers file key
+	Key   string
+	Value func(config *Config) *string
+	Check func(value string) error
+}
+
+// BadgerOptions are the Badger settings an answers file can set.
+var BadgerOptions = []BadgerOption{
+	{
+		Key:   "badger_api_base_url",
+		Value: func(c *Config) *string { return &c.BadgerAPIBaseURL },
+		Check: func(value string) error {
+			u, err := url.Parse(value)
+			if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				return invalid("validationHTTPURL", value)
+			}
+			return nil
+		},
+	},
+	{
+		Key:   "badger_session_cookie",
+		Value: func(c *Config) *string { return &c.BadgerSessionCookie },
+		Check: checkBadgerTokenName,
+	},
+	{
+		Key:   "badger_session_param",
+		Value: func(c *Config) *string { return &c.BadgerSessionParam },
+		Check: checkBadgerTokenName,
+	},
+	{
+		Key:   "badger_timeout",
+		Value: func(c *Config) *string { return &c.BadgerTimeout },
+		Check: func(value string) error {
+			d, err := time.ParseDuration(value)
+			if err != nil || d <= 0 {
+				return invalid("validationDuration", value)
+			}
+			return nil
+		},
+	},
+}
+
+func checkBadgerTokenName(value string) error {
+	if !badgerTokenName.MatchString(value) {
+		return invalid("validationTokenName", value)
+	}
+	return nil
+}
+
+// checkBadgerOptions validates the Badger settings of an answers file.
+func checkBadgerOptions(config Config) error {
+	for _, option := range BadgerOptions {
+		value := *option.Value(&config)
+		if value == "" {
+			continue
+		}
+		if err := option.Check(value); err != nil {
+			return invalid("validationAnswer", option.Key, err)
+		}
+	}
+	return nil
+}
+
+// checkAlertReceivers validates the alert receivers of an answers file.
+func checkAlertReceivers(config Config) error {
+	if config.AlertEmail != "" && !config.EnableEmail {
+		return invalid("validationAlertEmail")
+	}
+	if config.AlertWebhookURL != "" && !ValidNotifyURL(config.AlertWebhookURL) {
+		return invalid("validationAlertWebhookURL", config.AlertWebhookURL)
+	}
+	return nil
+}
+
+// checkLogDriver validates the log_driver of an answers file. Podman has no
+// syslog driver.
+func checkLogDriver(config Config) error {
+	switch config.LogDriver {
+	case "", LogDriverJournald:
+	case LogDriverSyslog:
+		if config.InstallationContainerType == Podman {
+			return invalid("validationLogDriverPodman")
+		}
+	default:
+		return invalid("validationLogDriver", config.LogDriver)
+	}
+	return nil
+}
+
+// checkGeoblocking validates the geoblocking settings of an answers file.
+func checkGeoblocking(config Config) error {
+	switch config.GeoblockMode {
+	case "", GeoblockAllow, GeoblockBlock:
+	default:
+		return invalid("validationGeoblockMode", config.GeoblockMode)
+	}
+	for _, code := range config.GeoblockCountries {
+		if _, ok := LookupCountry(code); !ok || code != strings.ToUpper(code) {
+			return invalid("validationGeoblockCountry", code)
+		}
+	}
+	return nil
+}
+
+// CheckGerbilAddress validates a gerbil_ipv4 or gerbil_ipv6 answer.
+func CheckGerbilAddress(family IPFamily, value string) error {
+	ip := net.ParseIP(value)
+	if ip == nil || !family.Matches(ip) || !ip.IsGlobalUnicast() || ip.IsPrivate() {
+		return invalid("validationGerbilAddress", value, family)
+	}
+	return nil
+}
+
+// checkGerbilEndpoints validates the Gerbil addresses of an answers file.
+func checkGerbilEndpoints(config Config) error {
+	for family, value := range map[IPFamily]string{IPv4: config.GerbilIPv4, IPv6: config.GerbilIPv6} {
+		if value == "" {
+			continue
+		}
+		if err := CheckGerbilAddress(family, value); err != nil {
+			return invalid("validationAnswer", fmt.Sprintf("gerbil_ipv%d", int(family)), err)
+		}
+	}
+	return nil
+}
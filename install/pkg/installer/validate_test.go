@@ -0,0 +1,161 @@
+package installer
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCheckDomain(t *testing.T) {
+	for _, tt := range []struct {
+		name  string
+		valid bool
+	}{
+		{"example.com", true},
+		{"pangolin.example.com", true},
+		{"apps.internal.example.com", true},
+		{"Pangolin.Example.COM", true},
+		{"localhost", true},
+		{"xn--bcher-kva.example", true},
+		{"pangolin.xn--bcher-kva.example", true},
+		{"a-b.example.com", true},
+		{strings.Repeat("a", 63) + ".example.com", true},
+		{"", false},
+		{"com", false},
+		{"example", false},
+		{"example.com.", false},
+		{"pangolin.example.com.", false},
+		{"http://example.com", false},
+		{"https://pangolin.example.com/", false},
+		{"example.com/path", false},
+		{"example.com:443", false},
+		{"exa mple.com", false},
+		{" example.com", false},
+		{"a_b.example.com", false},
+		{"*.example.com", false},
+		{"1.2.3.4", false},
+		{"::1", false},
+		{"[2001:db8::1]", false},
+		{"bücher.example", false},
+		{"-a.example.com", false},
+		{"a-.example.com", false},
+		{"example..com", false},
+		{".example.com", false},
+		{strings.Repeat("a", 64) + ".example.com", false},
+		{strings.Repeat("a.", 126) + "com", false},
+	} {
+		err := CheckDomain(tt.name)
+		if tt.valid && err != nil {
+			t.Errorf("CheckDomain(%q) = %v, want nil", tt.name, err)
+		}
+		if !tt.valid && err == nil {
+			t.Errorf("CheckDomain(%q) = nil, want an error", tt.name)
+		}
+	}
+}
+
+func TestCheckEmail(t *testing.T) {
+	for _, tt := range []struct {
+		address string
+		valid   bool
+	}{
+		{"admin@example.com", true},
+		{"first.last+pangolin@mail.example.com", true},
+		{"admin@xn--bcher-kva.example", true},
+		{"admin@localhost", true},
+		{"", false},
+		{"admin", false},
+		{"admin@", false},
+		{"@example.com", false},
+		{"a@b", false},
+		{"admin@example.com.", false},
+		{"admin@example_mail.com", false},
+		{"admin@1.2.3.4", false},
+		{"admin@[1.2.3.4]", false},
+		{"Admin <admin@example.com>", false},
+		{"<admin@example.com>", false},
+		{" admin@example.com", false},
+		{"admin@example.com, other@example.com", false},
+		{"mailto:admin@example.com", false},
+	} {
+		err := CheckEmail(tt.address)
+		if tt.valid && err != nil {
+			t.Errorf("CheckEmail(%q) = %v, want nil", tt.address, err)
+		}
+		if !tt.valid && err == nil {
+			t.Errorf("CheckEmail(%q) = nil, want an error", tt.address)
+		}
+	}
+}
+
+func TestDashboardUnderBase(t *testing.T) {
+	for _, tt := range []struct {
+		dashboard, base string
+		under           bool
+	}{
+		{"example.com", "example.com", true},
+		{"pangolin.example.com", "example.com", true},
+		{"apps.internal.example.com", "example.com", true},
+		{"apps.internal.example.com", "internal.example.com", true},
+		{"Pangolin.Example.com", "example.COM", true},
+		{"pangolin.example.com.", "example.com", true},
+		{"example.com", "pangolin.example.com", false},
+		{"pangolin.other.net", "example.com", false},
+		{"notexample.com", "example.com", false},
+		{"pangolin.example.com.evil.net", "example.com", false},
+	} {
+		if got := DashboardUnderBase(tt.dashboard, tt.base); got != tt.under {
+			t.Errorf("DashboardUnderBase(%q, %q) = %v, want %v", tt.dashboard, tt.base, got, tt.under)
+		}
+	}
+}
+
+func TestCheckDomains(t *testing.T) {
+	valid := Config{
+		BaseDomain:       "example.com",
+		DashboardDomain:  "pangolin.example.com",
+		LetsEncryptEmail: "admin@example.com",
+	}
+	withEmail := valid
+	withEmail.EnableEmail = true
+	withEmail.EmailNoReply = "noreply@example.com"
+
+	for _, tt := range []struct {
+		name   string
+		change func(c *Config)
+		// wantErr is a part of the expected error, or empty for none
+		wantErr string
+	}{
+		{"valid", func(c *Config) {}, ""},
+		{"dashboard on the apex", func(c *Config) { c.DashboardDomain = "example.com" }, ""},
+		{"dashboard outside the base domain", func(c *Config) { c.DashboardDomain = "pangolin.other.net" }, ""},
+		{"missing answers are left to MissingAnswers", func(c *Config) { *c = Config{} }, ""},
+		{"base domain with a scheme", func(c *Config) { c.BaseDomain = "https://example.com" }, "base_domain"},
+		{"dashboard domain with a trailing dot", func(c *Config) { c.DashboardDomain = "pangolin.example.com." }, "dashboard_domain"},
+		{"dashboard domain wildcard", func(c *Config) { c.DashboardDomain = "*.example.com" }, "dashboard_domain"},
+		{"Let's Encrypt email without a domain", func(c *Config) { c.LetsEncryptEmail = "a@b" }, "letsencrypt_email"},
+		{"no-reply address with a name", func(c *Config) {
+			*c = withEmail
+			c.EmailNoReply = "Pangolin <noreply@example.com>"
+		}, "no_reply"},
+		{"alert email without a domain", func(c *Config) { *c = withEmail; c.AlertEmail = "alerts" }, "alert_email"},
+		{"SMTP port 0", func(c *Config) { *c = withEmail; c.EmailSMTPPort = 0 }, "smtp_port"},
+		{"SMTP port 65536", func(c *Config) { *c = withEmail; c.EmailSMTPPort = 65536 }, "smtp_port"},
+		{"SMTP port 1", func(c *Config) { *c = withEmail; c.EmailSMTPPort = 1 }, ""},
+		{"SMTP port 65535", func(c *Config) { *c = withEmail; c.EmailSMTPPort = 65535 }, ""},
+		{"SMTP port unused without email", func(c *Config) { c.EmailSMTPPort = 0 }, ""},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			config := valid
+			tt.change(&config)
+			err := checkDomains(config)
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Errorf("checkDomains = %v, want nil", err)
+			case tt.wantErr != "" && err == nil:
+				t.Errorf("checkDomains = nil, want an error about %s", tt.wantErr)
+			case tt.wantErr != "" && !strings.Contains(err.Error(), tt.wantErr):
+				t.Errorf("checkDomains = %v, want an error about %s", err, tt.wantErr)
+			}
+		})
+	}
+}
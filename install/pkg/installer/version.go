@@ -0,0 +1,47 @@
+package installer
+
+import (
+	"regexp"
+	"strconv"
+)
+
+// versionNumber matches the numeric part of a version or image tag, e.g.
+// "1.2.3" in "ee-postgresql-1.2.3" or "v1.2.3".
+var versionNumber = regexp.MustCompile(`(\d+)(?:\.(\d+))?(?:\.(\d+))?`)
+
+// CompareVersions compares two release versions numerically, ignoring any
+// prefix such as "v" or "ee-". It returns -1, 0 or 1.
+func CompareVersions(a, b string) int {
+	pa, pb := ParseVersion(a), ParseVersion(b)
+	for i := range pa {
+		if pa[i] != pb[i] {
+			if pa[i] < pb[i] {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+// ParseVersion returns the major, minor and patch numbers of a version.
+func ParseVersion(v string) [3]int {
+	var parts [3]int
+	m := versionNumber.FindStringSubmatch(v)
+	if m == nil {
+		return parts
+	}
+	for i := range parts {
+		parts[i], _ = strconv.Atoi(m[i+1])
+	}
+	return parts
+}
+
+// StripVersionPrefix removes image tag variants so only the release remains,
+// e.g. "ee-postgresql-1.2.3" becomes "1.2.3".
+func StripVersionPrefix(tag string) string {
+	if loc := versionNumber.FindStringIndex(tag); loc != nil {
+		return tag[loc[0]:]
+	}
+	return tag
+}
@@ -0,0 +1,49 @@
+package installer
+
+import (
+	"fmt"
+	"os/exec"
+	"slices"
+	"strings"
+)
+
+// WebServer is a web server that can hold the ports Pangolin needs.
+type WebServer struct {
+	Name    string
+	Process string
+	Unit    string
+}
+
+// KnownWebServers are the web servers DetectWebServer recognizes.
+var KnownWebServers = []WebServer{
+	{Name: "nginx", Process: "nginx", Unit: "nginx"},
+	{Name: "Apache", Process: "apache2", Unit: "apache2"},
+	{Name: "Apache", Process: "httpd", Unit: "httpd"},
+}
+
+// DetectWebServer returns the known web server listening on one of ports,
+// judged by the listening process or, without ss, by the running units.
+func DetectWebServer(ports []int) *WebServer {
+	if out, err := exec.Command("ss", "-Hltnp").Output(); err == nil {
+		for _, line := range strings.Split(string(out), "\n") {
+			fields := strings.Fields(line)
+			if len(fields) < 4 || !slices.ContainsFunc(ports, func(p int) bool {
+				return strings.HasSuffix(fields[3], fmt.Sprintf(":%d", p))
+			}) {
+				continue
+			}
+			for i, server := range KnownWebServers {
+				if strings.Contains(line, `(("`+server.Process+`"`) {
+					return &KnownWebServers[i]
+				}
+			}
+		}
+	}
+
+	for i, server := range KnownWebServers {
+		if exec.Command("systemctl", "is-active", "--quiet", server.Unit).Run() == nil {
+			return &KnownWebServers[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"flag"
+	"os"
+)
+
+// plainMode (--plain) keeps the output line-oriented for screen readers and
+// dumb terminals: prompts are asked as plain text questions and neither the
+// installer nor the tools it runs print color, spinners or progress bars.
+var plainMode bool
+
+// plainFlag registers --plain on a command.
+func plainFlag(flags *flag.FlagSet) {
+	flags.BoolVar(&plainMode, "plain", false, "Plain line-oriented output without colors, spinners or progress bars, for screen readers and dumb terminals")
+}
+
+// enablePlainOutput applies --plain to the commands the installer runs, which
+// inherit its environment. NO_COLOR is honored by most CLIs; the COMPOSE_*
+// and BUILDKIT_* variables switch Docker Compose to plain progress output.
+func enablePlainOutput() {
+	if !plainMode {
+		return
+	}
+	for name, value := range map[string]string{
+		"NO_COLOR":          "1",
+		"COMPOSE_ANSI":      "never",
+		"COMPOSE_PROGRESS":  "plain",
+		"BUILDKIT_PROGRESS": "plain",
+	} {
+		os.Setenv(name, value)
+	}
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/fosrl/pangolin/install/pkg/installer"
+)
+
+// crowdsecBouncerVersion is the version of the CrowdSec bouncer plugin the
+// installer pins. Like the component versions it can be injected at build
+// time via -ldflags; the geoblock plugin's is installer.GeoblockPluginVersion.
+var crowdsecBouncerVersion = "v1.4.4"
+
+// traefikPlugin is a Traefik plugin whose version the installer manages in
+// the experimental.plugins block of the static config. Plugins are found by
+// module name, as the key under experimental.plugins is the user's choice.
+type traefikPlugin struct {
+	Name       string
+	ModuleName string
+	Version    func() string
+	// MinTraefik is the oldest Traefik release the pinned version loads on
+	MinTraefik string
+}
+
+var traefikPlugins = []traefikPlugin{
+	{
+		Name:       "Badger",
+		ModuleName: "github.com/fosrl/badger",
+		Version:    func() string { return badgerVersion },
+		MinTraefik: "3.0",
+	},
+	{
+		Name:       "CrowdSec bouncer",
+		ModuleName: "github.com/maxlerebourg/crowdsec-bouncer-traefik-plugin",
+		Version:    func() string { return crowdsecBouncerVersion },
+		MinTraefik: "2.10",
+	},
+	{
+		Name:       "geoblock",
+		ModuleName: "github.com/PascalMinder/geoblock",
+		Version:    func() string { return installer.GeoblockPluginVersion },
+		MinTraefik: "2.10",
+	},
+}
+
+// readPluginVersions returns the versions of the plugins in the Traefik
+// static config, by module name.
+func readPluginVersions(traefikConfigPath string) (map[string]string, error) {
+	data, err := os.ReadFile(traefikConfigPath)
+	if err != nil {
+		return nil, fmt.Errorf("error reading traefik config: %w", err)
+	}
+	var static map[string]any
+	if err := yaml.Unmarshal(data, &static); err != nil {
+		return nil, fmt.Errorf("error parsing traefik config: %w", err)
+	}
+	value, _ := lookup(static, "experimental", "plugins")
+	plugins, _ := value.(map[string]any)
+	versions := map[string]string{}
+	for _, key := range sortedKeys(plugins) {
+		plugin, _ := plugins[key].(map[string]any)
+		module, _ := plugin["moduleName"].(string)
+		version, _ := plugin["version"].(string)
+		if module != "" {
+			versions[module] = version
+		}
+	}
+	return versions, nil
+}
+
+// pluginCompatibility returns a problem for each installed plugin whose
+// pinned version does not load on Traefik traefikTag.
+func pluginCompatibility(installed map[string]string, traefikTag string) []string {
+	if traefikMajor(traefikTag) == 0 {
+		return nil
+	}
+	var problems []string
+	for _, plugin := range traefikPlugins {
+		if _, ok := installed[plugin.ModuleName]; !ok {
+			continue
+		}
+		if installer.CompareVersions(traefikTag, plugin.MinTraefik) < 0 {
+			problems = append(problems, fmt.Sprintf("%s %s needs Traefik %s or newer, the installation runs %s", plugin.Name, plugin.Version(), plugin.MinTraefik, traefikTag))
+		}
+	}
+	return problems
+}
+
+// updatePluginVersions moves the installed plugins to their pinned versions
+// and returns a line for each one that changed.
+func updatePluginVersions(traefikConfigPath string) ([]string, error) {
+	installed, err := readPluginVersions(traefikConfigPath)
+	if err != nil {
+		return nil, err
+	}
+	var updated []string
+	for _, plugin := range traefikPlugins {
+		from, ok := installed[plugin.ModuleName]
+		if !ok || from == plugin.Version() {
+			continue
+		}
+		if err := setPluginVersion(traefikConfigPath, plugin.ModuleName, plugin.Version()); err != nil {
+			return nil, err
+		}
+		updated = append(updated, fmt.Sprintf("%s %s -> %s", plugin.Name, orUnknown(from, "unpinned"), plugin.Version()))
+	}
+	if len(updated) > 0 {
+		recordChange("Update the Traefik plugins\n\n- " + strings.Join(updated, "\n- "))
+	}
+	return updated, nil
+}
+
+var (
+	pluginModuleLine  = regexp.MustCompile(`^(\s*)moduleName:\s*["']?([^"'\s#]+)`)
+	pluginVersionLine = regexp.MustCompile(`^(\s*version:\s*)["']?[^"'\s#]*["']?`)
+)
+
+// setPluginVersion sets the version next to the moduleName of a plugin in
+// the Traefik static config. Editing the text directly keeps the rest of the
+// file untouched.
+func setPluginVersion(traefikConfigPath, moduleName, version string) error {
+	content, err := os.ReadFile(traefikConfigPath)
+	if err != nil {
+		return fmt.Errorf("error reading traefik config: %w", err)
+	}
+
+	lines := strings.Split(string(content), "\n")
+	for i, line := range lines {
+		m := pluginModuleLine.FindStringSubmatch(line)
+		if m == nil || m[2] != moduleName {
+			continue
+		}
+		// The version is a sibling of moduleName: a line of the same
+		// indentation in the same block, before or after it
+		indent := m[1]
+		for _, step := range []int{-1, 1} {
+			for j := i + step; j >= 0 && j < len(lines); j += step {
+				sibling := lines[j]
+				rest, ok := strings.CutPrefix(sibling, indent)
+				if strings.TrimSpace(sibling) == "" || (ok && strings.HasPrefix(rest, " ")) {
+					continue
+				}
+				if !ok {
+					break
+				}
+				if pluginVersionLine.MatchString(sibling) {
+					lines[j] = pluginVersionLine.ReplaceAllString(sibling, `${1}"`+version+`"`)
+					return writePluginConfig(traefikConfigPath, lines)
+				}
+			}
+		}
+		lines = append(lines[:i+1], append([]string{indent + `version: "` + version + `"`}, lines[i+1:]...)...)
+		return writePluginConfig(traefikConfigPath, lines)
+	}
+	return fmt.Errorf("plugin %s not found in %s", moduleName, traefikConfigPath)
+}
+
+func writePluginConfig(traefikConfigPath string, lines []string) error {
+	if err := os.WriteFile(traefikConfigPath, []byte(strings.Join(lines, "\n")), 0644); err != nil {
+		return fmt.Errorf("error writing traefik config: %w", err)
+	}
+	return nil
+}
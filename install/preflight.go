@@ -0,0 +1,63 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/fosrl/pangolin/install/pkg/installer"
+)
+
+// runPreflight runs the environment checks of the install on this host and
+// prints what it found, without changing anything, so a server can be
+// validated before it is committed to. It exits with exitPreflight when a
+// check fails; warnings are things the install works around or asks about.
+func runPreflight(args []string) error {
+	flags := flag.NewFlagSet("preflight", flag.ExitOnError)
+	answersPath := flags.String("answers", "", "Answers file to take the domains, ports and container runtime from")
+	domain := flags.String("domain", "", "Dashboard domain whose DNS records to check (default: from --answers)")
+	baseDomain := flags.String("base-domain", "", "Base domain of the resources whose wildcard record to check (default: from --answers)")
+	runtimeFlag := flags.String("runtime", "", "Container runtime to check: docker or podman (default: from --answers, else docker)")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	config := installer.DefaultConfig()
+	if *answersPath != "" {
+		var err error
+		if config, err = loadAnswers(*answersPath); err != nil {
+			return withExitCode(exitUsage, err)
+		}
+	}
+	if *domain != "" {
+		config.DashboardDomain = *domain
+	}
+	if *baseDomain != "" {
+		config.BaseDomain = *baseDomain
+	}
+	if *runtimeFlag != "" {
+		config.InstallationContainerType = SupportedContainer(*runtimeFlag)
+	}
+	if config.InstallationContainerType != Docker && config.InstallationContainerType != Podman {
+		return usageErrorf("unknown runtime %q: use docker or podman", config.InstallationContainerType)
+	}
+
+	section := ""
+	report := installer.Preflight(config, func(e installer.Event) {
+		if e.Section != section {
+			if section != "" {
+				fmt.Println()
+			}
+			section = e.Section
+			fmt.Printf("=== %s ===\n", section)
+		}
+		fmt.Printf("%-9s%s\n", e.Status, e.Message)
+	})
+
+	failures := report.Count(installer.StatusFail)
+	fmt.Printf("\n%d failure(s), %d warning(s).\n", failures, report.Count(installer.StatusWarn))
+	if failures > 0 {
+		return preflightErrorf("this host does not meet the requirements of the installation")
+	}
+	fmt.Println("This host can run the installation.")
+	return nil
+}
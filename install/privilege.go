@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// doasConfigs are where doas is configured: /etc on Linux and OpenBSD,
+// /usr/local/etc where it comes from the FreeBSD ports.
+var doasConfigs = []string{"/etc/doas.conf", "/usr/local/etc/doas.conf"}
+
+// privilegeTool returns the command that runs a single step as root from a
+// non-root session, sudo or doas, or an empty string when the installer
+// runs as root or neither is available. doas comes first where it is
+// configured, as sudo may be installed without the user being allowed to
+// use it.
+func privilegeTool() string {
+	if os.Geteuid() == 0 {
+		return ""
+	}
+	tools := []string{"sudo", "doas"}
+	for _, path := range doasConfigs {
+		if _, err := os.Stat(path); err == nil {
+			tools = []string{"doas", "sudo"}
+			break
+		}
+	}
+	for _, tool := range tools {
+		if _, err := exec.LookPath(tool); err == nil {
+			return tool
+		}
+	}
+	return ""
+}
+
+// canBecomeRoot reports whether steps that need root can run: as root, or
+// each one through sudo or doas.
+func canBecomeRoot() bool {
+	return os.Geteuid() == 0 || privilegeTool() != ""
+}
+
+// rootCommand returns the command running name with args as root, through
+// sudo or doas when the installer does not run as root.
+func rootCommand(name string, args ...string) *exec.Cmd {
+	if tool := privilegeTool(); tool != "" {
+		return exec.Command(tool, append([]string{name}, args...)...)
+	}
+	return exec.Command(name, args...)
+}
+
+// runAsRoot runs a command as root, showing its output. what describes the
+// command for the notice printed before it is escalated.
+func runAsRoot(what, name string, args ...string) error {
+	if tool := privilegeTool(); tool != "" {
+		fmt.Printf("Running %s as root through %s...\n", what, tool)
+	}
+	cmd := rootCommand(name, args...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return hostOps.Run(cmd)
+}
+
+// writeFileAsRoot writes a file only root may write, such as one under /etc.
+func writeFileAsRoot(path string, data []byte, mode os.FileMode) error {
+	if os.Geteuid() == 0 {
+		return hostOps.WriteFile(path, data, mode)
+	}
+	fmt.Printf("Writing %s as root through %s...\n", path, privilegeTool())
+	cmd := rootCommand("sh", "-c", `cat > "$1" && chmod "$2" "$1"`, "sh", path, fmt.Sprintf("%o", mode.Perm()))
+	cmd.Stdin = bytes.NewReader(data)
+	if out, err := hostOps.CombinedOutput(cmd); err != nil {
+		return fmt.Errorf("%v: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
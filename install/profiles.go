@@ -0,0 +1,230 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// composeEnvFile is read by docker compose from the project directory; its
+// COMPOSE_PROFILES selects the optional services that run.
+const composeEnvFile = ".env"
+
+// composeProfiles are the optional services of the compose file, by the
+// profile that enables them.
+var composeProfiles = map[string]string{
+	"crowdsec":   "CrowdSec intrusion detection, set up with --crowdsec",
+	"monitoring": "Prometheus with alerting through Alertmanager, node-exporter and cAdvisor on 127.0.0.1",
+	"backups":    "nightly archive of the config directory into scheduled-backups/",
+	"examples":   "whoami container behind the example resource, see the post-install offer",
+}
+
+// readComposeProfiles returns the profiles enabled in the .env file next to
+// composePath.
+func readComposeProfiles(composePath string) []string {
+	data, err := os.ReadFile(filepath.Join(filepath.Dir(composePath), composeEnvFile))
+	if err != nil {
+		return nil
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if value, ok := strings.CutPrefix(strings.TrimSpace(line), "COMPOSE_PROFILES="); ok {
+			var profiles []string
+			for _, p := range strings.Split(strings.Trim(value, `"'`), ",") {
+				if p = strings.TrimSpace(p); p != "" {
+					profiles = append(profiles, p)
+				}
+			}
+			return profiles
+		}
+	}
+	return nil
+}
+
+// writeComposeProfiles sets COMPOSE_PROFILES in the .env file next to
+// composePath, keeping the other variables.
+func writeComposeProfiles(composePath string, profiles []string) error {
+	path := filepath.Join(filepath.Dir(composePath), composeEnvFile)
+	var lines []string
+	if data, err := os.ReadFile(path); err == nil {
+		for _, line := range strings.Split(strings.TrimRight(string(data), "\n"), "\n") {
+			if !strings.HasPrefix(strings.TrimSpace(line), "COMPOSE_PROFILES=") {
+				lines = append(lines, line)
+			}
+		}
+	}
+	lines = append(lines, "COMPOSE_PROFILES="+strings.Join(profiles, ","))
+	if err := os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %v", path, err)
+	}
+	return nil
+}
+
+// enableComposeProfile adds profile to COMPOSE_PROFILES.
+func enableComposeProfile(composePath, profile string) error {
+	profiles := readComposeProfiles(composePath)
+	if !slices.Contains(profiles, profile) {
+		profiles = append(profiles, profile)
+	}
+	return writeComposeProfiles(composePath, profiles)
+}
+
+// composeProfileArgs returns the --profile arguments for podman-compose,
+// which only honours profiles given on the command line.
+func composeProfileArgs(composePath string) []string {
+	var args []string
+	for _, profile := range readComposeProfiles(composePath) {
+		args = append(args, "--profile", profile)
+	}
+	return args
+}
+
+// podmanComposeArgs returns the podman-compose arguments for a subcommand
+// against docker-compose.yml, with the enabled profiles.
+func podmanComposeArgs(args ...string) []string {
+	result := append([]string{"-f", composeFile}, composeProfileArgs(composeFile)...)
+	return append(result, args...)
+}
+
+// serviceProfileActive reports whether a service of the compose file runs
+// with the enabled profiles: services without profiles always do.
+func serviceProfileActive(service map[string]any, enabled []string) bool {
+	profiles, _ := service["profiles"].([]any)
+	if len(profiles) == 0 {
+		return true
+	}
+	for _, p := range profiles {
+		if name, ok := p.(string); ok && slices.Contains(enabled, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// profileServices returns the services of the compose file that profile
+// enables.
+func profileServices(composePath, profile string) ([]string, error) {
+	data, err := os.ReadFile(composePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %v", composePath, err)
+	}
+	var compose map[string]any
+	if err := yaml.Unmarshal(data, &compose); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %v", composePath, err)
+	}
+	services, _ := compose["services"].(map[string]any)
+	var names []string
+	for _, name := range sortedKeys(services) {
+		service, _ := services[name].(map[string]any)
+		profiles, _ := service["profiles"].([]any)
+		if slices.Contains(profiles, any(profile)) {
+			names = append(names, name)
+		}
+	}
+	return names, nil
+}
+
+// runProfiles lists the optional services or enables or disables one, then
+// brings the stack in line.
+func runProfiles(args []string) error {
+	flags := flag.NewFlagSet("profiles", flag.ExitOnError)
+	dir := flags.String("dir", "", "Installation directory")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: installer profiles [--dir dir] [enable|disable <profile>]")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if err := enterInstallDir(*dir); err != nil {
+		return err
+	}
+	enabled := readComposeProfiles(composeFile)
+
+	if flags.NArg() == 0 {
+		for _, name := range sortedKeys(composeProfiles) {
+			state := "disabled"
+			if slices.Contains(enabled, name) {
+				state = "enabled"
+			}
+			fmt.Printf("%-12s %-9s %s\n", name, state, composeProfiles[name])
+		}
+		return nil
+	}
+	if flags.NArg() != 2 || (flags.Arg(0) != "enable" && flags.Arg(0) != "disable") {
+		flags.Usage()
+		return usageErrorf("expected enable or disable and a profile")
+	}
+	action, profile := flags.Arg(0), flags.Arg(1)
+	if _, ok := composeProfiles[profile]; !ok {
+		return usageErrorf("unknown profile %q: use %s", profile, strings.Join(sortedKeys(composeProfiles), ", "))
+	}
+	services, err := profileServices(composeFile, profile)
+	if err != nil {
+		return err
+	}
+	if len(services) == 0 {
+		return fmt.Errorf("%s has no services in the %s profile; it was generated by an older installer", composeFile, profile)
+	}
+	if profile == "crowdsec" && action == "enable" {
+		if _, err := os.Stat("config/crowdsec/acquis.d"); err != nil {
+			return preflightErrorf("CrowdSec is not set up yet: run the installer with --crowdsec, which also configures the Traefik bouncer")
+		}
+	}
+
+	containerType := detectContainerType()
+	if containerType == Undefined {
+		return preflightErrorf("could not detect the container runtime of the installation")
+	}
+
+	if profile == "monitoring" {
+		if err := updateStoredAnswers(func(config *Config) { config.EnableMonitoring = action == "enable" }); err != nil {
+			return err
+		}
+	}
+
+	if action == "enable" {
+		if err := enableComposeProfile(composeFile, profile); err != nil {
+			return err
+		}
+		recordChange(fmt.Sprintf("Enable the %s profile", profile))
+		if err := composeCommand(containerType, "up", "-d"); err != nil {
+			return fmt.Errorf("failed to start the %s services: %v", profile, err)
+		}
+		fmt.Printf("Enabled %s: %s.\n", profile, strings.Join(services, ", "))
+		return nil
+	}
+
+	// The containers are looked up while the profile is still enabled
+	running, err := composeServices(composeFile)
+	if err != nil {
+		return err
+	}
+	var containers []string
+	for _, service := range running {
+		if slices.Contains(services, service.Name) {
+			containers = append(containers, service.Container)
+		}
+	}
+	enabled = slices.DeleteFunc(enabled, func(p string) bool { return p == profile })
+	if err := writeComposeProfiles(composeFile, enabled); err != nil {
+		return err
+	}
+	recordChange(fmt.Sprintf("Disable the %s profile", profile))
+	if len(containers) > 0 {
+		cmd := containerCommand(containerType, append([]string{"rm", "--force"}, containers...)...)
+		cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+		if err := runCommand(cmd); err != nil {
+			return fmt.Errorf("failed to remove the %s containers: %v", profile, err)
+		}
+	}
+	fmt.Printf("Disabled %s: %s.\n", profile, strings.Join(services, ", "))
+	if profile == "crowdsec" {
+		fmt.Println("Traefik still routes through the CrowdSec bouncer middleware; remove it from config/traefik/dynamic_config.yml and restart Traefik.")
+	}
+	return nil
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// provisioningFile describes what --provision sets up once a fresh install
+// is healthy: the server admin, which completes the initial setup, and
+// organizations with their roles and invites.
+//
+//	admin:
+//	  email: admin@example.com
+//	  password_env: PANGOLIN_ADMIN_PASSWORD
+//	orgs:
+//	  - id: acme
+//	    name: Acme
+//	    roles:
+//	      - name: Developers
+//	    invites:
+//	      - email: ops@example.com
+//	        role: Admin
+//	      - email: dev@example.com
+//	        role: Developers
+type provisioningFile struct {
+	Admin struct {
+		Email string `yaml:"email"`
+		// Password is generated and printed when neither it nor PasswordEnv
+		// is set
+		Password    string `yaml:"password"`
+		PasswordEnv string `yaml:"password_env"`
+	} `yaml:"admin"`
+	Orgs []provisionedOrg `yaml:"orgs"`
+}
+
+type provisionedOrg struct {
+	ID    string `yaml:"id"`
+	Name  string `yaml:"name"`
+	Roles []struct {
+		Name        string `yaml:"name"`
+		Description string `yaml:"description"`
+	} `yaml:"roles"`
+	// Invites add users; invite with the built-in Admin role for more
+	// administrators of the organization
+	Invites []struct {
+		Email      string `yaml:"email"`
+		Role       string `yaml:"role"`
+		ValidHours int    `yaml:"valid_hours"`
+		SendEmail  bool   `yaml:"send_email"`
+	} `yaml:"invites"`
+}
+
+func init() {
+	registerStep(installStep{
+		Name:  "provision",
+		Order: 105,
+		When: func(state *installState) bool {
+			return containersStarting(state) && state.Provisioning != nil
+		},
+		Run: func(state *installState) error {
+			if err := provisionInstance(state.Config, state.Provisioning); err != nil {
+				return withExitCode(exitPartial, fmt.Errorf("the installation is running, but provisioning failed: %v", err))
+			}
+			state.Provisioned = true
+			return nil
+		},
+		Live: true,
+	})
+}
+
+// loadProvisioningFile reads and validates a provisioning file, before the
+// install starts.
+func loadProvisioningFile(path string) (*provisioningFile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading provisioning file: %w", err)
+	}
+	var file provisioningFile
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("error parsing provisioning file: %w", err)
+	}
+
+	if !strings.Contains(file.Admin.Email, "@") {
+		return nil, fmt.Errorf("provisioning file: admin.email is required")
+	}
+	if file.Admin.PasswordEnv != "" && os.Getenv(file.Admin.PasswordEnv) == "" {
+		return nil, fmt.Errorf("provisioning file: $%s is not set", file.Admin.PasswordEnv)
+	}
+	seen := map[string]bool{}
+	for _, org := range file.Orgs {
+		if org.ID == "" || org.Name == "" {
+			return nil, fmt.Errorf("provisioning file: every org needs an id and a name")
+		}
+		if seen[org.ID] {
+			return nil, fmt.Errorf("provisioning file: org %s is listed twice", org.ID)
+		}
+		seen[org.ID] = true
+		for _, role := range org.Roles {
+			if role.Name == "" {
+				return nil, fmt.Errorf("provisioning file: a role of org %s has no name", org.ID)
+			}
+		}
+		for _, invite := range org.Invites {
+			if !strings.Contains(invite.Email, "@") || invite.Role == "" {
+				return nil, fmt.Errorf("provisioning file: every invite of org %s needs an email and a role", org.ID)
+			}
+		}
+	}
+	return &file, nil
+}
+
+// provisionInstance completes the initial setup with the admin of the
+// provisioning file and creates its organizations, roles and invites.
+func provisionInstance(config Config, file *provisioningFile) error {
+	fmt.Println("\n=== Provisioning ===")
+	containerType := config.InstallationContainerType
+	if err := waitForPangolinAPI(containerType); err != nil {
+		return err
+	}
+
+	password, generated := file.Admin.Password, false
+	if file.Admin.PasswordEnv != "" {
+		password = os.Getenv(file.Admin.PasswordEnv)
+	}
+	if password == "" {
+		var err error
+		if password, err = randomAdminPassword(); err != nil {
+			return err
+		}
+		generated = true
+	}
+	api, err := createServerAdmin(containerType, file.Admin.Email, password)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Created the server admin %s.\n", file.Admin.Email)
+
+	var links []string
+	for _, org := range file.Orgs {
+		if err := createOrg(api, org.ID, org.Name); err != nil {
+			return err
+		}
+		fmt.Printf("Created organization %s.\n", org.ID)
+
+		for _, role := range org.Roles {
+			if err := api.do("PUT", "/org/"+org.ID+"/role", map[string]any{"name": role.Name, "description": role.Description}, nil); err != nil {
+				return fmt.Errorf("failed to create role %s in %s: %v", role.Name, org.ID, err)
+			}
+		}
+
+		var roles struct {
+			Roles []struct {
+				RoleID int    `json:"roleId"`
+				Name   string `json:"name"`
+			} `json:"roles"`
+		}
+		if len(org.Invites) > 0 {
+			if err := api.do("GET", "/org/"+org.ID+"/roles", nil, &roles); err != nil {
+				return fmt.Errorf("failed to list the roles of %s: %v", org.ID, err)
+			}
+		}
+		for _, invite := range org.Invites {
+			roleID := 0
+			for _, r := range roles.Roles {
+				if strings.EqualFold(r.Name, invite.Role) {
+					roleID = r.RoleID
+				}
+			}
+			if roleID == 0 {
+				return fmt.Errorf("org %s has no role %q to invite %s with", org.ID, invite.Role, invite.Email)
+			}
+			validHours := invite.ValidHours
+			if validHours == 0 {
+				validHours = 168
+			}
+			var created struct {
+				InviteLink string `json:"inviteLink"`
+			}
+			if err := api.do("POST", "/org/"+org.ID+"/create-invite", map[string]any{
+				"email": invite.Email, "roleId": roleID, "validHours": validHours, "sendEmail": invite.SendEmail,
+			}, &created); err != nil {
+				return fmt.Errorf("failed to invite %s to %s: %v", invite.Email, org.ID, err)
+			}
+			links = append(links, fmt.Sprintf("  %s (%s, %s): %s", invite.Email, org.ID, invite.Role, created.InviteLink))
+		}
+	}
+
+	fmt.Printf("\nLog in at https://%s as %s.\n", config.DashboardDomain, file.Admin.Email)
+	if generated {
+		fmt.Printf("Generated admin password: %s\nChange it after logging in; it is not stored anywhere.\n", password)
+	}
+	if len(links) > 0 {
+		fmt.Println("Invite links:")
+		for _, link := range links {
+			fmt.Println(link)
+		}
+	}
+	return nil
+}
+
+// createServerAdmin completes the initial setup with the setup token from
+// the logs of Pangolin and returns a dashboard client logged in as the new
+// admin.
+func createServerAdmin(containerType SupportedContainer, email, password string) (*apiClient, error) {
+	token, err := waitForSetupToken(containerType, serviceContainer("pangolin"))
+	if token == "" {
+		return nil, fmt.Errorf("no setup token found: %v", err)
+	}
+	api := newDashboardClient(containerType)
+	if err := api.do("PUT", "/auth/set-server-admin", map[string]any{
+		"email": email, "password": password, "setupToken": token,
+	}, nil); err != nil {
+		return nil, fmt.Errorf("failed to create the admin account: %v", err)
+	}
+	if err := api.login(email, password); err != nil {
+		return nil, fmt.Errorf("failed to log in: %v", err)
+	}
+	return api, nil
+}
+
+// createOrg creates an organization with the default subnets.
+func createOrg(api *apiClient, id, name string) error {
+	var defaults struct {
+		Subnet        string `json:"subnet"`
+		UtilitySubnet string `json:"utilitySubnet"`
+	}
+	if err := api.do("GET", "/pick-org-defaults", nil, &defaults); err != nil {
+		return fmt.Errorf("failed to get organization defaults: %v", err)
+	}
+	if err := api.do("PUT", "/org", map[string]any{
+		"orgId": id, "name": name, "subnet": defaults.Subnet, "utilitySubnet": defaults.UtilitySubnet,
+	}, nil); err != nil {
+		return fmt.Errorf("failed to create organization %s: %v", id, err)
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// prunableImages are the images the installer upgrades. Badger is not an
+// image: it is a Traefik plugin fetched into the traefik container, so old
+// versions disappear when the container is recreated.
+var prunableImages = []string{"fosrl/pangolin", "fosrl/gerbil"}
+
+// localImage is an image version present in the container runtime.
+type localImage struct {
+	Repository string
+	Tag        string
+	ID         string
+	Created    string
+}
+
+// listLocalImages returns the local versions of repository, newest first.
+func listLocalImages(containerType SupportedContainer, repository string) ([]localImage, error) {
+	out, err := containerCommand(containerType, "images", "--format", "{{.Repository}}\t{{.Tag}}\t{{.ID}}\t{{.CreatedAt}}").Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list images: %v", err)
+	}
+
+	var images []localImage
+	for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		fields := strings.SplitN(line, "\t", 4)
+		if len(fields) < 4 || normalizeRepository(fields[0]) != repository || fields[1] == "<none>" {
+			continue
+		}
+		images = append(images, localImage{Repository: fields[0], Tag: fields[1], ID: fields[2], Created: fields[3]})
+	}
+
+	// CreatedAt sorts chronologically as text in both runtimes
+	slices.SortFunc(images, func(a, b localImage) int {
+		return strings.Compare(b.Created, a.Created)
+	})
+	return images, nil
+}
+
+// normalizeRepository strips the default registry Podman includes in
+// repository names.
+func normalizeRepository(repository string) string {
+	return strings.TrimPrefix(repository, "docker.io/")
+}
+
+// pruneOldImages removes versions of the installer-managed images that the
+// compose file no longer references, keeping the keepLast most recent of
+// them for rollbacks.
+func pruneOldImages(containerType SupportedContainer, keepLast int, confirm bool) error {
+	var stale []localImage
+	for _, repository := range prunableImages {
+		inUse, _ := ReadComposeImageTag(composeFile, strings.TrimPrefix(repository, "fosrl/"))
+
+		images, err := listLocalImages(containerType, repository)
+		if err != nil {
+			return err
+		}
+
+		kept := 0
+		for _, image := range images {
+			if image.Tag == inUse {
+				continue
+			}
+			if kept < keepLast {
+				kept++
+				continue
+			}
+			stale = append(stale, image)
+		}
+	}
+
+	if len(stale) == 0 {
+		return nil
+	}
+
+	fmt.Println("\n=== Old Images ===")
+	for _, image := range stale {
+		fmt.Printf("%s:%s (%s)\n", image.Repository, image.Tag, image.ID)
+	}
+	if confirm && !readBool(msg("promptPruneImages", len(stale)), true) {
+		return nil
+	}
+
+	removed := 0
+	for _, image := range stale {
+		ref := image.Repository + ":" + image.Tag
+		if out, err := containerCommand(containerType, "rmi", ref).CombinedOutput(); err != nil {
+			fmt.Printf("Warning: could not remove %s: %s\n", ref, strings.TrimSpace(string(out)))
+			continue
+		}
+		removed++
+	}
+	fmt.Printf("Removed %d old image(s).\n", removed)
+	return nil
+}
@@ -0,0 +1,444 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// A minimal QR code encoder for the setup URL: byte mode, error correction
+// level L and versions 1-10, which holds up to 271 bytes. It follows ISO/IEC
+// 18004 and the structure of Project Nayuki's reference implementation.
+
+// qrLevelL lists, per version, the total codewords, the error correction
+// codewords per block and the number of blocks at error correction level L.
+var qrLevelL = []struct{ total, ecc, blocks int }{
+	{26, 7, 1}, {44, 10, 1}, {70, 15, 1}, {100, 20, 1}, {134, 26, 1},
+	{172, 18, 2}, {196, 20, 2}, {242, 24, 2}, {292, 30, 2}, {346, 18, 4},
+}
+
+// qrAlignment lists the alignment pattern centers per version.
+var qrAlignment = [][]int{
+	nil, {6, 18}, {6, 22}, {6, 26}, {6, 30},
+	{6, 34}, {6, 22, 38}, {6, 24, 42}, {6, 26, 46}, {6, 28, 50},
+}
+
+type qrCode struct {
+	size     int
+	modules  [][]bool // true is dark, indexed [y][x]
+	function [][]bool
+}
+
+// encodeQR returns the QR code for text.
+func encodeQR(text string) (*qrCode, error) {
+	data := []byte(text)
+
+	version := 0
+	var countBits int
+	for v := 1; v <= len(qrLevelL); v++ {
+		countBits = 8
+		if v >= 10 {
+			countBits = 16
+		}
+		spec := qrLevelL[v-1]
+		if 4+countBits+8*len(data) <= (spec.total-spec.ecc*spec.blocks)*8 {
+			version = v
+			break
+		}
+	}
+	if version == 0 {
+		return nil, fmt.Errorf("text too long for a QR code: %d bytes", len(data))
+	}
+	spec := qrLevelL[version-1]
+	dataCodewords := spec.total - spec.ecc*spec.blocks
+
+	// Mode indicator, character count, data, terminator and padding
+	var bits []bool
+	appendBits := func(value, n int) {
+		for i := n - 1; i >= 0; i-- {
+			bits = append(bits, value>>i&1 == 1)
+		}
+	}
+	appendBits(0b0100, 4)
+	appendBits(len(data), countBits)
+	for _, b := range data {
+		appendBits(int(b), 8)
+	}
+	appendBits(0, min(4, dataCodewords*8-len(bits)))
+	appendBits(0, (8-len(bits)%8)%8)
+	for pad := 0xEC; len(bits) < dataCodewords*8; pad ^= 0xEC ^ 0x11 {
+		appendBits(pad, 8)
+	}
+	codewords := make([]byte, dataCodewords)
+	for i, bit := range bits {
+		if bit {
+			codewords[i/8] |= 1 << (7 - i%8)
+		}
+	}
+
+	q := newQRCode(version)
+	q.drawCodewords(interleaveBlocks(codewords, spec.total, spec.ecc, spec.blocks))
+
+	bestMask, bestPenalty := 0, -1
+	for mask := range 8 {
+		q.applyMask(mask)
+		q.drawFormatBits(mask)
+		if penalty := q.penalty(); bestPenalty < 0 || penalty < bestPenalty {
+			bestMask, bestPenalty = mask, penalty
+		}
+		q.applyMask(mask) // masks are their own inverse
+	}
+	q.applyMask(bestMask)
+	q.drawFormatBits(bestMask)
+	return q, nil
+}
+
+// interleaveBlocks splits the data codewords into blocks, appends each
+// block's error correction codewords and interleaves the result.
+func interleaveBlocks(data []byte, total, ecc, numBlocks int) []byte {
+	shortBlocks := numBlocks - total%numBlocks
+	shortLen := total/numBlocks - ecc
+
+	divisor := reedSolomonDivisor(ecc)
+	var blocks, eccBlocks [][]byte
+	for i, offset := 0, 0; i < numBlocks; i++ {
+		n := shortLen
+		if i >= shortBlocks {
+			n++
+		}
+		block := data[offset : offset+n]
+		offset += n
+		blocks = append(blocks, block)
+		eccBlocks = append(eccBlocks, reedSolomonRemainder(block, divisor))
+	}
+
+	var result []byte
+	for i := 0; i <= shortLen; i++ {
+		for _, block := range blocks {
+			if i < len(block) {
+				result = append(result, block[i])
+			}
+		}
+	}
+	for i := range ecc {
+		for _, block := range eccBlocks {
+			result = append(result, block[i])
+		}
+	}
+	return result
+}
+
+func gfMultiply(x, y byte) byte {
+	var z int
+	for i := 7; i >= 0; i-- {
+		z = z<<1 ^ (z>>7)*0x11D
+		z ^= int(y>>i&1) * int(x)
+	}
+	return byte(z)
+}
+
+func reedSolomonDivisor(degree int) []byte {
+	result := make([]byte, degree)
+	result[degree-1] = 1
+	root := byte(1)
+	for range degree {
+		for j := range result {
+			result[j] = gfMultiply(result[j], root)
+			if j+1 < len(result) {
+				result[j] ^= result[j+1]
+			}
+		}
+		root = gfMultiply(root, 0x02)
+	}
+	return result
+}
+
+func reedSolomonRemainder(data, divisor []byte) []byte {
+	result := make([]byte, len(divisor))
+	for _, b := range data {
+		factor := b ^ result[0]
+		copy(result, result[1:])
+		result[len(result)-1] = 0
+		for i, d := range divisor {
+			result[i] ^= gfMultiply(d, factor)
+		}
+	}
+	return result
+}
+
+// newQRCode draws the function patterns of a version.
+func newQRCode(version int) *qrCode {
+	size := 17 + 4*version
+	q := &qrCode{size: size}
+	for range size {
+		q.modules = append(q.modules, make([]bool, size))
+		q.function = append(q.function, make([]bool, size))
+	}
+
+	for i := range size {
+		q.set(6, i, i%2 == 0)
+		q.set(i, 6, i%2 == 0)
+	}
+	for _, c := range [][2]int{{3, 3}, {size - 4, 3}, {3, size - 4}} {
+		for dy := -4; dy <= 4; dy++ {
+			for dx := -4; dx <= 4; dx++ {
+				x, y := c[0]+dx, c[1]+dy
+				if x >= 0 && x < size && y >= 0 && y < size {
+					dist := max(abs(dx), abs(dy))
+					q.set(x, y, dist != 2 && dist != 4)
+				}
+			}
+		}
+	}
+
+	positions := qrAlignment[version-1]
+	last := len(positions) - 1
+	for i, x := range positions {
+		for j, y := range positions {
+			if i == 0 && j == 0 || i == 0 && j == last || i == last && j == 0 {
+				continue
+			}
+			for dy := -2; dy <= 2; dy++ {
+				for dx := -2; dx <= 2; dx++ {
+					q.set(x+dx, y+dy, max(abs(dx), abs(dy)) != 1)
+				}
+			}
+		}
+	}
+
+	// Reserve the format areas; the real bits are drawn once the mask is known
+	q.drawFormatBits(0)
+
+	if version >= 7 {
+		rem := version
+		for range 12 {
+			rem = rem<<1 ^ (rem>>11)*0x1F25
+		}
+		bits := version<<12 | rem
+		for i := range 18 {
+			bit := bits>>i&1 == 1
+			a, b := size-11+i%3, i/3
+			q.set(a, b, bit)
+			q.set(b, a, bit)
+		}
+	}
+	return q
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+// set draws a function module at column x, row y.
+func (q *qrCode) set(x, y int, dark bool) {
+	q.modules[y][x] = dark
+	q.function[y][x] = true
+}
+
+func (q *qrCode) drawFormatBits(mask int) {
+	data := 0b01<<3 | mask // error correction level L
+	rem := data
+	for range 10 {
+		rem = rem<<1 ^ (rem>>9)*0x537
+	}
+	bits := (data<<10 | rem) ^ 0x5412
+	bit := func(i int) bool { return bits>>i&1 == 1 }
+
+	for i := range 6 {
+		q.set(8, i, bit(i))
+	}
+	q.set(8, 7, bit(6))
+	q.set(8, 8, bit(7))
+	q.set(7, 8, bit(8))
+	for i := 9; i < 15; i++ {
+		q.set(14-i, 8, bit(i))
+	}
+	for i := range 8 {
+		q.set(q.size-1-i, 8, bit(i))
+	}
+	for i := 8; i < 15; i++ {
+		q.set(8, q.size-15+i, bit(i))
+	}
+	q.set(8, q.size-8, true)
+}
+
+// drawCodewords places the data in the zigzag order of the standard.
+func (q *qrCode) drawCodewords(data []byte) {
+	i := 0
+	for right := q.size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5
+		}
+		for vert := range q.size {
+			for j := range 2 {
+				x := right - j
+				y := vert
+				if (right+1)&2 == 0 {
+					y = q.size - 1 - vert
+				}
+				if !q.function[y][x] && i < len(data)*8 {
+					q.modules[y][x] = data[i>>3]>>(7-i&7)&1 == 1
+					i++
+				}
+			}
+		}
+	}
+}
+
+func (q *qrCode) applyMask(mask int) {
+	for y := range q.size {
+		for x := range q.size {
+			var invert bool
+			switch mask {
+			case 0:
+				invert = (x+y)%2 == 0
+			case 1:
+				invert = y%2 == 0
+			case 2:
+				invert = x%3 == 0
+			case 3:
+				invert = (x+y)%3 == 0
+			case 4:
+				invert = (x/3+y/2)%2 == 0
+			case 5:
+				invert = x*y%2+x*y%3 == 0
+			case 6:
+				invert = (x*y%2+x*y%3)%2 == 0
+			case 7:
+				invert = ((x+y)%2+x*y%3)%2 == 0
+			}
+			if invert && !q.function[y][x] {
+				q.modules[y][x] = !q.modules[y][x]
+			}
+		}
+	}
+}
+
+// penalty scores a masked symbol with the four rules of the standard; the
+// mask with the lowest score is the easiest to scan.
+func (q *qrCode) penalty() int {
+	penalty, dark := 0, 0
+	finderLike := [][]bool{
+		{true, false, true, true, true, false, true, false, false, false, false},
+		{false, false, false, false, true, false, true, true, true, false, true},
+	}
+	for _, horizontal := range []bool{true, false} {
+		at := func(a, b int) bool {
+			if horizontal {
+				return q.modules[a][b]
+			}
+			return q.modules[b][a]
+		}
+		for a := range q.size {
+			run := 1
+			for b := 1; b <= q.size; b++ {
+				if b < q.size && at(a, b) == at(a, b-1) {
+					run++
+					continue
+				}
+				if run >= 5 {
+					penalty += run - 2
+				}
+				run = 1
+			}
+			for b := 0; b+11 <= q.size; b++ {
+				for _, pattern := range finderLike {
+					match := true
+					for k, want := range pattern {
+						if at(a, b+k) != want {
+							match = false
+							break
+						}
+					}
+					if match {
+						penalty += 40
+					}
+				}
+			}
+		}
+	}
+	for y := range q.size {
+		for x := range q.size {
+			if q.modules[y][x] {
+				dark++
+			}
+			if x+1 < q.size && y+1 < q.size {
+				c := q.modules[y][x]
+				if q.modules[y][x+1] == c && q.modules[y+1][x] == c && q.modules[y+1][x+1] == c {
+					penalty += 3
+				}
+			}
+		}
+	}
+	total := q.size * q.size
+	return penalty + abs(dark*100/total-50)/5*10
+}
+
+// Values of --qr.
+const (
+	qrURL   = "url"
+	qrToken = "token"
+	qrOff   = "off"
+)
+
+// qrMode selects what the setup QR code encodes. Embedding the token saves
+// typing it on a phone, but leaves it in the browser history.
+var qrMode = qrURL
+
+// printSetupQRCode prints a QR code linking to the initial setup page so it
+// can be opened on a phone or tablet, optionally with the token filled in.
+func printSetupQRCode(dashboardDomain, token string) {
+	if qrMode == qrOff || plainMode {
+		return
+	}
+
+	link := fmt.Sprintf("https://%s/auth/initial-setup", dashboardDomain)
+	if qrMode == qrToken && token != "" {
+		link += "?token=" + url.QueryEscape(token)
+	}
+	q, err := encodeQR(link)
+	if err != nil {
+		return
+	}
+
+	fmt.Println(msg("setupQRCode"))
+	renderQR(os.Stdout, q)
+}
+
+// renderQR draws the code with half-block characters, two rows per line and
+// a two-module quiet zone. Light modules are drawn as blocks, as terminals
+// usually have a dark background.
+func renderQR(w io.Writer, q *qrCode) {
+	const margin = 2
+	light := func(x, y int) bool {
+		x, y = x-margin, y-margin
+		if x < 0 || y < 0 || x >= q.size || y >= q.size {
+			return true
+		}
+		return !q.modules[y][x]
+	}
+
+	var b strings.Builder
+	for y := 0; y < q.size+2*margin; y += 2 {
+		for x := range q.size + 2*margin {
+			top, bottom := light(x, y), y+1 < q.size+2*margin && light(x, y+1)
+			switch {
+			case top && bottom:
+				b.WriteRune('█')
+			case top:
+				b.WriteRune('▀')
+			case bottom:
+				b.WriteRune('▄')
+			default:
+				b.WriteRune(' ')
+			}
+		}
+		b.WriteByte('\n')
+	}
+	io.WriteString(w, b.String())
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/fosrl/pangolin/install/pkg/installer"
+)
+
+// runRender renders every configuration file from an answers file into an
+// output directory without touching Docker or the rest of the host. The
+// output is deterministic for a given answers file, so it can be committed
+// and reviewed before being deployed by other tooling.
+func runRender(args []string) error {
+	flags := flag.NewFlagSet("render", flag.ExitOnError)
+	answersPath := flags.String("answers", "", "Path to the YAML answers file (required)")
+	outDir := flags.String("out", "./manifests", "Directory to write the rendered files to")
+	flags.StringVar(&templatesDir, "templates-dir", "", "Directory of templates that override the embedded config files")
+	telemetryFlag(flags)
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if *answersPath == "" {
+		return usageErrorf("--answers is required")
+	}
+
+	config, err := loadAnswers(*answersPath)
+	if err != nil {
+		return err
+	}
+
+	// Telemetry stays off unless the answers file or --telemetry enables it
+	if telemetryChoice != nil {
+		config.Telemetry = *telemetryChoice
+	}
+
+	if missing := installer.MissingAnswers(config); len(missing) > 0 {
+		return fmt.Errorf("answers file is missing required keys: %s", strings.Join(missing, ", "))
+	}
+
+	// A random secret would make the output differ on every run.
+	if config.Secret == "" {
+		return fmt.Errorf("answers file is missing required key: secret (generate one with: openssl rand -base64 32)")
+	}
+
+	if err := installer.Validate(config); err != nil {
+		return localizeError(err)
+	}
+	if config.AutoUpdate == installer.AutoUpdateTimer {
+		fmt.Println("Note: the auto_update timer is a host systemd unit and is not rendered; it is installed by the interactive installer.")
+	}
+
+	// CrowdSec is layered on top of an existing install and is not rendered here.
+	config.DoCrowdsecInstall = false
+
+	if err := renderConfigFiles(config, *outDir); err != nil {
+		return fmt.Errorf("error rendering config files: %w", err)
+	}
+
+	if err := moveFile(filepath.Join(*outDir, "config", "docker-compose.yml"), filepath.Join(*outDir, "docker-compose.yml")); err != nil {
+		return fmt.Errorf("error moving docker-compose.yml: %w", err)
+	}
+	if config.EnableMonitoring {
+		if err := enableComposeProfile(filepath.Join(*outDir, "docker-compose.yml"), "monitoring"); err != nil {
+			return err
+		}
+	}
+
+	fmt.Printf("Rendered configuration to %s\n", *outDir)
+	return nil
+}
@@ -0,0 +1,454 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/fosrl/pangolin/install/pkg/installer"
+)
+
+// repairFiles are the files an installation cannot start without, checked
+// and fixed one by one by repair.
+var repairFiles = []string{composeFile, appConfigFile, traefikStaticFile, traefikDynamicFile}
+
+// repairFinding is a problem repair found, what most likely caused it and
+// the fixes it offers, the most targeted first.
+type repairFinding struct {
+	Problem string
+	Cause   string
+	Fixes   []repairFix
+}
+
+// repairFix is a single change that addresses a finding.
+type repairFix struct {
+	Description string
+	Apply       func() error
+}
+
+// repairSession holds what the diagnoses of a repair share: the answers the
+// installation was made with and their rendered files, when there are any,
+// and its backups.
+type repairSession struct {
+	containerType SupportedContainer
+	answers       *Config
+	rendered      string
+	backups       []*upgradeBackup
+}
+
+// runRepair diagnoses a damaged installation and offers targeted fixes for
+// what it finds, instead of a reinstall: re-rendering a single file from the
+// recorded answers, restoring it from the newest backup, starting the
+// container runtime, recreating a service or rolling back to the last
+// upgrade backup after a failed database migration. The files are repaired
+// before the containers are looked at, as the containers depend on them.
+func runRepair(args []string) error {
+	flags := flag.NewFlagSet("repair", flag.ExitOnError)
+	dir := flags.String("dir", "", "Installation directory")
+	yes := flags.Bool("yes", false, "Apply the first fix offered for every problem without asking")
+	dryRun := flags.Bool("dry-run", false, "Only report the problems and the fixes that would be offered")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if err := enterDamagedInstallDir(*dir); err != nil {
+		return err
+	}
+	cwd, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Inspecting the installation in %s...\n", cwd)
+
+	session := &repairSession{}
+	defer session.close()
+	if answers, err := repairAnswers(); err == nil {
+		session.answers = &answers
+	} else {
+		fmt.Printf("Note: files cannot be re-rendered: %s holds no complete answers, and %v\n", installStateFile, err)
+	}
+	if session.backups, err = listUpgradeBackups(); err != nil {
+		fmt.Printf("Warning: %v\n", err)
+	}
+
+	found, fixed := 0, 0
+	var applied []string
+	for _, diagnose := range []func() []repairFinding{session.diagnoseFiles, session.diagnoseRuntime, session.diagnoseContainers} {
+		for _, finding := range diagnose() {
+			found++
+			fmt.Printf("\nproblem  %s\n", finding.Problem)
+			fmt.Printf("cause    %s\n", finding.Cause)
+			if len(finding.Fixes) == 0 {
+				fmt.Println("fix      none available; see the cause above")
+				continue
+			}
+			if *dryRun {
+				for _, fix := range finding.Fixes {
+					fmt.Printf("fix      %s\n", fix.Description)
+				}
+				continue
+			}
+			fix := chooseRepairFix(finding.Fixes, *yes)
+			if fix == nil {
+				fmt.Println("Left as it is.")
+				continue
+			}
+			fmt.Printf("Fixing: %s...\n", fix.Description)
+			if err := fix.Apply(); err != nil {
+				fmt.Printf("The fix failed: %v\n", err)
+				continue
+			}
+			fixed++
+			applied = append(applied, fix.Description)
+		}
+	}
+
+	if len(applied) > 0 {
+		recordChange("Repair the installation\n\n- " + strings.Join(applied, "\n- "))
+	}
+
+	fmt.Println()
+	switch {
+	case found == 0:
+		fmt.Println("No problems found.")
+		return nil
+	case *dryRun:
+		return fmt.Errorf("%d problem(s) found; run `installer repair` without --dry-run to fix them", found)
+	case fixed < found:
+		return fmt.Errorf("%d of %d problem(s) fixed; run `installer repair` again once the others are addressed", fixed, found)
+	}
+	fmt.Printf("%d problem(s) fixed. Run `installer check` to confirm the installation matches its answers.\n", fixed)
+	return nil
+}
+
+// enterDamagedInstallDir changes into the installation to repair. Unlike
+// enterInstallDir it accepts a directory whose Pangolin config is gone, as
+// long as something else of the installation is left.
+func enterDamagedInstallDir(dir string) error {
+	if err := enterInstallDir(dir); err == nil {
+		return nil
+	}
+	if dir == "" {
+		dir = "."
+	}
+	installDir, err := expandPath(dir)
+	if err != nil {
+		return err
+	}
+	for _, name := range []string{composeFile, "config", installStateFile, storedAnswersFile, backupsDir} {
+		if _, err := os.Stat(filepath.Join(installDir, name)); err == nil {
+			if installer.InInstallerContainer() {
+				_, err := enterHostPath(installDir)
+				return err
+			}
+			return os.Chdir(installDir)
+		}
+	}
+	return preflightErrorf("nothing of a Pangolin installation found in %s; pass --dir", installDir)
+}
+
+// chooseRepairFix offers the fixes in order until one is accepted, and
+// returns it, or nil if all were declined. With yes the first is taken.
+func chooseRepairFix(fixes []repairFix, yes bool) *repairFix {
+	if yes {
+		return &fixes[0]
+	}
+	for i := range fixes {
+		if readBool(msg("promptApplyRepairFix", fixes[i].Description), i == 0) {
+			return &fixes[i]
+		}
+	}
+	return nil
+}
+
+// repairAnswers returns the complete answers of the installation, from its
+// state file or, for installations made before it existed, its stored
+// answers.
+func repairAnswers() (Config, error) {
+	if config, ok, err := loadInstallState(); err == nil && ok && config.Secret != "" && len(installer.MissingAnswers(config)) == 0 {
+		return config, nil
+	}
+	return loadStoredAnswers(storedAnswersFile)
+}
+
+func (s *repairSession) close() {
+	if s.rendered != "" {
+		os.RemoveAll(s.rendered)
+	}
+}
+
+// diagnoseFiles reports the files of repairFiles that are missing, empty or
+// not valid YAML.
+func (s *repairSession) diagnoseFiles() []repairFinding {
+	var findings []repairFinding
+	for _, path := range repairFiles {
+		data, err := os.ReadFile(path)
+		var finding repairFinding
+		switch {
+		case os.IsNotExist(err):
+			finding.Problem = path + " is missing"
+			finding.Cause = "it was deleted, or an install was interrupted before it was written"
+		case err != nil:
+			finding.Problem = fmt.Sprintf("%s cannot be read: %v", path, err)
+			finding.Cause = "its permissions or ownership were changed; `installer check` reports the expected files"
+			findings = append(findings, finding)
+			continue
+		case len(strings.TrimSpace(string(data))) == 0:
+			finding.Problem = path + " is empty"
+			finding.Cause = "a full disk or an interrupted write truncated it"
+		default:
+			var doc map[string]any
+			err := yaml.Unmarshal(data, &doc)
+			if err == nil {
+				continue
+			}
+			finding.Problem = fmt.Sprintf("%s is not valid YAML: %v", path, err)
+			finding.Cause = "it was edited by hand, or a write to it was cut short"
+		}
+		if fix, ok := s.rerenderFix(path); ok {
+			finding.Fixes = append(finding.Fixes, fix)
+		}
+		if fix, ok := s.restoreFileFix(path); ok {
+			finding.Fixes = append(finding.Fixes, fix)
+		}
+		findings = append(findings, finding)
+	}
+	return findings
+}
+
+// rerenderFix re-renders path from the recorded answers. A damaged file is
+// kept next to it with a .broken suffix.
+func (s *repairSession) rerenderFix(path string) (repairFix, bool) {
+	if s.answers == nil {
+		return repairFix{}, false
+	}
+	description := fmt.Sprintf("re-render %s from the recorded answers", path)
+	if path == composeFile && checkIsCrowdsecInstalledInCompose() {
+		description += "; CrowdSec has to be added again"
+	}
+	return repairFix{
+		Description: description,
+		Apply: func() error {
+			if s.rendered == "" {
+				rendered, err := renderScratchConfig(*s.answers)
+				if err != nil {
+					return fmt.Errorf("error rendering the configuration: %w", err)
+				}
+				s.rendered = rendered
+			}
+			source := filepath.Join(s.rendered, path)
+			if path == composeFile {
+				source = filepath.Join(s.rendered, "config", composeFile)
+			}
+			if err := setAsideBroken(path); err != nil {
+				return err
+			}
+			if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+				return err
+			}
+			return copyFile(source, path)
+		},
+	}, true
+}
+
+// restoreFileFix restores path from the newest backup that holds it.
+func (s *repairSession) restoreFileFix(path string) (repairFix, bool) {
+	for _, backup := range s.backups {
+		if path == composeFile {
+			source := filepath.Join(backup.Dir, backup.Compose)
+			if _, err := os.Stat(source); err != nil {
+				continue
+			}
+			return repairFix{
+				Description: fmt.Sprintf("restore %s from the backup %s", path, filepath.Base(backup.Dir)),
+				Apply: func() error {
+					if err := setAsideBroken(path); err != nil {
+						return err
+					}
+					return copyFile(source, path)
+				},
+			}, true
+		}
+
+		archive := filepath.Join(backup.Dir, backup.Config)
+		if exec.Command("tar", "-tzf", archive, path).Run() != nil {
+			continue
+		}
+		return repairFix{
+			Description: fmt.Sprintf("restore %s from the backup %s", path, filepath.Base(backup.Dir)),
+			Apply: func() error {
+				if err := setAsideBroken(path); err != nil {
+					return err
+				}
+				if out, err := exec.Command("tar", "-xzf", archive, path).CombinedOutput(); err != nil {
+					return fmt.Errorf("failed to extract %s: %v: %s", path, err, strings.TrimSpace(string(out)))
+				}
+				return nil
+			},
+		}, true
+	}
+	return repairFix{}, false
+}
+
+// setAsideBroken renames a damaged file to path.broken, so what was left of
+// it is not lost.
+func setAsideBroken(path string) error {
+	if _, err := os.Stat(path); err != nil {
+		return nil
+	}
+	if err := os.Rename(path, path+".broken"); err != nil {
+		return fmt.Errorf("failed to keep the damaged %s: %v", path, err)
+	}
+	fmt.Printf("The damaged file is kept as %s.broken.\n", path)
+	return nil
+}
+
+// diagnoseRuntime reports a container runtime that is installed but not
+// running, which leaves every container down.
+func (s *repairSession) diagnoseRuntime() []repairFinding {
+	s.containerType = detectContainerType()
+	if s.containerType != Undefined {
+		return nil
+	}
+	recorded := Docker
+	if s.answers != nil && s.answers.InstallationContainerType == Podman {
+		recorded = Podman
+	}
+
+	finding := repairFinding{Problem: "no container runtime is running"}
+	switch {
+	case recorded == Docker && isDockerInstalled():
+		finding.Cause = "the Docker service is stopped, or did not start at boot"
+		finding.Fixes = []repairFix{{
+			Description: "start the Docker service and enable it at boot",
+			Apply: func() error {
+				if err := startDockerService(); err != nil {
+					return err
+				}
+				if s.containerType = detectContainerType(); s.containerType == Undefined {
+					return fmt.Errorf("docker still does not respond")
+				}
+				return nil
+			},
+		}}
+	case recorded == Podman && isPodmanInstalled():
+		finding.Cause = "the Podman socket is not active; start it with `systemctl --user start podman.socket` or as root"
+	default:
+		finding.Cause = fmt.Sprintf("%s is not installed; run the installer to install it", recorded)
+	}
+	return []repairFinding{finding}
+}
+
+// diagnoseContainers reports the services that have no container, are
+// stopped, restarting or unhealthy, with the cause their state and logs
+// point to.
+func (s *repairSession) diagnoseContainers() []repairFinding {
+	if s.containerType == Undefined {
+		return nil
+	}
+	// A compose file that is still damaged was reported already
+	services, err := composeServices(composeFile)
+	if err != nil {
+		return nil
+	}
+
+	var findings []repairFinding
+	for _, service := range services {
+		state, err := inspectContainer(s.containerType, service.Container)
+		if err != nil {
+			findings = append(findings, repairFinding{
+				Problem: fmt.Sprintf("%s has no container", service.Name),
+				Cause:   "the stack was taken down, or never started after the install",
+				Fixes:   []repairFix{s.startServiceFix(service.Name)},
+			})
+			continue
+		}
+		failure := state.failure()
+		if state.ready() || (failure == "" && !state.Restarting) {
+			continue
+		}
+		if failure == "" {
+			failure = "keeps restarting"
+		}
+
+		logs := containerLogTail(s.containerType, service.Container, 50)
+		finding := repairFinding{
+			Problem: fmt.Sprintf("%s %s", service.Name, failure),
+			Cause:   containerFailureCause(service.Name, state, logs),
+			Fixes:   []repairFix{s.startServiceFix(service.Name)},
+		}
+		if service.Name == "pangolin" && isMigrating(logs) {
+			if fix, ok := s.rollbackFix(); ok {
+				finding.Fixes = append([]repairFix{fix}, finding.Fixes...)
+			}
+		}
+		findings = append(findings, finding)
+	}
+	return findings
+}
+
+// containerFailureCause names the likely cause of a container that stopped
+// or does not become healthy, from its exit code and its last log lines.
+func containerFailureCause(service string, state containerState, logs string) string {
+	lower := strings.ToLower(logs)
+	switch {
+	case service == "pangolin" && isMigrating(logs):
+		return "a database migration failed: Pangolin stopped before it logged that the migrations completed"
+	case state.ExitCode == 137:
+		return "it was killed, most likely because the host ran out of memory"
+	case strings.Contains(lower, "address already in use") || strings.Contains(lower, "port is already allocated"):
+		return "a port it publishes is taken by another process; find it with `ss -tulpn`"
+	case strings.Contains(lower, "permission denied"):
+		return "it cannot access a file it mounts; check the ownership and permissions under config/"
+	case strings.Contains(lower, "invalid configuration") || strings.Contains(lower, "yaml:"):
+		return "it rejected its configuration; `installer validate` shows where"
+	}
+	lines := strings.Split(logs, "\n")
+	if len(lines) > 5 {
+		lines = lines[len(lines)-5:]
+	}
+	if strings.TrimSpace(logs) == "" {
+		return "it logged nothing that points to a cause"
+	}
+	return "its logs point to no known cause; the last lines:\n         " + strings.Join(lines, "\n         ")
+}
+
+// startServiceFix recreates and starts a service.
+func (s *repairSession) startServiceFix(service string) repairFix {
+	return repairFix{
+		Description: fmt.Sprintf("recreate and start the %s container", service),
+		Apply: func() error {
+			if err := composeCommand(s.containerType, "up", "-d", "--force-recreate", service); err != nil {
+				return fmt.Errorf("failed to start %s: %v", service, err)
+			}
+			return waitForContainer(serviceContainer(service), s.containerType)
+		},
+	}
+}
+
+// rollbackFix rolls back to the newest upgrade backup, which holds the
+// database as it was before the migration.
+func (s *repairSession) rollbackFix() (repairFix, bool) {
+	for _, backup := range s.backups {
+		if backup.Reason != "upgrade" || backup.Database == "" {
+			continue
+		}
+		name := filepath.Base(backup.Dir)
+		return repairFix{
+			Description: fmt.Sprintf("roll back to the backup %s of Pangolin %s, taken before the last upgrade", name, backup.Versions["pangolin"]),
+			Apply: func() error {
+				cwd, err := os.Getwd()
+				if err != nil {
+					return err
+				}
+				return runRollback([]string{"--dir", cwd, "--to", name, "--yes"})
+			},
+		}, true
+	}
+	return repairFix{}, false
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+)
+
+// runRollback restores the compose file, config tree and database from a
+// backup taken by `upgrade` and restarts the stack. By default the newest
+// upgrade backup is restored; the current state is backed up first so the
+// rollback itself can be undone with --to.
+func runRollback(args []string) error {
+	flags := flag.NewFlagSet("rollback", flag.ExitOnError)
+	dir := flags.String("dir", "", "Installation directory")
+	yes := flags.Bool("yes", false, "Do not ask for confirmation")
+	plainFlag(flags)
+	to := flags.String("to", "", "Name of the backup under backups/ to restore (default: the newest upgrade backup)")
+	list := flags.Bool("list", false, "List the available backups and exit")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	enablePlainOutput()
+
+	if err := enterInstallDir(*dir); err != nil {
+		return err
+	}
+
+	backups, err := listUpgradeBackups()
+	if err != nil {
+		return err
+	}
+	if len(backups) == 0 {
+		return fmt.Errorf("no backups found in %s; backups are taken by `upgrade`", backupsDir)
+	}
+
+	if *list {
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "NAME\tCREATED\tREASON\tPANGOLIN\tDATABASE")
+		for _, backup := range backups {
+			database := backup.Database
+			if database == "" {
+				database = "-"
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", filepath.Base(backup.Dir), backup.Created.Local().Format("2006-01-02 15:04"),
+				backup.Reason, backup.Versions["pangolin"], database)
+		}
+		return w.Flush()
+	}
+
+	var backup *upgradeBackup
+	for _, candidate := range backups {
+		if *to == "" && candidate.Reason == "upgrade" || *to != "" && filepath.Base(candidate.Dir) == *to {
+			backup = candidate
+			break
+		}
+	}
+	if backup == nil {
+		if *to != "" {
+			return fmt.Errorf("backup %q not found; use --list to show the available backups", *to)
+		}
+		return fmt.Errorf("no upgrade backup found; use --list and --to to pick a backup")
+	}
+
+	installed, err := installedVersions()
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("\n=== Rollback ===")
+	fmt.Printf("Installed versions: Pangolin %s, Gerbil %s, Badger %s\n", installed["pangolin"], orNone(installed["gerbil"]), installed["badger"])
+	fmt.Printf("Restoring %s from %s: Pangolin %s, Gerbil %s, Badger %s\n", backup.Dir, backup.Created.Local().Format("2006-01-02 15:04"),
+		backup.Versions["pangolin"], orNone(backup.Versions["gerbil"]), backup.Versions["badger"])
+	if backup.Database == "" {
+		fmt.Println("The backup holds no database snapshot; the current database is kept.")
+	} else {
+		fmt.Println("The database is restored too: changes made since the backup are lost.")
+	}
+
+	if !*yes && !readBool(msg("promptProceedRollback"), false) {
+		fmt.Println(msg("rollbackCancelled"))
+		return errAborted
+	}
+
+	containerType := detectContainerType()
+	if containerType == Undefined {
+		fmt.Println("Unable to detect container type from existing installation.")
+		containerType = podmanOrDocker()
+	}
+
+	if err := runHooks(hookPreRollback, existingConfig(containerType)); err != nil {
+		return err
+	}
+
+	fmt.Println("Backing up the current state...")
+	current, err := createUpgradeBackup(containerType, "rollback", installed)
+	if err != nil {
+		return fmt.Errorf("backup failed: %w", err)
+	}
+	fmt.Printf("Current state saved to %s\n", current.Dir)
+
+	if err := stopContainers(containerType); err != nil {
+		return err
+	}
+
+	fmt.Println("Restoring configuration...")
+	if err := copyFile(filepath.Join(backup.Dir, backup.Compose), composeFile); err != nil {
+		return fmt.Errorf("failed to restore %s: %v", composeFile, err)
+	}
+	if out, err := exec.Command("tar", "-xzf", filepath.Join(backup.Dir, backup.Config)).CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to restore the config directory: %v: %s", err, strings.TrimSpace(string(out)))
+	}
+
+	if backup.Database != "" {
+		fmt.Println("Restoring the database...")
+		if err := restoreDatabase(containerType, filepath.Join(backup.Dir, backup.Database)); err != nil {
+			return fmt.Errorf("database restore failed: %w\nThe state before the rollback is in %s", err, current.Dir)
+		}
+	}
+
+	// The maintenance page an upgrade turned on after the backup is dropped
+	// along with its router
+	if !maintenanceEnabled() {
+		if err := disableMaintenance(containerType); err != nil {
+			fmt.Printf("Warning: could not turn maintenance mode off: %v\n", err)
+		}
+	}
+
+	if err := startContainers(containerType); err != nil {
+		return err
+	}
+	if err := waitForServices(containerType); err != nil {
+		return fmt.Errorf("the restored containers are not healthy: %v", err)
+	}
+	if err := waitForPangolinAPI(containerType); err != nil {
+		return fmt.Errorf("the restored Pangolin is not ready: %v", err)
+	}
+
+	if err := recordRolledBackVersions(backup.Versions); err != nil {
+		fmt.Printf("Warning: could not record the restored versions: %v\n", err)
+	}
+
+	recordChange(fmt.Sprintf("Roll back Pangolin from %s to %s\n\nRestored: %s\nPrevious state: %s",
+		installed["pangolin"], backup.Versions["pangolin"], backup.Dir, current.Dir))
+
+	fmt.Printf("\nRolled back to Pangolin %s.\n", backup.Versions["pangolin"])
+	runPostHooks(hookPostRollback, existingConfig(containerType))
+	return nil
+}
+
+// recordRolledBackVersions records the versions a rollback restored in the
+// stored answers and the installer state, so that apply does not upgrade
+// them again.
+func recordRolledBackVersions(versions map[string]string) error {
+	return updateStoredAnswers(func(config *Config) {
+		config.PangolinVersion = versions["pangolin"]
+		config.GerbilVersion = versions["gerbil"]
+		config.BadgerVersion = versions["badger"]
+	})
+}
+
+// restoreDatabase replaces Pangolin's database with a snapshot taken by
+// snapshotDatabase. The stack must be stopped; for PostgreSQL only the
+// postgres service is started to load the dump.
+func restoreDatabase(containerType SupportedContainer, snapshot string) error {
+	if isPostgresInstall() {
+		return restorePostgres(containerType, snapshot)
+	}
+
+	// A stale WAL would be replayed on top of the restored database
+	for _, suffix := range []string{"-wal", "-shm"} {
+		if err := os.Remove(sqliteDBFile + suffix); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove %s: %v", sqliteDBFile+suffix, err)
+		}
+	}
+	for _, suffix := range []string{"", "-wal", "-shm"} {
+		if _, err := os.Stat(snapshot + suffix); err != nil {
+			continue
+		}
+		if err := copyFile(snapshot+suffix, sqliteDBFile+suffix); err != nil {
+			return fmt.Errorf("failed to restore %s: %v", sqliteDBFile+suffix, err)
+		}
+	}
+	return nil
+}
+
+// restorePostgres loads a custom-format dump into the pangolin database,
+// dropping the objects it contains first.
+func restorePostgres(containerType SupportedContainer, dump string) error {
+	if err := composeCommand(containerType, "up", "-d", "postgres"); err != nil {
+		return fmt.Errorf("failed to start postgres: %v", err)
+	}
+	if err := waitForContainer(serviceContainer("postgres"), containerType); err != nil {
+		return fmt.Errorf("postgres did not become ready: %v", err)
+	}
+
+	in, err := os.Open(dump)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	cmd := containerCommand(containerType, "exec", "-i", serviceContainer("postgres"),
+		"pg_restore", "-U", "pangolin", "-d", "pangolin", "--clean", "--if-exists")
+	cmd.Stdin = in
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("pg_restore failed: %v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// composeCommand runs a compose subcommand against docker-compose.yml with
+// the given container runtime.
+func composeCommand(containerType SupportedContainer, args ...string) error {
+	switch containerType {
+	case Podman:
+		return run("podman-compose", podmanComposeArgs(args...)...)
+	case Docker:
+		return executeDockerComposeCommandWithArgs(append([]string{"-f", "docker-compose.yml"}, args...)...)
+	}
+	return fmt.Errorf("unsupported container type: %s", containerType)
+}
+
+// serviceDependencies returns, for every service in the compose file, the
+// services it depends on through depends_on or a service network mode.
+func serviceDependencies(compose map[string]any) map[string][]string {
+	services, _ := compose["services"].(map[string]any)
+	deps := map[string][]string{}
+	for name, raw := range services {
+		service, _ := raw.(map[string]any)
+		deps[name] = nil
+
+		switch dependsOn := service["depends_on"].(type) {
+		case []any:
+			for _, d := range dependsOn {
+				if s, ok := d.(string); ok {
+					deps[name] = append(deps[name], s)
+				}
+			}
+		case map[string]any:
+			deps[name] = append(deps[name], sortedKeys(dependsOn)...)
+		}
+
+		if mode, ok := service["network_mode"].(string); ok {
+			if shared, ok := strings.CutPrefix(mode, "service:"); ok {
+				deps[name] = append(deps[name], shared)
+			}
+		}
+	}
+	return deps
+}
+
+// dependencyOrder sorts services so every service comes after the services
+// it depends on. Ties are broken alphabetically for a stable order.
+func dependencyOrder(deps map[string][]string) ([]string, error) {
+	var order []string
+	state := map[string]int{} // 1: visiting, 2: done
+
+	var visit func(name string, path []string) error
+	visit = func(name string, path []string) error {
+		switch state[name] {
+		case 1:
+			return fmt.Errorf("dependency cycle: %s", strings.Join(append(path, name), " -> "))
+		case 2:
+			return nil
+		}
+		state[name] = 1
+		for _, dep := range slices.Sorted(slices.Values(deps[name])) {
+			if _, known := deps[dep]; !known {
+				continue
+			}
+			if err := visit(dep, append(path, name)); err != nil {
+				return err
+			}
+		}
+		state[name] = 2
+		order = append(order, name)
+		return nil
+	}
+
+	for _, name := range sortedKeys(deps) {
+		if err := visit(name, nil); err != nil {
+			return nil, err
+		}
+	}
+	return order, nil
+}
+
+// containerID returns the ID of a container, or an empty string if it does
+// not exist.
+func containerID(containerType SupportedContainer, container string) string {
+	out, err := containerCommand(containerType, "inspect", "--format", "{{.Id}}", container).Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// rollingRestart recreates the compose services one at a time in dependency
+// order, waiting for each to become healthy before moving on, so the rest
+// of the stack keeps serving while a service is replaced. Compose only
+// recreates services whose image or configuration changed; services sharing
+// the network namespace of a recreated service are recreated with it.
+func rollingRestart(containerType SupportedContainer) error {
+	data, err := os.ReadFile(composeFile)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %v", composeFile, err)
+	}
+	var compose map[string]any
+	if err := yaml.Unmarshal(data, &compose); err != nil {
+		return fmt.Errorf("failed to parse %s: %v", composeFile, err)
+	}
+
+	deps := serviceDependencies(compose)
+	order, err := dependencyOrder(deps)
+	if err != nil {
+		return err
+	}
+
+	containers := map[string]string{}
+	services, err := composeServices(composeFile)
+	if err != nil {
+		return err
+	}
+	for _, service := range services {
+		containers[service.Name] = service.Container
+	}
+
+	recreated := map[string]bool{}
+	for _, name := range order {
+		args := []string{"up", "-d", "--no-deps"}
+		if mode, _ := lookupString(compose, "services", name, "network_mode"); strings.HasPrefix(mode, "service:") {
+			if recreated[strings.TrimPrefix(mode, "service:")] {
+				args = append(args, "--force-recreate")
+			}
+		}
+
+		fmt.Printf("\nUpdating service %s...\n", name)
+		before := containerID(containerType, containers[name])
+		if err := composeCommand(containerType, append(args, name)...); err != nil {
+			return fmt.Errorf("failed to update service %s: %v", name, err)
+		}
+		recreated[name] = containerID(containerType, containers[name]) != before
+
+		if !recreated[name] {
+			fmt.Printf("Service %s is up to date.\n", name)
+			continue
+		}
+		if err := waitForContainer(containers[name], containerType); err != nil {
+			return fmt.Errorf("service %s did not become healthy, stopping the upgrade: %v\nLast log lines:\n%s",
+				name, err, containerLogTail(containerType, containers[name], 20))
+		}
+		fmt.Printf("Service %s is healthy.\n", name)
+	}
+	return nil
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+)
+
+// rootlessMode selects the fully unprivileged install path (--rootless):
+//
+//   - the containers run under rootless Podman or rootless Docker, so the
+//     installer never needs root and never installs packages;
+//   - Traefik is published on high host ports (8080/8443 by default) since
+//     unprivileged users cannot bind ports below 1024. Ports 80/443 must be
+//     forwarded to them by a firewall rule or an external load balancer,
+//     for which the installer prints guidance;
+//   - host changes that need root (sysctl, logrotate, Docker install) are
+//     skipped with instructions instead of aborting;
+//   - autostart uses a systemd user unit instead of a system unit.
+var rootlessMode bool
+
+const (
+	rootlessHTTPPort  = 8080
+	rootlessHTTPSPort = 8443
+)
+
+func init() {
+	registerStep(installStep{
+		Name:  "systemd user service",
+		Order: 80,
+		When: func(state *installState) bool {
+			return containersStarting(state) && rootlessMode && runtime.GOOS == "linux"
+		},
+		Run: func(state *installState) error {
+			if confirmHostChange(msg("promptUserUnit"), true) {
+				if err := installUserUnit(state.InstallDir, state.Config.InstallationContainerType); err != nil {
+					fmt.Printf("Error setting up the systemd user service: %v\n", err)
+				}
+			}
+			return nil
+		},
+	})
+	registerStep(installStep{
+		Name:  "port forwarding guidance",
+		Order: 90,
+		When:  func(state *installState) bool { return freshInstall(state) && nativeEngine(state) },
+		Run: func(state *installState) error {
+			printPortForwardingGuidance(state.Config)
+			return nil
+		},
+	})
+}
+
+// isRootlessDocker reports whether the docker CLI talks to a rootless daemon.
+func isRootlessDocker() bool {
+	out, err := dockerCommand("docker", "info", "--format", "{{.SecurityOptions}}").Output()
+	if err != nil {
+		return false
+	}
+	return strings.Contains(string(out), "rootless")
+}
+
+// collectAlternatePorts asks for the host ports Traefik should be published
+// on when it cannot have 80 and 443: without root, or next to another web
+// server.
+func collectAlternatePorts(config *Config) {
+	fmt.Println("\n=== " + msg("sectionRootlessPorts") + " ===")
+	if coexistingWebServer != nil {
+		fmt.Println(msg("webServerAlternatePorts", coexistingWebServer.Name))
+	} else {
+		fmt.Println(msg("rootlessPortsDescription"))
+	}
+	config.HTTPPort = readPort(msg("promptHTTPPort"), rootlessHTTPPort)
+	config.HTTPSPort = readPort(msg("promptHTTPSPort"), rootlessHTTPSPort)
+}
+
+// printPortForwardingGuidance explains how to get public traffic on ports
+// 80/443 to the high ports used by a rootless install.
+func printPortForwardingGuidance(config Config) {
+	if config.HTTPPort == 80 && config.HTTPSPort == 443 || coexistingWebServer != nil {
+		return
+	}
+
+	fmt.Println("\n=== Port Forwarding ===")
+	fmt.Printf("Pangolin is published on ports %d (HTTP) and %d (HTTPS).\n", config.HTTPPort, config.HTTPSPort)
+	fmt.Println("Let's Encrypt and your users still connect on ports 80 and 443, so forward them using one of the following:")
+	fmt.Println("")
+	fmt.Println("1. A redirect rule (run once as an administrator):")
+	fmt.Printf("   nft add table ip nat && nft add chain ip nat prerouting '{ type nat hook prerouting priority -100; }'\n")
+	fmt.Printf("   nft add rule ip nat prerouting tcp dport 80 redirect to :%d\n", config.HTTPPort)
+	fmt.Printf("   nft add rule ip nat prerouting tcp dport 443 redirect to :%d\n", config.HTTPSPort)
+	fmt.Printf("   nft add rule ip nat prerouting udp dport 443 redirect to :%d\n", config.HTTPSPort)
+	fmt.Println("")
+	fmt.Println("2. Allow unprivileged users to bind low ports (run once as an administrator), then change the ports in docker-compose.yml to 80/443:")
+	fmt.Println("   echo 'net.ipv4.ip_unprivileged_port_start=80' > /etc/sysctl.d/99-pangolin.conf && sysctl --system")
+	fmt.Println("")
+	fmt.Println("3. An external load balancer or your provider's firewall forwarding ports 80/443 to this host's ports.")
+}
+
+// printRootlessRuntimeHelp explains how to set up a rootless container
+// runtime when none is available.
+func printRootlessRuntimeHelp(containerType SupportedContainer) {
+	switch containerType {
+	case Docker:
+		fmt.Println("Rootless Docker is not set up for this user. See https://docs.docker.com/engine/security/rootless/")
+		fmt.Println("On most distributions this is: dockerd-rootless-setuptool.sh install")
+	case Podman:
+		fmt.Println("Podman and podman-compose run rootless by default. Install both with your package manager (as an administrator).")
+	}
+}
+
+// rootlessContainer checks that the chosen container runtime works without
+// root. Unlike the privileged path it never changes host settings.
+func rootlessContainer(chosenContainer SupportedContainer) SupportedContainer {
+	switch chosenContainer {
+	case Podman:
+		if !isPodmanInstalled() {
+			fmt.Println("Podman or podman-compose is not installed.")
+			printRootlessRuntimeHelp(Podman)
+			os.Exit(exitPreflight)
+		}
+	case Docker:
+		if !isDockerInstalled() || !isRootlessDocker() {
+			printRootlessRuntimeHelp(Docker)
+			os.Exit(exitPreflight)
+		}
+		fmt.Println("Using rootless Docker.")
+	default:
+		os.Exit(1)
+	}
+
+	return chosenContainer
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/fosrl/pangolin/install/pkg/installer"
+)
+
+// sandboxMode (--sandbox) brings up the full stack on localhost in one
+// command, without questions, DNS or a public IP: dev mode defaults,
+// certificates from mkcert when it is installed, and an admin account,
+// organization and example resources created through the API.
+var sandboxMode bool
+
+const (
+	sandboxInstallDir = "~/pangolin-sandbox"
+	sandboxAdminEmail = "admin@example.com"
+	sandboxOrgID      = "sandbox"
+)
+
+// sandboxResources are the example resources of the sandbox.
+var sandboxResources = exampleResources(devBaseDomain)
+
+// runSandbox installs and starts the sandbox in dir, or the default sandbox
+// directory.
+func runSandbox(dir string) error {
+	if dir == "" {
+		dir = sandboxInstallDir
+	}
+	installDir, err := prepareInstallDirectory(dir)
+	if err != nil {
+		return err
+	}
+	if hasExistingInstall(installDir) {
+		return fmt.Errorf("%s already holds an installation; remove it or pass another --dir", installDir)
+	}
+	if err := os.Chdir(installDir); err != nil {
+		return err
+	}
+
+	containerType := Docker
+	if !isDockerInstalled() && isPodmanInstalled() {
+		containerType = Podman
+	} else {
+		ensureDesktopDocker()
+	}
+
+	config := installer.DefaultConfig()
+	loadVersions(&config)
+	config.InstallationContainerType = containerType
+	config.BaseDomain = devBaseDomain
+	config.DashboardDomain = "pangolin." + devBaseDomain
+	config.SelfSignedTLS = true
+	config.Sandbox = true
+	config.InstallGerbil = false
+	config.EnableIPv6 = false
+	config.Secret = generateRandomSecretKey()
+
+	fmt.Println("\n=== " + msg("sectionGenerate") + " ===")
+	if err := createConfigFiles(config); err != nil {
+		return fmt.Errorf("error creating config files: %v", err)
+	}
+	if err := moveFile("config/docker-compose.yml", "docker-compose.yml"); err != nil {
+		return fmt.Errorf("error moving docker-compose.yml: %v", err)
+	}
+	if err := enableComposeProfile(composeFile, exampleProfile); err != nil {
+		return err
+	}
+	if err := writeSandboxCertificate(config); err != nil {
+		return err
+	}
+	secureInstallFiles()
+
+	if err := pullContainers(containerType); err != nil {
+		return err
+	}
+	if err := startContainers(containerType); err != nil {
+		return err
+	}
+	if err := waitForServices(containerType); err != nil {
+		return err
+	}
+	if err := waitForPangolinAPI(containerType); err != nil {
+		return err
+	}
+
+	return seedSandbox(config)
+}
+
+// writeSandboxCertificate has mkcert issue a certificate the browsers of
+// this machine trust, falling back to a self-signed one.
+func writeSandboxCertificate(config Config) error {
+	if _, err := exec.LookPath("mkcert"); err != nil {
+		fmt.Println("mkcert is not installed, using a self-signed certificate. Install mkcert (https://github.com/FiloSottile/mkcert) for one your browser trusts.")
+		return writeSelfSignedCertificate(config)
+	}
+
+	// Browsers reject wildcards directly below a top-level domain such as
+	// localhost, so every name is listed
+	args := []string{"-cert-file", devCertFile, "-key-file", devKeyFile, config.DashboardDomain, "localhost", "127.0.0.1", "::1"}
+	for _, r := range sandboxResources {
+		args = append(args, r.Hostname)
+	}
+	if err := os.MkdirAll(filepath.Dir(devCertFile), 0755); err != nil {
+		return err
+	}
+	if err := run("mkcert", "-install"); err != nil {
+		return fmt.Errorf("mkcert -install failed: %v", err)
+	}
+	if err := run("mkcert", args...); err != nil {
+		return fmt.Errorf("mkcert failed: %v", err)
+	}
+	return nil
+}
+
+// seedSandbox completes the initial setup with a generated admin password,
+// then creates an organization with a local site and the example resources.
+func seedSandbox(config Config) error {
+	fmt.Println("\n=== Seeding the Sandbox ===")
+	password, err := randomAdminPassword()
+	if err != nil {
+		return err
+	}
+	api, err := createServerAdmin(config.InstallationContainerType, sandboxAdminEmail, password)
+	if err != nil {
+		return err
+	}
+	if err := createOrg(api, sandboxOrgID, "Sandbox"); err != nil {
+		return err
+	}
+
+	// A local site's targets are reached by Traefik directly
+	var site struct {
+		SiteID int `json:"siteId"`
+	}
+	if err := api.do("PUT", "/org/"+sandboxOrgID+"/site", map[string]any{"name": "Local", "type": "local"}, &site); err != nil {
+		return fmt.Errorf("failed to create the site: %v", err)
+	}
+	if err := createImportedResources(api, sandboxOrgID, site.SiteID, sandboxResources); err != nil {
+		return err
+	}
+
+	fmt.Println("\nThe sandbox is ready:")
+	fmt.Printf("  Dashboard: https://%s\n", config.DashboardDomain)
+	fmt.Printf("  Email:     %s\n", sandboxAdminEmail)
+	fmt.Printf("  Password:  %s\n", password)
+	for _, r := range sandboxResources {
+		fmt.Printf("  Example:   https://%s\n", r.Hostname)
+	}
+	fmt.Printf("Remove it with \"%s\" and by deleting the directory.\n", strings.Join(append(composeCommandLine(config.InstallationContainerType), "down", "-v"), " "))
+	return nil
+}
+
+// randomAdminPassword returns a random password that meets Pangolin's
+// password rules.
+func randomAdminPassword() (string, error) {
+	b := make([]byte, 12)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b) + "-Aa1", nil
+}
@@ -0,0 +1,346 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode/utf8"
+)
+
+// Simulation. With --simulate the install runs as usual, asking the same
+// questions, but every host change goes to a recorder instead of the host.
+// The installation directory is copied to a scratch directory that the
+// steps work in, and the files they write there are recorded as writes to
+// the real directory. Steps that wait for the containers or talk to outside
+// services are skipped. The recorded operations are written as a shell
+// script, or as JSON when the plan file ends in .json.
+
+// simulatePath is the plan file given with --simulate.
+var simulatePath string
+
+// plannedOp is a recorded host change.
+type plannedOp struct {
+	// Kind is exec, mkdir, write, chown or remove.
+	Kind    string   `json:"kind"`
+	Command []string `json:"command,omitempty"`
+	Dir     string   `json:"dir,omitempty"`
+	Stdin   string   `json:"stdin,omitempty"`
+	Path    string   `json:"path,omitempty"`
+	Mode    string   `json:"mode,omitempty"`
+	Content string   `json:"content,omitempty"`
+	// Owner is the uid:gid of a chown.
+	Owner string `json:"owner,omitempty"`
+	// Encoding is base64 for content or stdin that is not text.
+	Encoding string `json:"encoding,omitempty"`
+}
+
+// hostRecorder is the hostRunner of a simulation.
+type hostRecorder struct {
+	ops []plannedOp
+	// installDir is the real installation directory and scratch the copy
+	// the steps run in, once entered.
+	installDir string
+	scratch    string
+	// files are the modes and contents of the scratch files already
+	// recorded, by path relative to scratch.
+	files map[string]scratchFile
+}
+
+type scratchFile struct {
+	mode os.FileMode
+	data []byte
+}
+
+// simulating reports whether the install is a simulation.
+func simulating() bool {
+	_, ok := hostOps.(*hostRecorder)
+	return ok
+}
+
+func (r *hostRecorder) Run(cmd *exec.Cmd) error {
+	r.recordCommand(cmd)
+	return nil
+}
+
+func (r *hostRecorder) CombinedOutput(cmd *exec.Cmd) ([]byte, error) {
+	r.recordCommand(cmd)
+	return nil, nil
+}
+
+func (r *hostRecorder) WriteFile(path string, data []byte, mode os.FileMode) error {
+	r.syncScratch()
+	op := plannedOp{Kind: "write", Path: r.realPath(path), Mode: fmt.Sprintf("%04o", mode.Perm())}
+	op.Content, op.Encoding = encodeContent(data)
+	r.ops = append(r.ops, op)
+	fmt.Printf("Would write %s\n", op.Path)
+	return nil
+}
+
+func (r *hostRecorder) MkdirAll(path string, mode os.FileMode) error {
+	r.syncScratch()
+	op := plannedOp{Kind: "mkdir", Path: r.realPath(path), Mode: fmt.Sprintf("%04o", mode.Perm())}
+	r.ops = append(r.ops, op)
+	fmt.Printf("Would create %s\n", op.Path)
+	return nil
+}
+
+func (r *hostRecorder) Chown(path string, uid, gid int) error {
+	r.syncScratch()
+	op := plannedOp{Kind: "chown", Path: r.realPath(path), Owner: fmt.Sprintf("%d:%d", uid, gid)}
+	r.ops = append(r.ops, op)
+	fmt.Printf("Would change the owner of %s to %s\n", op.Path, op.Owner)
+	return nil
+}
+
+// recordCommand records cmd. Its environment is left out, as it may hold
+// secrets such as the encryption passphrase.
+func (r *hostRecorder) recordCommand(cmd *exec.Cmd) {
+	r.syncScratch()
+	op := plannedOp{Kind: "exec", Dir: cmd.Dir}
+	for _, arg := range cmd.Args {
+		op.Command = append(op.Command, r.realPath(arg))
+	}
+	if op.Dir == "" {
+		op.Dir, _ = os.Getwd()
+	}
+	op.Dir = r.realPath(op.Dir)
+	// Input the user would type is not known in advance
+	if cmd.Stdin != nil && cmd.Stdin != os.Stdin {
+		if data, err := io.ReadAll(cmd.Stdin); err == nil {
+			op.Stdin, op.Encoding = encodeContent(data)
+		}
+	}
+	r.ops = append(r.ops, op)
+	fmt.Printf("Would run: %s\n", shellCommandLine(op.Command))
+}
+
+// realPath maps a path in the scratch directory to the installation
+// directory.
+func (r *hostRecorder) realPath(path string) string {
+	if r.scratch == "" {
+		return path
+	}
+	return strings.ReplaceAll(path, r.scratch, r.installDir)
+}
+
+// enterScratch copies the installation directory, without the container
+// data and git history, to a scratch directory and changes to it.
+func (r *hostRecorder) enterScratch(installDir string) error {
+	scratch, err := os.MkdirTemp("", "pangolin-simulate-")
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(installDir); err == nil {
+		err := walkInstallFiles(installDir, func(rel string, d fs.DirEntry) error {
+			if d.IsDir() {
+				return os.MkdirAll(filepath.Join(scratch, rel), 0755)
+			}
+			return copyFile(filepath.Join(installDir, rel), filepath.Join(scratch, rel))
+		})
+		if err != nil {
+			os.RemoveAll(scratch)
+			return fmt.Errorf("error copying %s: %v", installDir, err)
+		}
+	}
+	if err := os.Chdir(scratch); err != nil {
+		os.RemoveAll(scratch)
+		return err
+	}
+	r.installDir, r.scratch = installDir, scratch
+	r.files = r.scanScratch()
+	return nil
+}
+
+// syncScratch records the files the steps wrote to, changed or removed from
+// the scratch directory since the last operation, so they come before the
+// commands that use them.
+func (r *hostRecorder) syncScratch() {
+	if r.scratch == "" {
+		return
+	}
+	files := r.scanScratch()
+	for _, rel := range sortedKeys(files) {
+		file := files[rel]
+		old, seen := r.files[rel]
+		path := filepath.Join(r.installDir, rel)
+		switch {
+		case file.mode.IsDir():
+			if !seen {
+				r.ops = append(r.ops, plannedOp{Kind: "mkdir", Path: path, Mode: fmt.Sprintf("%04o", file.mode.Perm())})
+			}
+		case !seen || !bytes.Equal(old.data, file.data) || old.mode != file.mode:
+			op := plannedOp{Kind: "write", Path: path, Mode: fmt.Sprintf("%04o", file.mode.Perm())}
+			op.Content, op.Encoding = encodeContent(file.data)
+			r.ops = append(r.ops, op)
+		}
+	}
+	for _, rel := range sortedKeys(r.files) {
+		if _, ok := files[rel]; !ok {
+			r.ops = append(r.ops, plannedOp{Kind: "remove", Path: filepath.Join(r.installDir, rel)})
+		}
+	}
+	r.files = files
+}
+
+func (r *hostRecorder) scanScratch() map[string]scratchFile {
+	files := map[string]scratchFile{}
+	walkInstallFiles(r.scratch, func(rel string, d fs.DirEntry) error {
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		file := scratchFile{mode: info.Mode()}
+		if !d.IsDir() {
+			if file.data, err = os.ReadFile(filepath.Join(r.scratch, rel)); err != nil {
+				return nil
+			}
+		}
+		files[rel] = file
+		return nil
+	})
+	return files
+}
+
+// walkInstallFiles calls fn for the directories and regular files under
+// root, skipping git history and the contents of container data
+// directories.
+func walkInstallFiles(root string, fn func(rel string, d fs.DirEntry) error) error {
+	return filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil || rel == "." {
+			return err
+		}
+		if rel == ".git" {
+			return filepath.SkipDir
+		}
+		if !d.IsDir() && !d.Type().IsRegular() {
+			return nil
+		}
+		if err := fn(rel, d); err != nil {
+			return err
+		}
+		if d.IsDir() && slices.Contains(dataDirs, filepath.ToSlash(rel)) {
+			return filepath.SkipDir
+		}
+		return nil
+	})
+}
+
+// finishSimulation writes the plan and removes the scratch directory.
+func (r *hostRecorder) finishSimulation() error {
+	r.syncScratch()
+	if r.scratch != "" {
+		os.Chdir(r.installDir)
+		os.RemoveAll(r.scratch)
+	}
+
+	var data []byte
+	if strings.HasSuffix(simulatePath, ".json") {
+		var err error
+		if data, err = json.MarshalIndent(map[string]any{"operations": r.ops}, "", "  "); err != nil {
+			return err
+		}
+		data = append(data, '\n')
+	} else {
+		data = []byte(planScript(r.ops))
+	}
+	if err := os.WriteFile(simulatePath, data, 0600); err != nil {
+		return fmt.Errorf("error writing the plan: %v", err)
+	}
+	fmt.Printf("\nSimulation complete, nothing on this host was changed. The %d recorded operations are in %s.\n", len(r.ops), simulatePath)
+	return nil
+}
+
+const planDelimiter = "PANGOLIN_EOF"
+
+// planScript renders ops as a shell script that carries them out.
+func planScript(ops []plannedOp) string {
+	var b strings.Builder
+	b.WriteString("#!/bin/sh\n# Recorded by the Pangolin installer with --simulate. Review before running.\nset -e\n")
+	dir := ""
+	for _, op := range ops {
+		b.WriteString("\n")
+		switch op.Kind {
+		case "exec":
+			if op.Dir != dir {
+				fmt.Fprintf(&b, "cd %s\n", shellWord(op.Dir))
+				dir = op.Dir
+			}
+			command := shellCommandLine(op.Command)
+			switch {
+			case op.Stdin == "":
+				b.WriteString(command + "\n")
+			case op.Encoding == "base64":
+				b.WriteString(heredoc("base64 -d") + " | " + command + heredocBody(op.Stdin))
+			default:
+				b.WriteString(heredoc(command) + heredocBody(op.Stdin))
+			}
+		case "mkdir":
+			fmt.Fprintf(&b, "mkdir -p -m %s %s\n", op.Mode, shellWord(op.Path))
+		case "write":
+			writer := "cat"
+			if op.Encoding == "base64" {
+				writer = "base64 -d"
+			}
+			b.WriteString(heredoc(writer+" > "+shellWord(op.Path)) + heredocBody(op.Content))
+			fmt.Fprintf(&b, "chmod %s %s\n", op.Mode, shellWord(op.Path))
+		case "chown":
+			fmt.Fprintf(&b, "chown %s %s\n", op.Owner, shellWord(op.Path))
+		case "remove":
+			fmt.Fprintf(&b, "rm -f %s\n", shellWord(op.Path))
+		}
+	}
+	return b.String()
+}
+
+// heredoc returns command reading a here-document, which heredocBody
+// returns for content. Text content ends with a newline, which the
+// here-document keeps; base64 ignores the one added here.
+func heredoc(command string) string {
+	return fmt.Sprintf("%s <<'%s'", command, planDelimiter)
+}
+
+func heredocBody(content string) string {
+	if !strings.HasSuffix(content, "\n") {
+		content += "\n"
+	}
+	return "\n" + content + planDelimiter + "\n"
+}
+
+// encodeContent returns data as a string, base64 encoded when it is not
+// text that a here-document reproduces exactly.
+func encodeContent(data []byte) (string, string) {
+	if utf8.Valid(data) && bytes.HasSuffix(data, []byte("\n")) && !bytes.ContainsRune(data, 0) && !bytes.Contains(data, []byte(planDelimiter)) {
+		return string(data), ""
+	}
+	return base64.StdEncoding.EncodeToString(data), "base64"
+}
+
+var plainShellWord = regexp.MustCompile(`^[A-Za-z0-9_@%+=:,./-]+$`)
+
+func shellWord(s string) string {
+	if plainShellWord.MatchString(s) {
+		return s
+	}
+	return shellQuote(s)
+}
+
+func shellCommandLine(args []string) string {
+	words := make([]string, len(args))
+	for i, arg := range args {
+		words[i] = shellWord(arg)
+	}
+	return strings.Join(words, " ")
+}
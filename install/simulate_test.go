@@ -0,0 +1,53 @@
+package main
+
+import (
+	"os"
+	"slices"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+// TestSimulationLeavesHostAlone checks that host changes made outside the
+// installation directory are recorded in the plan instead of being made.
+func TestSimulationLeavesHostAlone(t *testing.T) {
+	recorder := &hostRecorder{}
+	hostOps = recorder
+	t.Cleanup(func() { hostOps = systemHost{} })
+
+	t.Run("rc.d script", func(t *testing.T) {
+		_, statErr := os.Stat(rcScriptPath)
+		if err := installRcScript("/opt/pangolin"); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := os.Stat(rcScriptPath); os.IsNotExist(statErr) && !os.IsNotExist(err) {
+			t.Errorf("the simulation wrote %s", rcScriptPath)
+		}
+		if !slices.ContainsFunc(recorder.ops, func(op plannedOp) bool { return op.Kind == "write" && op.Path == rcScriptPath }) {
+			t.Errorf("the plan does not write %s", rcScriptPath)
+		}
+	})
+
+	t.Run("sudo ownership", func(t *testing.T) {
+		if os.Geteuid() != 0 {
+			t.Skip("the ownership is only offered to root")
+		}
+		dir := t.TempDir()
+		t.Setenv("SUDO_USER", "pangolin")
+		t.Setenv("SUDO_UID", "4242")
+		t.Setenv("SUDO_GID", "4242")
+		answerPrompts(t, "y")
+
+		changeDirectoryOwnership(dir)
+		info, err := os.Stat(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Sys().(*syscall.Stat_t).Uid == 4242 {
+			t.Errorf("the simulation changed the owner of %s", dir)
+		}
+		if !strings.Contains(planScript(recorder.ops), "chown 4242:4242 "+shellWord(dir)) {
+			t.Errorf("the plan does not change the owner of %s:\n%s", dir, planScript(recorder.ops))
+		}
+	})
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	backupsDir     = "backups"
+	sqliteDBFile   = "config/db/db.sqlite"
+	backupManifest = "manifest.yml"
+)
+
+// upgradeBackup describes a backup taken before an upgrade. It is stored as
+// manifest.yml next to the files it lists, in a timestamped directory under
+// backups/, and is what rollback restores.
+type upgradeBackup struct {
+	Dir      string            `yaml:"-"`
+	Created  time.Time         `yaml:"created"`
+	Reason   string            `yaml:"reason"`
+	Versions map[string]string `yaml:"versions"`
+	Compose  string            `yaml:"compose"`
+	Config   string            `yaml:"config"`
+	Database string            `yaml:"database,omitempty"`
+	// Files are copies of the installerFiles the installation had
+	Files []string `yaml:"files,omitempty"`
+}
+
+// installerFiles are the answers, state and credentials the installer keeps
+// next to the configuration. Backups copy them so that a migrated
+// installation keeps them; rollback leaves the current ones in place.
+var installerFiles = []string{storedAnswersFile, installStateFile, installSecretsFile, apiCredentialsFile}
+
+// createUpgradeBackup copies the compose file, the installer files, the
+// config tree and a consistent database snapshot into a new directory under
+// backups/.
+// versions are the component versions the backup can be rolled back to.
+func createUpgradeBackup(containerType SupportedContainer, reason string, versions map[string]string) (*upgradeBackup, error) {
+	now := time.Now().UTC()
+	backup := &upgradeBackup{
+		Dir:      filepath.Join(backupsDir, now.Format("20060102-150405")),
+		Created:  now,
+		Reason:   reason,
+		Versions: versions,
+		Compose:  "docker-compose.yml",
+		Config:   "config.tar.gz",
+	}
+	if err := os.MkdirAll(backup.Dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create %s: %v", backup.Dir, err)
+	}
+	if err := os.Chmod(backupsDir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to restrict permissions of %s: %v", backupsDir, err)
+	}
+
+	if err := copyFile(composeFile, filepath.Join(backup.Dir, backup.Compose)); err != nil {
+		return nil, fmt.Errorf("failed to back up %s: %v", composeFile, err)
+	}
+	for _, file := range installerFiles {
+		if _, err := os.Stat(file); os.IsNotExist(err) {
+			continue
+		}
+		if err := copyFile(file, filepath.Join(backup.Dir, file)); err != nil {
+			return nil, fmt.Errorf("failed to back up %s: %v", file, err)
+		}
+		backup.Files = append(backup.Files, file)
+	}
+
+	// The database is snapshotted separately so the archive stays small and
+	// never holds a half-written database file
+	archive := filepath.Join(backup.Dir, backup.Config)
+	if out, err := exec.Command("tar", "-czf", archive, "--exclude=config/db", "config").CombinedOutput(); err != nil {
+		return nil, fmt.Errorf("failed to back up the config directory: %v: %s", err, strings.TrimSpace(string(out)))
+	}
+	if err := os.Chmod(archive, 0600); err != nil {
+		return nil, fmt.Errorf("failed to restrict permissions of %s: %v", archive, err)
+	}
+
+	database, err := snapshotDatabase(containerType, backup.Dir)
+	if err != nil {
+		return nil, fmt.Errorf("database snapshot failed: %w", err)
+	}
+	backup.Database = database
+
+	data, err := yaml.Marshal(backup)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(filepath.Join(backup.Dir, backupManifest), data, 0600); err != nil {
+		return nil, fmt.Errorf("failed to write backup manifest: %v", err)
+	}
+	return backup, nil
+}
+
+// listUpgradeBackups returns the backups under backups/, newest first.
+func listUpgradeBackups() ([]*upgradeBackup, error) {
+	entries, err := os.ReadDir(backupsDir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %v", backupsDir, err)
+	}
+
+	var backups []*upgradeBackup
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		dir := filepath.Join(backupsDir, entry.Name())
+		data, err := os.ReadFile(filepath.Join(dir, backupManifest))
+		if err != nil {
+			continue
+		}
+		backup := &upgradeBackup{}
+		if err := yaml.Unmarshal(data, backup); err != nil {
+			continue
+		}
+		backup.Dir = dir
+		backups = append(backups, backup)
+	}
+
+	slices.SortFunc(backups, func(a, b *upgradeBackup) int {
+		return b.Created.Compare(a.Created)
+	})
+	return backups, nil
+}
+
+// snapshotDatabase takes a consistent copy of Pangolin's database into dir
+// and returns the file name, or an empty name if there is no database yet.
+// SQLite is copied with the sqlite3 online backup when available, otherwise
+// after stopping the pangolin container, which the upgrade recreates anyway.
+// PostgreSQL is dumped with pg_dump in the postgres container.
+func snapshotDatabase(containerType SupportedContainer, dir string) (string, error) {
+	if isPostgresInstall() {
+		name := "pangolin.dump"
+		if err := dumpPostgres(containerType, filepath.Join(dir, name)); err != nil {
+			return "", err
+		}
+		return name, nil
+	}
+
+	if _, err := os.Stat(sqliteDBFile); err != nil {
+		return "", nil
+	}
+	name := "db.sqlite"
+	if err := copySQLite(containerType, filepath.Join(dir, name)); err != nil {
+		return "", err
+	}
+	return name, nil
+}
+
+// isPostgresInstall reports whether Pangolin uses the bundled PostgreSQL
+// service.
+func isPostgresInstall() bool {
+	services, err := composeServices(composeFile)
+	if err != nil {
+		return false
+	}
+	for _, service := range services {
+		if service.Name == "postgres" {
+			return true
+		}
+	}
+	return false
+}
+
+// dumpPostgres writes a custom-format pg_dump of the pangolin database.
+func dumpPostgres(containerType SupportedContainer, target string) error {
+	out, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %v", target, err)
+	}
+	defer out.Close()
+
+	cmd := containerCommand(containerType, "exec", serviceContainer("postgres"), "pg_dump", "-U", "pangolin", "-Fc", "pangolin")
+	cmd.Stdout = out
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		os.Remove(target)
+		return fmt.Errorf("pg_dump failed: %v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+// copySQLite copies the SQLite database consistently.
+func copySQLite(containerType SupportedContainer, target string) error {
+	if _, err := exec.LookPath("sqlite3"); err == nil {
+		if out, err := exec.Command("sqlite3", sqliteDBFile, fmt.Sprintf(".backup '%s'", target)).CombinedOutput(); err != nil {
+			return fmt.Errorf("sqlite3 backup failed: %v: %s", err, strings.TrimSpace(string(out)))
+		}
+		return os.Chmod(target, 0600)
+	}
+
+	// Without sqlite3, stop the writer so the file and its WAL are at rest
+	pangolin := serviceContainer("pangolin")
+	if state, err := inspectContainer(containerType, pangolin); err == nil && state.Running {
+		fmt.Println("Stopping Pangolin to take a consistent database snapshot...")
+		if out, err := containerCommand(containerType, "stop", pangolin).CombinedOutput(); err != nil {
+			return fmt.Errorf("failed to stop pangolin: %v: %s", err, strings.TrimSpace(string(out)))
+		}
+	}
+
+	for _, suffix := range []string{"", "-wal", "-shm"} {
+		if _, err := os.Stat(sqliteDBFile + suffix); err != nil {
+			continue
+		}
+		if err := copyFile(sqliteDBFile+suffix, target+suffix); err != nil {
+			return fmt.Errorf("failed to copy %s: %v", sqliteDBFile+suffix, err)
+		}
+	}
+	return nil
+}
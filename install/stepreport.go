@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+	"time"
+)
+
+// installLogFile collects the step summaries of the installs run in the
+// installation directory, newest last.
+const installLogFile = "pangolin-install.log"
+
+// Outcomes of an install step.
+const (
+	stepDone      = "done"
+	stepSkipped   = "skipped"
+	stepSimulated = "simulated"
+	stepFailed    = "failed"
+	stepNotRun    = "not run"
+)
+
+// stepResult is the outcome of an install step and the time it took.
+type stepResult struct {
+	Name     string
+	Outcome  string
+	Duration time.Duration
+}
+
+// reportInstallSteps prints the summary of an install and appends it to the
+// install log. A simulation leaves the log alone, as it changes nothing.
+func reportInstallSteps(results []stepResult, total time.Duration) {
+	fmt.Println("\n=== " + msg("sectionInstallSummary") + " ===")
+	writeStepSummary(os.Stdout, results, total)
+
+	if simulating() {
+		return
+	}
+	f, err := os.OpenFile(installLogFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		fmt.Printf("Warning: could not write %s: %v\n", installLogFile, err)
+		return
+	}
+	defer f.Close()
+	fmt.Fprintf(f, "== Install on %s, installer %s ==\n", time.Now().UTC().Format(time.RFC3339), orUnknown(installerVersion, "dev"))
+	writeStepSummary(f, results, total)
+	fmt.Fprintln(f)
+}
+
+// writeStepSummary writes the steps with their outcome and duration as a
+// table, followed by the total.
+func writeStepSummary(out io.Writer, results []stepResult, total time.Duration) {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "STEP\tRESULT\tTIME")
+	for _, r := range results {
+		duration := "-"
+		if r.Outcome == stepDone || r.Outcome == stepFailed {
+			duration = formatStepDuration(r.Duration)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", r.Name, r.Outcome, duration)
+	}
+	fmt.Fprintf(w, "total\t\t%s\n", formatStepDuration(total))
+	w.Flush()
+}
+
+// formatStepDuration rounds d to tenths of a second, or to seconds from a
+// minute on.
+func formatStepDuration(d time.Duration) string {
+	if d < time.Minute {
+		return d.Round(100 * time.Millisecond).String()
+	}
+	return d.Round(time.Second).String()
+}
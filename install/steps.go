@@ -0,0 +1,340 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"runtime"
+	"slices"
+	"time"
+
+	"github.com/fosrl/pangolin/install/pkg/installer"
+)
+
+// installState is shared by the install steps. Steps read the answers from
+// Config and record what they did for the steps that follow.
+type installState struct {
+	Config     Config
+	InstallDir string
+	// AlreadyInstalled is set when the directory holds a configuration from
+	// an earlier run, which is then left alone.
+	AlreadyInstalled bool
+	// StartContainers is set once the user agreed to start the containers.
+	StartContainers bool
+	// CrowdsecRequested is set by --crowdsec.
+	CrowdsecRequested bool
+	// Provisioning is the file given with --provision; Provisioned is set
+	// once it completed the initial setup.
+	Provisioning *provisioningFile
+	Provisioned  bool
+}
+
+// installStep is a named step of the interactive install. Steps run in
+// ascending Order; a step whose When returns false is skipped. Core steps
+// are spaced by ten so feature modules can register steps in between.
+type installStep struct {
+	Name  string
+	Order int
+	When  func(state *installState) bool
+	Run   func(state *installState) error
+	// Live is set for steps that wait for the running containers or change
+	// something outside this host. A simulation skips them.
+	Live bool
+}
+
+var installSteps []installStep
+
+// registerStep adds a step to the install. Feature modules call it from an
+// init function.
+func registerStep(step installStep) {
+	if slices.ContainsFunc(installSteps, func(s installStep) bool { return s.Name == step.Name }) {
+		panic("duplicate install step: " + step.Name)
+	}
+	installSteps = append(installSteps, step)
+}
+
+// runInstallSteps runs the registered steps in order, stopping at the first
+// step that fails. The outcome and duration of every step are reported at
+// the end, whether the install succeeded or not.
+func runInstallSteps(state *installState) error {
+	steps := slices.Clone(installSteps)
+	slices.SortStableFunc(steps, func(a, b installStep) int { return a.Order - b.Order })
+
+	results := make([]stepResult, 0, len(steps))
+	started := time.Now()
+	defer func() { reportInstallSteps(results, time.Since(started)) }()
+
+	for i, step := range steps {
+		if step.When != nil && !step.When(state) {
+			results = append(results, stepResult{Name: step.Name, Outcome: stepSkipped})
+			continue
+		}
+		if step.Live && simulating() {
+			fmt.Printf("Skipping %s in the simulation.\n", step.Name)
+			results = append(results, stepResult{Name: step.Name, Outcome: stepSimulated})
+			continue
+		}
+		began := time.Now()
+		err := step.Run(state)
+		result := stepResult{Name: step.Name, Outcome: stepDone, Duration: time.Since(began)}
+		if err != nil {
+			result.Outcome = stepFailed
+			results = append(results, result)
+			for _, rest := range steps[i+1:] {
+				results = append(results, stepResult{Name: rest.Name, Outcome: stepNotRun})
+			}
+			return fmt.Errorf("%s: %w", step.Name, err)
+		}
+		results = append(results, result)
+	}
+	return nil
+}
+
+func freshInstall(state *installState) bool { return !state.AlreadyInstalled }
+
+func containersStarting(state *installState) bool {
+	return !state.AlreadyInstalled && state.StartContainers
+}
+
+func init() {
+	registerStep(installStep{Name: "collect answers", Order: 10, When: freshInstall, Run: collectAnswers})
+	registerStep(installStep{Name: "generate configuration", Order: 20, When: freshInstall, Run: generateConfiguration})
+	registerStep(installStep{
+		Name:  "download MaxMind databases",
+		Order: 40,
+		When:  func(state *installState) bool { return freshInstall(state) && state.Config.EnableMaxMind },
+		Run: func(state *installState) error {
+			fmt.Println("\n=== Downloading MaxMind Country and ASN Databases ===")
+			if err := downloadMaxMindDatabase(); err != nil {
+				fmt.Printf("Error downloading MaxMind databases: %v\n", err)
+				fmt.Println("You can download it manually later if needed.")
+			}
+			return nil
+		},
+	})
+	registerStep(installStep{Name: "prepare container runtime", Order: 50, When: freshInstall, Run: prepareContainerRuntime})
+	registerStep(installStep{
+		Name:  "record installer state",
+		Order: 52,
+		When:  freshInstall,
+		// The answers are saved again with what the steps since added, so
+		// that apply converges on the same answers the state records
+		Run: func(state *installState) error {
+			if err := saveStoredAnswers(state.Config); err != nil {
+				return err
+			}
+			return saveInstallState(state.Config)
+		},
+	})
+	registerStep(installStep{Name: "start containers", Order: 60, When: containersStarting, Run: startStack})
+	registerStep(installStep{
+		Name:  "update MaxMind databases",
+		Order: 40,
+		When:  func(state *installState) bool { return state.AlreadyInstalled },
+		Run:   func(*installState) error { offerMaxMindUpdate(); return nil },
+	})
+	registerStep(installStep{
+		Name:  "setup token",
+		Order: 110,
+		When: func(state *installState) bool {
+			return (!state.AlreadyInstalled || state.Config.DoCrowdsecInstall) && !state.Provisioned
+		},
+		Run: func(state *installState) error {
+			showSetupToken(state.Config)
+			return nil
+		},
+		Live: true,
+	})
+}
+
+// collectAnswers asks the install questions, or takes the answers of a
+// non-interactive install.
+func collectAnswers(state *installState) error {
+	if nonInteractive {
+		state.Config = answeredConfig
+	} else {
+		state.Config = collectUserInput()
+		loadVersions(&state.Config)
+	}
+
+	state.Config.DoCrowdsecInstall = false
+	if state.Config.Secret == "" {
+		state.Config.Secret = generateRandomSecretKey()
+	}
+	return nil
+}
+
+// generateConfiguration writes the configuration files into the installation
+// directory.
+func generateConfiguration(state *installState) error {
+	fmt.Println("\n=== " + msg("sectionGenerate") + " ===")
+
+	// Remove partially generated files if interrupted so the next run
+	// does not mistake them for an existing installation
+	_, statErr := os.Stat("config")
+	configDirExisted := statErr == nil
+	generated := onInterrupt(func() {
+		fmt.Println("Removing partially generated configuration files...")
+		if configDirExisted {
+			os.Remove("config/config.yml")
+		} else {
+			os.RemoveAll("config")
+		}
+		os.Remove("docker-compose.yml")
+	})
+
+	if err := createConfigFiles(state.Config); err != nil {
+		return fmt.Errorf("error creating config files: %v", err)
+	}
+
+	if err := moveFile("config/docker-compose.yml", "docker-compose.yml"); err != nil {
+		return fmt.Errorf("error moving docker-compose.yml: %v", err)
+	}
+
+	// Keep the answers so that apply can converge on them later
+	if err := saveStoredAnswers(state.Config); err != nil {
+		return err
+	}
+
+	fmt.Println("\n" + msg("configCreated"))
+
+	secureInstallFiles()
+	recordInstallDir(state.InstallDir)
+	generated()
+	setResumeHint(msg("installResumeKept", state.InstallDir))
+	return nil
+}
+
+// prepareContainerRuntime asks whether to start the containers and, if so,
+// picks the container runtime and installs Docker when it is missing.
+func prepareContainerRuntime(state *installState) error {
+	fmt.Println("\n=== " + msg("sectionStartInstall") + " ===")
+
+	if !answeredBool(startContainersAnswer, msg("promptStartContainers"), true) {
+		return nil
+	}
+	state.StartContainers = true
+	config := &state.Config
+
+	config.InstallationContainerType = podmanOrDocker()
+	if !hostEngine.Native() && !confirmDockerEngine(*config) {
+		state.StartContainers = false
+		fmt.Println(msg("dockerEngineNotStarted"))
+		return nil
+	}
+
+	if config.AutoUpdate == installer.AutoUpdateWatchtower && config.InstallationContainerType == Podman {
+		fmt.Println(msg("watchtowerNeedsDockerSocket"))
+	}
+
+	if !isDockerInstalled() && runtime.GOOS == "linux" && config.InstallationContainerType == Docker {
+		if confirmHostChange(msg("promptInstallDocker"), true) {
+			if err := installDocker(); err != nil {
+				return errors.New(msg("dockerInstallFailed", err))
+			}
+
+			// try to start docker service but ignore errors
+			if err := startDockerService(); err != nil {
+				fmt.Println(msg("dockerServiceStartFailed", err))
+			} else {
+				fmt.Println(msg("dockerServiceStarted"))
+			}
+			// wait for docker to start, checking if docker is running every 2
+			// seconds, unless this is a simulation that installed nothing
+			if !simulating() {
+				fmt.Println(msg("dockerWaiting"))
+				if !waitUntil(waitTimeout, isDockerRunning) {
+					return errors.New(msg("dockerNotRunning", waitTimeout))
+				}
+				fmt.Println(msg("dockerRunning"))
+				fmt.Println(msg("dockerInstalled"))
+			}
+		} else if nonInteractive {
+			return preflightErrorf("%s", msg("dockerNotInstalledNonInteractive"))
+		}
+	}
+	if config.InstallationContainerType == Docker && os.Geteuid() == 0 && hostEngine.Native() {
+		offerDockerGroupForSudoUser()
+	}
+	return nil
+}
+
+// startStack pulls and starts the containers and checks that Pangolin comes
+// up with a valid certificate. Health problems are reported as warnings.
+func startStack(state *installState) error {
+	config := state.Config
+
+	if err := pullContainers(config.InstallationContainerType); err != nil {
+		return err
+	}
+
+	if err := startContainers(config.InstallationContainerType); err != nil {
+		return err
+	}
+	// A simulation started nothing to check
+	if simulating() {
+		return nil
+	}
+
+	if err := waitForServices(config.InstallationContainerType); err != nil {
+		fmt.Printf("Warning: %v\n", err)
+	} else if err := waitForPangolinAPI(config.InstallationContainerType); err != nil {
+		fmt.Printf("Warning: %v\n", err)
+	} else if err := verifyCertificate(config.InstallationContainerType, config.DashboardDomain, config.HTTPSPort); err != nil {
+		fmt.Printf("Warning: %v\n", err)
+	}
+	return nil
+}
+
+// offerMaxMindUpdate offers to update or download the MaxMind databases of
+// an existing installation.
+func offerMaxMindUpdate() {
+	fmt.Println(msg("alreadyInstalled"))
+
+	// Check if MaxMind database exists and offer to update it
+	fmt.Println("\n=== " + msg("sectionMaxMindUpdate") + " ===")
+	if _, err := os.Stat("config/GeoLite2-Country.mmdb"); err == nil {
+		fmt.Println("MaxMind GeoLite2 Country database found.")
+		if readBool(msg("promptMaxMindUpdate"), false) {
+			if err := downloadMaxMindDatabase(); err != nil {
+				fmt.Printf("Error updating MaxMind database: %v\n", err)
+				fmt.Println("You can try updating it manually later if needed.")
+			}
+		}
+	} else {
+		fmt.Println("MaxMind GeoLite2 Country and ASN databases not found.")
+		if readBool(msg("promptMaxMindDownload"), false) {
+			if err := downloadMaxMindDatabase(); err != nil {
+				fmt.Printf("Error downloading MaxMind database: %v\n", err)
+				fmt.Println("You can try downloading it manually later if needed.")
+				return
+			}
+			changed, err := enableGeoIPConfig()
+			if err != nil {
+				fmt.Printf("Error updating %s: %v\n", appConfigFile, err)
+			} else if changed {
+				fmt.Println(msg("geoIPRestartHint"))
+			}
+		}
+	}
+}
+
+// showSetupToken prints the initial setup token, or instructions for finding
+// it if the containers were not started.
+func showSetupToken(config Config) {
+	fmt.Println("\n=== " + msg("sectionSetupToken") + " ===")
+
+	// Check if containers were started during this installation
+	containersStarted := false
+	if (isDockerInstalled() && config.InstallationContainerType == Docker) ||
+		(isPodmanInstalled() && config.InstallationContainerType == Podman) {
+		// Try to fetch and display the token if containers are running
+		containersStarted = true
+		printSetupToken(config.InstallationContainerType, config.DashboardDomain)
+	}
+
+	// If containers weren't started or token wasn't found, show instructions
+	if !containersStarted {
+		showSetupTokenInstructions(config.InstallationContainerType, config.DashboardDomain)
+	}
+}
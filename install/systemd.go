@@ -0,0 +1,212 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+const systemdUnitName = "pangolin.service"
+
+func init() {
+	registerStep(installStep{
+		Name:  "systemd service",
+		Order: 80,
+		When: func(state *installState) bool {
+			return containersStarting(state) && !rootlessMode && runtime.GOOS == "linux" && !devMode && nativeEngine(state)
+		},
+		Run: func(state *installState) error {
+			if confirmHostChange(msg("promptSystemUnit"), true) {
+				if err := installSystemUnit(state.InstallDir, state.Config.InstallationContainerType); err != nil {
+					fmt.Printf("Error setting up the systemd service: %v\n", err)
+				}
+			}
+			return nil
+		},
+	})
+}
+
+// composeCommandLine returns the command used to run compose for the given
+// container runtime, preferring the docker compose plugin.
+func composeCommandLine(containerType SupportedContainer) []string {
+	if containerType == Podman {
+		return []string{"podman-compose"}
+	}
+	if exec.Command("docker", "compose", "version").Run() == nil {
+		return []string{"docker", "compose"}
+	}
+	return []string{"docker-compose"}
+}
+
+// renderComposeUnit returns a systemd unit that starts the compose stack in
+// installDir and stops it again.
+func renderComposeUnit(installDir string, containerType SupportedContainer, userUnit bool) string {
+	compose := composeCommandLine(containerType)
+	if path, err := exec.LookPath(compose[0]); err == nil {
+		compose[0] = path
+	}
+	composeCmd := strings.Join(compose, " ") + " -f docker-compose.yml"
+
+	after := "network-online.target"
+	wantedBy := "default.target"
+	if !userUnit {
+		after += " docker.service"
+		wantedBy = "multi-user.target"
+	}
+
+	return fmt.Sprintf(`# Generated by the Pangolin installer.
+[Unit]
+Description=Pangolin stack
+Wants=network-online.target
+After=%s
+
+[Service]
+Type=oneshot
+RemainAfterExit=yes
+WorkingDirectory=%s
+ExecStart=%s up -d
+ExecStop=%s down
+TimeoutStartSec=0
+
+[Install]
+WantedBy=%s
+`, after, systemdPath(installDir), composeCmd, composeCmd, wantedBy)
+}
+
+// systemdShellCommand returns the command line of an Exec= setting that
+// runs script with /bin/sh. systemd unquotes the script and expands
+// specifiers and environment variables in it, so those are escaped.
+func systemdShellCommand(script string) string {
+	return `/bin/sh -c '` + strings.NewReplacer(`\`, `\\`, `'`, `\'`, "%", "%%", "$", "$$").Replace(script) + `'`
+}
+
+// systemdPath escapes the specifiers in a path for a unit setting.
+func systemdPath(path string) string {
+	return strings.ReplaceAll(path, "%", "%%")
+}
+
+// systemSystemdUnitDir is where units are installed when running as root.
+const systemSystemdUnitDir = "/etc/systemd/system"
+
+// userUnitDir returns the directory for systemd user units.
+func userUnitDir() (string, error) {
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(configDir, "systemd", "user"), nil
+}
+
+// systemctl runs systemctl against the user or the system manager.
+func systemctl(userUnit bool, args ...string) error {
+	if userUnit {
+		args = append([]string{"--user"}, args...)
+	}
+	return run("systemctl", args...)
+}
+
+// writeSystemdUnits writes the given units (file name to contents) and
+// reloads systemd.
+func writeSystemdUnits(userUnit bool, units map[string]string) error {
+	dir := systemSystemdUnitDir
+	if userUnit {
+		var err error
+		if dir, err = userUnitDir(); err != nil {
+			return fmt.Errorf("failed to locate systemd user directory: %v", err)
+		}
+	}
+	if err := hostOps.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create %s: %v", dir, err)
+	}
+
+	for _, name := range sortedKeys(units) {
+		unitPath := filepath.Join(dir, name)
+		if err := hostOps.WriteFile(unitPath, []byte(units[name]), 0644); err != nil {
+			return fmt.Errorf("failed to write %s: %v", unitPath, err)
+		}
+		fmt.Printf("Wrote %s\n", unitPath)
+	}
+
+	if err := systemctl(userUnit, "daemon-reload"); err != nil {
+		return fmt.Errorf("failed to reload systemd units: %v", err)
+	}
+	return nil
+}
+
+// installSystemUnit writes and enables a system unit for the stack, which
+// brings it up at boot also where the restart policy of the containers
+// does not, e.g. when Podman runs without a restart service.
+func installSystemUnit(installDir string, containerType SupportedContainer) error {
+	if os.Geteuid() != 0 {
+		fmt.Println(msg("systemUnitNeedsRoot", filepath.Join(systemSystemdUnitDir, systemdUnitName)))
+		fmt.Print(renderComposeUnit(installDir, containerType, false))
+		return nil
+	}
+	if err := writeSystemdUnits(false, map[string]string{
+		systemdUnitName: renderComposeUnit(installDir, containerType, false),
+	}); err != nil {
+		return err
+	}
+	// The stack is already up, starting the unit only marks it active
+	if err := systemctl(false, "enable", "--now", systemdUnitName); err != nil {
+		return fmt.Errorf("failed to enable %s: %v", systemdUnitName, err)
+	}
+	fmt.Println(msg("systemUnitInstalled", strings.TrimSuffix(systemdUnitName, ".service")))
+	return nil
+}
+
+// installUserUnit writes and enables a systemd user unit for the stack.
+func installUserUnit(installDir string, containerType SupportedContainer) error {
+	if err := writeSystemdUnits(true, map[string]string{
+		systemdUnitName: renderComposeUnit(installDir, containerType, true),
+	}); err != nil {
+		return err
+	}
+	if err := systemctl(true, "enable", "--now", systemdUnitName); err != nil {
+		return fmt.Errorf("failed to enable %s: %v", systemdUnitName, err)
+	}
+
+	// Without lingering the user's systemd manager, and the stack with it,
+	// only runs while the user is logged in
+	name, err := enableLinger()
+	if err != nil {
+		fmt.Printf("The stack will start when you log in, but enabling lingering failed: %v\n", err)
+		fmt.Println("To keep it running after logout and across reboots, have an administrator run:")
+		fmt.Printf("   loginctl enable-linger %s\n", name)
+		return nil
+	}
+	fmt.Printf("The stack now starts at boot and keeps running after you log out. Check it with: systemctl --user status %s\n", strings.TrimSuffix(systemdUnitName, ".service"))
+	return nil
+}
+
+// lingerDir holds a file for every user whose systemd manager is started
+// at boot.
+const lingerDir = "/var/lib/systemd/linger"
+
+// enableLinger enables lingering for the current user, which needs no root
+// on most distributions, and returns the user name.
+func enableLinger() (string, error) {
+	current, err := user.Current()
+	if err != nil {
+		return os.Getenv("USER"), err
+	}
+	name := current.Username
+	lingering := func() bool {
+		_, err := os.Stat(filepath.Join(lingerDir, name))
+		return err == nil
+	}
+	if lingering() {
+		return name, nil
+	}
+	if err := run("loginctl", "enable-linger", name); err != nil {
+		return name, err
+	}
+	if !lingering() {
+		return name, fmt.Errorf("loginctl did not enable lingering for %s", name)
+	}
+	return name, nil
+}
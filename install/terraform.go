@@ -0,0 +1,291 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"gopkg.in/yaml.v3"
+)
+
+// terraformProvider describes how to create the server on one hosting
+// provider. DNS records are always managed in Cloudflare.
+type terraformProvider struct {
+	// LocalName is the name the provider is required and configured by
+	LocalName string
+	Source    string
+	Version   string
+	// Server is the HCL of the server resource, named "pangolin"; IPv4 is
+	// the expression of its public address
+	Server string
+	IPv4   string
+	// Variables are the provider specific variables with their defaults
+	Variables map[string]string
+}
+
+var terraformProviders = map[string]terraformProvider{
+	"hetzner": {
+		LocalName: "hcloud",
+		Source:    "hetznercloud/hcloud",
+		Version:   "~> 1.49",
+		Server: `provider "hcloud" {
+  token = var.hcloud_token
+}
+
+resource "hcloud_ssh_key" "pangolin" {
+  name       = var.server_name
+  public_key = file(pathexpand(var.ssh_public_key_path))
+}
+
+resource "hcloud_server" "pangolin" {
+  name        = var.server_name
+  server_type = var.server_type
+  image       = "ubuntu-24.04"
+  location    = var.location
+  ssh_keys    = [hcloud_ssh_key.pangolin.id]
+}`,
+		IPv4:      "hcloud_server.pangolin.ipv4_address",
+		Variables: map[string]string{"server_type": "cx22", "location": "nbg1"},
+	},
+	"digitalocean": {
+		LocalName: "digitalocean",
+		Source:    "digitalocean/digitalocean",
+		Version:   "~> 2.44",
+		Server: `provider "digitalocean" {
+  token = var.digitalocean_token
+}
+
+resource "digitalocean_ssh_key" "pangolin" {
+  name       = var.server_name
+  public_key = file(pathexpand(var.ssh_public_key_path))
+}
+
+resource "digitalocean_droplet" "pangolin" {
+  name     = var.server_name
+  size     = var.server_type
+  image    = "ubuntu-24-04-x64"
+  region   = var.location
+  ssh_keys = [digitalocean_ssh_key.pangolin.fingerprint]
+}`,
+		IPv4:      "digitalocean_droplet.pangolin.ipv4_address",
+		Variables: map[string]string{"server_type": "s-1vcpu-2gb", "location": "fra1"},
+	},
+}
+
+// terraformMain is the root module. The install runs over SSH once the DNS
+// records exist, so Let's Encrypt can validate the domains right away.
+var terraformMain = template.Must(template.New("main.tf").Parse(`# Generated by the Pangolin installer for {{.Config.DashboardDomain}}.
+
+terraform {
+  required_version = ">= 1.4"
+  required_providers {
+    {{.Provider.LocalName}} = {
+      source  = "{{.Provider.Source}}"
+      version = "{{.Provider.Version}}"
+    }
+    cloudflare = {
+      source  = "cloudflare/cloudflare"
+      version = "~> 4.0"
+    }
+  }
+}
+
+variable "{{.Provider.LocalName}}_token" {
+  type      = string
+  sensitive = true
+}
+
+variable "cloudflare_api_token" {
+  type      = string
+  sensitive = true
+}
+
+variable "cloudflare_zone_id" {
+  type = string
+}
+
+variable "server_name" {
+  type    = string
+  default = "pangolin"
+}
+{{range $name, $default := .Provider.Variables}}
+variable "{{$name}}" {
+  type    = string
+  default = "{{$default}}"
+}
+{{end}}
+variable "ssh_public_key_path" {
+  type    = string
+  default = "~/.ssh/id_ed25519.pub"
+}
+
+variable "ssh_private_key_path" {
+  type    = string
+  default = "~/.ssh/id_ed25519"
+}
+
+variable "dashboard_domain" {
+  type = string
+}
+
+variable "base_domain" {
+  type = string
+}
+
+# The install commands below use the same directory; regenerate to change it
+locals {
+  install_dir = {{.InstallDir}}
+}
+
+{{.Provider.Server}}
+
+provider "cloudflare" {
+  api_token = var.cloudflare_api_token
+}
+
+resource "cloudflare_record" "dashboard" {
+  zone_id = var.cloudflare_zone_id
+  name    = var.dashboard_domain
+  type    = "A"
+  content = {{.Provider.IPv4}}
+  proxied = false
+}
+
+# Resources are served on subdomains of the base domain
+resource "cloudflare_record" "wildcard" {
+  zone_id = var.cloudflare_zone_id
+  name    = "*.${var.base_domain}"
+  type    = "A"
+  content = {{.Provider.IPv4}}
+  proxied = false
+}
+
+resource "terraform_data" "install" {
+  triggers_replace = [{{.Provider.IPv4}}, filesha256("${path.module}/answers.yml")]
+  depends_on       = [cloudflare_record.dashboard, cloudflare_record.wildcard]
+
+  connection {
+    type        = "ssh"
+    host        = {{.Provider.IPv4}}
+    user        = "root"
+    private_key = file(pathexpand(var.ssh_private_key_path))
+  }
+
+  provisioner "remote-exec" {
+    inline = [
+      "cloud-init status --wait || true",
+      "mkdir -p ${local.install_dir}",
+    ]
+  }
+
+  provisioner "file" {
+    source      = "${path.module}/answers.yml"
+    destination = "${local.install_dir}/answers.yml"
+  }
+
+  provisioner "remote-exec" {
+    inline = [
+{{- range .Commands}}
+      {{.}},
+{{- end}}
+    ]
+  }
+}
+
+output "ipv4_address" {
+  value = {{.Provider.IPv4}}
+}
+
+output "dashboard_url" {
+  value = "https://${var.dashboard_domain}/auth/initial-setup"
+}
+`))
+
+func runGenerateTerraform(args []string) error {
+	var names []string
+	for name := range terraformProviders {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	flags := flag.NewFlagSet("generate terraform", flag.ExitOnError)
+	answersPath := flags.String("answers", "", "Path to the YAML answers file (required)")
+	out := flags.String("out", "terraform", "Directory to write the Terraform files to")
+	providerName := flags.String("provider", "hetzner", "Hosting provider of the server: "+strings.Join(names, ", "))
+	dir := flags.String("dir", defaultInstallDir, "Installation directory on the server")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	provider, ok := terraformProviders[*providerName]
+	if !ok {
+		return fmt.Errorf("unknown provider %q: use %s", *providerName, strings.Join(names, ", "))
+	}
+	config, err := loadProvisioningAnswers(*answersPath)
+	if err != nil {
+		return err
+	}
+
+	commands := []string{"apt-get update && DEBIAN_FRONTEND=noninteractive apt-get install -y " + strings.Join(provisionPackages(config), " ")}
+	commands = append(commands, provisionCommands(config, *dir)...)
+	for i, c := range commands {
+		commands[i] = hclString(c)
+	}
+
+	var main bytes.Buffer
+	if err := terraformMain.Execute(&main, map[string]any{
+		"Provider":   provider,
+		"Config":     config,
+		"InstallDir": hclString(*dir),
+		"Commands":   commands,
+	}); err != nil {
+		return err
+	}
+
+	answers, err := yaml.Marshal(config)
+	if err != nil {
+		return err
+	}
+	tfvars := fmt.Sprintf(`# Set the API tokens through TF_VAR_%s_token and TF_VAR_cloudflare_api_token.
+dashboard_domain   = %s
+base_domain        = %s
+cloudflare_zone_id = ""
+`, provider.LocalName, hclString(config.DashboardDomain), hclString(config.BaseDomain))
+
+	if err := os.MkdirAll(*out, 0755); err != nil {
+		return err
+	}
+	files := []struct {
+		name    string
+		content []byte
+		mode    os.FileMode
+	}{
+		{"main.tf", main.Bytes(), 0644},
+		{"terraform.tfvars", []byte(tfvars), 0644},
+		// The answers hold the secret and any passwords
+		{"answers.yml", answers, 0600},
+	}
+	for _, f := range files {
+		path := filepath.Join(*out, f.name)
+		if err := os.WriteFile(path, f.content, f.mode); err != nil {
+			return fmt.Errorf("failed to write %s: %v", path, err)
+		}
+		fmt.Printf("Wrote %s\n", path)
+	}
+
+	fmt.Printf("\nFill in cloudflare_zone_id in %s, export the API tokens, then run:\n", filepath.Join(*out, "terraform.tfvars"))
+	fmt.Printf("  cd %s && terraform init && terraform apply\n", *out)
+	fmt.Println("Keep answers.yml and the Terraform state out of version control: both contain secrets.")
+	return nil
+}
+
+// hclString quotes s as an HCL string literal, escaping template sequences.
+func hclString(s string) string {
+	return strings.NewReplacer("${", "$${", "%{", "%%{").Replace(strconv.Quote(s))
+}
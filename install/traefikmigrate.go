@@ -0,0 +1,197 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/fosrl/pangolin/install/pkg/installer"
+)
+
+// traefikVersion is the Traefik image tag this installer ships with and
+// upgrades to.
+var traefikVersion = "v3.6"
+
+// traefikMigration rewrites the Traefik configuration for a major version.
+// Apply edits the parsed static and dynamic configs in place; it returns what
+// it rewrote and what it found that has to be changed by hand.
+type traefikMigration struct {
+	Major int
+	Apply func(static, dynamic map[string]any) (rewritten, manual []string)
+}
+
+// traefikMigrations follow the Traefik migration guides.
+var traefikMigrations = []traefikMigration{
+	{Major: 3, Apply: migrateTraefikV3},
+}
+
+// traefikMajor returns the major version of a Traefik image tag such as
+// "v3.6" or "2.11.2", or 0 for tags like "latest".
+func traefikMajor(tag string) int {
+	major, _, _ := strings.Cut(installer.StripVersionPrefix(tag), ".")
+	n, err := strconv.Atoi(major)
+	if err != nil {
+		return 0
+	}
+	return n
+}
+
+// migrateTraefikConfig applies the migrations for the majors after from up
+// to and including to. With apply false, nothing is written and the result
+// is what an upgrade would do.
+func migrateTraefikConfig(from, to int, apply bool) (rewritten, manual []string, err error) {
+	files := map[string]*yamlFile{}
+	for _, path := range []string{traefikStaticFile, traefikDynamicFile} {
+		file, err := readYAMLFile(path)
+		if err != nil {
+			return nil, nil, err
+		}
+		files[path] = file
+	}
+
+	for _, m := range traefikMigrations {
+		if m.Major <= from || m.Major > to {
+			continue
+		}
+		r, m := m.Apply(files[traefikStaticFile].Doc, files[traefikDynamicFile].Doc)
+		rewritten = append(rewritten, r...)
+		manual = append(manual, m...)
+	}
+	if !apply || len(rewritten) == 0 {
+		return rewritten, manual, nil
+	}
+
+	for _, path := range []string{traefikStaticFile, traefikDynamicFile} {
+		if _, err := files[path].save(); err != nil {
+			return nil, nil, err
+		}
+	}
+	recordChange(fmt.Sprintf("Migrate the Traefik configuration to v%d\n\n- %s", to, strings.Join(rewritten, "\n- ")))
+	return rewritten, manual, nil
+}
+
+// traefikV3RemovedStatic are static options Traefik v3 no longer accepts
+// and that have no automatic replacement.
+var traefikV3RemovedStatic = map[string]string{
+	"providers.docker.swarmMode":     "moved to the separate providers.swarm provider",
+	"providers.marathon":             "the Marathon provider was removed",
+	"providers.rancher":              "the Rancher v1 provider was removed",
+	"tracing.jaeger":                 "tracing only supports OpenTelemetry (tracing.otlp)",
+	"tracing.zipkin":                 "tracing only supports OpenTelemetry (tracing.otlp)",
+	"tracing.datadog":                "tracing only supports OpenTelemetry (tracing.otlp)",
+	"tracing.instana":                "tracing only supports OpenTelemetry (tracing.otlp)",
+	"tracing.haystack":               "tracing only supports OpenTelemetry (tracing.otlp)",
+	"tracing.elastic":                "tracing only supports OpenTelemetry (tracing.otlp)",
+	"metrics.influxDB":               "InfluxDB v1 metrics were removed; use metrics.influxDB2",
+	"experimental.kubernetesGateway": "the Gateway API is now providers.kubernetesGateway",
+}
+
+// traefikV3RuleFunctions are v2 rule matchers renamed in v3.
+var traefikV3RuleFunctions = strings.NewReplacer(
+	"HeadersRegexp(", "HeaderRegexp(",
+	"Headers(", "Header(",
+	"HostHeader(", "Host(",
+)
+
+var (
+	// traefikMultiArgMatcher matches Host or PathPrefix with more than one
+	// argument, which v3 no longer accepts
+	traefikMultiArgMatcher = regexp.MustCompile("\\b(Host|Path|PathPrefix)\\(((?:`[^`]*`\\s*,\\s*)+`[^`]*`)\\)")
+	// traefikNamedRegexp matches the {name:regexp} placeholders of v2
+	// HostRegexp and PathRegexp
+	traefikNamedRegexp = regexp.MustCompile(`\{[A-Za-z0-9_]+:([^{}]+)\}`)
+	traefikRegexpRule  = regexp.MustCompile(`\b(HostRegexp|PathRegexp)\(`)
+)
+
+func migrateTraefikV3(static, dynamic map[string]any) (rewritten, manual []string) {
+	if deleteKey(static, []string{"pilot"}) {
+		rewritten = append(rewritten, "removed pilot: Traefik Pilot was shut down")
+	}
+	if deleteKey(static, []string{"experimental", "http3"}) {
+		rewritten = append(rewritten, "removed experimental.http3: HTTP/3 is enabled per entry point")
+	}
+	for _, provider := range []string{"consulCatalog", "nomad"} {
+		if ns, ok := lookupString(static, "providers", provider, "namespace"); ok {
+			deleteKey(static, []string{"providers", provider, "namespace"})
+			setKey(static, []string{"providers", provider, "namespaces"}, []any{ns})
+			rewritten = append(rewritten, fmt.Sprintf("providers.%s.namespace is now namespaces: [%s]", provider, ns))
+		}
+	}
+	for _, key := range sortedKeys(traefikV3RemovedStatic) {
+		if _, ok := lookup(static, strings.Split(key, ".")...); ok {
+			manual = append(manual, fmt.Sprintf("%s: %s: %s", traefikStaticFile, key, traefikV3RemovedStatic[key]))
+		}
+	}
+
+	for _, protocol := range []string{"http", "tcp"} {
+		middlewares, _ := lookup(dynamic, protocol, "middlewares")
+		m, _ := middlewares.(map[string]any)
+		for _, name := range sortedKeys(m) {
+			middleware, _ := m[name].(map[string]any)
+			if middleware == nil {
+				continue
+			}
+			where := fmt.Sprintf("%s.middlewares.%s", protocol, name)
+			if moveKey(middleware, []string{"ipWhiteList"}, []string{"ipAllowList"}) {
+				rewritten = append(rewritten, where+": ipWhiteList is now ipAllowList")
+			}
+			if deleteKey(middleware, []string{"stripPrefix", "forceSlash"}) {
+				rewritten = append(rewritten, where+": removed stripPrefix.forceSlash")
+			}
+			if moveKey(middleware, []string{"headers", "featurePolicy"}, []string{"headers", "permissionsPolicy"}) {
+				rewritten = append(rewritten, where+": headers.featurePolicy is now permissionsPolicy")
+			}
+			for _, key := range []string{"sslRedirect", "sslTemporaryRedirect", "sslHost", "sslForceHost"} {
+				if _, ok := lookup(middleware, "headers", key); ok {
+					manual = append(manual, fmt.Sprintf("%s: %s: headers.%s was removed; use a redirectScheme middleware or entry point redirection", traefikDynamicFile, where, key))
+				}
+			}
+			if _, ok := lookup(middleware, "contentType", "autoDetect"); ok {
+				manual = append(manual, fmt.Sprintf("%s: %s: contentType.autoDetect was removed; content type detection is now off unless the middleware is used", traefikDynamicFile, where))
+			}
+		}
+	}
+
+	tlsOptions, _ := lookup(dynamic, "tls", "options")
+	options, _ := tlsOptions.(map[string]any)
+	for _, name := range sortedKeys(options) {
+		if option, ok := options[name].(map[string]any); ok && deleteKey(option, []string{"preferServerCipherSuites"}) {
+			rewritten = append(rewritten, fmt.Sprintf("tls.options.%s: removed preferServerCipherSuites", name))
+		}
+	}
+
+	for _, protocol := range []string{"http", "tcp"} {
+		routersValue, _ := lookup(dynamic, protocol, "routers")
+		routers, _ := routersValue.(map[string]any)
+		for _, name := range sortedKeys(routers) {
+			router, _ := routers[name].(map[string]any)
+			rule, _ := router["rule"].(string)
+			if rule == "" || router["ruleSyntax"] == "v2" {
+				continue
+			}
+			where := fmt.Sprintf("%s.routers.%s", protocol, name)
+			updated := traefikV3RuleFunctions.Replace(rule)
+			updated = traefikMultiArgMatcher.ReplaceAllStringFunc(updated, func(match string) string {
+				parts := traefikMultiArgMatcher.FindStringSubmatch(match)
+				var alternatives []string
+				for _, arg := range strings.Split(parts[2], ",") {
+					alternatives = append(alternatives, parts[1]+"("+strings.TrimSpace(arg)+")")
+				}
+				return "(" + strings.Join(alternatives, " || ") + ")"
+			})
+			if traefikRegexpRule.MatchString(updated) && traefikNamedRegexp.MatchString(updated) {
+				updated = traefikNamedRegexp.ReplaceAllString(updated, "$1")
+				manual = append(manual, fmt.Sprintf("%s: %s: check the rewritten regular expression, which v3 matches against the whole value unanchored", traefikDynamicFile, where))
+			}
+			if traefikRegexpRule.MatchString(updated) && strings.Contains(updated, "{") {
+				manual = append(manual, fmt.Sprintf("%s: %s: the placeholders in %q need regular expressions in v3", traefikDynamicFile, where, updated))
+			}
+			if updated != rule {
+				router["rule"] = updated
+				rewritten = append(rewritten, fmt.Sprintf("%s: rule is now %s", where, updated))
+			}
+		}
+	}
+	return rewritten, manual
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/fosrl/pangolin/install/pkg/installer"
+)
+
+const (
+	latestReleasePath  = "/repos/fosrl/pangolin/releases/latest"
+	releaseAssetPath   = "/fosrl/pangolin/releases/download/%s/installer_%s_%s"
+	updateCheckTimeout = 3 * time.Second
+	// skipUpdateCheckEnv disables the startup update check. It is also set
+	// when re-executing after a self-update.
+	skipUpdateCheckEnv = "PANGOLIN_INSTALLER_SKIP_UPDATE_CHECK"
+)
+
+// checkForInstallerUpdate compares the Pangolin version this installer
+// deploys with the latest release and warns when the installer is a minor
+// release or more behind, offering to replace itself with the latest build
+// and start over. The check is best-effort: network errors are ignored.
+func checkForInstallerUpdate(args []string) {
+	if pangolinVersion == "" || os.Getenv(skipUpdateCheckEnv) != "" {
+		return
+	}
+	if slices.Contains(args, "--version") || slices.Contains(args, "-version") {
+		return
+	}
+	latest, err := latestPangolinRelease(updateCheckTimeout)
+	if err != nil || !significantlyBehind(pangolinVersion, latest) {
+		return
+	}
+
+	fmt.Println(msg("updateAvailable", pangolinVersion, latest))
+	// The flags are parsed after the check, and a non-interactive run must
+	// never stop at a question
+	if isAccessibleMode() || !selfUpdateSupported() || nonInteractiveArg(args) {
+		fmt.Println(msg("updateDownloadHint", "curl -fsSL "+getInstallerURL+" | bash") + "\n")
+		return
+	}
+	if !readBool(msg("promptSelfUpdate"), true) {
+		return
+	}
+
+	if err := selfUpdate(latest); err != nil {
+		fmt.Printf("Error updating the installer: %v\nContinuing with the current installer.\n", err)
+	}
+}
+
+// nonInteractiveArg reports whether args hold --non-interactive, before the
+// flags are parsed.
+func nonInteractiveArg(args []string) bool {
+	return slices.ContainsFunc(args, func(arg string) bool {
+		name, value, _ := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		return strings.HasPrefix(arg, "-") && name == "non-interactive" && value != "false"
+	})
+}
+
+// latestPangolinRelease returns the tag of the latest Pangolin release.
+func latestPangolinRelease(timeout time.Duration) (string, error) {
+	body, err := fetchGitHubJSON(latestReleasePath, timeout)
+	if err != nil {
+		return "", err
+	}
+
+	var release struct {
+		TagName string `json:"tag_name"`
+	}
+	if err := json.Unmarshal(body, &release); err != nil {
+		return "", err
+	}
+	if release.TagName == "" {
+		return "", fmt.Errorf("release has no tag")
+	}
+	return release.TagName, nil
+}
+
+// significantlyBehind reports whether latest is a newer major or minor
+// release than current. Patch releases alone do not warrant a warning.
+func significantlyBehind(current, latest string) bool {
+	c, l := installer.ParseVersion(current), installer.ParseVersion(latest)
+	return l[0] > c[0] || l[0] == c[0] && l[1] > c[1]
+}
+
+// selfUpdateSupported reports whether a release build of the installer
+// exists for this platform.
+func selfUpdateSupported() bool {
+	return runtime.GOOS == "linux" && (runtime.GOARCH == "amd64" || runtime.GOARCH == "arm64")
+}
+
+// selfUpdate replaces the running executable with the installer of the given
+// release and re-executes it with the same arguments.
+func selfUpdate(tag string) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	if exe, err = filepath.EvalSymlinks(exe); err != nil {
+		return err
+	}
+
+	url := githubDownloadBase() + fmt.Sprintf(releaseAssetPath, tag, runtime.GOOS, runtime.GOARCH)
+	fmt.Printf("Downloading %s...\n", url)
+	client := &http.Client{Timeout: 2 * time.Minute}
+	resp, err := client.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("download failed: %s", resp.Status)
+	}
+
+	// Write next to the executable so the rename is atomic
+	tmp, err := os.CreateTemp(filepath.Dir(exe), ".installer-update-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := io.Copy(tmp, resp.Body); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0755); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), exe); err != nil {
+		return err
+	}
+
+	fmt.Printf("Updated the installer to %s, restarting...\n\n", tag)
+	return syscall.Exec(exe, os.Args, append(os.Environ(), skipUpdateCheckEnv+"=1"))
+}
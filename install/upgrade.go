@@ -0,0 +1,402 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/fosrl/pangolin/install/pkg/installer"
+)
+
+// upgradeComponents are the components `upgrade --only` accepts, with the
+// compose services to recreate for each. Badger is loaded by Traefik, and
+// Traefik shares Gerbil's network namespace.
+var upgradeComponents = map[string][]string{
+	"pangolin": {"pangolin"},
+	"gerbil":   {"gerbil", "traefik"},
+	"badger":   {"traefik"},
+}
+
+// runUpgrade upgrades an existing installation to
+// the component versions baked into this installer: it backs up the config,
+// applies config migrations, bumps the image tags and Badger plugin version
+// and recreates the containers, one at a time with --rolling, while the
+// dashboard shows the maintenance page. Afterwards it offers to remove old
+// image versions beyond --keep-last. With --only, a single component is
+// upgraded after checking it against the compatibility matrix.
+func runUpgrade(args []string) error {
+	flags := flag.NewFlagSet("upgrade", flag.ExitOnError)
+	dir := flags.String("dir", "", "Installation directory")
+	yes := flags.Bool("yes", false, "Do not ask for confirmation")
+	plainFlag(flags)
+	rolling := flags.Bool("rolling", false, "Recreate services one at a time in dependency order, checking health in between, to minimize downtime")
+	only := flags.String("only", "", "Upgrade a single component: pangolin, gerbil or badger")
+	noMaintenance := flags.Bool("no-maintenance", false, "Do not show the maintenance page on the dashboard domain while the containers are recreated")
+	keepLast := flags.Int("keep-last", 1, "Number of previous Pangolin and Gerbil image versions to keep when removing old images")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *keepLast < 0 {
+		return usageErrorf("--keep-last must not be negative")
+	}
+	if _, ok := upgradeComponents[*only]; *only != "" && !ok {
+		return usageErrorf("unknown component %q: use pangolin, gerbil or badger", *only)
+	}
+
+	enablePlainOutput()
+
+	if err := enterInstallDir(*dir); err != nil {
+		return err
+	}
+
+	if pangolinVersion == "" || gerbilVersion == "" || badgerVersion == "" {
+		return preflightErrorf("this installer was built without target versions; use a release build to upgrade")
+	}
+
+	installed, err := installedVersions()
+	if err != nil {
+		return err
+	}
+	targets := map[string]string{"pangolin": pangolinVersion, "gerbil": gerbilVersion, "badger": badgerVersion}
+
+	fmt.Println("\n=== Upgrade ===")
+	fmt.Printf("Installed versions: Pangolin %s, Gerbil %s, Badger %s\n", installed["pangolin"], orNone(installed["gerbil"]), installed["badger"])
+
+	// The versions the installation will run after the upgrade
+	result := targets
+	if *only != "" {
+		if installed[*only] == "" {
+			return fmt.Errorf("%s is not part of this installation", *only)
+		}
+		result = maps.Clone(installed)
+		result[*only] = targets[*only]
+		fmt.Printf("Upgrading only %s to %s\n", *only, targets[*only])
+	} else {
+		fmt.Printf("Target versions: Pangolin %s, Gerbil %s, Badger %s\n", pangolinVersion, gerbilVersion, badgerVersion)
+	}
+
+	for component, version := range result {
+		if installer.CompareVersions(installed[component], version) > 0 && installed[component] != "" {
+			return preflightErrorf("installed %s %s is newer than this installer's target %s", component, installed[component], version)
+		}
+	}
+	if problems := checkCompatibility(result["pangolin"], result); len(problems) > 0 {
+		return preflightErrorf("the resulting versions are incompatible:\n  %s", strings.Join(problems, "\n  "))
+	}
+
+	// Plugins are only moved with a full upgrade, which also moves Traefik
+	if *only == "" {
+		plugins, err := readPluginVersions(traefikStaticFile)
+		if err != nil {
+			return err
+		}
+		if problems := pluginCompatibility(plugins, traefikVersion); len(problems) > 0 {
+			return preflightErrorf("the Traefik plugins are incompatible with Traefik %s:\n  %s", traefikVersion, strings.Join(problems, "\n  "))
+		}
+	}
+
+	var migrations []configMigration
+	if *only == "" || *only == "pangolin" {
+		migrations = pendingMigrations(installed["pangolin"], pangolinVersion)
+	}
+	if len(migrations) > 0 {
+		fmt.Printf("%d config migration(s) will be applied.\n", len(migrations))
+	}
+
+	// A new Traefik major refuses to start on options it removed, so they
+	// are rewritten or reported before anything changes
+	installedTraefik, _ := ReadComposeImageTag(composeFile, "traefik")
+	fromMajor, toMajor := traefikMajor(installedTraefik), traefikMajor(traefikVersion)
+	traefikMajorUpgrade := *only == "" && fromMajor > 0 && fromMajor < toMajor
+	if traefikMajorUpgrade {
+		fmt.Printf("Traefik will be upgraded from %s to %s, a new major version.\n", installedTraefik, traefikVersion)
+		rewritten, manual, err := migrateTraefikConfig(fromMajor, toMajor, false)
+		if err != nil {
+			return err
+		}
+		if len(rewritten) > 0 {
+			fmt.Printf("%d Traefik option(s) will be rewritten:\n  %s\n", len(rewritten), strings.Join(rewritten, "\n  "))
+		}
+		if len(manual) > 0 {
+			fmt.Printf("These Traefik options have to be changed by hand, or Traefik %s will not start:\n  %s\n", traefikVersion, strings.Join(manual, "\n  "))
+			if *yes || !readBool(msg("promptUpgradeDespiteTraefik"), false) {
+				return preflightErrorf("fix the Traefik configuration and run the upgrade again")
+			}
+		}
+	}
+
+	if !*yes && !readBool(msg("promptProceedUpgrade"), true) {
+		fmt.Println(msg("upgradeCancelled"))
+		return errAborted
+	}
+
+	containerType := detectContainerType()
+	if containerType == Undefined {
+		fmt.Println("Unable to detect container type from existing installation.")
+		containerType = podmanOrDocker()
+	}
+
+	if err := runHooks(hookPreUpgrade, existingConfig(containerType)); err != nil {
+		return err
+	}
+
+	fmt.Println("Backing up configuration and database...")
+	backup, err := createUpgradeBackup(containerType, "upgrade", installed)
+	if err != nil {
+		return fmt.Errorf("backup failed: %w", err)
+	}
+	fmt.Printf("Backup saved to %s; restore it with `rollback` if the upgrade fails.\n", backup.Dir)
+	record := "\n\nBackup: " + backup.Dir
+	if backup.Database != "" {
+		record += "\nDatabase snapshot: " + filepath.Join(backup.Dir, backup.Database)
+	} else {
+		fmt.Println("No database found, skipping the snapshot.")
+	}
+
+	if len(migrations) > 0 {
+		fmt.Println("Migrating configuration...")
+		if err := applyMigrations(migrations); err != nil {
+			return fmt.Errorf("config migration failed: %w", err)
+		}
+		recordChange(fmt.Sprintf("Migrate the configuration to Pangolin %s", pangolinVersion))
+	}
+	if traefikMajorUpgrade {
+		fmt.Printf("Migrating the Traefik configuration to %s...\n", traefikVersion)
+		rewritten, _, err := migrateTraefikConfig(fromMajor, toMajor, true)
+		if err != nil {
+			return fmt.Errorf("Traefik config migration failed: %w", err)
+		}
+		for _, change := range rewritten {
+			fmt.Printf("  [traefik %s] %s\n", traefikVersion, change)
+		}
+	}
+
+	// The maintenance page stays up if the upgrade fails; one turned on by
+	// hand before the upgrade is left on
+	maintenance := !*noMaintenance && !maintenanceEnabled()
+	if maintenance {
+		fmt.Println("Turning maintenance mode on...")
+		if err := enableMaintenance(containerType); err != nil {
+			fmt.Printf("Warning: could not turn maintenance mode on: %v\n", err)
+			maintenance = false
+		} else {
+			defer func() {
+				if maintenanceEnabled() {
+					fmt.Println("Maintenance mode is still on; turn it off with `maintenance off` once Pangolin is up.")
+				}
+			}()
+		}
+	}
+
+	if *only != "" {
+		if err := upgradeComponent(containerType, *only, installed[*only], targets[*only], record); err != nil {
+			return err
+		}
+	} else {
+		if err := updateComponentVersions(); err != nil {
+			return err
+		}
+
+		recordChange(fmt.Sprintf("Upgrade Pangolin from %s to %s", installed["pangolin"], pangolinVersion) + record)
+
+		if err := pullContainers(containerType); err != nil {
+			return err
+		}
+		if *rolling {
+			if err := rollingRestart(containerType); err != nil {
+				return err
+			}
+		} else if err := startContainers(containerType); err != nil {
+			return err
+		}
+		if err := waitForServices(containerType); err != nil {
+			return fmt.Errorf("the upgraded containers are not healthy: %v", err)
+		}
+	}
+	if err := waitForPangolinAPI(containerType); err != nil {
+		return fmt.Errorf("the upgraded Pangolin is not ready: %v", err)
+	}
+
+	if maintenance {
+		if err := disableMaintenance(containerType); err != nil {
+			fmt.Printf("Warning: could not turn maintenance mode off, run `maintenance off`: %v\n", err)
+		}
+	}
+
+	if *only != "" {
+		fmt.Printf("\nUpgraded %s to %s.\n", *only, targets[*only])
+	} else {
+		fmt.Printf("\nUpgraded Pangolin to %s.\n", pangolinVersion)
+	}
+
+	if err := reapplyDesiredState(); err != nil {
+		return withExitCode(exitPartial, fmt.Errorf("upgraded, but %s could not be applied: %v", desiredStateFile, err))
+	}
+
+	runPostHooks(hookPostUpgrade, existingConfig(containerType))
+
+	if err := pruneOldImages(containerType, *keepLast, !*yes); err != nil {
+		fmt.Printf("Warning: could not remove old images: %v\n", err)
+	}
+	return nil
+}
+
+// installedVersions returns the installed Pangolin, Gerbil and Badger
+// versions. Gerbil is empty when the installation runs without it.
+func installedVersions() (map[string]string, error) {
+	pangolinTag, err := ReadComposeImageTag(composeFile, "pangolin")
+	if err != nil {
+		return nil, fmt.Errorf("error detecting installed version: %w", err)
+	}
+	gerbilTag, _ := ReadComposeImageTag(composeFile, "gerbil")
+
+	badger, err := installedBadgerVersion()
+	if err != nil {
+		return nil, fmt.Errorf("error detecting installed Badger version: %w", err)
+	}
+
+	versions := map[string]string{
+		"pangolin": installer.StripVersionPrefix(pangolinTag),
+		"gerbil":   "",
+		"badger":   badger,
+	}
+	if gerbilTag != "" {
+		versions["gerbil"] = installer.StripVersionPrefix(gerbilTag)
+	}
+	return versions, nil
+}
+
+// installedBadgerVersion returns the Badger version recorded in the state
+// file, or the one the Traefik config loads for older installations.
+func installedBadgerVersion() (string, error) {
+	if config, ok, err := loadInstallState(); err != nil {
+		return "", err
+	} else if ok && config.BadgerVersion != "" {
+		return config.BadgerVersion, nil
+	}
+	traefikConfig, err := ReadTraefikConfig(traefikStaticFile)
+	if err != nil {
+		return "", err
+	}
+	return traefikConfig.BadgerVersion, nil
+}
+
+// upgradeComponent moves a single component to version and recreates only
+// the services that use it, waiting for each to become healthy. record is
+// appended to the configuration history entry.
+func upgradeComponent(containerType SupportedContainer, component, from, version, record string) error {
+	var err error
+	switch component {
+	case "pangolin":
+		err = setComposeImageVersion(composeFile, "fosrl/pangolin", version)
+	case "gerbil":
+		err = setComposeImageVersion(composeFile, "fosrl/gerbil", version)
+	case "badger":
+		err = setBadgerVersion(traefikStaticFile, version)
+	}
+	if err != nil {
+		return err
+	}
+	err = updateStoredAnswers(func(config *Config) {
+		switch component {
+		case "pangolin":
+			config.PangolinVersion = version
+		case "gerbil":
+			config.GerbilVersion = version
+		case "badger":
+			config.BadgerVersion = version
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	recordChange(fmt.Sprintf("Upgrade %s from %s to %s", component, from, version) + record)
+
+	services := upgradeComponents[component]
+	if component != "badger" {
+		if err := composeCommand(containerType, "pull", services[0]); err != nil {
+			return fmt.Errorf("failed to pull %s: %v", services[0], err)
+		}
+	}
+
+	containers := map[string]string{}
+	if found, err := composeServices(composeFile); err == nil {
+		for _, service := range found {
+			containers[service.Name] = service.Container
+		}
+	}
+
+	// Traefik only reads plugin versions on start, so recreate even if the
+	// compose definition did not change
+	for _, service := range services {
+		if _, ok := containers[service]; !ok {
+			continue
+		}
+		if err := composeCommand(containerType, "up", "-d", "--no-deps", "--force-recreate", service); err != nil {
+			return fmt.Errorf("failed to recreate %s: %v", service, err)
+		}
+		if err := waitForContainer(containers[service], containerType); err != nil {
+			return fmt.Errorf("%s did not become healthy: %v", service, err)
+		}
+	}
+	return nil
+}
+
+func orNone(version string) string {
+	if version == "" {
+		return "(not installed)"
+	}
+	return version
+}
+
+// updateComponentVersions points the compose file and Traefik plugin config
+// at the versions baked into the installer. The plugins are updated first,
+// so their change is recorded on its own.
+func updateComponentVersions() error {
+	updated, err := updatePluginVersions(traefikStaticFile)
+	if err != nil {
+		return err
+	}
+	for _, plugin := range updated {
+		fmt.Printf("Traefik plugin: %s\n", plugin)
+	}
+	if err := setComposeImageVersion(composeFile, "fosrl/pangolin", pangolinVersion); err != nil {
+		return err
+	}
+	if err := setComposeImageVersion(composeFile, "fosrl/gerbil", gerbilVersion); err != nil {
+		return err
+	}
+	if err := setComposeImageVersion(composeFile, "docker.io/traefik", traefikVersion); err != nil {
+		return err
+	}
+	return updateStoredAnswers(loadVersions)
+}
+
+// setComposeImageVersion replaces the release part of an image tag in the
+// compose file, keeping variant prefixes such as "ee-postgresql-". Editing
+// the text directly keeps the rest of the file untouched.
+func setComposeImageVersion(composePath, image, version string) error {
+	content, err := os.ReadFile(composePath)
+	if err != nil {
+		return fmt.Errorf("error reading compose file: %w", err)
+	}
+
+	pattern := regexp.MustCompile(`(?m)^(\s*image:\s*\S*` + regexp.QuoteMeta(image) + `:(?:[a-z]+-)*)\S+`)
+	updated := pattern.ReplaceAll(content, []byte("${1}"+version))
+
+	if err := os.WriteFile(composePath, updated, 0644); err != nil {
+		return fmt.Errorf("error writing compose file: %w", err)
+	}
+	return nil
+}
+
+// setBadgerVersion updates the Badger plugin version in the Traefik static
+// config.
+func setBadgerVersion(traefikConfigPath, version string) error {
+	return setPluginVersion(traefikConfigPath, traefikPlugins[0].ModuleName, version)
+}
@@ -0,0 +1,342 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"maps"
+	"net/mail"
+	"net/url"
+	"os"
+	"path"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Paths of the files that make up an installation, relative to the
+// installation directory.
+const (
+	composeFile        = "docker-compose.yml"
+	appConfigFile      = "config/config.yml"
+	traefikStaticFile  = "config/traefik/traefik_config.yml"
+	traefikDynamicFile = "config/traefik/dynamic_config.yml"
+)
+
+// knownAppConfigSections are the top-level keys accepted by Pangolin's config
+// schema (server/lib/readConfigFile.ts).
+var knownAppConfigSections = []string{
+	"app", "domains", "server", "postgres", "postgres_logs", "traefik",
+	"gerbil", "orgs", "rate_limits", "email", "flags", "dns",
+}
+
+type validationIssue struct {
+	File    string
+	Message string
+	Warning bool
+}
+
+// validator collects the problems found while checking an installation.
+type validator struct {
+	issues []validationIssue
+}
+
+func (v *validator) errorf(file, format string, args ...any) {
+	v.issues = append(v.issues, validationIssue{File: file, Message: fmt.Sprintf(format, args...)})
+}
+
+func (v *validator) warnf(file, format string, args ...any) {
+	v.issues = append(v.issues, validationIssue{File: file, Message: fmt.Sprintf(format, args...), Warning: true})
+}
+
+func (v *validator) errorCount() int {
+	count := 0
+	for _, issue := range v.issues {
+		if !issue.Warning {
+			count++
+		}
+	}
+	return count
+}
+
+func (v *validator) print() {
+	for _, issue := range v.issues {
+		level := "ERROR"
+		if issue.Warning {
+			level = "WARN "
+		}
+		fmt.Printf("  %s %s: %s\n", level, issue.File, issue.Message)
+	}
+}
+
+// runValidate checks an installation for mistakes that would prevent the
+// stack from starting.
+func runValidate(args []string) error {
+	flags := flag.NewFlagSet("validate", flag.ExitOnError)
+	dir := flags.String("dir", "", "Installation directory")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if err := enterInstallDir(*dir); err != nil {
+		return err
+	}
+
+	if version, err := ReadComposeImageTag(composeFile, "pangolin"); err == nil {
+		fmt.Printf("Validating configuration for Pangolin %s...\n", version)
+	}
+
+	v := validateInstall()
+
+	if len(v.issues) == 0 {
+		fmt.Println("Configuration is valid.")
+		return nil
+	}
+
+	v.print()
+
+	if errors := v.errorCount(); errors > 0 {
+		return preflightErrorf("found %d error(s) in the configuration", errors)
+	}
+
+	fmt.Println("Configuration is valid, with warnings.")
+	return nil
+}
+
+// validateInstall runs every check against the installation in the current
+// directory.
+func validateInstall() *validator {
+	v := &validator{}
+
+	for _, file := range []string{composeFile, appConfigFile, traefikStaticFile} {
+		if _, err := os.Stat(file); err != nil {
+			v.errorf(file, "file is missing")
+		}
+	}
+
+	compose, composeOK := loadYAMLMap(v, composeFile)
+
+	// Default to the mount used by the generated compose file
+	traefikMounts := []bindMount{{Source: "config/traefik", Target: "/etc/traefik"}}
+	if composeOK {
+		validateComposeMounts(v, compose)
+		if mounts := composeBindMounts(compose, "traefik"); len(mounts) > 0 {
+			traefikMounts = mounts
+		}
+	}
+
+	if app, ok := loadYAMLMap(v, appConfigFile); ok {
+		validateAppConfig(v, app)
+	}
+
+	static, staticOK := loadYAMLMap(v, traefikStaticFile)
+
+	dynamicFile := traefikDynamicFile
+	if staticOK {
+		if filename, ok := lookupString(static, "providers", "file", "filename"); ok {
+			hostPath, mounted := hostPathFor(traefikMounts, filename)
+			if !mounted {
+				v.errorf(traefikStaticFile, "file provider %s is not inside any volume mounted into the traefik container", filename)
+				return v
+			}
+			dynamicFile = hostPath
+		}
+	}
+
+	if dynamic, ok := loadYAMLMap(v, dynamicFile); ok {
+		validateTraefikDynamic(v, dynamicFile, dynamic)
+		if staticOK {
+			validateTraefikReferences(v, static, dynamic, dynamicFile, traefikMounts)
+		}
+	}
+
+	return v
+}
+
+// loadYAMLMap reads and parses a YAML file, recording an issue if the file
+// is missing or malformed.
+func loadYAMLMap(v *validator, file string) (map[string]any, bool) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			v.errorf(file, "cannot read file: %v", err)
+		} else if file != appConfigFile && file != traefikStaticFile {
+			v.errorf(file, "file is missing")
+		}
+		return nil, false
+	}
+
+	var content map[string]any
+	if err := yaml.Unmarshal(data, &content); err != nil {
+		v.errorf(file, "invalid YAML: %v", err)
+		return nil, false
+	}
+	if content == nil {
+		content = map[string]any{}
+	}
+
+	return content, true
+}
+
+func validateAppConfig(v *validator, app map[string]any) {
+	file := appConfigFile
+
+	for key := range app {
+		if !slices.Contains(knownAppConfigSections, key) {
+			v.warnf(file, "unknown section %q", key)
+		}
+	}
+
+	dashboardURL, ok := lookupString(app, "app", "dashboard_url")
+	if !ok || dashboardURL == "" {
+		v.errorf(file, "app.dashboard_url must be defined")
+	} else if u, err := url.Parse(dashboardURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		v.errorf(file, "app.dashboard_url %q is not a valid http(s) URL", dashboardURL)
+	}
+
+	if level, ok := lookupString(app, "app", "log_level"); ok {
+		if !slices.Contains([]string{"debug", "info", "warn", "error"}, level) {
+			v.errorf(file, "app.log_level must be one of debug, info, warn, error (got %q)", level)
+		}
+	}
+
+	domainsManaged := true
+	if disabled, ok := lookup(app, "flags", "disable_config_managed_domains"); ok && disabled == true {
+		domainsManaged = false
+	}
+	domains, _ := lookup(app, "domains")
+	domainMap, _ := domains.(map[string]any)
+	if domainsManaged && len(domainMap) == 0 {
+		v.errorf(file, "at least one domain must be defined under domains")
+	}
+	for name := range domainMap {
+		if base, ok := lookupString(domainMap, name, "base_domain"); !ok || base == "" {
+			v.errorf(file, "domains.%s.base_domain must be defined", name)
+		}
+	}
+
+	if secret, ok := lookupString(app, "server", "secret"); !ok || secret == "" {
+		v.errorf(file, "server.secret must be defined")
+	} else if len(secret) < 8 {
+		v.errorf(file, "server.secret must be at least 8 characters long")
+	}
+
+	for _, key := range [][]string{
+		{"server", "integration_port"},
+		{"server", "external_port"},
+		{"server", "internal_port"},
+		{"server", "next_port"},
+		{"gerbil", "start_port"},
+		{"gerbil", "clients_start_port"},
+		{"email", "smtp_port"},
+	} {
+		value, ok := lookup(app, key...)
+		if !ok {
+			continue
+		}
+		port, isInt := value.(int)
+		if !isInt || port < 1 || port > 65535 {
+			v.errorf(file, "%s must be a port number between 1 and 65535", strings.Join(key, "."))
+		}
+	}
+
+	if noReply, ok := lookupString(app, "email", "no_reply"); ok && noReply != "" {
+		if _, err := mail.ParseAddress(noReply); err != nil {
+			v.errorf(file, "email.no_reply %q is not a valid email address", noReply)
+		}
+	}
+
+	// The ./config directory is mounted at /app/config in the container
+	for _, key := range []string{"maxmind_db_path", "maxmind_asn_path"} {
+		p, ok := lookupString(app, "server", key)
+		if !ok || p == "" {
+			continue
+		}
+		hostPath := strings.TrimPrefix(path.Clean(p), "/app/")
+		if strings.HasPrefix(hostPath, "config/") {
+			if _, err := os.Stat(hostPath); err != nil {
+				v.errorf(file, "server.%s points to %s, which does not exist", key, p)
+			}
+		}
+	}
+}
+
+func validateTraefikDynamic(v *validator, file string, dynamic map[string]any) {
+	for _, protocol := range []string{"http", "tcp", "udp"} {
+		middlewares := mapKeys(dynamic, protocol, "middlewares")
+		services := mapKeys(dynamic, protocol, "services")
+
+		routers, _ := lookup(dynamic, protocol, "routers")
+		routerMap, _ := routers.(map[string]any)
+
+		for _, name := range sortedKeys(routerMap) {
+			router, _ := routerMap[name].(map[string]any)
+			if router == nil {
+				v.errorf(file, "%s router %q is empty", protocol, name)
+				continue
+			}
+
+			if service, ok := router["service"].(string); ok {
+				if !isProviderQualified(service) && !slices.Contains(services, service) {
+					v.errorf(file, "%s router %q references unknown service %q", protocol, name, service)
+				}
+			} else if protocol != "udp" {
+				v.errorf(file, "%s router %q has no service", protocol, name)
+			}
+
+			refs, _ := router["middlewares"].([]any)
+			for _, ref := range refs {
+				middleware, _ := ref.(string)
+				if isProviderQualified(middleware) {
+					continue
+				}
+				if !slices.Contains(middlewares, middleware) {
+					v.errorf(file, "%s router %q references unknown middleware %q", protocol, name, middleware)
+				}
+			}
+		}
+	}
+}
+
+// isProviderQualified reports whether a Traefik reference names an object
+// from another provider (e.g. "badger@http"), which cannot be checked
+// against the file provider.
+func isProviderQualified(name string) bool {
+	return strings.Contains(name, "@")
+}
+
+// lookup walks a nested YAML map by key.
+func lookup(m map[string]any, keys ...string) (any, bool) {
+	var current any = m
+	for _, key := range keys {
+		section, ok := current.(map[string]any)
+		if !ok {
+			return nil, false
+		}
+		current, ok = section[key]
+		if !ok {
+			return nil, false
+		}
+	}
+	return current, true
+}
+
+func lookupString(m map[string]any, keys ...string) (string, bool) {
+	value, ok := lookup(m, keys...)
+	if !ok {
+		return "", false
+	}
+	s, ok := value.(string)
+	return s, ok
+}
+
+// mapKeys returns the sorted keys of the map found at the given path.
+func mapKeys(m map[string]any, keys ...string) []string {
+	value, _ := lookup(m, keys...)
+	section, _ := value.(map[string]any)
+	return sortedKeys(section)
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	return slices.Sorted(maps.Keys(m))
+}
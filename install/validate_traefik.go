@@ -0,0 +1,184 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// bindMount is a host directory or file mounted into a container.
+type bindMount struct {
+	Source string // host path, relative to the installation directory
+	Target string // path inside the container
+}
+
+// composeBindMounts returns the bind mounts of a service in the compose
+// file. Named volumes are skipped.
+func composeBindMounts(compose map[string]any, serviceName string) []bindMount {
+	volumes, _ := lookup(compose, "services", serviceName, "volumes")
+	list, _ := volumes.([]any)
+
+	var mounts []bindMount
+	for _, entry := range list {
+		spec, ok := entry.(string)
+		if !ok {
+			continue
+		}
+		// Strip trailing comments and mount options (":ro", ":z")
+		parts := strings.Split(strings.TrimSpace(spec), ":")
+		if len(parts) < 2 {
+			continue
+		}
+		source, target := parts[0], parts[1]
+		if !strings.HasPrefix(source, ".") && !strings.HasPrefix(source, "/") {
+			continue
+		}
+		mounts = append(mounts, bindMount{Source: filepath.Clean(source), Target: path.Clean(target)})
+	}
+	return mounts
+}
+
+// hostPathFor maps a path inside a container to the host using the most
+// specific bind mount that contains it.
+func hostPathFor(mounts []bindMount, containerPath string) (string, bool) {
+	containerPath = path.Clean(containerPath)
+
+	best := -1
+	for i, m := range mounts {
+		if containerPath != m.Target && !strings.HasPrefix(containerPath, m.Target+"/") {
+			continue
+		}
+		if best == -1 || len(m.Target) > len(mounts[best].Target) {
+			best = i
+		}
+	}
+	if best == -1 {
+		return "", false
+	}
+
+	rest := strings.TrimPrefix(containerPath, mounts[best].Target)
+	return filepath.Join(mounts[best].Source, filepath.FromSlash(rest)), true
+}
+
+// validateComposeMounts warns about bind-mount sources that do not exist.
+// Docker creates missing sources as empty directories, which usually means
+// a config file ended up in the wrong place. Services of disabled profiles
+// are skipped.
+func validateComposeMounts(v *validator, compose map[string]any) {
+	profiles := readComposeProfiles(composeFile)
+	for _, service := range mapKeys(compose, "services") {
+		if definition, ok := lookup(compose, "services", service); ok {
+			if m, ok := definition.(map[string]any); ok && !serviceProfileActive(m, profiles) {
+				continue
+			}
+		}
+		for _, m := range composeBindMounts(compose, service) {
+			if _, err := os.Stat(m.Source); err != nil {
+				v.warnf(composeFile, "service %q mounts %s, which does not exist", service, m.Source)
+			}
+		}
+	}
+}
+
+// validateTraefikReferences checks that everything the Traefik configs refer
+// to by name (entry points, certificate resolvers, plugins) is defined in the
+// static configuration, and that referenced files exist on the host.
+func validateTraefikReferences(v *validator, static, dynamic map[string]any, dynamicFile string, mounts []bindMount) {
+	entryPoints := mapKeys(static, "entryPoints")
+	resolvers := mapKeys(static, "certificatesResolvers")
+	plugins := append(mapKeys(static, "experimental", "plugins"), mapKeys(static, "experimental", "localPlugins")...)
+
+	// Static configuration
+	for _, name := range entryPoints {
+		if resolver, ok := lookupString(static, "entryPoints", name, "http", "tls", "certResolver"); ok && !slices.Contains(resolvers, resolver) {
+			v.errorf(traefikStaticFile, "entry point %q uses unknown certificate resolver %q", name, resolver)
+		}
+		if to, ok := lookupString(static, "entryPoints", name, "http", "redirections", "entryPoint", "to"); ok && !slices.Contains(entryPoints, to) {
+			v.errorf(traefikStaticFile, "entry point %q redirects to unknown entry point %q", name, to)
+		}
+	}
+
+	if ep, ok := lookupString(static, "ping", "entryPoint"); ok && !slices.Contains(entryPoints, ep) && ep != "traefik" {
+		v.errorf(traefikStaticFile, "ping uses unknown entry point %q", ep)
+	}
+
+	for _, name := range mapKeys(static, "experimental", "plugins") {
+		if module, _ := lookupString(static, "experimental", "plugins", name, "moduleName"); module == "" {
+			v.errorf(traefikStaticFile, "plugin %q has no moduleName", name)
+		}
+		if version, _ := lookupString(static, "experimental", "plugins", name, "version"); version == "" {
+			v.errorf(traefikStaticFile, "plugin %q has no version", name)
+		}
+	}
+
+	for _, name := range resolvers {
+		if storage, ok := lookupString(static, "certificatesResolvers", name, "acme", "storage"); ok {
+			checkTraefikPath(v, traefikStaticFile, mounts, fmt.Sprintf("certificate resolver %q storage", name), path.Dir(storage))
+		}
+	}
+
+	if dir, ok := lookupString(static, "providers", "file", "directory"); ok {
+		checkTraefikPath(v, traefikStaticFile, mounts, "file provider directory", dir)
+	}
+	for _, key := range []string{"log", "accessLog"} {
+		if file, ok := lookupString(static, key, "filePath"); ok {
+			checkTraefikPath(v, traefikStaticFile, mounts, key+" directory", path.Dir(file))
+		}
+	}
+
+	// Dynamic configuration
+	for _, protocol := range []string{"http", "tcp", "udp"} {
+		routers, _ := lookup(dynamic, protocol, "routers")
+		routerMap, _ := routers.(map[string]any)
+
+		for _, name := range sortedKeys(routerMap) {
+			router, _ := routerMap[name].(map[string]any)
+
+			refs, _ := router["entryPoints"].([]any)
+			for _, ref := range refs {
+				if ep, _ := ref.(string); !slices.Contains(entryPoints, ep) {
+					v.errorf(dynamicFile, "%s router %q uses unknown entry point %q", protocol, name, ep)
+				}
+			}
+
+			if resolver, ok := lookupString(router, "tls", "certResolver"); ok && !slices.Contains(resolvers, resolver) {
+				v.errorf(dynamicFile, "%s router %q uses unknown certificate resolver %q", protocol, name, resolver)
+			}
+		}
+	}
+
+	for _, name := range mapKeys(dynamic, "http", "middlewares") {
+		for _, plugin := range mapKeys(dynamic, "http", "middlewares", name, "plugin") {
+			if !slices.Contains(plugins, plugin) {
+				v.errorf(dynamicFile, "middleware %q uses plugin %q, which is not declared under experimental.plugins in %s", name, plugin, traefikStaticFile)
+			}
+		}
+	}
+
+	certs, _ := lookup(dynamic, "tls", "certificates")
+	certList, _ := certs.([]any)
+	for _, entry := range certList {
+		cert, _ := entry.(map[string]any)
+		for _, key := range []string{"certFile", "keyFile"} {
+			if file, ok := lookupString(cert, key); ok {
+				checkTraefikPath(v, dynamicFile, mounts, "tls certificate "+key, file)
+			}
+		}
+	}
+}
+
+// checkTraefikPath reports a path inside the Traefik container that is
+// backed by a bind mount but missing on the host.
+func checkTraefikPath(v *validator, file string, mounts []bindMount, what, containerPath string) {
+	hostPath, ok := hostPathFor(mounts, containerPath)
+	if !ok {
+		v.warnf(file, "%s %s is not inside any volume mounted into the traefik container", what, containerPath)
+		return
+	}
+	if _, err := os.Stat(hostPath); err != nil {
+		v.errorf(file, "%s %s does not exist on the host (expected at %s)", what, containerPath, hostPath)
+	}
+}
@@ -0,0 +1,295 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	newtImage   = "docker.io/fosrl/newt:latest"
+	whoamiImage = "docker.io/traefik/whoami:latest"
+)
+
+// runVerifyTunnel proves the full proxy path works end to end: it creates a
+// temporary site and resource through the integration API, connects a
+// disposable Newt client serving a test backend, requests the resource
+// through its public domain and tears everything down again.
+func runVerifyTunnel(args []string) error {
+	flags := flag.NewFlagSet("verify-tunnel", flag.ExitOnError)
+	dir := flags.String("dir", "", "Installation directory")
+	org := flags.String("org", "", "ID of the organization to create the temporary site and resource in")
+	apiKey := flags.String("api-key", os.Getenv("PANGOLIN_API_KEY"), "Integration API key with access to the organization (default $PANGOLIN_API_KEY)")
+	apiURL := flags.String("api-url", "", "Integration API base URL, e.g. https://api.example.com/v1 (default: call it inside the pangolin container)")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if *org == "" || *apiKey == "" {
+		return fmt.Errorf("--org and --api-key are required")
+	}
+
+	if err := enterInstallDir(*dir); err != nil {
+		return err
+	}
+
+	api, dashboardURL, err := installAPIClient(*apiURL, *apiKey)
+	if err != nil {
+		return err
+	}
+
+	t := &tunnelCheck{
+		api:           api,
+		containerType: api.containerType,
+		orgID:         *org,
+		suffix:        randomSuffix(),
+		endpoint:      dashboardURL,
+	}
+
+	fmt.Println("\n=== Tunnel Verification ===")
+	release := onInterrupt(t.teardown)
+	defer release()
+	defer t.teardown()
+
+	return t.run()
+}
+
+// tunnelCheck holds the temporary objects created by verify-tunnel so they
+// can be removed no matter where the check stops.
+type tunnelCheck struct {
+	api           *apiClient
+	containerType SupportedContainer
+	orgID         string
+	suffix        string
+	endpoint      string
+
+	siteID     int
+	resourceID int
+	network    string
+	containers []string
+	torndown   bool
+}
+
+func (t *tunnelCheck) run() error {
+	var defaults struct {
+		ExitNodeID    int    `json:"exitNodeId"`
+		Subnet        string `json:"subnet"`
+		NewtID        string `json:"newtId"`
+		NewtSecret    string `json:"newtSecret"`
+		ClientAddress string `json:"clientAddress"`
+	}
+	if err := t.api.do("GET", "/org/"+t.orgID+"/pick-site-defaults", nil, &defaults); err != nil {
+		return fmt.Errorf("failed to get site defaults: %v", err)
+	}
+
+	var site struct {
+		SiteID int `json:"siteId"`
+	}
+	err := t.api.do("PUT", "/org/"+t.orgID+"/site", map[string]any{
+		"name":       "verify-tunnel-" + t.suffix,
+		"type":       "newt",
+		"exitNodeId": defaults.ExitNodeID,
+		"subnet":     defaults.Subnet,
+		"newtId":     defaults.NewtID,
+		"secret":     defaults.NewtSecret,
+		"address":    defaults.ClientAddress,
+	}, &site)
+	if err != nil {
+		return fmt.Errorf("failed to create temporary site: %v", err)
+	}
+	t.siteID = site.SiteID
+	fmt.Printf("Created temporary site %d\n", t.siteID)
+
+	var domains struct {
+		Domains []struct {
+			DomainID   string `json:"domainId"`
+			BaseDomain string `json:"baseDomain"`
+			Verified   bool   `json:"verified"`
+		} `json:"domains"`
+	}
+	if err := t.api.do("GET", "/org/"+t.orgID+"/domains", nil, &domains); err != nil {
+		return fmt.Errorf("failed to list domains: %v", err)
+	}
+	domainID, baseDomain := "", ""
+	for _, d := range domains.Domains {
+		if d.Verified {
+			domainID, baseDomain = d.DomainID, d.BaseDomain
+			break
+		}
+	}
+	if domainID == "" {
+		return fmt.Errorf("organization %s has no verified domain", t.orgID)
+	}
+
+	subdomain := "verify-tunnel-" + t.suffix
+	var resource struct {
+		ResourceID int `json:"resourceId"`
+	}
+	err = t.api.do("PUT", "/org/"+t.orgID+"/resource", map[string]any{
+		"name":      subdomain,
+		"subdomain": subdomain,
+		"http":      true,
+		"protocol":  "tcp",
+		"domainId":  domainID,
+	}, &resource)
+	if err != nil {
+		return fmt.Errorf("failed to create temporary resource: %v", err)
+	}
+	t.resourceID = resource.ResourceID
+	fmt.Printf("Created temporary resource %s.%s\n", subdomain, baseDomain)
+
+	// The test request must not be redirected to the login page
+	if err := t.api.do("POST", fmt.Sprintf("/resource/%d", t.resourceID), map[string]any{"sso": false}, nil); err != nil {
+		return fmt.Errorf("failed to disable authentication on the temporary resource: %v", err)
+	}
+
+	backend, err := t.startClient(defaults.NewtID, defaults.NewtSecret)
+	if err != nil {
+		return err
+	}
+
+	err = t.api.do("PUT", fmt.Sprintf("/resource/%d/target", t.resourceID), map[string]any{
+		"siteId": t.siteID,
+		"ip":     backend,
+		"port":   80,
+		"method": "http",
+	}, nil)
+	if err != nil {
+		return fmt.Errorf("failed to add the target: %v", err)
+	}
+
+	return t.request("https://" + subdomain + "." + baseDomain + "/")
+}
+
+// startClient starts a test backend and a Newt client on a private network
+// and returns the backend's host name as seen by Newt.
+func (t *tunnelCheck) startClient(newtID, newtSecret string) (string, error) {
+	runtime := string(t.containerType)
+	t.network = "pangolin-verify-" + t.suffix
+	if out, err := exec.Command(runtime, "network", "create", t.network).CombinedOutput(); err != nil {
+		t.network = ""
+		return "", fmt.Errorf("failed to create network: %v: %s", err, strings.TrimSpace(string(out)))
+	}
+
+	backend := "pangolin-verify-backend-" + t.suffix
+	if out, err := exec.Command(runtime, "run", "-d", "--name", backend, "--network", t.network, whoamiImage).CombinedOutput(); err != nil {
+		return "", fmt.Errorf("failed to start the test backend: %v: %s", err, strings.TrimSpace(string(out)))
+	}
+	t.containers = append(t.containers, backend)
+
+	// Pass the credentials through the environment so they do not show up
+	// in the process list
+	client := "pangolin-verify-newt-" + t.suffix
+	cmd := exec.Command(runtime, "run", "-d", "--name", client, "--network", t.network,
+		"-e", "PANGOLIN_ENDPOINT", "-e", "NEWT_ID", "-e", "NEWT_SECRET", newtImage)
+	cmd.Env = append(os.Environ(), "PANGOLIN_ENDPOINT="+t.endpoint, "NEWT_ID="+newtID, "NEWT_SECRET="+newtSecret)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return "", fmt.Errorf("failed to start Newt: %v: %s", err, strings.TrimSpace(string(out)))
+	}
+	t.containers = append(t.containers, client)
+	fmt.Println("Started a disposable Newt client and test backend")
+
+	return backend, nil
+}
+
+// request polls the public URL until the test backend answers through the
+// tunnel. Certificates for the new subdomain may still be in issuance, so
+// the first requests skip verification and the certificate is checked
+// separately afterwards.
+func (t *tunnelCheck) request(publicURL string) error {
+	fmt.Printf("Requesting %s through the tunnel...\n", publicURL)
+
+	insecure := &http.Client{
+		Timeout:   10 * time.Second,
+		Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}},
+	}
+
+	var lastErr error
+	ok := waitUntil(waitTimeout, func() bool {
+		resp, err := insecure.Get(publicURL)
+		if err != nil {
+			lastErr = err
+			return false
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		if resp.StatusCode != http.StatusOK || !strings.Contains(string(body), "Hostname: ") {
+			lastErr = fmt.Errorf("got status %s", resp.Status)
+			return false
+		}
+		return true
+	})
+	if !ok {
+		fmt.Printf("Newt logs:\n%s\n", containerLogTail(t.containerType, t.containers[len(t.containers)-1], 20))
+		return fmt.Errorf("the tunnel did not serve %s within %v: %v", publicURL, waitTimeout, lastErr)
+	}
+	fmt.Println("The request was served by the test backend through Gerbil and Newt.")
+
+	if resp, err := http.Get(publicURL); err != nil {
+		fmt.Printf("Warning: the certificate for the test domain could not be verified yet: %v\n", err)
+	} else {
+		resp.Body.Close()
+		fmt.Println("The certificate for the test domain is valid.")
+	}
+
+	fmt.Println("Tunnel verification passed.")
+	return nil
+}
+
+// teardown removes everything the check created. It is safe to call more
+// than once.
+func (t *tunnelCheck) teardown() {
+	if t.torndown {
+		return
+	}
+	t.torndown = true
+
+	runtime := string(t.containerType)
+	for _, container := range t.containers {
+		_ = exec.Command(runtime, "rm", "-f", container).Run()
+	}
+	if t.network != "" {
+		_ = exec.Command(runtime, "network", "rm", t.network).Run()
+	}
+	if t.resourceID != 0 {
+		if err := t.api.do("DELETE", fmt.Sprintf("/resource/%d", t.resourceID), nil, nil); err != nil {
+			fmt.Printf("Warning: could not delete temporary resource %d: %v\n", t.resourceID, err)
+		}
+	}
+	if t.siteID != 0 {
+		if err := t.api.do("DELETE", fmt.Sprintf("/site/%d", t.siteID), nil, nil); err != nil {
+			fmt.Printf("Warning: could not delete temporary site %d: %v\n", t.siteID, err)
+		}
+	}
+	fmt.Println("Removed the temporary site, resource and containers.")
+}
+
+// readAppConfigMap reads config/config.yml as a generic map.
+func readAppConfigMap() (map[string]any, error) {
+	data, err := os.ReadFile(appConfigFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %v", appConfigFile, err)
+	}
+	var content map[string]any
+	if err := yaml.Unmarshal(data, &content); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %v", appConfigFile, err)
+	}
+	return content, nil
+}
+
+// randomSuffix returns a short random identifier for temporary objects.
+func randomSuffix() string {
+	b := make([]byte, 4)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/debug"
+
+	"github.com/fosrl/pangolin/install/pkg/installer"
+)
+
+// buildInfo returns the installer version, commit and build date, falling
+// back to the VCS information Go embeds when they were not set via -ldflags.
+func buildInfo() (version, commit, date string) {
+	version, commit, date = installerVersion, buildCommit, buildDate
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range info.Settings {
+			switch setting.Key {
+			case "vcs.revision":
+				if commit == "" && len(setting.Value) >= 7 {
+					commit = setting.Value[:7]
+				}
+			case "vcs.time":
+				if date == "" {
+					date = setting.Value
+				}
+			}
+		}
+	}
+	return orUnknown(version, "dev"), orUnknown(commit, "unknown"), orUnknown(date, "unknown")
+}
+
+func orUnknown(value, fallback string) string {
+	if value == "" {
+		return fallback
+	}
+	return value
+}
+
+// printVersion prints the build metadata and the component versions this
+// installer deploys, for support requests.
+func printVersion() {
+	version, commit, date := buildInfo()
+	fmt.Printf("Pangolin installer %s (commit %s, built %s, %s %s/%s)\n", version, commit, date, runtime.Version(), runtime.GOOS, runtime.GOARCH)
+	fmt.Println("Target versions:")
+	fmt.Printf("  Pangolin: %s\n", orUnknown(pangolinVersion, "not set"))
+	fmt.Printf("  Gerbil:   %s\n", orUnknown(gerbilVersion, "not set"))
+	fmt.Printf("  Badger:   %s\n", orUnknown(badgerVersion, "not set"))
+	fmt.Printf("  Traefik:  %s\n", traefikVersion)
+	fmt.Printf("  CrowdSec bouncer plugin: %s\n", crowdsecBouncerVersion)
+	fmt.Printf("  geoblock plugin:         %s\n", installer.GeoblockPluginVersion)
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/fosrl/pangolin/install/pkg/installer"
+)
+
+const watchdogServiceName = "pangolin-watchdog.service"
+
+func init() {
+	registerStep(installStep{
+		Name:  "watchdog",
+		Order: 84,
+		When: func(state *installState) bool {
+			return containersStarting(state) && runtime.GOOS == "linux" && !devMode && nativeEngine(state)
+		},
+		Run: func(state *installState) error {
+			if readBool(msg("promptWatchdog"), false) {
+				if err := installWatchdog(state.InstallDir, state.Config); err != nil {
+					fmt.Printf("Error setting up the watchdog: %v\n", err)
+				}
+			}
+			return nil
+		},
+	})
+}
+
+// watchdog restarts the stack when it stays unhealthy. Restarts back off
+// exponentially, so a stack that cannot recover is not restarted in a
+// tight loop; the backoff resets once it is healthy again.
+type watchdog struct {
+	containerType SupportedContainer
+	failures      int
+	notifyURL     string
+
+	unhealthy  int
+	backoff    time.Duration
+	maxBackoff time.Duration
+	nextRetry  time.Time
+}
+
+// runWatchdog checks the stack every interval until it is stopped. It is
+// meant to run as a systemd service next to the stack.
+func runWatchdog(args []string) error {
+	flags := flag.NewFlagSet("watchdog", flag.ExitOnError)
+	dir := flags.String("dir", "", "Installation directory")
+	runtimeFlag := flags.String("runtime", "", "Container runtime of the stack: docker or podman (default: detect)")
+	interval := flags.Duration("interval", time.Minute, "Time between health checks")
+	failures := flags.Int("failures", 3, "Consecutive failed checks before the stack is restarted")
+	maxBackoff := flags.Duration("max-backoff", time.Hour, "Longest wait between two restarts")
+	notifyURL := flags.String("notify-url", "", "URL to POST a message to on every restart and on recovery")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *failures < 1 || *interval <= 0 {
+		return usageErrorf("--failures and --interval must be positive")
+	}
+	if *notifyURL != "" && !installer.ValidNotifyURL(*notifyURL) {
+		return usageErrorf("invalid --notify-url %q", *notifyURL)
+	}
+
+	if err := enterInstallDir(*dir); err != nil {
+		return err
+	}
+	containerType := SupportedContainer(*runtimeFlag)
+	if containerType == "" {
+		containerType = detectContainerType()
+	}
+	if containerType != Docker && containerType != Podman {
+		return preflightErrorf("could not detect the container runtime of the installation; pass --runtime")
+	}
+
+	w := &watchdog{
+		containerType: containerType,
+		failures:      *failures,
+		notifyURL:     *notifyURL,
+		maxBackoff:    *maxBackoff,
+	}
+	fmt.Printf("Checking the stack every %v.\n", *interval)
+	for {
+		w.check(time.Now())
+		time.Sleep(*interval)
+	}
+}
+
+// check runs one health check and restarts the stack when it failed often
+// enough and the backoff allows it.
+func (w *watchdog) check(now time.Time) {
+	problem := stackProblem(w.containerType)
+	if problem == "" {
+		if w.unhealthy >= w.failures {
+			fmt.Println("The stack is healthy again.")
+			w.notify("Pangolin on %s is healthy again", hostname())
+		}
+		w.unhealthy, w.backoff, w.nextRetry = 0, 0, time.Time{}
+		return
+	}
+
+	w.unhealthy++
+	fmt.Printf("Health check %d failed: %s\n", w.unhealthy, problem)
+	if w.unhealthy < w.failures || now.Before(w.nextRetry) {
+		return
+	}
+
+	w.backoff = min(max(2*w.backoff, time.Minute), w.maxBackoff)
+	w.nextRetry = now.Add(w.backoff)
+	fmt.Printf("Restarting the stack; the next restart is %v away at the earliest.\n", w.backoff)
+	if err := composeCommand(w.containerType, "restart"); err != nil {
+		fmt.Printf("Restart failed: %v\n", err)
+		w.notify("Pangolin on %s is unhealthy (%s) and could not be restarted: %v", hostname(), problem, err)
+		return
+	}
+	w.notify("Pangolin on %s was unhealthy (%s) and has been restarted", hostname(), problem)
+}
+
+// stackProblem describes the first problem found with the stack, or returns
+// an empty string if every container is ready and the Pangolin API answers.
+func stackProblem(containerType SupportedContainer) string {
+	services, err := composeServices(composeFile)
+	if err != nil {
+		return err.Error()
+	}
+	for _, service := range services {
+		state, err := inspectContainer(containerType, service.Container)
+		switch {
+		case err != nil:
+			return fmt.Sprintf("service %s has no container", service.Name)
+		case state.failure() != "":
+			return fmt.Sprintf("service %s %s", service.Name, state.failure())
+		case !state.ready():
+			return fmt.Sprintf("service %s is %s", service.Name, describeState(state))
+		}
+	}
+	if err := probePangolinAPI(containerType); err != nil {
+		return err.Error()
+	}
+	return ""
+}
+
+// notify posts a message to the notification URL, if there is one.
+func (w *watchdog) notify(format string, args ...any) {
+	if w.notifyURL == "" {
+		return
+	}
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Post(w.notifyURL, "text/plain", strings.NewReader(fmt.Sprintf(format, args...)))
+	if err != nil {
+		fmt.Printf("Failed to send the notification: %v\n", err)
+		return
+	}
+	resp.Body.Close()
+}
+
+func hostname() string {
+	name, err := os.Hostname()
+	if err != nil {
+		return "unknown host"
+	}
+	return name
+}
+
+// renderWatchdogUnit returns the service that runs the watchdog of the stack
+// in installDir.
+func renderWatchdogUnit(installDir string, config Config, binary string) string {
+	command := fmt.Sprintf("%s watchdog --dir %s --runtime %s", binary, installDir, config.InstallationContainerType)
+	if config.AlertWebhookURL != "" {
+		command += " --notify-url " + config.AlertWebhookURL
+	}
+	after := "network-online.target"
+	wantedBy := "default.target"
+	if !config.Rootless {
+		after += " docker.service"
+		wantedBy = "multi-user.target"
+	}
+
+	return fmt.Sprintf(`# Generated by the Pangolin installer.
+[Unit]
+Description=Restart the Pangolin stack when it is unhealthy
+Wants=network-online.target
+After=%s
+
+[Service]
+Environment=%s=1
+ExecStart=%s
+Restart=always
+RestartSec=30
+
+[Install]
+WantedBy=%s
+`, after, skipUpdateCheckEnv, command, wantedBy)
+}
+
+// installWatchdog keeps a copy of the installer in installDir, which the
+// service runs, and starts the service.
+func installWatchdog(installDir string, config Config) error {
+	binary := filepath.Join(installDir, "installer")
+	self, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	if self, err = filepath.EvalSymlinks(self); err != nil {
+		return err
+	}
+	if self != binary {
+		if err := copyFile(self, binary); err != nil {
+			return fmt.Errorf("failed to copy the installer to %s: %v", binary, err)
+		}
+		if err := os.Chmod(binary, 0755); err != nil {
+			return err
+		}
+	}
+
+	userUnit := config.Rootless
+	if err := writeSystemdUnits(userUnit, map[string]string{
+		watchdogServiceName: renderWatchdogUnit(installDir, config, binary),
+	}); err != nil {
+		return err
+	}
+	if err := systemctl(userUnit, "enable", "--now", watchdogServiceName); err != nil {
+		return fmt.Errorf("failed to enable %s: %v", watchdogServiceName, err)
+	}
+	fmt.Println(msg("watchdogInstalled", watchdogServiceName))
+	return nil
+}
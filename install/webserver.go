@@ -0,0 +1,255 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/fosrl/pangolin/install/pkg/installer"
+)
+
+// Ways to install next to a web server that holds ports 80/443.
+const (
+	webServerStop  = "stop"
+	webServerPorts = "ports"
+	webServerProxy = "proxy"
+	webServerAbort = "abort"
+)
+
+// coexistingWebServer is the web server Pangolin is installed next to, with
+// webServerMode saying how: on alternate ports, or behind it.
+var (
+	coexistingWebServer *installer.WebServer
+	webServerMode       string
+)
+
+func init() {
+	registerStep(installStep{
+		Name:  "web server proxy configuration",
+		Order: 90,
+		When: func(state *installState) bool {
+			return freshInstall(state) && coexistingWebServer != nil
+		},
+		Run: func(state *installState) error {
+			if webServerMode == webServerProxy {
+				return writeWebServerProxyConfig(state)
+			}
+			fmt.Println("\n" + msg("webServerPortsNote", state.Config.HTTPPort, state.Config.HTTPSPort, coexistingWebServer.Name))
+			return nil
+		},
+	})
+}
+
+// resolveWebServerConflict checks that ports 80 and 443 are free. If nginx
+// or Apache holds them, the user can stop it, run Pangolin on other ports or
+// run Pangolin behind it; anything else holding them ends the install.
+func resolveWebServerConflict() {
+	var busy []int
+	var busyErr error
+	for _, p := range []int{80, 443} {
+		if err := installer.CheckPortAvailable(p); err != nil {
+			busy, busyErr = append(busy, p), err
+		}
+	}
+	if len(busy) == 0 {
+		return
+	}
+
+	server := installer.DetectWebServer(busy)
+	if server == nil {
+		fmt.Fprintln(os.Stderr, busyErr)
+		fmt.Printf("Please close any services on ports 80/443 in order to run the installation smoothly. If you already have the Pangolin stack running, shut them down before proceeding.\n")
+		os.Exit(exitPreflight)
+	}
+
+	fmt.Println("\n=== " + msg("sectionWebServer") + " ===")
+	fmt.Println(msg("webServerDetected", server.Name, joinPorts(busy)))
+	fmt.Println("stop:  " + msg("webServerStopDescription", server.Unit))
+	fmt.Println("ports: " + msg("webServerPortsDescription"))
+	fmt.Println("proxy: " + msg("webServerProxyDescription", server.Name))
+	fmt.Println("abort: " + msg("webServerAbortDescription"))
+
+	for {
+		choice := strings.ToLower(readString(msg("promptWebServerChoice"), webServerProxy))
+		switch choice {
+		case webServerStop:
+			if err := systemctl(false, "disable", "--now", server.Unit); err != nil {
+				fmt.Printf("Error stopping %s: %v\n", server.Unit, err)
+				continue
+			}
+			for _, p := range busy {
+				if err := installer.CheckPortAvailable(p); err != nil {
+					fmt.Fprintln(os.Stderr, err)
+					os.Exit(1)
+				}
+			}
+			fmt.Println(msg("webServerStopped", server.Unit))
+			return
+		case webServerPorts, webServerProxy:
+			coexistingWebServer, webServerMode = server, choice
+			return
+		case webServerAbort:
+			fmt.Println(msg("webServerAborted"))
+			os.Exit(exitAborted)
+		default:
+			fmt.Println(msg("webServerChoiceUnknown", choice))
+		}
+	}
+}
+
+func joinPorts(ports []int) string {
+	var s []string
+	for _, p := range ports {
+		s = append(s, fmt.Sprint(p))
+	}
+	return strings.Join(s, "/")
+}
+
+// writeWebServerProxyConfig writes the configuration that lets the existing
+// web server forward Pangolin's domains to it, and explains how to enable it.
+func writeWebServerProxyConfig(state *installState) error {
+	config := state.Config
+	fmt.Println("\n=== " + msg("sectionWebServer") + " ===")
+
+	files := map[string]string{}
+	if coexistingWebServer.Process == "nginx" {
+		files["nginx-pangolin-http.conf"] = nginxHTTPConfig(config)
+		files["nginx-pangolin-stream.conf"] = nginxStreamConfig(config)
+	} else {
+		files["apache-pangolin.conf"] = apacheConfig(config)
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(files)) {
+		path := filepath.Join(state.InstallDir, name)
+		if err := os.WriteFile(path, []byte(files[name]), 0644); err != nil {
+			return fmt.Errorf("error writing %s: %v", path, err)
+		}
+		fmt.Println(msg("webServerConfigWritten", path))
+	}
+
+	if coexistingWebServer.Process == "nginx" {
+		fmt.Println(msg("webServerNginxInstructions", state.InstallDir))
+	} else {
+		fmt.Println(msg("webServerApacheInstructions", state.InstallDir))
+	}
+	return nil
+}
+
+// proxiedServerNames returns the host names that belong to Pangolin: the
+// dashboard, the base domain and its subdomains used by resources. The
+// dashboard may be the base domain itself.
+func proxiedServerNames(config Config) []string {
+	names := []string{config.DashboardDomain}
+	if config.BaseDomain == "" {
+		return names
+	}
+	if !config.DashboardOnApex() {
+		names = append(names, config.BaseDomain)
+	}
+	return append(names, "*."+config.BaseDomain)
+}
+
+// nginxHTTPConfig forwards plain HTTP for Pangolin's domains, including the
+// ACME HTTP-01 challenges Traefik answers.
+func nginxHTTPConfig(config Config) string {
+	return fmt.Sprintf(`# Generated by the Pangolin installer.
+# Copy to /etc/nginx/conf.d/ and reload nginx.
+server {
+    listen 80;
+    listen [::]:80;
+    server_name %s;
+
+    location / {
+        proxy_pass http://127.0.0.1:%d;
+        proxy_set_header Host $host;
+        proxy_set_header X-Forwarded-For $proxy_add_x_forwarded_for;
+        proxy_set_header X-Forwarded-Proto $scheme;
+    }
+}
+`, strings.Join(proxiedServerNames(config), " "), config.HTTPPort)
+}
+
+// nginxStreamConfig passes TLS for Pangolin's domains through untouched, so
+// Traefik keeps terminating it with its own certificates, and sends
+// everything else to the server blocks that used to listen on 443.
+func nginxStreamConfig(config Config) string {
+	return fmt.Sprintf(`# Generated by the Pangolin installer.
+# Include at the top level of /etc/nginx/nginx.conf, outside the http block:
+#
+#   stream {
+#       include /etc/nginx/nginx-pangolin-stream.conf;
+#   }
+#
+# This takes over port 443, so change the existing "listen 443 ssl" server
+# blocks to "listen 127.0.0.1:4443 ssl".
+map $ssl_preread_server_name $pangolin_upstream {
+    hostnames;
+%s    default 127.0.0.1:4443;
+}
+
+server {
+    listen 443;
+    listen [::]:443;
+    ssl_preread on;
+    proxy_pass $pangolin_upstream;
+}
+`, nginxMapEntries(config))
+}
+
+func nginxMapEntries(config Config) string {
+	// With hostnames, ".example.com" matches the domain and its subdomains,
+	// which the dashboard is one of; nginx rejects it listed twice
+	names := []string{config.DashboardDomain}
+	if config.BaseDomain != "" {
+		names = []string{"." + config.BaseDomain}
+		if !installer.DashboardUnderBase(config.DashboardDomain, config.BaseDomain) {
+			names = append(names, config.DashboardDomain)
+		}
+	}
+	var b strings.Builder
+	for _, name := range names {
+		fmt.Fprintf(&b, "    %s 127.0.0.1:%d;\n", name, config.HTTPSPort)
+	}
+	return b.String()
+}
+
+// apacheConfig proxies Pangolin's domains. Apache cannot pass TLS through,
+// so it terminates TLS itself and needs a certificate for these names.
+func apacheConfig(config Config) string {
+	names := proxiedServerNames(config)
+	aliases := ""
+	if len(names) > 1 {
+		aliases = "\n    ServerAlias " + strings.Join(names[1:], " ")
+	}
+	return fmt.Sprintf(`# Generated by the Pangolin installer.
+# Needs mod_proxy, mod_proxy_http, mod_proxy_wstunnel and mod_ssl
+# (a2enmod proxy proxy_http proxy_wstunnel ssl), then copy to
+# /etc/apache2/sites-available/ and enable it with a2ensite, or to
+# /etc/httpd/conf.d/.
+<VirtualHost *:80>
+    ServerName %[1]s%[2]s
+    ProxyPreserveHost On
+    ProxyPass / http://127.0.0.1:%[3]d/
+    ProxyPassReverse / http://127.0.0.1:%[3]d/
+</VirtualHost>
+
+<VirtualHost *:443>
+    ServerName %[1]s%[2]s
+    SSLEngine on
+    # A certificate covering the names above
+    SSLCertificateFile /etc/ssl/certs/pangolin.pem
+    SSLCertificateKeyFile /etc/ssl/private/pangolin.key
+
+    SSLProxyEngine on
+    SSLProxyVerify none
+    SSLProxyCheckPeerName off
+    ProxyPreserveHost On
+    RequestHeader set X-Forwarded-Proto "https"
+    ProxyPass / https://127.0.0.1:%[4]d/ upgrade=websocket
+    ProxyPassReverse / https://127.0.0.1:%[4]d/
+</VirtualHost>
+`, names[0], aliases, config.HTTPPort, config.HTTPSPort)
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/fosrl/pangolin/install/pkg/installer"
+)
+
+func init() {
+	registerStep(installStep{
+		Name:  "WireGuard port notice",
+		Order: 95,
+		When: func(state *installState) bool {
+			return freshInstall(state) && state.Config.InstallGerbil &&
+				(state.Config.WireGuardPort != installer.DefaultWireGuardPort || state.Config.ClientsWireGuardPort != installer.DefaultClientsWireGuardPort)
+		},
+		Run: func(state *installState) error {
+			fmt.Println("\n" + msg("wireGuardPortsChanged", state.Config.WireGuardPort, state.Config.ClientsWireGuardPort))
+			return nil
+		},
+	})
+}
+
+// collectWireGuardPorts checks that Gerbil's WireGuard ports are free and
+// offers other ports when they are not. A WireGuard interface or VPN already
+// on 51820 otherwise leaves a stack whose tunnels never connect, without any
+// error on startup.
+func collectWireGuardPorts(config *Config) {
+	config.WireGuardPort = resolveWireGuardPort(config.WireGuardPort, 0)
+	config.ClientsWireGuardPort = resolveWireGuardPort(config.ClientsWireGuardPort, config.WireGuardPort)
+}
+
+// resolveWireGuardPort returns port if it is free, or the port the user
+// picks instead. taken is a port already assigned to Gerbil.
+func resolveWireGuardPort(port, taken int) int {
+	user := udpPortUser(port)
+	if user == "" && port != taken {
+		return port
+	}
+
+	fmt.Println("\n=== " + msg("sectionWireGuardPorts") + " ===")
+	if user == "" {
+		user = "Gerbil"
+	}
+	fmt.Println(msg("wireGuardPortInUse", port, user))
+	if !readBool(msg("promptRemapWireGuardPort"), true) {
+		fmt.Println(msg("wireGuardPortKept", port))
+		return port
+	}
+
+	for {
+		suggested := port + 1
+		for udpPortUser(suggested) != "" || suggested == taken {
+			suggested++
+		}
+		chosen := readPort(msg("promptWireGuardPort"), suggested)
+		switch {
+		case chosen == taken:
+			fmt.Println(msg("wireGuardPortInUse", chosen, "Gerbil"))
+		case udpPortUser(chosen) != "":
+			fmt.Println(msg("wireGuardPortInUse", chosen, udpPortUser(chosen)))
+		default:
+			return chosen
+		}
+	}
+}
+
+// udpPortUser describes what holds a UDP port: a WireGuard interface if one
+// listens on it, or "another service". It returns an empty string if the
+// port is free.
+func udpPortUser(port int) string {
+	if installer.UDPPortFree(port) {
+		return ""
+	}
+	if iface := installer.WireGuardInterfaceOn(port); iface != "" {
+		return msg("wireGuardInterface", iface)
+	}
+	return msg("anotherService")
+}
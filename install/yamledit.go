@@ -0,0 +1,255 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// yamlFile is a YAML file that is edited as a map but written back through
+// its node tree: only the keys that changed are touched, so comments, key
+// order, quoting, anchors and the indentation of the file survive. Blank
+// lines, which the YAML parser drops, are put back where they were.
+type yamlFile struct {
+	path string
+	data []byte
+	node yaml.Node
+	// Doc is the content of the file; edit it and call save
+	Doc map[string]any
+}
+
+// readYAMLFile parses a YAML file for editing.
+func readYAMLFile(path string) (*yamlFile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s: %w", path, err)
+	}
+	f := &yamlFile{path: path, data: data}
+	if err := yaml.Unmarshal(data, &f.node); err != nil {
+		return nil, fmt.Errorf("error parsing %s: %w", path, err)
+	}
+	if err := f.node.Decode(&f.Doc); err != nil {
+		return nil, fmt.Errorf("error parsing %s: %w", path, err)
+	}
+	if f.Doc == nil {
+		f.Doc = map[string]any{}
+	}
+	return f, nil
+}
+
+// editYAMLFile runs edit on the content of a YAML file and saves the file
+// if edit reports a change. It returns whether the file was written.
+func editYAMLFile(path string, edit func(doc map[string]any) bool) (bool, error) {
+	f, err := readYAMLFile(path)
+	if err != nil {
+		return false, err
+	}
+	if !edit(f.Doc) {
+		return false, nil
+	}
+	return f.save()
+}
+
+// save writes the changes made to Doc into the file, keeping its mode. It
+// reports whether there were any.
+func (f *yamlFile) save() (bool, error) {
+	if f.node.Kind == 0 {
+		f.node = yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{{Kind: yaml.MappingNode, Tag: "!!map"}}}
+	}
+	var original map[string]any
+	if err := f.node.Decode(&original); err == nil && reflect.DeepEqual(original, f.Doc) {
+		return false, nil
+	}
+	if err := syncYAMLNode(&f.node, f.Doc); err != nil {
+		return false, fmt.Errorf("error updating %s: %w", f.path, err)
+	}
+
+	var buffer bytes.Buffer
+	encoder := yaml.NewEncoder(&buffer)
+	encoder.SetIndent(yamlIndent(f.data))
+	if err := encoder.Encode(&f.node); err != nil {
+		return false, fmt.Errorf("error marshaling %s: %w", f.path, err)
+	}
+	if err := encoder.Close(); err != nil {
+		return false, fmt.Errorf("error marshaling %s: %w", f.path, err)
+	}
+
+	mode := os.FileMode(0644)
+	if info, err := os.Stat(f.path); err == nil {
+		mode = info.Mode().Perm()
+	}
+	data := restoreBlankLines(f.data, buffer.Bytes())
+	if err := os.WriteFile(f.path, data, mode); err != nil {
+		return false, fmt.Errorf("error writing %s: %w", f.path, err)
+	}
+	f.data = data
+	return true, nil
+}
+
+// syncYAMLNode changes node to represent value. Nodes whose content is
+// already equal to value are left alone, as are the keys and items around
+// the ones that changed; a scalar that changes keeps its quoting style and
+// comments.
+func syncYAMLNode(node *yaml.Node, value any) error {
+	if node.Kind == yaml.DocumentNode {
+		return syncYAMLNode(node.Content[0], value)
+	}
+	var current any
+	if err := node.Decode(&current); err == nil && reflect.DeepEqual(current, value) {
+		return nil
+	}
+
+	switch value := value.(type) {
+	case map[string]any:
+		// Keys merged in with << cannot be told apart from the node's own
+		if node.Kind == yaml.MappingNode && !hasMergeKey(node) {
+			var content []*yaml.Node
+			seen := map[string]bool{}
+			for i := 0; i+1 < len(node.Content); i += 2 {
+				key, child := node.Content[i], node.Content[i+1]
+				childValue, ok := value[key.Value]
+				if !ok {
+					continue
+				}
+				seen[key.Value] = true
+				if err := syncYAMLNode(child, childValue); err != nil {
+					return err
+				}
+				content = append(content, key, child)
+			}
+			for _, key := range sortedKeys(value) {
+				if seen[key] {
+					continue
+				}
+				child, err := newYAMLNode(value[key])
+				if err != nil {
+					return err
+				}
+				content = append(content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key}, child)
+			}
+			node.Content = content
+			return nil
+		}
+	case []any:
+		if node.Kind == yaml.SequenceNode {
+			for i, item := range value {
+				if i < len(node.Content) {
+					if err := syncYAMLNode(node.Content[i], item); err != nil {
+						return err
+					}
+					continue
+				}
+				child, err := newYAMLNode(item)
+				if err != nil {
+					return err
+				}
+				node.Content = append(node.Content, child)
+			}
+			node.Content = node.Content[:len(value)]
+			return nil
+		}
+	}
+
+	replacement, err := newYAMLNode(value)
+	if err != nil {
+		return err
+	}
+	if node.Kind == yaml.ScalarNode && replacement.Kind == yaml.ScalarNode && node.Tag == replacement.Tag {
+		replacement.Style = node.Style
+	}
+	replacement.HeadComment, replacement.LineComment, replacement.FootComment = node.HeadComment, node.LineComment, node.FootComment
+	*node = *replacement
+	return nil
+}
+
+// newYAMLNode encodes value as a node.
+func newYAMLNode(value any) (*yaml.Node, error) {
+	var node yaml.Node
+	if err := node.Encode(value); err != nil {
+		return nil, err
+	}
+	return &node, nil
+}
+
+func hasMergeKey(node *yaml.Node) bool {
+	for i := 0; i < len(node.Content); i += 2 {
+		if node.Content[i].Tag == "!!merge" {
+			return true
+		}
+	}
+	return false
+}
+
+// yamlIndent returns the indentation the keys of the top-level sections of
+// a file use most, 2 if there are none.
+func yamlIndent(data []byte) int {
+	counts := map[int]int{}
+	parentIsTopLevel := false
+	for _, line := range strings.Split(string(data), "\n") {
+		trimmed := strings.TrimLeft(line, " ")
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		indent := len(line) - len(trimmed)
+		if indent > 0 && parentIsTopLevel && !strings.HasPrefix(trimmed, "-") {
+			counts[indent]++
+		}
+		parentIsTopLevel = indent == 0
+	}
+	best := 2
+	for indent, n := range counts {
+		if n > counts[best] || (n == counts[best] && indent < best) {
+			best = indent
+		}
+	}
+	return best
+}
+
+// restoreBlankLines puts the blank lines of the original file back into
+// the encoded one, before the lines that followed them. A line is matched
+// by its text, or by its text and the line before it where the text alone
+// occurs more than once; lines that are still ambiguous are skipped.
+func restoreBlankLines(original, encoded []byte) []byte {
+	counts := map[string]int{}
+	blankBefore := map[string]bool{}
+	previous, previousBlank := "", false
+	for _, line := range strings.Split(string(original), "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" {
+			previousBlank = true
+			continue
+		}
+		for _, key := range []string{trimmed, previous + "\n" + trimmed} {
+			counts[key]++
+			if previousBlank {
+				blankBefore[key] = true
+			}
+		}
+		previous, previousBlank = trimmed, false
+	}
+
+	var lines []string
+	previous = ""
+	for _, line := range strings.Split(string(encoded), "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed != "" && len(lines) > 0 && lines[len(lines)-1] != "" {
+			for _, key := range []string{trimmed, previous + "\n" + trimmed} {
+				if counts[key] == 1 {
+					if blankBefore[key] {
+						lines = append(lines, "")
+					}
+					break
+				}
+			}
+		}
+		if trimmed != "" {
+			previous = trimmed
+		}
+		lines = append(lines, line)
+	}
+	return []byte(strings.Join(lines, "\n"))
+}
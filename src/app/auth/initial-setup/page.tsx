@@ -61,6 +61,14 @@ export default function InitialSetupPage() {
         }
     });
 
+    useEffect(() => {
+        // The installer's QR code can link here with the token filled in
+        const token = new URLSearchParams(window.location.search).get("token");
+        if (token) {
+            form.setValue("setupToken", token);
+        }
+    }, [form]);
+
     async function onSubmit(values: z.infer<typeof formSchema>) {
         setLoading(true);
         setError(null);